@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+// abortCondition stops the test early once the results of its last
+// window meet the threshold, e.g. errors>20% over 30s.
+type abortCondition struct {
+	expr      string
+	threshold threshold
+	window    time.Duration
+}
+
+const abortWindowSeparator = " over "
+
+func parseAbortCondition(expr string) (abortCondition, error) {
+	c := abortCondition{expr: strings.TrimSpace(expr)}
+	i := strings.LastIndex(c.expr, abortWindowSeparator)
+	if i < 0 {
+		return c, fmt.Errorf("Invalid abort condition %q, expected "+
+			"\"<metric><operator><value> over <window>\", e.g. "+
+			"\"errors>20%% over 30s\"", expr)
+	}
+	window, err := time.ParseDuration(
+		strings.TrimSpace(c.expr[i+len(abortWindowSeparator):]))
+	if err != nil || window < statsInterval {
+		return c, fmt.Errorf("Invalid window of abort condition %q, "+
+			"it must be a duration of %v or more", expr, statsInterval)
+	}
+	c.window = window
+	c.threshold, err = parseThreshold(c.expr[:i])
+	return c, err
+}
+
+// intervals returns the number of intervals the window spans.
+func (c abortCondition) intervals() int {
+	return int((c.window + statsInterval - 1) / statsInterval)
+}
+
+// breached checks the condition against the results of its window,
+// the reason is empty unless it's breached.
+func (c abortCondition) breached(r *internal.Results) (reason string, ok bool) {
+	res := c.threshold.check(r)
+	if !res.Passed {
+		return "", false
+	}
+	return fmt.Sprintf("%v, actual %v", c.expr, res.Actual), true
+}
+
+// abortConditionsList is the value of the repeatable --abort-if flag.
+type abortConditionsList []abortCondition
+
+func (l *abortConditionsList) String() string {
+	exprs := make([]string, 0, len(*l))
+	for _, c := range *l {
+		exprs = append(exprs, c.expr)
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (l *abortConditionsList) IsCumulative() bool {
+	return true
+}
+
+func (l *abortConditionsList) Set(value string) error {
+	c, err := parseAbortCondition(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, c)
+	return nil
+}
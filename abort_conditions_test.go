@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+func TestParseAbortCondition(t *testing.T) {
+	expectations := []struct {
+		in        string
+		threshold string
+		window    time.Duration
+		intervals int
+	}{
+		{"errors>20% over 30s", "errors>20%", 30 * time.Second, 30},
+		{" p99 > 2s over 10s ", "p99 > 2s", 10 * time.Second, 10},
+		{"2xx==0 over 15s", "2xx==0", 15 * time.Second, 15},
+		{"rps<100 over 1500ms", "rps<100", 1500 * time.Millisecond, 2},
+	}
+	for _, e := range expectations {
+		c, err := parseAbortCondition(e.in)
+		if err != nil {
+			t.Errorf("%q: %v", e.in, err)
+			continue
+		}
+		if c.threshold.expr != e.threshold || c.window != e.window ||
+			c.intervals() != e.intervals {
+			t.Errorf("%q: unexpected condition %+v", e.in, c)
+		}
+	}
+	invalid := []string{
+		"", "errors>20%", "errors>20% over", "errors>20% over 30",
+		"errors>20% over 100ms", "errors over 30s", "latency>1s over 10s",
+	}
+	for _, in := range invalid {
+		if _, err := parseAbortCondition(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestAbortConditionBreached(t *testing.T) {
+	r := &internal.Results{
+		Req2XX:    70,
+		Req5XX:    30,
+		Latencies: new(latencyBuckets),
+		Requests:  rateSamples(nil),
+	}
+	expectations := []struct {
+		condition, reason string
+		breached          bool
+	}{
+		{"5xx>20% over 10s", "5xx>20% over 10s, actual 30.00%", true},
+		{"5xx>50% over 10s", "", false},
+		{"2xx==0 over 10s", "", false},
+		{"p99>1s over 10s", "", false},
+	}
+	for _, e := range expectations {
+		c, err := parseAbortCondition(e.condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason, breached := c.breached(r)
+		if reason != e.reason || breached != e.breached {
+			t.Errorf("%v: expected %q(%v), but got %q(%v)",
+				e.condition, e.reason, e.breached, reason, breached)
+		}
+	}
+}
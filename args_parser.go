@@ -25,16 +25,56 @@ type kingpinParser struct {
 	numReqs      *nullableUint64
 	duration     *nullableDuration
 	headers      *headersList
+	host         string
+	omitHeaders  *nullableStrings
 	numConns     uint64
 	timeout      time.Duration
+	maxRedirects uint64
+	cookieJar    bool
+	cookies      *nullableStrings
+	resetSession uint64
+	compression  string
+	acceptEnc    string
 	latencies    bool
 	insecure     bool
 	method       string
 	body         string
 	bodyFilePath string
+	bodyTemplate bool
+	form         *nullableStrings
+	multipart    bool
 	payloadFile  string
 	payloadUrl   string
 	varNames     string
+	payloadFmt   string
+	delimiter    string
+	header       bool
+	lazyQuotes   bool
+	payloadStrm  bool
+	bufferSize   uint64
+	rewind       bool
+	strategy     string
+	seed         int64
+	zipf         float64
+	payloadHdrs  *headersList
+	token        string
+	pageSize     uint64
+	retries      *nullableUint64
+	payloadTmout time.Duration
+	assertions   *assertionsList
+	assertMax    uint64
+	assertSample float64
+	samples      *nullableUint64
+	failuresDir  string
+	thresholds   *thresholdsList
+	abortIf      *abortConditionsList
+	histogram    bool
+	baseline     string
+	tolerances   *toleranceList
+	significance float64
+	compareFmt   string
+	tsFile       string
+	tsFormat     string
 	startLine    uint32
 	scope        string
 	stream       bool
@@ -54,6 +94,16 @@ func newKingpinParser() argsParser {
 		numReqs:      new(nullableUint64),
 		duration:     new(nullableDuration),
 		headers:      new(headersList),
+		omitHeaders:  new(nullableStrings),
+		cookies:      new(nullableStrings),
+		form:         new(nullableStrings),
+		payloadHdrs:  new(headersList),
+		retries:      new(nullableUint64),
+		assertions:   new(assertionsList),
+		samples:      new(nullableUint64),
+		thresholds:   new(thresholdsList),
+		abortIf:      new(abortConditionsList),
+		tolerances:   new(toleranceList),
 		numConns:     defaultNumberOfConns,
 		timeout:      defaultTimeout,
 		latencies:    false,
@@ -88,6 +138,30 @@ func newKingpinParser() argsParser {
 		PlaceHolder(defaultTimeout.String()).
 		Short('t').
 		DurationVar(&kparser.timeout)
+	app.Flag("follow-redirects", "Follow at most N redirects, "+
+		"0 means redirects are not followed").
+		PlaceHolder("0").
+		Uint64Var(&kparser.maxRedirects)
+	app.Flag("cookie-jar", "Keep cookies set by the server, "+
+		"each connection has its own session").
+		BoolVar(&kparser.cookieJar)
+	app.Flag("cookie", "Cookie to start each session with(can be "+
+		"repeated), value may contain variables, i.e. \"sid=${sessionId}\"").
+		PlaceHolder("\"K=V\"").
+		SetValue(kparser.cookies)
+	app.Flag("reset-session", "Start a new session after every N "+
+		"requests of the connection, 0 means never").
+		PlaceHolder("0").
+		Uint64Var(&kparser.resetSession)
+	app.Flag("compress", "Compress request body: "+
+		strings.Join(encodings, ", ")).
+		Default("").
+		StringVar(&kparser.compression)
+	app.Flag("accept-encoding", "Accept-Encoding to send, compressed "+
+		"responses up to --assert-max-body are decoded and their sizes "+
+		"reported, i.e. \"gzip, br\"").
+		Default("").
+		StringVar(&kparser.acceptEnc)
 	app.Flag("latencies", "Print latency statistics").
 		Short('l').
 		BoolVar(&kparser.latencies)
@@ -103,6 +177,19 @@ func newKingpinParser() argsParser {
 		Default("").
 		Short('f').
 		StringVar(&kparser.bodyFilePath)
+	app.Flag("body-template", "Render request body (--body or "+
+		"--body-file) with Go's text/template for each request, "+
+		"the row of the payload is passed to it").
+		BoolVar(&kparser.bodyTemplate)
+	app.Flag("form", "Form field to send(can be repeated), "+
+		"\"key=value\" or \"key=@path[;filename=name][;type=mime/type]\" "+
+		"to upload a file, values may contain variables").
+		PlaceHolder("\"K=V\"").
+		Short('F').
+		SetValue(kparser.form)
+	app.Flag("multipart", "Send form as multipart/form-data even if "+
+		"there are no files in it").
+		BoolVar(&kparser.multipart)
 	app.Flag("payload-file", "External File to use as user defined variables in http request").
 		Default("").
 		StringVar(&kparser.payloadFile)
@@ -112,6 +199,68 @@ func newKingpinParser() argsParser {
 	app.Flag("variable-names", "Variable names separated by commas").
 		Default("").
 		StringVar(&kparser.varNames)
+	app.Flag("payload-format", "Format of the payload file: "+
+		strings.Join(payloadFormats, ", ")+", detected from the file "+
+		"extension by default").
+		PlaceHolder("csv").
+		StringVar(&kparser.payloadFmt)
+	app.Flag("payload-header", "First row of the CSV payload holds "+
+		"variable names, implied if --variable-names aren't provided").
+		BoolVar(&kparser.header)
+	app.Flag("payload-delimiter", "Delimiter of the CSV payload "+
+		"columns, a single character or \\t").
+		PlaceHolder(",").
+		StringVar(&kparser.delimiter)
+	app.Flag("payload-lazy-quotes", "Allow quotes in unquoted fields "+
+		"and non-doubled quotes in quoted fields of the CSV payload").
+		BoolVar(&kparser.lazyQuotes)
+	app.Flag("payload-stream", "Read the payload file during the "+
+		"test instead of loading it into memory").
+		BoolVar(&kparser.payloadStrm)
+	app.Flag("payload-buffer", "Number of rows of the streamed "+
+		"payload to read ahead").
+		PlaceHolder(strconv.Itoa(defaultPayloadBufferSize)).
+		Uint64Var(&kparser.bufferSize)
+	app.Flag("payload-rewind", "Start reading the streamed payload "+
+		"file over after the last row, otherwise the test stops once "+
+		"it's exhausted. Rows of --payload-url are always started over "+
+		"unless the strategy is unique").
+		BoolVar(&kparser.rewind)
+	app.Flag("payload-strategy", "Order in which requests use rows of "+
+		"the payload (request scope only):"+
+		"\n\t* sequential (in order, starting over after the last one)"+
+		"\n\t* unique (each row once, the test stops after the last one)"+
+		"\n\t* shuffle (in random order)"+
+		"\n\t* random (uniformly with replacement)"+
+		"\n\t* zipf (first rows are the most popular)"+
+		"\n\t* partition (each connection goes through its own rows)").
+		PlaceHolder("sequential").
+		StringVar(&kparser.strategy)
+	app.Flag("payload-seed", "Seed of the random payload strategies, "+
+		"current time by default").
+		Int64Var(&kparser.seed)
+	app.Flag("payload-zipf", "Exponent of the zipf payload strategy, "+
+		"must be greater than 1").
+		PlaceHolder(strconv.FormatFloat(defaultZipfExponent, 'f', -1, 64)).
+		Float64Var(&kparser.zipf)
+	app.Flag("payload-url-header", "HTTP headers of the payload URL "+
+		"requests (can be repeated)").
+		PlaceHolder("\"K: V\"").
+		SetValue(kparser.payloadHdrs)
+	app.Flag("payload-url-token", "Bearer token of the payload URL "+
+		"requests").
+		StringVar(&kparser.token)
+	app.Flag("payload-page-size", "Number of rows fetched from the "+
+		"payload URL at once").
+		PlaceHolder(strconv.Itoa(defaultPayloadPageSize)).
+		Uint64Var(&kparser.pageSize)
+	app.Flag("payload-url-retries", "Number of times failed payload URL "+
+		"requests are retried").
+		PlaceHolder(strconv.Itoa(defaultPayloadRetries)).
+		SetValue(kparser.retries)
+	app.Flag("payload-url-timeout", "Timeout of the payload URL requests").
+		PlaceHolder(defaultPayloadTimeout.String()).
+		DurationVar(&kparser.payloadTmout)
 	app.Flag("start-line", "Read variables start from specified line if necessary").
 		PlaceHolder(strconv.FormatUint(0, 10)).
 		Uint32Var(&kparser.startLine)
@@ -143,6 +292,55 @@ func newKingpinParser() argsParser {
 		PlaceHolder("\"K: V\"").
 		Short('H').
 		SetValue(kparser.headers)
+	app.Flag("host", "Host header (HTTP/2 authority) to send instead "+
+		"of the one derived from the URL").
+		Default("").
+		StringVar(&kparser.host)
+	app.Flag("omit-header", "Don't send the header which the client adds "+
+		"by default(can be repeated): "+strings.Join(omittableHeaders, ", ")).
+		PlaceHolder("<name>").
+		SetValue(kparser.omitHeaders)
+	app.Flag("assert", "Assertion checked against every response(can "+
+		"be repeated), e.g. \"StatusCode RANGE 2xx\" or "+
+		"\"Header:Content-Type MATCHES ^application/json\". "+
+		"Expressions with spaces are quoted, e.g. "+
+		"\"HtmlSelector:'#main > a' EXISTS\". "+
+		"Severity is hard, soft(only reported) or abort[:<n>](stops "+
+		"the test after n failures). Named assertions can be combined "+
+		"with "+strings.Join(assertionGroups, ", ")+", e.g. "+
+		"\"anyOf(ok, allOf(notFound, errorCode))\". "+
+		"Available asserters: "+strings.Join(asserterNames(), ", ")).
+		PlaceHolder("\"[[name]] [severity] asserter[:expression] [condition] [expected]\"").
+		SetValue(kparser.assertions)
+	app.Flag("assert-max-body", "Size limit of response bodies in bytes "+
+		"checked by assertions, larger ones fail the assertions that "+
+		"look at the body").
+		PlaceHolder(strconv.Itoa(defaultAssertMaxBody)).
+		Uint64Var(&kparser.assertMax)
+	app.Flag("assert-sample", "Fraction of responses checked by "+
+		"assertions, failures of the rest are estimated").
+		PlaceHolder("1.0").
+		Float64Var(&kparser.assertSample)
+	app.Flag("failure-samples", "Number of the first responses failed "+
+		"assertions that are kept for the report").
+		PlaceHolder(strconv.Itoa(defaultFailureSamples)).
+		SetValue(kparser.samples)
+	app.Flag("failures-dir", "Directory the failed responses are saved "+
+		"to as JSON files").
+		PlaceHolder("<dir>").
+		StringVar(&kparser.failuresDir)
+	app.Flag("threshold", "Condition the results must meet for the test "+
+		"to pass(can be repeated), e.g. \"p99<300ms\", \"errors<0.1%\" "+
+		"or \"rps>2000\", the exit status is 2 if any isn't. Metrics: "+
+		strings.Join(thresholdMetricNames(), ", ")).
+		PlaceHolder("\"<metric><operator><value>\"").
+		SetValue(kparser.thresholds)
+	app.Flag("abort-if", "Condition that stops the test early once "+
+		"the results of its last window meet it(can be repeated), e.g. "+
+		"\"errors>20% over 30s\", \"p99>2s over 10s\" or "+
+		"\"2xx==0 over 15s\". Metrics are the ones of --threshold").
+		PlaceHolder("\"<metric><operator><value> over <window>\"").
+		SetValue(kparser.abortIf)
 	app.Flag("requests", "Number of requests").
 		PlaceHolder("[pos. int.]").
 		Short('n').
@@ -204,6 +402,38 @@ func newKingpinParser() argsParser {
 		Short('o').
 		StringVar(&kparser.formatSpec)
 
+	app.Flag("latency-histogram", "Include every latency in the JSON "+
+		"result, so that distributions can be compared").
+		BoolVar(&kparser.histogram)
+	app.Flag("baseline", "JSON result of an earlier test to compare "+
+		"the results with, the exit status is 3 if they regressed").
+		PlaceHolder("<file>").
+		StringVar(&kparser.baseline)
+	app.Flag("tolerance", "How much a metric may get worse by compared "+
+		"to the baseline(can be repeated), e.g. \"p99=5%\", percentage "+
+		"points for rates of errors, 4xx and 5xx. Metrics: "+
+		strings.Join(toleranceMetricNames(), ", ")).
+		PlaceHolder("\"<metric>=<percent>\"").
+		SetValue(kparser.tolerances)
+	app.Flag("significance", "P-value below which latency distributions "+
+		"differ, changes of latencies within noise aren't regressions").
+		PlaceHolder(strconv.FormatFloat(defaultSignificance, 'f', -1, 64)).
+		Float64Var(&kparser.significance)
+	app.Flag("compare-format", "Which format to output the comparison "+
+		"with the baseline in: plain-text (short: pt), json (short: j) "+
+		"or markdown (short: md)").
+		PlaceHolder("<spec>").
+		StringVar(&kparser.compareFmt)
+	app.Flag("timeseries", "File the results of every second of the "+
+		"test are written to as they come, as CSV if it ends with .csv "+
+		"or JSON lines otherwise. They are in the JSON result too").
+		PlaceHolder("<file>").
+		StringVar(&kparser.tsFile)
+	app.Flag("timeseries-format", "Format of the --timeseries file, "+
+		"either csv or jsonl").
+		PlaceHolder("<format>").
+		StringVar(&kparser.tsFormat)
+
 	app.Arg("url", "Target's URL").Required().
 		StringVar(&kparser.url)
 
@@ -237,32 +467,101 @@ func (k *kingpinParser) parse(args []string) (config, error) {
 	if err != nil {
 		return emptyConf, err
 	}
+	var payloadHeaders *headersList
+	if len(*k.payloadHdrs) > 0 {
+		payloadHeaders = k.payloadHdrs
+	}
+	var assertions *[]assertion
+	if len(*k.assertions) > 0 {
+		list := []assertion(*k.assertions)
+		assertions = &list
+	}
+	var thresholds *[]threshold
+	if len(*k.thresholds) > 0 {
+		list := []threshold(*k.thresholds)
+		thresholds = &list
+	}
+	if _, ok := comparisonFormatFromString(k.compareFmt); !ok {
+		return emptyConf, fmt.Errorf(
+			"unknown comparison format %q", k.compareFmt,
+		)
+	}
+	var tolerances *[]tolerance
+	if len(*k.tolerances) > 0 {
+		list := []tolerance(*k.tolerances)
+		tolerances = &list
+	}
+	var abortConditions *[]abortCondition
+	if len(*k.abortIf) > 0 {
+		list := []abortCondition(*k.abortIf)
+		abortConditions = &list
+	}
 	return config{
-		numConns:       k.numConns,
-		numReqs:        k.numReqs.val,
-		duration:       k.duration.val,
-		url:            url,
-		headers:        k.headers,
-		timeout:        k.timeout,
-		method:         k.method,
-		body:           k.body,
-		bodyFilePath:   k.bodyFilePath,
-		payloadFile:    k.payloadFile,
-		payloadUrl:     k.payloadUrl,
-		varNames:       k.varNames,
-		startLine:      k.startLine,
-		scope:          getScope(k.scope),
-		stream:         k.stream,
-		keyPath:        k.keyPath,
-		certPath:       k.certPath,
-		printLatencies: k.latencies,
-		insecure:       k.insecure,
-		rate:           k.rate.val,
-		clientType:     k.clientType,
-		printIntro:     pi,
-		printProgress:  pp,
-		printResult:    pr,
-		format:         format,
+		numConns:            k.numConns,
+		numReqs:             k.numReqs.val,
+		duration:            k.duration.val,
+		url:                 url,
+		headers:             k.headers,
+		host:                k.host,
+		omitHeaders:         k.omitHeaders.val,
+		timeout:             k.timeout,
+		maxRedirects:        k.maxRedirects,
+		cookieJar:           k.cookieJar,
+		cookies:             k.cookies.val,
+		resetSessionEvery:   k.resetSession,
+		compression:         k.compression,
+		acceptEncoding:      k.acceptEnc,
+		method:              k.method,
+		body:                k.body,
+		bodyFilePath:        k.bodyFilePath,
+		bodyTemplate:        k.bodyTemplate,
+		form:                k.form.val,
+		multipart:           k.multipart,
+		payloadFile:         k.payloadFile,
+		payloadUrl:          k.payloadUrl,
+		varNames:            k.varNames,
+		payloadFormat:       k.payloadFmt,
+		payloadDelimiter:    k.delimiter,
+		payloadHeader:       k.header,
+		payloadLazyQuotes:   k.lazyQuotes,
+		payloadStream:       k.payloadStrm,
+		payloadBufferSize:   k.bufferSize,
+		payloadRewind:       k.rewind,
+		payloadStrategy:     k.strategy,
+		payloadSeed:         k.seed,
+		payloadZipfExponent: k.zipf,
+		payloadHeaders:      payloadHeaders,
+		payloadToken:        k.token,
+		payloadPageSize:     k.pageSize,
+		payloadRetries:      k.retries.val,
+		payloadTimeout:      k.payloadTmout,
+		assertions:          assertions,
+		assertMaxBody:       k.assertMax,
+		assertSample:        k.assertSample,
+		failureSamples:      k.samples.val,
+		failuresDir:         k.failuresDir,
+		thresholds:          thresholds,
+		abortConditions:     abortConditions,
+		latencyHistogram:    k.histogram,
+		baselineFile:        k.baseline,
+		tolerances:          tolerances,
+		significance:        k.significance,
+		compareFormat:       k.compareFmt,
+		timeseriesFile:      k.tsFile,
+		timeseriesFormat:    k.tsFormat,
+		startLine:           k.startLine,
+		scope:               getScope(k.scope),
+		stream:              k.stream,
+		keyPath:             k.keyPath,
+		certPath:            k.certPath,
+		printLatencies:      k.latencies,
+		insecure:            k.insecure,
+		rate:                k.rate.val,
+		clientType:          k.clientType,
+		printIntro:          pi,
+		printProgress:       pp,
+		printResult:         pr,
+		format:              format,
 	}, nil
 }
 
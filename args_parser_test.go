@@ -25,6 +25,10 @@ func TestInvalidArgsParsing(t *testing.T) {
 			[]string{programName, "http://google.com", "http://yahoo.com"},
 			"unexpected http://yahoo.com",
 		},
+		{
+			[]string{programName, "--compare-format", "html", "http://google.com"},
+			`unknown comparison format "html"`,
+		},
 	}
 	for _, e := range expectations {
 		p := newKingpinParser()
@@ -46,6 +50,8 @@ func TestUnspecifiedArgParsing(t *testing.T) {
 
 func TestArgsParsing(t *testing.T) {
 	ten := uint64(10)
+	zeroRetries := uint64(0)
+	noSamples := uint64(0)
 	expectations := []struct {
 		in  [][]string
 		out config
@@ -300,6 +306,368 @@ func TestArgsParsing(t *testing.T) {
 				format:        knownFormat("plain-text"),
 			},
 		},
+		{
+			[][]string{
+				{
+					programName,
+					"--cookie-jar",
+					"--cookie", "sid=${sid}",
+					"--cookie", "lang=en",
+					"--reset-session", "10",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:          defaultNumberOfConns,
+				timeout:           defaultTimeout,
+				cookieJar:         true,
+				cookies:           &[]string{"sid=${sid}", "lang=en"},
+				resetSessionEvery: 10,
+				headers:           new(headersList),
+				method:            "GET",
+				url:               "https://somehost.somedomain:443",
+				printIntro:        true,
+				printProgress:     true,
+				printResult:       true,
+				format:            knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--payload-file", "/tmp/users.txt",
+					"--payload-format", "csv",
+					"--payload-delimiter", ";",
+					"--payload-header",
+					"--payload-lazy-quotes",
+					"--payload-stream",
+					"--payload-buffer", "64",
+					"--payload-rewind",
+					"--payload-strategy", "zipf",
+					"--payload-seed", "42",
+					"--payload-zipf", "1.5",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:            defaultNumberOfConns,
+				timeout:             defaultTimeout,
+				payloadFile:         "/tmp/users.txt",
+				payloadFormat:       "csv",
+				payloadDelimiter:    ";",
+				payloadHeader:       true,
+				payloadLazyQuotes:   true,
+				payloadStream:       true,
+				payloadBufferSize:   64,
+				payloadRewind:       true,
+				payloadStrategy:     "zipf",
+				payloadSeed:         42,
+				payloadZipfExponent: 1.5,
+				scope:               request,
+				headers:             new(headersList),
+				method:              "GET",
+				url:                 "https://somehost.somedomain:443",
+				printIntro:          true,
+				printProgress:       true,
+				printResult:         true,
+				format:              knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--payload-url", "http://localhost:8082/rows",
+					"--payload-url-header", "X-Tenant: qa",
+					"--payload-url-token", "secret",
+					"--payload-page-size", "500",
+					"--payload-url-retries", "0",
+					"--payload-url-timeout", "5s",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:        defaultNumberOfConns,
+				timeout:         defaultTimeout,
+				payloadUrl:      "http://localhost:8082/rows",
+				payloadHeaders:  &headersList{{"X-Tenant", "qa"}},
+				payloadToken:    "secret",
+				payloadPageSize: 500,
+				payloadRetries:  &zeroRetries,
+				payloadTimeout:  5 * time.Second,
+				scope:           request,
+				headers:         new(headersList),
+				method:          "GET",
+				url:             "https://somehost.somedomain:443",
+				printIntro:      true,
+				printProgress:   true,
+				printResult:     true,
+				format:          knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--assert", "StatusCode RANGE 2xx",
+					"--assert", "Header:Content-Type MATCHES ^application/json",
+					"--assert-max-body", "4096",
+					"--assert-sample", "0.1",
+					"--failure-samples", "0",
+					"--failures-dir", "failures",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns: defaultNumberOfConns,
+				timeout:  defaultTimeout,
+				assertions: &[]assertion{
+					{asserter: "StatusCode", condition: "RANGE", expected: "2xx"},
+					{asserter: "Header", expression: "Content-Type",
+						condition: "MATCHES", expected: "^application/json"},
+				},
+				assertMaxBody:  4096,
+				assertSample:   0.1,
+				failureSamples: &noSamples,
+				failuresDir:    "failures",
+				scope:          request,
+				headers:        new(headersList),
+				method:         "GET",
+				url:            "https://somehost.somedomain:443",
+				printIntro:     true,
+				printProgress:  true,
+				printResult:    true,
+				format:         knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--threshold", "p99<300ms",
+					"--threshold", "errors < 0.1%",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns: defaultNumberOfConns,
+				timeout:  defaultTimeout,
+				thresholds: &[]threshold{
+					{expr: "p99<300ms", metric: "p99", operator: "<", value: 300000},
+					{expr: "errors < 0.1%", metric: "errors", operator: "<",
+						value: 0.1, percent: true},
+				},
+				scope:         request,
+				headers:       new(headersList),
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--latency-histogram",
+					"--baseline", "/tmp/nightly.json",
+					"--tolerance", "p99=5%",
+					"--tolerance", "errors=0.5",
+					"--significance", "0.01",
+					"--compare-format", "md",
+					"--timeseries", "/tmp/series.csv",
+					"--timeseries-format", "csv",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:         defaultNumberOfConns,
+				timeout:          defaultTimeout,
+				latencyHistogram: true,
+				baselineFile:     "/tmp/nightly.json",
+				tolerances: &[]tolerance{
+					{metric: "p99", value: 5},
+					{metric: "errors", value: 0.5},
+				},
+				significance:     0.01,
+				compareFormat:    "md",
+				timeseriesFile:   "/tmp/series.csv",
+				timeseriesFormat: "csv",
+				scope:            request,
+				headers:          new(headersList),
+				method:           "GET",
+				url:              "https://somehost.somedomain:443",
+				printIntro:       true,
+				printProgress:    true,
+				printResult:      true,
+				format:           knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--abort-if", "errors>20% over 30s",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns: defaultNumberOfConns,
+				timeout:  defaultTimeout,
+				abortConditions: &[]abortCondition{
+					{
+						expr: "errors>20% over 30s",
+						threshold: threshold{expr: "errors>20%", metric: "errors",
+							operator: ">", value: 20, percent: true},
+						window: 30 * time.Second,
+					},
+				},
+				scope:         request,
+				headers:       new(headersList),
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--body-file", "/tmp/order.json.tmpl",
+					"--body-template",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:      defaultNumberOfConns,
+				timeout:       defaultTimeout,
+				bodyFilePath:  "/tmp/order.json.tmpl",
+				bodyTemplate:  true,
+				headers:       new(headersList),
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--form", "name=${name}",
+					"-F", "doc=@/tmp/doc.pdf",
+					"--multipart",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:      defaultNumberOfConns,
+				timeout:       defaultTimeout,
+				form:          &[]string{"name=${name}", "doc=@/tmp/doc.pdf"},
+				multipart:     true,
+				headers:       new(headersList),
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--compress", "gzip",
+					"--accept-encoding", "gzip, br",
+					"https://somehost.somedomain",
+				},
+				{
+					programName,
+					"--compress=gzip",
+					"--accept-encoding=gzip, br",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:       defaultNumberOfConns,
+				timeout:        defaultTimeout,
+				compression:    "gzip",
+				acceptEncoding: "gzip, br",
+				headers:        new(headersList),
+				method:         "GET",
+				url:            "https://somehost.somedomain:443",
+				printIntro:     true,
+				printProgress:  true,
+				printResult:    true,
+				format:         knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--follow-redirects", "5",
+					"https://somehost.somedomain",
+				},
+				{
+					programName,
+					"--follow-redirects=5",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:      defaultNumberOfConns,
+				timeout:       defaultTimeout,
+				maxRedirects:  5,
+				headers:       new(headersList),
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
+		{
+			[][]string{
+				{
+					programName,
+					"--host", "example.com",
+					"--omit-header", "User-Agent",
+					"--omit-header", "Accept-Encoding",
+					"https://somehost.somedomain",
+				},
+				{
+					programName,
+					"--host=example.com",
+					"--omit-header=User-Agent",
+					"--omit-header=Accept-Encoding",
+					"https://somehost.somedomain",
+				},
+			},
+			config{
+				numConns:      defaultNumberOfConns,
+				timeout:       defaultTimeout,
+				headers:       new(headersList),
+				host:          "example.com",
+				omitHeaders:   &[]string{"User-Agent", "Accept-Encoding"},
+				method:        "GET",
+				url:           "https://somehost.somedomain:443",
+				printIntro:    true,
+				printProgress: true,
+				printResult:   true,
+				format:        knownFormat("plain-text"),
+			},
+		},
 		{
 			[][]string{
 				{
@@ -1,85 +1,1093 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
-	"github.com/oliveagle/jsonpath"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
 )
 
 type assertion struct {
+	// name identifies the assertion in the results, see displayName
+	name       string
 	asserter   string
 	expression string
 	condition  string
 	expected   string
+
+	severity assertionSeverity
+	// abortAfter is the number of failures of an abort assertion that
+	// stop the test
+	abortAfter uint64
+
+	// group is allOf, anyOf or not, which combine the members instead
+	// of checking the response with an asserter
+	group   string
+	members []assertion
+	// ref is the name of the assertion a member of a group stands for,
+	// see resolveAssertions
+	ref string
+}
+
+// assertionSeverity tells what a failure of the assertion does.
+type assertionSeverity int
+
+const (
+	// hard assertions fail the request
+	hardSeverity assertionSeverity = iota
+	// soft assertions are only reported
+	softSeverity
+	// abort assertions fail the request and stop the test after a
+	// number of failures
+	abortSeverity
+)
+
+func (s assertionSeverity) String() string {
+	switch s {
+	case softSeverity:
+		return "soft"
+	case abortSeverity:
+		return "abort"
+	}
+	return "hard"
+}
+
+// parseAssertionSeverity parses soft, hard, abort and abort:<n>, which
+// stops the test after n failures instead of the first one.
+func parseAssertionSeverity(s string) (assertionSeverity, uint64, error) {
+	switch s {
+	case "", "hard":
+		return hardSeverity, 0, nil
+	case "soft":
+		return softSeverity, 0, nil
+	case "abort":
+		return abortSeverity, 1, nil
+	}
+	if n := strings.TrimPrefix(s, "abort:"); n != s {
+		after, err := strconv.ParseUint(n, 10, 64)
+		if err != nil || after == 0 {
+			return hardSeverity, 0, fmt.Errorf(
+				"abort requires a positive number of failures, but got %q", n)
+		}
+		return abortSeverity, after, nil
+	}
+	return hardSeverity, 0, fmt.Errorf(
+		"Unknown severity %q, available are hard, soft, abort[:<n>]", s)
+}
+
+func isAssertionSeverity(s string) bool {
+	return s == "hard" || s == "soft" || s == "abort" ||
+		strings.HasPrefix(s, "abort:")
 }
 
+var assertionGroups = []string{"allOf", "anyOf", "not"}
+
 type assertResult struct {
 	successful bool
 	errMsg     string
+	// index of the failed assertion
+	assertion int
+	severity  assertionSeverity
+	reason    failureReason
+	// actual is an excerpt of the value that didn't match
+	actual string
+	// violations of the JSON schema
+	violations []schemaViolation
 }
 
 var success = assertResult{successful: true}
 
+// assertResults are the failed assertions of a response.
+type assertResults []assertResult
+
+// successful tells whether the response passes, failures of soft
+// assertions don't fail it.
+func (rs assertResults) successful() bool {
+	for _, r := range rs {
+		if r.severity != softSeverity {
+			return false
+		}
+	}
+	return true
+}
+
+// first returns the failure the response is reported with, which is
+// the first one that fails the response or, if there is none, the
+// first soft one.
+func (rs assertResults) first() assertResult {
+	for _, r := range rs {
+		if r.severity != softSeverity {
+			return r
+		}
+	}
+	if len(rs) > 0 {
+		return rs[0]
+	}
+	return success
+}
+
 var failure = assertResult{successful: false}
 
-func jsonPathAssert(data []byte, assertion assertion) assertResult {
-	// TODO
-	var jsonData interface{}
-	err := json.Unmarshal(data, &jsonData)
-	if err != nil {
-		return failure
+// notSent fails requests that weren't sent.
+var notSent = assertResults{failure}
+
+// failureReason is the category of the assertion failure.
+type failureReason int
+
+const (
+	wrongValue failureReason = iota
+	missingValue
+	invalidBody
+	bodyTooLarge
+	invalidExpected
+
+	numFailureReasons
+)
+
+func (r failureReason) String() string {
+	switch r {
+	case missingValue:
+		return "missing value"
+	case invalidBody:
+		return "invalid body"
+	case bodyTooLarge:
+		return "body too large"
+	case invalidExpected:
+		return "invalid expected value"
+	}
+	return "wrong value"
+}
+
+// maxActualLen is the length of the excerpts of actual values kept as
+// examples of failures.
+const maxActualLen = 100
+
+func failed(format string, a ...interface{}) assertResult {
+	return assertResult{errMsg: fmt.Sprintf(format, a...)}
+}
+
+func (r assertResult) because(reason failureReason) assertResult {
+	r.reason = reason
+	return r
+}
+
+func (r assertResult) withActual(actual string) assertResult {
+	r.actual = excerpt(actual)
+	return r
+}
+
+func excerpt(s string) string {
+	if len(s) <= maxActualLen {
+		return s
+	}
+	// doesn't cut runes in half
+	i := maxActualLen
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i] + "..."
+}
+
+// assertedResponse is what the assertions are checked against, it's
+// shared by both HTTP clients.
+type assertedResponse struct {
+	code int
+	// header returns the first value of the header and whether it's
+	// present in the response
+	header func(name string) (string, bool)
+	// headers visits every header of the response
+	headers func(visit func(key, value string))
+	body    []byte
+	// tooLarge tells that the body exceeds the size limit, so it isn't
+	// available to assertions
+	tooLarge bool
+	took     time.Duration
+	// vars of the request expected values are rendered with
+	vars *vars
+
+	// the body is parsed once for all the assertions
+	jsonParsed bool
+	jsonData   interface{}
+	jsonErr    error
+	xmlDoc     *xmlNode
+	xmlErr     error
+	htmlDoc    *html.Node
+	htmlErr    error
+}
+
+// json returns the body parsed as JSON.
+func (r *assertedResponse) json() (interface{}, error) {
+	if !r.jsonParsed {
+		r.jsonErr = json.Unmarshal(r.body, &r.jsonData)
+		r.jsonParsed = true
+	}
+	return r.jsonData, r.jsonErr
+}
+
+// xml returns the body parsed as XML.
+func (r *assertedResponse) xml() (*xmlNode, error) {
+	if r.xmlDoc == nil && r.xmlErr == nil {
+		r.xmlDoc, r.xmlErr = parseXML(r.body)
+	}
+	return r.xmlDoc, r.xmlErr
+}
+
+// html returns the body parsed as HTML.
+func (r *assertedResponse) html() (*html.Node, error) {
+	if r.htmlDoc == nil && r.htmlErr == nil {
+		r.htmlDoc, r.htmlErr = html.Parse(bytes.NewReader(r.body))
+	}
+	return r.htmlDoc, r.htmlErr
+}
+
+// assertFunc checks the response against a compiled assertion.
+type assertFunc func(resp *assertedResponse) assertResult
+
+// asserter checks one aspect of the response.
+type asserter struct {
+	conditions []string
+	// defaultCondition is used if the assertion has none, the condition
+	// is required if it's empty
+	defaultCondition string
+	// needsBody tells whether the response body has to be read
+	needsBody bool
+	// compile validates expression and expected value of the assertion
+	// and prepares everything that doesn't change between responses
+	compile func(a assertion) (assertFunc, error)
+}
+
+var orderConditions = []string{"EQUAL", "LT", "LTE", "GT", "GTE"}
+
+var asserters = map[string]asserter{
+	"JsonPath": {
+		conditions: jsonPathConditions,
+		needsBody:  true,
+		compile:    compileJsonPathAssertion,
+	},
+	"StatusCode": {
+		conditions:       []string{"EQUAL", "IN", "RANGE"},
+		defaultCondition: "EQUAL",
+		compile:          compileStatusCodeAssertion,
+	},
+	"Header": {
+		conditions:       []string{"EXISTS", "NOT_EXISTS", "EQUAL", "CONTAINS", "MATCHES"},
+		defaultCondition: "EXISTS",
+		compile:          compileHeaderAssertion,
+	},
+	"BodyContains": {
+		conditions:       []string{"CONTAINS", "NOT_CONTAINS"},
+		defaultCondition: "CONTAINS",
+		needsBody:        true,
+		compile:          compileBodyContainsAssertion,
+	},
+	"BodyRegex": {
+		conditions:       []string{"MATCHES", "NOT_MATCHES"},
+		defaultCondition: "MATCHES",
+		needsBody:        true,
+		compile:          compileBodyRegexAssertion,
+	},
+	"BodySize": {
+		conditions:       orderConditions,
+		defaultCondition: "LTE",
+		needsBody:        true,
+		compile:          compileBodySizeAssertion,
+	},
+	"ResponseTime": {
+		conditions:       orderConditions[1:],
+		defaultCondition: "LTE",
+		compile:          compileResponseTimeAssertion,
+	},
+	"JsonSchema": {
+		conditions:       []string{"VALID", "INVALID"},
+		defaultCondition: "VALID",
+		needsBody:        true,
+		compile:          compileJsonSchemaAssertion,
+	},
+	"XPath": {
+		conditions:       xpathConditions,
+		defaultCondition: "EXISTS",
+		needsBody:        true,
+		compile:          compileXPathAssertion,
+	},
+	"HtmlSelector": {
+		conditions:       []string{"EXISTS", "NOT_EXISTS"},
+		defaultCondition: "EXISTS",
+		needsBody:        true,
+		compile:          compileHtmlSelectorAssertion,
+	},
+}
+
+func asserterNames() []string {
+	names := make([]string, 0, len(asserters))
+	for name := range asserters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// displayName returns the name of the assertion or, if it has none, a
+// name made of the assertion itself.
+func (a assertion) displayName() string {
+	if a.name != "" {
+		return a.name
+	}
+	if a.ref != "" {
+		return a.ref
+	}
+	if a.group != "" {
+		members := make([]string, 0, len(a.members))
+		for _, m := range a.members {
+			members = append(members, m.displayName())
+		}
+		return a.group + "(" + strings.Join(members, ", ") + ")"
+	}
+	parts := []string{a.asserter}
+	if a.expression != "" {
+		parts[0] += ":" + a.expression
+	}
+	for _, p := range []string{a.condition, a.expected} {
+		if p != "" {
+			parts = append(parts, p)
+		}
 	}
+	return strings.Join(parts, " ")
+}
+
+// conditionOf returns the condition of the assertion, or the default
+// one if it's not set.
+func (a assertion) conditionOf(asr asserter) string {
+	if a.condition == "" {
+		return asr.defaultCondition
+	}
+	return a.condition
+}
+
+// checkAssertion rejects assertions that can't be evaluated, so that
+// they don't pass or fail silently during the test.
+func checkAssertion(a assertion) error {
+	_, err := compileAssertion(a)
+	return err
+}
+
+// compiledAssertion is an assertion ready to check responses.
+type compiledAssertion struct {
+	assertion
+	needsBody bool
+	assert    assertFunc
+}
 
-	res, err := jsonpath.JsonPathLookup(jsonData, assertion.expression)
+func compileAssertion(a assertion) (compiledAssertion, error) {
+	if a.group != "" {
+		return compileAssertionGroup(a)
+	}
+	if a.ref != "" {
+		return compiledAssertion{}, fmt.Errorf("Unknown assertion %q", a.ref)
+	}
+	asr, ok := asserters[a.asserter]
+	if !ok {
+		return compiledAssertion{}, fmt.Errorf(
+			"Unknown asserter %q, available are %v",
+			a.asserter, strings.Join(asserterNames(), ", "),
+		)
+	}
+	a.condition = a.conditionOf(asr)
+	if a.condition == "" {
+		return compiledAssertion{}, fmt.Errorf(
+			"%v asserter requires a condition, available are %v",
+			a.asserter, strings.Join(asr.conditions, ", "),
+		)
+	}
+	known := false
+	for _, c := range asr.conditions {
+		known = known || c == a.condition
+	}
+	if !known {
+		return compiledAssertion{}, fmt.Errorf(
+			"Unknown condition %q of %v asserter, available are %v",
+			a.condition, a.asserter, strings.Join(asr.conditions, ", "),
+		)
+	}
+	assert, err := asr.compile(a)
+	if err != nil {
+		return compiledAssertion{}, fmt.Errorf("%v assertion: %v", a.asserter, err)
+	}
+	if asr.needsBody {
+		check := assert
+		assert = func(resp *assertedResponse) assertResult {
+			if resp.tooLarge {
+				return failed("response body exceeds the size limit").
+					because(bodyTooLarge)
+			}
+			return check(resp)
+		}
+	}
+	return compiledAssertion{
+		assertion: a,
+		needsBody: asr.needsBody,
+		assert:    assert,
+	}, nil
+}
 
-	if "NULL" == assertion.condition {
-		if res == nil {
+// compileAssertionGroup compiles the members of the group, allOf
+// passes if all of them pass, anyOf if any of them does and not if its
+// only member fails.
+func compileAssertionGroup(a assertion) (compiledAssertion, error) {
+	known := false
+	for _, g := range assertionGroups {
+		known = known || g == a.group
+	}
+	switch {
+	case !known:
+		return compiledAssertion{}, fmt.Errorf(
+			"Unknown assertion group %q, available are %v",
+			a.group, strings.Join(assertionGroups, ", "),
+		)
+	case a.asserter != "":
+		return compiledAssertion{}, fmt.Errorf(
+			"%v group can't have an asserter", a.group)
+	case a.group == "not" && len(a.members) != 1:
+		return compiledAssertion{}, fmt.Errorf(
+			"not group requires exactly one assertion, but got %v",
+			len(a.members))
+	case len(a.members) == 0:
+		return compiledAssertion{}, fmt.Errorf(
+			"%v group requires assertions", a.group)
+	}
+	c := compiledAssertion{assertion: a}
+	members := make([]compiledAssertion, 0, len(a.members))
+	for _, m := range a.members {
+		if m.severity != hardSeverity {
+			return compiledAssertion{}, fmt.Errorf(
+				"%v is %v, so it can't be a part of a group",
+				m.displayName(), m.severity)
+		}
+		compiled, err := compileAssertion(m)
+		if err != nil {
+			return compiledAssertion{}, err
+		}
+		members = append(members, compiled)
+		c.needsBody = c.needsBody || compiled.needsBody
+	}
+	switch a.group {
+	case "allOf":
+		c.assert = func(resp *assertedResponse) assertResult {
+			for _, m := range members {
+				if r := m.assert(resp); !r.successful {
+					r.errMsg = m.displayName() + ": " + r.errMsg
+					return r
+				}
+			}
 			return success
-		} else {
-			return failure
+		}
+	case "anyOf":
+		c.assert = func(resp *assertedResponse) assertResult {
+			errs := make([]string, 0, len(members))
+			for _, m := range members {
+				r := m.assert(resp)
+				if r.successful {
+					return success
+				}
+				errs = append(errs, m.displayName()+": "+r.errMsg)
+			}
+			return failed("none of %v passed: %v", a.displayName(),
+				strings.Join(errs, "; "))
+		}
+	case "not":
+		m := members[0]
+		c.assert = func(resp *assertedResponse) assertResult {
+			if r := m.assert(resp); r.successful {
+				return failed("%v passed", m.displayName())
+			}
+			return success
+		}
+	}
+	return c, nil
+}
+
+// resolveAssertions replaces references to named assertions in groups
+// with the assertions themselves, which are then checked only as a
+// part of the groups.
+func resolveAssertions(assertions []assertion) ([]assertion, error) {
+	named := make(map[string]assertion, len(assertions))
+	for _, a := range assertions {
+		if a.name != "" {
+			named[a.name] = a
+		}
+	}
+	referenced := make(map[string]bool)
+	// path is the names of the assertions being resolved, so that
+	// groups don't contain themselves
+	var resolve func(a assertion, path []string) (assertion, error)
+	resolve = func(a assertion, path []string) (assertion, error) {
+		if a.ref != "" {
+			for _, name := range path {
+				if name == a.ref {
+					return a, fmt.Errorf("Assertion %q is a part of itself", a.ref)
+				}
+			}
+			target, ok := named[a.ref]
+			if !ok {
+				return a, fmt.Errorf("Unknown assertion %q", a.ref)
+			}
+			referenced[a.ref] = true
+			return resolve(target, append(path, a.ref))
+		}
+		if len(a.members) == 0 {
+			return a, nil
+		}
+		members := make([]assertion, 0, len(a.members))
+		for _, m := range a.members {
+			resolved, err := resolve(m, path)
+			if err != nil {
+				return a, err
+			}
+			members = append(members, resolved)
+		}
+		a.members = members
+		return a, nil
+	}
+	resolved := make([]assertion, 0, len(assertions))
+	for _, a := range assertions {
+		if a.ref != "" {
+			return nil, fmt.Errorf(
+				"Reference to %q must be a part of a group", a.ref)
+		}
+		var path []string
+		if a.name != "" {
+			path = []string{a.name}
+		}
+		r, err := resolve(a, path)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, r)
+	}
+	res := resolved[:0]
+	for _, a := range resolved {
+		if a.name == "" || !referenced[a.name] {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+// withExpected compiles the assertion with its expected value once or,
+// if the value has placeholders, renders and compiles it for each
+// response, failing the assertion if it's invalid.
+func withExpected(
+	a assertion, compile func(expected string) (assertFunc, error),
+) (assertFunc, error) {
+	tmpl := compileTemplate(a.expected)
+	if !tmpl.hasVars() {
+		// escaped placeholders are unescaped all the same
+		return compile(tmpl.render(nil))
+	}
+	return func(resp *assertedResponse) assertResult {
+		assert, err := compile(tmpl.render(resp.vars))
+		if err != nil {
+			return failed("%v", err).because(invalidExpected)
+		}
+		return assert(resp)
+	}, nil
+}
+
+// assertionPlan holds the assertions compiled once before the test
+// and decides which responses are asserted.
+type assertionPlan struct {
+	assertions []compiledAssertion
+	// needsBody tells whether any of the assertions has to look at the
+	// response body
+	needsBody bool
+	// sample is the fraction of responses asserted
+	sample float64
+
+	responses, asserted uint64
+}
+
+func compileAssertions(assertions []assertion, sample float64) (*assertionPlan, error) {
+	if sample <= 0 || sample > 1 {
+		return nil, errInvalidAssertSample
+	}
+	assertions, err := resolveAssertions(assertions)
+	if err != nil {
+		return nil, err
+	}
+	p := &assertionPlan{
+		assertions: make([]compiledAssertion, 0, len(assertions)),
+		sample:     sample,
+	}
+	for _, a := range assertions {
+		c, err := compileAssertion(a)
+		if err != nil {
+			return nil, err
+		}
+		p.assertions = append(p.assertions, c)
+		p.needsBody = p.needsBody || c.needsBody
+	}
+	return p, nil
+}
+
+// sampled tells whether the next response should be asserted. The
+// responses are picked evenly, starting with the first one.
+func (p *assertionPlan) sampled() bool {
+	n := atomic.AddUint64(&p.responses, 1)
+	if p.sample < 1 &&
+		math.Ceil(float64(n)*p.sample) == math.Ceil(float64(n-1)*p.sample) {
+		return false
+	}
+	atomic.AddUint64(&p.asserted, 1)
+	return true
+}
+
+// scale returns the ratio of all responses to the asserted ones, which
+// failures are multiplied by to estimate their total number.
+func (p *assertionPlan) scale() float64 {
+	asserted := atomic.LoadUint64(&p.asserted)
+	if asserted == 0 {
+		return 1
+	}
+	return float64(atomic.LoadUint64(&p.responses)) / float64(asserted)
+}
+
+// list returns the assertions checked, the ones referred to by groups
+// are checked only as their parts.
+func (p *assertionPlan) list() []assertion {
+	if p == nil {
+		return nil
+	}
+	res := make([]assertion, 0, len(p.assertions))
+	for _, a := range p.assertions {
+		res = append(res, a.assertion)
+	}
+	return res
+}
+
+// assert returns the failed assertions. All of them are checked, so
+// that soft ones are reported even if the response fails anyway.
+func (p *assertionPlan) assert(resp *assertedResponse) assertResults {
+	var failures assertResults
+	for i, a := range p.assertions {
+		if r := a.assert(resp); !r.successful {
+			r.assertion = i
+			r.severity = a.severity
+			failures = append(failures, r)
 		}
 	}
+	return failures
+}
 
-	if "NOT_NULL" == assertion.condition {
-		if res == nil {
-			return failure
+// statusCodeMatcher accepts a code for EQUAL, comma separated codes for
+// IN and an inclusive range like 200-299 or a class like 2xx for RANGE.
+func statusCodeMatcher(condition, expected string) (func(int) bool, error) {
+	switch condition {
+	case "IN":
+		codes := map[int]bool{}
+		for _, s := range strings.Split(expected, ",") {
+			code, err := parseStatusCode(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			codes[code] = true
+		}
+		return func(code int) bool {
+			return codes[code]
+		}, nil
+	case "RANGE":
+		var from, to int
+		if len(expected) == 3 && strings.HasSuffix(strings.ToLower(expected), "xx") {
+			class, err := parseStatusCode(expected[:1] + "00")
+			if err != nil {
+				return nil, err
+			}
+			from, to = class, class+99
 		} else {
-			return success
+			bounds := strings.SplitN(expected, "-", 2)
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("Invalid status code range %q", expected)
+			}
+			var err error
+			if from, err = parseStatusCode(strings.TrimSpace(bounds[0])); err != nil {
+				return nil, err
+			}
+			if to, err = parseStatusCode(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, err
+			}
+			if from > to {
+				return nil, fmt.Errorf("Invalid status code range %q", expected)
+			}
 		}
+		return func(code int) bool {
+			return from <= code && code <= to
+		}, nil
+	}
+	expectedCode, err := parseStatusCode(expected)
+	if err != nil {
+		return nil, err
+	}
+	return func(code int) bool {
+		return code == expectedCode
+	}, nil
+}
+
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("Invalid status code %q", s)
 	}
+	return code, nil
+}
 
-	if "EQUAL" == assertion.condition {
-		if res == nil {
-			return failure
+func compileStatusCodeAssertion(a assertion) (assertFunc, error) {
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		matches, err := statusCodeMatcher(a.condition, expected)
+		if err != nil {
+			return nil, err
 		}
+		return func(resp *assertedResponse) assertResult {
+			if !matches(resp.code) {
+				return failed("status code %v doesn't match %v %v",
+					resp.code, a.condition, expected).
+					withActual(strconv.Itoa(resp.code))
+			}
+			return success
+		}, nil
+	})
+}
 
-		var actual string
-		switch res.(type) {
-		case float64:
-			actual = strconv.FormatFloat(res.(float64), 'f', -1, 64)
-		case int:
-			actual = strconv.Itoa(res.(int))
-		case string:
-			actual = res.(string)
+func compileHeaderAssertion(a assertion) (assertFunc, error) {
+	if a.expression == "" {
+		return nil, errEmptyAssertionExpression
+	}
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		var matches func(value string) bool
+		switch a.condition {
+		case "EQUAL":
+			matches = func(value string) bool {
+				return value == expected
+			}
+		case "CONTAINS":
+			matches = func(value string) bool {
+				return strings.Contains(value, expected)
+			}
+		case "MATCHES":
+			re, err := regexp.Compile(expected)
+			if err != nil {
+				return nil, err
+			}
+			matches = re.MatchString
 		}
-		if actual == assertion.expected {
+		return func(resp *assertedResponse) assertResult {
+			value, ok := resp.header(a.expression)
+			switch a.condition {
+			case "EXISTS":
+				if !ok {
+					return failed("header %v is missing", a.expression).
+						because(missingValue)
+				}
+				return success
+			case "NOT_EXISTS":
+				if ok {
+					return failed("header %v is present", a.expression).
+						withActual(value)
+				}
+				return success
+			}
+			if !ok {
+				return failed("header %v is missing", a.expression).
+					because(missingValue)
+			}
+			if !matches(value) {
+				return failed("header %v: %q doesn't match %v %q",
+					a.expression, value, a.condition, expected).
+					withActual(value)
+			}
 			return success
-		} else {
-			return failure
+		}, nil
+	})
+}
+
+func compileBodyContainsAssertion(a assertion) (assertFunc, error) {
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		if expected == "" {
+			return nil, errEmptyAssertionExpected
+		}
+		substr := []byte(expected)
+		return func(resp *assertedResponse) assertResult {
+			contains := bytes.Contains(resp.body, substr)
+			if a.condition == "NOT_CONTAINS" {
+				if contains {
+					return failed("body contains %q", expected).
+						withActual(string(resp.body))
+				}
+			} else if !contains {
+				return failed("body doesn't contain %q", expected).
+					withActual(string(resp.body))
+			}
+			return success
+		}, nil
+	})
+}
+
+func compileBodyRegexAssertion(a assertion) (assertFunc, error) {
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return nil, err
+		}
+		return func(resp *assertedResponse) assertResult {
+			matches := re.Match(resp.body)
+			if a.condition == "NOT_MATCHES" {
+				if matches {
+					return failed("body matches %q", expected).
+						withActual(string(resp.body))
+				}
+			} else if !matches {
+				return failed("body doesn't match %q", expected).
+					withActual(string(resp.body))
+			}
+			return success
+		}, nil
+	})
+}
+
+func compileBodySizeAssertion(a assertion) (assertFunc, error) {
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		size, err := strconv.ParseUint(expected, decBase, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(resp *assertedResponse) assertResult {
+			actual := uint64(len(resp.body))
+			if !compareOrdered(a.condition, actual, size) {
+				return failed("body size %v doesn't match %v %v",
+					actual, a.condition, size).
+					withActual(strconv.FormatUint(actual, decBase))
+			}
+			return success
+		}, nil
+	})
+}
+
+func compileResponseTimeAssertion(a assertion) (assertFunc, error) {
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		took, err := time.ParseDuration(expected)
+		if err != nil {
+			return nil, err
 		}
+		return func(resp *assertedResponse) assertResult {
+			if !compareOrdered(a.condition, uint64(resp.took), uint64(took)) {
+				return failed("response time %v doesn't match %v %v",
+					resp.took, a.condition, took).
+					withActual(resp.took.String())
+			}
+			return success
+		}, nil
+	})
+}
+
+func compareOrdered(condition string, actual, expected uint64) bool {
+	switch condition {
+	case "LT":
+		return actual < expected
+	case "LTE":
+		return actual <= expected
+	case "GT":
+		return actual > expected
+	case "GTE":
+		return actual >= expected
 	}
+	return actual == expected
+}
 
-	return success
+// assertionsList is the value of the repeatable --assert flag, each of
+// them is
+//
+//	[[<name>]] [<severity>] <asserter>[:<expression>] [<condition>] [<expected>]
+//
+// where the name in square brackets is optional, the severity is hard
+// by default, the condition can be omitted if the asserter has a
+// default one and the expected value is the rest of the line. Groups
+// combine named assertions, e.g.
+//
+//	[[<name>]] [<severity>] anyOf(allOf(ok, hasData), not(<name>))
+type assertionsList []assertion
+
+func (l *assertionsList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *assertionsList) IsCumulative() bool {
+	return true
+}
+
+func (l *assertionsList) Set(value string) error {
+	value = strings.TrimSpace(value)
+	var name string
+	if strings.HasPrefix(value, "[") {
+		end := strings.IndexByte(value, ']')
+		if end < 0 {
+			return errInvalidAssertionFormat
+		}
+		if name = strings.TrimSpace(value[1:end]); name == "" {
+			return errInvalidAssertionFormat
+		}
+		value = strings.TrimSpace(value[end+1:])
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return errInvalidAssertionFormat
+	}
+	severity, abortAfter := hardSeverity, uint64(0)
+	if isAssertionSeverity(fields[0]) {
+		var err error
+		severity, abortAfter, err = parseAssertionSeverity(fields[0])
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSpace(value[len(fields[0]):])
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return errInvalidAssertionFormat
+		}
+	}
+	if isAssertionGroup(value) {
+		a, rest, err := parseAssertionGroup(value)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return errInvalidAssertionFormat
+		}
+		a.name, a.severity, a.abortAfter = name, severity, abortAfter
+		*l = append(*l, a)
+		return nil
+	}
+	a := assertion{
+		name:       name,
+		asserter:   fields[0],
+		severity:   severity,
+		abortAfter: abortAfter,
+	}
+	rest := strings.TrimSpace(value[len(fields[0]):])
+	if i := strings.IndexByte(fields[0], ':'); i >= 0 {
+		a.asserter = fields[0][:i]
+		a.expression, rest = splitAssertionExpression(value[i+1:])
+	}
+	fields = append(fields[:1], strings.Fields(rest)...)
+	if len(fields) > 1 && isCondition(a.asserter, fields[1]) {
+		a.condition = fields[1]
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+	}
+	a.expected = rest
+	*l = append(*l, a)
+	return nil
 }
 
-func assertThat(data []byte, assertions []assertion) assertResult {
-	for _, assertion := range assertions {
-		if "JsonPath" == assertion.asserter {
-			r := jsonPathAssert(data, assertion)
-			if !r.successful {
-				return r
+// splitAssertionExpression splits the expression off the rest of the
+// assertion. Spaces end it only outside of quotes and brackets, e.g.
+// //a[@title='a b'], and the whole expression may be quoted to hold
+// them, e.g. "div > a".
+func splitAssertionExpression(s string) (string, string) {
+	var (
+		quote byte
+		depth int
+	)
+	end := len(s)
+scan:
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
 			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case (c == ']' || c == ')') && depth > 0:
+			depth--
+		case (c == ' ' || c == '\t') && depth == 0:
+			end = i
+			break scan
 		}
 	}
-	return success
+	expr := s[:end]
+	if len(expr) >= 2 && (expr[0] == '\'' || expr[0] == '"') &&
+		expr[len(expr)-1] == expr[0] {
+		expr = expr[1 : len(expr)-1]
+	}
+	return expr, strings.TrimSpace(s[end:])
+}
+
+func isAssertionGroup(s string) bool {
+	for _, g := range assertionGroups {
+		if strings.HasPrefix(s, g+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAssertionGroup parses the group at the start of s, its members
+// are names of assertions or groups themselves. It returns the rest of
+// s after the group.
+func parseAssertionGroup(s string) (assertion, string, error) {
+	open := strings.IndexByte(s, '(')
+	a := assertion{group: s[:open]}
+	s = s[open+1:]
+	for {
+		s = strings.TrimLeft(s, " \t")
+		var member assertion
+		if isAssertionGroup(s) {
+			var err error
+			member, s, err = parseAssertionGroup(s)
+			if err != nil {
+				return a, s, err
+			}
+		} else {
+			end := strings.IndexAny(s, "(),")
+			if end < 0 {
+				return a, s, errInvalidAssertionFormat
+			}
+			member.ref = strings.TrimSpace(s[:end])
+			if member.ref == "" || s[end] == '(' {
+				return a, s, errInvalidAssertionFormat
+			}
+			s = s[end:]
+		}
+		a.members = append(a.members, member)
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return a, s, errInvalidAssertionFormat
+		}
+		switch s[0] {
+		case ')':
+			return a, s[1:], nil
+		case ',':
+			s = s[1:]
+		default:
+			return a, s, errInvalidAssertionFormat
+		}
+	}
+}
+
+func isCondition(asserterName, s string) bool {
+	// unknown asserters have no conditions, they're reported by checkArgs
+	asr := asserters[asserterName]
+	for _, c := range asr.conditions {
+		if c == s {
+			return true
+		}
+	}
+	return false
 }
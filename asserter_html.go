@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssSelector is a compiled list of comma separated selectors. Only a
+// subset of CSS is supported:
+//
+//	tag, *, #id, .class, [attr], [attr=v], [attr^=v], [attr$=v],
+//	[attr*=v], [attr~=v]
+//
+// combined with descendant (space) and child (>) combinators.
+type cssSelector []cssComplex
+
+// cssComplex is a chain of compound selectors, the last one matches the
+// element itself.
+type cssComplex struct {
+	compounds []cssCompound
+	// combinators[i] joins compounds[i] and compounds[i+1]
+	combinators []byte
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []cssAttr
+}
+
+type cssAttr struct {
+	name, operator, value string
+}
+
+var (
+	cssIdentRegexp = regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*`)
+	cssAttrRegexp  = regexp.MustCompile(
+		`^\[\s*(-?[_a-zA-Z][_a-zA-Z0-9-]*)\s*(?:([~^$*]?=)\s*(?:"([^"]*)"|'([^']*)'|([^\]\s]+))\s*)?\]`)
+)
+
+func compileCSSSelector(selector string) (cssSelector, error) {
+	var res cssSelector
+	for _, part := range strings.Split(selector, ",") {
+		c, err := compileCSSComplex(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("Unsupported CSS selector %q: %v", selector, err)
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func compileCSSComplex(s string) (cssComplex, error) {
+	var c cssComplex
+	if s == "" {
+		return c, errors.New("empty selector")
+	}
+	for {
+		compound, rest, err := compileCSSCompound(s)
+		if err != nil {
+			return c, err
+		}
+		c.compounds = append(c.compounds, compound)
+		trimmed := strings.TrimLeft(rest, " \t")
+		if trimmed == "" {
+			return c, nil
+		}
+		combinator := byte(' ')
+		if trimmed[0] == '>' {
+			combinator = '>'
+			trimmed = strings.TrimLeft(trimmed[1:], " \t")
+		} else if trimmed == rest {
+			return c, fmt.Errorf("unexpected %q", rest)
+		}
+		c.combinators = append(c.combinators, combinator)
+		s = trimmed
+	}
+}
+
+func compileCSSCompound(s string) (cssCompound, string, error) {
+	var c cssCompound
+	if strings.HasPrefix(s, "*") {
+		s = s[1:]
+	} else if tag := cssIdentRegexp.FindString(s); tag != "" {
+		c.tag, s = strings.ToLower(tag), s[len(tag):]
+	}
+	start := s
+	for s != "" {
+		switch s[0] {
+		case '#', '.':
+			ident := cssIdentRegexp.FindString(s[1:])
+			if ident == "" {
+				return c, s, fmt.Errorf("invalid %q", s)
+			}
+			if s[0] == '#' {
+				c.id = ident
+			} else {
+				c.classes = append(c.classes, ident)
+			}
+			s = s[1+len(ident):]
+		case '[':
+			m := cssAttrRegexp.FindStringSubmatch(s)
+			if m == nil {
+				return c, s, fmt.Errorf("invalid %q", s)
+			}
+			c.attrs = append(c.attrs, cssAttr{
+				name:     strings.ToLower(m[1]),
+				operator: m[2],
+				value:    m[3] + m[4] + m[5],
+			})
+			s = s[len(m[0]):]
+		default:
+			if s == start && c.tag == "" && !strings.HasPrefix(s, "*") {
+				return c, s, fmt.Errorf("unexpected %q", s)
+			}
+			return c, s, nil
+		}
+	}
+	return c, s, nil
+}
+
+func (s cssSelector) matches(n *html.Node) bool {
+	for _, c := range s {
+		if c.matches(n, len(c.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches tells whether n matches compounds up to i, its ancestors
+// are matched against the preceding ones.
+func (c *cssComplex) matches(n *html.Node, i int) bool {
+	if !c.compounds[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if c.matches(p, i-1) {
+			return true
+		}
+		if c.combinators[i-1] == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+func (c *cssCompound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && n.Data != c.tag) {
+		return false
+	}
+	attr := func(name string) (string, bool) {
+		for _, a := range n.Attr {
+			if a.Namespace == "" && a.Key == name {
+				return a.Val, true
+			}
+		}
+		return "", false
+	}
+	if c.id != "" {
+		if id, _ := attr("id"); id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		class, _ := attr("class")
+		classes := strings.Fields(class)
+		for _, want := range c.classes {
+			if !containsString(classes, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		v, ok := attr(a.name)
+		if !ok {
+			return false
+		}
+		switch a.operator {
+		case "=":
+			ok = v == a.value
+		case "^=":
+			ok = a.value != "" && strings.HasPrefix(v, a.value)
+		case "$=":
+			ok = a.value != "" && strings.HasSuffix(v, a.value)
+		case "*=":
+			ok = a.value != "" && strings.Contains(v, a.value)
+		case "~=":
+			ok = containsString(strings.Fields(v), a.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the first element matching the selector in document
+// order.
+func (s cssSelector) find(n *html.Node) *html.Node {
+	if s.matches(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := s.find(c); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func compileHtmlSelectorAssertion(a assertion) (assertFunc, error) {
+	if a.expression == "" {
+		return nil, errEmptyAssertionExpression
+	}
+	selector, err := compileCSSSelector(a.expression)
+	if err != nil {
+		return nil, err
+	}
+	return func(resp *assertedResponse) assertResult {
+		doc, err := resp.html()
+		if err != nil {
+			return failed("body is not HTML: %v", err).
+				because(invalidBody).withActual(string(resp.body))
+		}
+		found := selector.find(doc)
+		if a.condition == "NOT_EXISTS" {
+			if found != nil {
+				return failed("%v is present", a.expression).
+					withActual(renderHtml(found))
+			}
+		} else if found == nil {
+			return failed("%v not found", a.expression).because(missingValue)
+		}
+		return success
+	}, nil
+}
+
+func renderHtml(n *html.Node) string {
+	var b strings.Builder
+	_ = html.Render(&b, n)
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+const htmlPage = `<!DOCTYPE html>
+<html>
+<head><title>Orders</title></head>
+<body>
+  <div id="main" class="content wide">
+    <ul class="orders">
+      <li data-id="1" class="order shipped"><a href="/orders/1">#1</a></li>
+      <li data-id="2" class="order"><a href="https://example.com/orders/2">#2</a></li>
+    </ul>
+  </div>
+  <p class="footer">Total: 2</p>
+</body>
+</html>`
+
+func TestHtmlSelectorAssertion(t *testing.T) {
+	resp := &assertedResponse{body: []byte(htmlPage)}
+	expectations := []struct {
+		selector, condition string
+		successful          bool
+	}{
+		{"title", "", true},
+		{"#main", "", true},
+		{"div.content.wide", "", true},
+		{"div.content.narrow", "", false},
+		{"#main > ul.orders > li.order", "", true},
+		{"#main > li", "", false},
+		{"body li a", "", true},
+		{"li[data-id='2']", "", true},
+		{"li[data-id=3]", "", false},
+		{`a[href^="https://"]`, "", true},
+		{`a[href$="/1"]`, "", true},
+		{`a[href*=example]`, "", true},
+		{"li[class~=shipped]", "", true},
+		{"li[class~=ship]", "", false},
+		{"table, p.footer", "", true},
+		{"*[data-id]", "", true},
+		{".error", "NOT_EXISTS", true},
+		{"li.shipped", "NOT_EXISTS", false},
+	}
+	for _, e := range expectations {
+		a := assertion{
+			asserter:   "HtmlSelector",
+			expression: e.selector,
+			condition:  e.condition,
+		}
+		if a.condition == "" {
+			a.condition = "EXISTS"
+		}
+		if err := checkAssertion(a); err != nil {
+			t.Errorf("%+v: %v", a, err)
+			continue
+		}
+		r := assertOnce(t, resp, a)
+		if r.successful != e.successful {
+			t.Errorf("%+v: expected %v, but got %+v", a, e.successful, r)
+		}
+	}
+}
+
+func TestCompileCSSSelectorShouldRejectUnsupportedSelectors(t *testing.T) {
+	selectors := []string{
+		"",
+		"a,",
+		"li:first-child",
+		"a + b",
+		"#",
+		"[href",
+		"div..content",
+	}
+	for _, s := range selectors {
+		if _, err := compileCSSSelector(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
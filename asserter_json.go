@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oliveagle/jsonpath"
+)
+
+var jsonPathConditions = []string{
+	"NULL", "NOT_NULL", "EQUAL", "NOT_EQUAL", "GT", "GTE", "LT", "LTE",
+	"CONTAINS", "MATCHES", "IN", "LENGTH_EQ", "LENGTH_GT", "IS_TYPE",
+}
+
+var jsonTypes = []string{"string", "number", "boolean", "null", "array", "object"}
+
+func compileJsonPathAssertion(a assertion) (assertFunc, error) {
+	if a.expression == "" {
+		return nil, errEmptyAssertionExpression
+	}
+	path, err := jsonpath.Compile(a.expression)
+	if err != nil {
+		return nil, err
+	}
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		matches, err := jsonMatcher(a.condition, expected)
+		if err != nil {
+			return nil, err
+		}
+		return func(resp *assertedResponse) assertResult {
+			data, err := resp.json()
+			if err != nil {
+				return failed("body is not JSON: %v", err).
+					because(invalidBody).withActual(string(resp.body))
+			}
+			// missing values are told from nulls, which are found
+			res, err := path.Lookup(data)
+			found := err == nil
+			if matches(res, found) {
+				return success
+			}
+			if !found {
+				return failed("%v not found", a.expression).
+					because(missingValue)
+			}
+			actual := jsonString(res)
+			return failed("%v is %v, expected %v", a.expression, actual,
+				strings.TrimSpace(a.condition+" "+expected)).withActual(actual)
+		}, nil
+	})
+}
+
+// jsonMatcher returns the function comparing the value found by the
+// path with the expected one according to the type of the value, e.g.
+// the expected value is treated as a number if the value is a number.
+// The expected value is parsed in advance.
+func jsonMatcher(condition, expected string) (func(actual interface{}, found bool) bool, error) {
+	switch condition {
+	case "NULL":
+		return func(actual interface{}, found bool) bool {
+			return found && actual == nil
+		}, nil
+	case "NOT_NULL":
+		return func(actual interface{}, _ bool) bool {
+			return actual != nil
+		}, nil
+	}
+	var matches func(actual interface{}) bool
+	switch condition {
+	case "EQUAL", "NOT_EQUAL":
+		e := parseJsonValue(expected)
+		negate := condition == "NOT_EQUAL"
+		matches = func(actual interface{}) bool {
+			return e.equal(actual) != negate
+		}
+	case "GT", "GTE", "LT", "LTE":
+		e, err := strconv.ParseFloat(expected, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v requires a number, but got %q",
+				condition, expected)
+		}
+		matches = func(actual interface{}) bool {
+			a, ok := jsonNumber(actual)
+			if !ok {
+				return false
+			}
+			switch condition {
+			case "GT":
+				return a > e
+			case "GTE":
+				return a >= e
+			case "LT":
+				return a < e
+			}
+			return a <= e
+		}
+	case "CONTAINS":
+		e := parseJsonValue(expected)
+		matches = func(actual interface{}) bool {
+			switch v := actual.(type) {
+			case string:
+				return strings.Contains(v, expected)
+			case []interface{}:
+				for _, element := range v {
+					if e.equal(element) {
+						return true
+					}
+				}
+			case map[string]interface{}:
+				_, ok := v[expected]
+				return ok
+			}
+			return false
+		}
+	case "MATCHES":
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return nil, err
+		}
+		matches = func(actual interface{}) bool {
+			return re.MatchString(jsonString(actual))
+		}
+	case "IN":
+		options, err := jsonOptions(expected)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]jsonValue, 0, len(options))
+		for _, o := range options {
+			values = append(values, parseJsonValue(o))
+		}
+		matches = func(actual interface{}) bool {
+			for _, v := range values {
+				if v.equal(actual) {
+					return true
+				}
+			}
+			return false
+		}
+	case "LENGTH_EQ", "LENGTH_GT":
+		e, err := strconv.Atoi(expected)
+		if err != nil || e < 0 {
+			return nil, fmt.Errorf("%v requires a length, but got %q",
+				condition, expected)
+		}
+		matches = func(actual interface{}) bool {
+			n, ok := jsonLength(actual)
+			if !ok {
+				return false
+			}
+			if condition == "LENGTH_GT" {
+				return n > e
+			}
+			return n == e
+		}
+	case "IS_TYPE":
+		known := false
+		for _, t := range jsonTypes {
+			known = known || t == expected
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown JSON type %q, available are %v",
+				expected, strings.Join(jsonTypes, ", "))
+		}
+		matches = func(actual interface{}) bool {
+			return jsonType(actual) == expected
+		}
+	default:
+		return nil, fmt.Errorf("Unknown condition %q", condition)
+	}
+	return func(actual interface{}, found bool) bool {
+		return found && matches(actual)
+	}, nil
+}
+
+// jsonValue is the expected value parsed for each type of the actual
+// values it can be compared with, arrays and objects are parsed as
+// JSON.
+type jsonValue struct {
+	raw string
+
+	boolean, isBool   bool
+	number            float64
+	isNumber, isValue bool
+	value             interface{}
+}
+
+func parseJsonValue(s string) jsonValue {
+	v := jsonValue{raw: s}
+	var err error
+	v.boolean, err = strconv.ParseBool(s)
+	v.isBool = err == nil
+	v.number, err = strconv.ParseFloat(s, 64)
+	v.isNumber = err == nil
+	v.isValue = json.Unmarshal([]byte(s), &v.value) == nil
+	return v
+}
+
+// equal tells whether the actual value equals the expected one.
+func (e jsonValue) equal(actual interface{}) bool {
+	switch v := actual.(type) {
+	case nil:
+		return e.raw == "null"
+	case bool:
+		return e.isBool && e.boolean == v
+	case string:
+		return v == e.raw
+	case float64, int:
+		a, _ := jsonNumber(v)
+		return e.isNumber && a == e.number
+	}
+	return e.isValue && reflect.DeepEqual(actual, e.value)
+}
+
+// jsonNumber returns the value as a number, strings holding numbers
+// are converted as well.
+func jsonNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func jsonLength(v interface{}) (int, bool) {
+	switch l := v.(type) {
+	case string:
+		return utf8.RuneCountInString(l), true
+	case []interface{}:
+		return len(l), true
+	case map[string]interface{}:
+		return len(l), true
+	}
+	return 0, false
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, int:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// jsonOptions splits the expected value of IN, which is either a JSON
+// array or a comma separated list.
+func jsonOptions(expected string) ([]string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(expected), "[") {
+		options := strings.Split(expected, ",")
+		for i := range options {
+			options[i] = strings.TrimSpace(options[i])
+		}
+		return options, nil
+	}
+	var values []interface{}
+	if err := json.Unmarshal([]byte(expected), &values); err != nil {
+		return nil, fmt.Errorf("Invalid list %q: %v", expected, err)
+	}
+	options := make([]string, 0, len(values))
+	for _, v := range values {
+		options = append(options, jsonString(v))
+	}
+	return options, nil
+}
@@ -0,0 +1,955 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReportedViolations is the number of schema violations listed in
+// the failure message, all of them are counted in the results though.
+const maxReportedViolations = 3
+
+// schemaNode is a compiled JSON schema (draft-07). Schemas referenced
+// by $ref are compiled once and shared, so nodes may form cycles.
+type schemaNode struct {
+	// path locates the schema, e.g. #/properties/id or, for schemas
+	// in other files, defs.json#/definitions/id
+	path string
+
+	// boolean schemas are either always valid or never
+	always, never bool
+	ref           *schemaNode
+
+	types    []string
+	enum     []interface{}
+	constant *interface{}
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	format               string
+
+	items           *schemaNode
+	itemsList       []*schemaNode
+	additionalItems *schemaNode
+	contains        *schemaNode
+	minItems        *int
+	maxItems        *int
+	uniqueItems     bool
+
+	properties           map[string]*schemaNode
+	propertyOrder        []string
+	patternProperties    []patternSchema
+	additionalProperties *schemaNode
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+	propertyNames        *schemaNode
+	dependencies         map[string]schemaDependency
+
+	allOf, anyOf, oneOf []*schemaNode
+	not                 *schemaNode
+	ifThen, ifElse      *schemaNode
+	condition           *schemaNode
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *schemaNode
+}
+
+// schemaDependency is either a list of required properties or a schema.
+type schemaDependency struct {
+	properties []string
+	schema     *schemaNode
+}
+
+// schemaViolation tells which keyword of the schema the value at
+// instancePath violates.
+type schemaViolation struct {
+	schemaPath   string
+	instancePath string
+	message      string
+}
+
+func (v schemaViolation) String() string {
+	return fmt.Sprintf("%v: %v (%v)", v.instancePath, v.message, v.schemaPath)
+}
+
+// schemaCompiler loads schema documents and compiles the schemas in
+// them. Documents are identified by their URIs, file:// ones for local
+// files, and $ref is resolved against the base URI set by $id.
+type schemaCompiler struct {
+	root string
+	docs map[string]interface{}
+	// ids locates the schemas identified by $id
+	ids map[string]schemaLocation
+	// bases are the base URIs set by $id, by schema location
+	bases map[schemaLocation]string
+	nodes map[string]*schemaNode
+}
+
+// schemaLocation is a JSON pointer to the schema in the document.
+type schemaLocation struct {
+	doc, pointer string
+}
+
+// schemaClient fetches remote schemas referenced by $ref.
+var schemaClient = &http.Client{Timeout: 10 * time.Second}
+
+func loadJsonSchema(path string) (*schemaNode, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	root := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+	c := &schemaCompiler{
+		root:  root,
+		docs:  map[string]interface{}{},
+		ids:   map[string]schemaLocation{},
+		bases: map[schemaLocation]string{},
+		nodes: map[string]*schemaNode{},
+	}
+	schema, err := c.compileAt(root, "")
+	if err != nil {
+		return nil, err
+	}
+	// a schema applied to the same value it is applied to would never
+	// finish validating, unlike the ones applied to its parts
+	visiting := map[*schemaNode]bool{}
+	for _, n := range c.nodes {
+		if err := checkSchemaCycle(n, visiting); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// checkSchemaCycle fails if n reaches itself through subschemas
+// applied to the same value, visiting holds the nodes checked so far,
+// those being checked are true.
+func checkSchemaCycle(n *schemaNode, visiting map[*schemaNode]bool) error {
+	if inProgress, ok := visiting[n]; ok {
+		if inProgress {
+			return fmt.Errorf("%v: $ref refers to itself", n.path)
+		}
+		return nil
+	}
+	visiting[n] = true
+	for _, s := range n.inPlace() {
+		if err := checkSchemaCycle(s, visiting); err != nil {
+			return err
+		}
+	}
+	visiting[n] = false
+	return nil
+}
+
+// inPlace returns the subschemas applied to the same value as n.
+func (n *schemaNode) inPlace() []*schemaNode {
+	var res []*schemaNode
+	for _, s := range []*schemaNode{n.ref, n.not, n.condition, n.ifThen, n.ifElse} {
+		if s != nil {
+			res = append(res, s)
+		}
+	}
+	res = append(res, n.allOf...)
+	res = append(res, n.anyOf...)
+	res = append(res, n.oneOf...)
+	for _, d := range n.dependencies {
+		if d.schema != nil {
+			res = append(res, d.schema)
+		}
+	}
+	return res
+}
+
+func (c *schemaCompiler) doc(uri string) (interface{}, error) {
+	if doc, ok := c.docs[uri]; ok {
+		return doc, nil
+	}
+	data, err := fetchSchema(uri)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%v: %v", schemaDocName(uri), err)
+	}
+	c.docs[uri] = doc
+	if err := c.index(uri, schemaLocation{doc: uri}, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fetchSchema reads the document of local or remote schema.
+func fetchSchema(uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return ioutil.ReadFile(filepath.FromSlash(u.Path))
+	case "http", "https":
+		resp, err := schemaClient.Get(uri)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%v: %v", uri, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	return nil, fmt.Errorf("%v: unsupported scheme %q", uri, u.Scheme)
+}
+
+// index registers the schemas of the document identified by $id and
+// the base URIs they set for their subschemas.
+func (c *schemaCompiler) index(base string, loc schemaLocation, v interface{}) error {
+	switch s := v.(type) {
+	case []interface{}:
+		for i, e := range s {
+			sub := schemaLocation{loc.doc, loc.pointer + "/" + strconv.Itoa(i)}
+			if err := c.index(base, sub, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// siblings of $ref, $id among them, are ignored in draft-07
+		if _, ok := s["$ref"]; ok {
+			return nil
+		}
+		if id, ok := s["$id"].(string); ok {
+			uri, err := resolveURI(base, id)
+			if err != nil {
+				return fmt.Errorf("%v#%v/$id: %v", schemaDocName(loc.doc),
+					loc.pointer, err)
+			}
+			c.ids[uri] = loc
+			if i := strings.IndexByte(uri, '#'); i >= 0 {
+				uri = uri[:i]
+			}
+			c.ids[uri] = loc
+			c.bases[loc] = uri
+			base = uri
+		}
+		for key, e := range s {
+			// values of these are data, not schemas
+			if key == "enum" || key == "const" || key == "default" ||
+				key == "examples" {
+				continue
+			}
+			sub := schemaLocation{loc.doc, loc.pointer + "/" + escapeJsonPointer(key)}
+			if err := c.index(base, sub, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// baseAt returns the base URI of the schema at loc, that is the one set
+// by the closest $id above it.
+func (c *schemaCompiler) baseAt(loc schemaLocation) string {
+	base := loc.doc
+	if b, ok := c.bases[schemaLocation{doc: loc.doc}]; ok {
+		base = b
+	}
+	for i := 1; i < len(loc.pointer); i++ {
+		if loc.pointer[i] != '/' {
+			continue
+		}
+		if b, ok := c.bases[schemaLocation{loc.doc, loc.pointer[:i]}]; ok {
+			base = b
+		}
+	}
+	if b, ok := c.bases[loc]; ok {
+		base = b
+	}
+	return base
+}
+
+func resolveURI(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// schemaDocName is the name of the document in paths and errors.
+func schemaDocName(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Path != "" {
+		return path.Base(u.Path)
+	}
+	return uri
+}
+
+// compileAt compiles the schema located by the JSON pointer in the
+// document.
+func (c *schemaCompiler) compileAt(uri, pointer string) (*schemaNode, error) {
+	key := uri + "#" + pointer
+	if n, ok := c.nodes[key]; ok {
+		return n, nil
+	}
+	doc, err := c.doc(uri)
+	if err != nil {
+		return nil, err
+	}
+	v, err := resolveJsonPointer(doc, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("%v#%v: %v", schemaDocName(uri), pointer, err)
+	}
+	n := &schemaNode{path: "#" + pointer}
+	if uri != c.root {
+		n.path = schemaDocName(uri) + n.path
+	}
+	// registered before compiling, so that recursive schemas end
+	c.nodes[key] = n
+	if err := c.compile(n, uri, pointer, v); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (c *schemaCompiler) compile(n *schemaNode, file, pointer string, v interface{}) error {
+	switch s := v.(type) {
+	case bool:
+		n.always, n.never = s, !s
+		return nil
+	case map[string]interface{}:
+		return c.compileObject(n, file, pointer, s)
+	}
+	return fmt.Errorf("%v: schema must be an object or a boolean", n.path)
+}
+
+func (c *schemaCompiler) compileObject(
+	n *schemaNode, file, pointer string, s map[string]interface{},
+) error {
+	var err error
+	sub := func(keyword string, path ...string) (*schemaNode, error) {
+		p := pointer + "/" + escapeJsonPointer(keyword)
+		for _, token := range path {
+			p += "/" + escapeJsonPointer(token)
+		}
+		return c.compileAt(file, p)
+	}
+	if ref, ok := s["$ref"]; ok {
+		// siblings of $ref are ignored in draft-07
+		r, ok := ref.(string)
+		if !ok {
+			return fmt.Errorf("%v: $ref must be a string", n.path)
+		}
+		n.ref, err = c.resolveRef(schemaLocation{file, pointer}, r)
+		return err
+	}
+
+	if t, ok := s["type"]; ok {
+		if n.types, err = stringsOf(t); err != nil {
+			return fmt.Errorf("%v/type: %v", n.path, err)
+		}
+		for _, name := range n.types {
+			if name != "integer" && !knownJsonType(name) {
+				return fmt.Errorf("%v/type: unknown type %q", n.path, name)
+			}
+		}
+	}
+	if e, ok := s["enum"]; ok {
+		if n.enum, ok = e.([]interface{}); !ok {
+			return fmt.Errorf("%v/enum: must be an array", n.path)
+		}
+	}
+	if constant, ok := s["const"]; ok {
+		n.constant = &constant
+	}
+
+	numbers := map[string]**float64{
+		"minimum":          &n.minimum,
+		"maximum":          &n.maximum,
+		"exclusiveMinimum": &n.exclusiveMinimum,
+		"exclusiveMaximum": &n.exclusiveMaximum,
+		"multipleOf":       &n.multipleOf,
+	}
+	for keyword, dst := range numbers {
+		if v, ok := s[keyword]; ok {
+			f, ok := v.(float64)
+			if !ok {
+				return fmt.Errorf("%v/%v: must be a number", n.path, keyword)
+			}
+			*dst = &f
+		}
+	}
+	counts := map[string]**int{
+		"minLength":     &n.minLength,
+		"maxLength":     &n.maxLength,
+		"minItems":      &n.minItems,
+		"maxItems":      &n.maxItems,
+		"minProperties": &n.minProperties,
+		"maxProperties": &n.maxProperties,
+	}
+	for keyword, dst := range counts {
+		if v, ok := s[keyword]; ok {
+			f, ok := v.(float64)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return fmt.Errorf("%v/%v: must be a non-negative integer",
+					n.path, keyword)
+			}
+			i := int(f)
+			*dst = &i
+		}
+	}
+
+	if p, ok := s["pattern"]; ok {
+		expr, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("%v/pattern: must be a string", n.path)
+		}
+		if n.pattern, err = regexp.Compile(expr); err != nil {
+			return fmt.Errorf("%v/pattern: %v", n.path, err)
+		}
+	}
+	if f, ok := s["format"].(string); ok {
+		n.format = f
+	}
+
+	switch items := s["items"].(type) {
+	case nil:
+	case []interface{}:
+		for i := range items {
+			item, err := sub("items", strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+			n.itemsList = append(n.itemsList, item)
+		}
+	default:
+		if n.items, err = sub("items"); err != nil {
+			return err
+		}
+	}
+	if u, ok := s["uniqueItems"].(bool); ok {
+		n.uniqueItems = u
+	}
+
+	if props, ok := s["properties"].(map[string]interface{}); ok {
+		n.properties = make(map[string]*schemaNode, len(props))
+		for name := range props {
+			if n.properties[name], err = sub("properties", name); err != nil {
+				return err
+			}
+			n.propertyOrder = append(n.propertyOrder, name)
+		}
+		sort.Strings(n.propertyOrder)
+	}
+	if props, ok := s["patternProperties"].(map[string]interface{}); ok {
+		patterns := make([]string, 0, len(props))
+		for expr := range props {
+			patterns = append(patterns, expr)
+		}
+		sort.Strings(patterns)
+		for _, expr := range patterns {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("%v/patternProperties: %v", n.path, err)
+			}
+			schema, err := sub("patternProperties", expr)
+			if err != nil {
+				return err
+			}
+			n.patternProperties = append(n.patternProperties,
+				patternSchema{re: re, schema: schema})
+		}
+	}
+	if r, ok := s["required"]; ok {
+		if n.required, err = stringsOf(r); err != nil {
+			return fmt.Errorf("%v/required: %v", n.path, err)
+		}
+	}
+	if deps, ok := s["dependencies"].(map[string]interface{}); ok {
+		n.dependencies = make(map[string]schemaDependency, len(deps))
+		for name, dep := range deps {
+			if props, ok := dep.([]interface{}); ok {
+				names, err := stringsOf(props)
+				if err != nil {
+					return fmt.Errorf("%v/dependencies: %v", n.path, err)
+				}
+				n.dependencies[name] = schemaDependency{properties: names}
+				continue
+			}
+			schema, err := sub("dependencies", name)
+			if err != nil {
+				return err
+			}
+			n.dependencies[name] = schemaDependency{schema: schema}
+		}
+	}
+
+	subschemas := map[string]**schemaNode{
+		"additionalItems":      &n.additionalItems,
+		"contains":             &n.contains,
+		"additionalProperties": &n.additionalProperties,
+		"propertyNames":        &n.propertyNames,
+		"not":                  &n.not,
+		"if":                   &n.condition,
+		"then":                 &n.ifThen,
+		"else":                 &n.ifElse,
+	}
+	for keyword, dst := range subschemas {
+		if _, ok := s[keyword]; ok {
+			if *dst, err = sub(keyword); err != nil {
+				return err
+			}
+		}
+	}
+	lists := map[string]*[]*schemaNode{
+		"allOf": &n.allOf,
+		"anyOf": &n.anyOf,
+		"oneOf": &n.oneOf,
+	}
+	for keyword, dst := range lists {
+		if _, ok := s[keyword]; !ok {
+			continue
+		}
+		list, ok := s[keyword].([]interface{})
+		if !ok || len(list) == 0 {
+			return fmt.Errorf("%v/%v: must be a non-empty array", n.path, keyword)
+		}
+		for i := range list {
+			schema, err := sub(keyword, strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+			*dst = append(*dst, schema)
+		}
+	}
+	return nil
+}
+
+// resolveRef compiles the schema referenced from the one at loc. The
+// reference is resolved against the base URI, it's either a schema
+// identified by $id or a document, local or remote, optionally
+// followed by a JSON pointer.
+func (c *schemaCompiler) resolveRef(loc schemaLocation, ref string) (*schemaNode, error) {
+	uri, err := resolveURI(c.baseAt(loc), ref)
+	if err != nil {
+		return nil, fmt.Errorf("$ref %q: %v", ref, err)
+	}
+	u, _ := url.Parse(uri)
+	pointer := u.Fragment
+	u.Fragment = ""
+	target, ok := c.ids[u.String()]
+	if !ok {
+		// the document itself, its $id may differ from the URI it's
+		// retrieved by
+		target = schemaLocation{doc: u.String()}
+		if _, err := c.doc(target.doc); err != nil {
+			return nil, fmt.Errorf("$ref %q: %v", ref, err)
+		}
+	}
+	// the ids of the document are known once it's loaded
+	if identified, ok := c.ids[uri]; ok {
+		return c.compileAt(identified.doc, identified.pointer)
+	}
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("$ref %q: no schema has this $id", ref)
+	}
+	return c.compileAt(target.doc, target.pointer+pointer)
+}
+
+func resolveJsonPointer(doc interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+	v := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch c := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = c[token]; !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("invalid index %q", token)
+			}
+			v = c[i]
+		default:
+			return nil, fmt.Errorf("%q not found", token)
+		}
+	}
+	return v, nil
+}
+
+func escapeJsonPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func stringsOf(v interface{}) ([]string, error) {
+	switch s := v.(type) {
+	case string:
+		return []string{s}, nil
+	case []interface{}:
+		res := make([]string, 0, len(s))
+		for _, e := range s {
+			str, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", jsonString(e))
+			}
+			res = append(res, str)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("%v is neither a string nor an array", jsonString(v))
+}
+
+func knownJsonType(name string) bool {
+	for _, t := range jsonTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validate appends violations of the value at instancePath to vs.
+func (n *schemaNode) validate(v interface{}, instancePath string, vs *[]schemaViolation) {
+	violate := func(keyword, format string, a ...interface{}) {
+		*vs = append(*vs, schemaViolation{
+			schemaPath:   n.path + "/" + keyword,
+			instancePath: instancePath,
+			message:      fmt.Sprintf(format, a...),
+		})
+	}
+	switch {
+	case n.always:
+		return
+	case n.never:
+		*vs = append(*vs, schemaViolation{
+			schemaPath:   n.path,
+			instancePath: instancePath,
+			message:      "no value is allowed",
+		})
+		return
+	case n.ref != nil:
+		n.ref.validate(v, instancePath, vs)
+		return
+	}
+
+	if len(n.types) > 0 && !schemaTypeMatches(n.types, v) {
+		violate("type", "%v is not %v", jsonType(v), strings.Join(n.types, " or "))
+	}
+	if n.enum != nil {
+		found := false
+		for _, e := range n.enum {
+			found = found || reflect.DeepEqual(v, e)
+		}
+		if !found {
+			violate("enum", "%v is not one of %v", excerpt(jsonString(v)),
+				excerpt(jsonString(n.enum)))
+		}
+	}
+	if n.constant != nil && !reflect.DeepEqual(v, *n.constant) {
+		violate("const", "%v is not %v", excerpt(jsonString(v)),
+			excerpt(jsonString(*n.constant)))
+	}
+
+	switch value := v.(type) {
+	case float64:
+		n.validateNumber(value, violate)
+	case string:
+		n.validateString(value, violate)
+	case []interface{}:
+		n.validateArray(value, instancePath, vs, violate)
+	case map[string]interface{}:
+		n.validateObject(value, instancePath, vs, violate)
+	}
+
+	for _, s := range n.allOf {
+		s.validate(v, instancePath, vs)
+	}
+	if n.anyOf != nil {
+		valid := false
+		for _, s := range n.anyOf {
+			valid = valid || s.valid(v)
+		}
+		if !valid {
+			violate("anyOf", "value doesn't match any of the schemas")
+		}
+	}
+	if n.oneOf != nil {
+		matched := 0
+		for _, s := range n.oneOf {
+			if s.valid(v) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			violate("oneOf", "value matches %v of the schemas instead of one", matched)
+		}
+	}
+	if n.not != nil && n.not.valid(v) {
+		violate("not", "value matches the schema it mustn't")
+	}
+	if n.condition != nil {
+		if n.condition.valid(v) {
+			if n.ifThen != nil {
+				n.ifThen.validate(v, instancePath, vs)
+			}
+		} else if n.ifElse != nil {
+			n.ifElse.validate(v, instancePath, vs)
+		}
+	}
+}
+
+func (n *schemaNode) valid(v interface{}) bool {
+	var vs []schemaViolation
+	n.validate(v, "", &vs)
+	return len(vs) == 0
+}
+
+type violateFunc func(keyword, format string, a ...interface{})
+
+func (n *schemaNode) validateNumber(v float64, violate violateFunc) {
+	if n.minimum != nil && v < *n.minimum {
+		violate("minimum", "%v is less than %v", v, *n.minimum)
+	}
+	if n.maximum != nil && v > *n.maximum {
+		violate("maximum", "%v is greater than %v", v, *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && v <= *n.exclusiveMinimum {
+		violate("exclusiveMinimum", "%v is not greater than %v", v, *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && v >= *n.exclusiveMaximum {
+		violate("exclusiveMaximum", "%v is not less than %v", v, *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil && *n.multipleOf > 0 {
+		q := v / *n.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			violate("multipleOf", "%v is not a multiple of %v", v, *n.multipleOf)
+		}
+	}
+}
+
+func (n *schemaNode) validateString(v string, violate violateFunc) {
+	length := utf8.RuneCountInString(v)
+	if n.minLength != nil && length < *n.minLength {
+		violate("minLength", "length %v is less than %v", length, *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		violate("maxLength", "length %v is greater than %v", length, *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(v) {
+		violate("pattern", "%q doesn't match %v", excerpt(v), n.pattern)
+	}
+	if n.format != "" && !formatMatches(n.format, v) {
+		violate("format", "%q is not %v", excerpt(v), n.format)
+	}
+}
+
+func (n *schemaNode) validateArray(
+	v []interface{}, instancePath string, vs *[]schemaViolation, violate violateFunc,
+) {
+	if n.minItems != nil && len(v) < *n.minItems {
+		violate("minItems", "%v items are less than %v", len(v), *n.minItems)
+	}
+	if n.maxItems != nil && len(v) > *n.maxItems {
+		violate("maxItems", "%v items are more than %v", len(v), *n.maxItems)
+	}
+	if n.uniqueItems {
+	unique:
+		for i := range v {
+			for j := i + 1; j < len(v); j++ {
+				if reflect.DeepEqual(v[i], v[j]) {
+					violate("uniqueItems", "items %v and %v are equal", i, j)
+					break unique
+				}
+			}
+		}
+	}
+	for i, item := range v {
+		path := instancePath + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case n.items != nil:
+			n.items.validate(item, path, vs)
+		case i < len(n.itemsList):
+			n.itemsList[i].validate(item, path, vs)
+		case n.itemsList != nil && n.additionalItems != nil:
+			n.additionalItems.validate(item, path, vs)
+		}
+	}
+	if n.contains != nil {
+		found := false
+		for _, item := range v {
+			found = found || n.contains.valid(item)
+		}
+		if !found {
+			violate("contains", "no item matches the schema")
+		}
+	}
+}
+
+func (n *schemaNode) validateObject(
+	v map[string]interface{}, instancePath string, vs *[]schemaViolation, violate violateFunc,
+) {
+	if n.minProperties != nil && len(v) < *n.minProperties {
+		violate("minProperties", "%v properties are less than %v", len(v), *n.minProperties)
+	}
+	if n.maxProperties != nil && len(v) > *n.maxProperties {
+		violate("maxProperties", "%v properties are more than %v", len(v), *n.maxProperties)
+	}
+	for _, name := range n.required {
+		if _, ok := v[name]; !ok {
+			violate("required", "property %q is missing", name)
+		}
+	}
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	// violations are reported in the same order for every response
+	sort.Strings(names)
+	for _, name := range names {
+		value, path := v[name], instancePath+"."+name
+		matched := false
+		if s, ok := n.properties[name]; ok {
+			s.validate(value, path, vs)
+			matched = true
+		}
+		for _, p := range n.patternProperties {
+			if p.re.MatchString(name) {
+				p.schema.validate(value, path, vs)
+				matched = true
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			if n.additionalProperties.never {
+				violate("additionalProperties", "property %q is not allowed", name)
+			} else {
+				n.additionalProperties.validate(value, path, vs)
+			}
+		}
+		if n.propertyNames != nil && !n.propertyNames.valid(name) {
+			violate("propertyNames", "property name %q is invalid", name)
+		}
+		if dep, ok := n.dependencies[name]; ok {
+			for _, required := range dep.properties {
+				if _, ok := v[required]; !ok {
+					violate("dependencies", "property %q requires %q", name, required)
+				}
+			}
+			if dep.schema != nil {
+				dep.schema.validate(v, instancePath, vs)
+			}
+		}
+	}
+}
+
+func schemaTypeMatches(types []string, v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if f, ok := v.(float64); ok && t == "integer" && f == math.Trunc(f) {
+			return true
+		}
+	}
+	return false
+}
+
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// formatMatches checks the common formats, the rest of them are only
+// annotations, as draft-07 allows.
+func formatMatches(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", v)
+		if err != nil {
+			_, err = time.Parse("15:04:05.999999999Z07:00", v)
+		}
+		return err == nil
+	case "email":
+		return emailRegexp.MatchString(v)
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil && !strings.Contains(v, ":")
+	case "ipv6":
+		return net.ParseIP(v) != nil && strings.Contains(v, ":")
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.IsAbs()
+	}
+	return true
+}
+
+func compileJsonSchemaAssertion(a assertion) (assertFunc, error) {
+	if a.expression == "" {
+		return nil, errEmptyAssertionExpression
+	}
+	schema, err := loadJsonSchema(a.expression)
+	if err != nil {
+		return nil, err
+	}
+	return func(resp *assertedResponse) assertResult {
+		data, err := resp.json()
+		if err != nil {
+			return failed("body is not JSON: %v", err).
+				because(invalidBody).withActual(string(resp.body))
+		}
+		var vs []schemaViolation
+		schema.validate(data, "$", &vs)
+		valid := len(vs) == 0
+		if valid == (a.condition == "VALID") {
+			return success
+		}
+		if valid {
+			return failed("body matches the schema %v", a.expression).
+				withActual(string(resp.body))
+		}
+		messages := make([]string, 0, maxReportedViolations)
+		for i := 0; i < len(vs) && i < maxReportedViolations; i++ {
+			messages = append(messages, vs[i].String())
+		}
+		if len(vs) > maxReportedViolations {
+			messages = append(messages, fmt.Sprintf("%v more",
+				len(vs)-maxReportedViolations))
+		}
+		r := failed("body violates the schema %v: %v", a.expression,
+			strings.Join(messages, "; ")).withActual(string(resp.body))
+		r.violations = vs
+		return r
+	}, nil
+}
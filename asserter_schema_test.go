@@ -0,0 +1,254 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSchemas(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestJsonSchemaAssertion(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"user.json": `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"type": "object",
+			"required": ["id", "name"],
+			"properties": {
+				"id": {"type": "integer", "minimum": 1},
+				"name": {"type": "string", "minLength": 1},
+				"email": {"type": "string", "format": "email"},
+				"role": {"enum": ["admin", "user"]},
+				"address": {"$ref": "defs.json#/definitions/address"},
+				"friends": {"type": "array", "items": {"$ref": "#"}}
+			},
+			"additionalProperties": false
+		}`,
+		"defs.json": `{
+			"definitions": {
+				"address": {
+					"type": "object",
+					"properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}}
+				}
+			}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+	a := assertion{
+		asserter:   "JsonSchema",
+		expression: filepath.Join(dir, "user.json"),
+	}
+	if err := checkAssertion(a); err != nil {
+		t.Fatal(err)
+	}
+	expectations := []struct {
+		body       string
+		successful bool
+		paths      []string
+	}{
+		{`{"id": 1, "name": "Ann"}`, true, nil},
+		{`{"id": 1, "name": "Ann", "email": "ann@example.com", "role": "admin",
+			"address": {"zip": "12345"},
+			"friends": [{"id": 2, "name": "Bob"}]}`, true, nil},
+		{`{"id": 0, "name": ""}`, false, []string{
+			"#/properties/id/minimum",
+			"#/properties/name/minLength",
+		}},
+		{`{"id": 1.5, "name": "Ann", "role": "root"}`, false, []string{
+			"#/properties/id/type",
+			"#/properties/role/enum",
+		}},
+		{`{"name": "Ann", "age": 30}`, false, []string{
+			"#/required",
+			"#/additionalProperties",
+		}},
+		{`{"id": 1, "name": "Ann", "address": {"zip": "1"}}`, false, []string{
+			"defs.json#/definitions/address/properties/zip/pattern",
+		}},
+		{`{"id": 1, "name": "Ann", "friends": [{"id": "2"}]}`, false, []string{
+			"#/required",
+			"#/properties/id/type",
+		}},
+	}
+	for _, e := range expectations {
+		r := assertOnce(t, &assertedResponse{body: []byte(e.body)}, a)
+		if r.successful != e.successful {
+			t.Errorf("%v: expected %v, but got %+v", e.body, e.successful, r)
+			continue
+		}
+		paths := make([]string, 0, len(r.violations))
+		for _, v := range r.violations {
+			paths = append(paths, v.schemaPath)
+		}
+		if strings.Join(paths, ",") != strings.Join(e.paths, ",") {
+			t.Errorf("%v: expected violations of %v, but got %v",
+				e.body, e.paths, r.violations)
+		}
+	}
+
+	r := assertOnce(t, &assertedResponse{body: []byte("<html>")}, a)
+	if r.successful || r.reason != invalidBody {
+		t.Errorf("expected %v, but got %+v", invalidBody, r)
+	}
+
+	a.condition = "INVALID"
+	r = assertOnce(t, &assertedResponse{body: []byte(`{"id": "1"}`)}, a)
+	if !r.successful {
+		t.Errorf("expected the body to be invalid, but got %+v", r)
+	}
+}
+
+func TestJsonSchemaAssertionShouldReportViolations(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"list.json": `{"type": "array", "items": {"type": "integer"}}`,
+	})
+	defer os.RemoveAll(dir)
+	a := assertion{
+		asserter:   "JsonSchema",
+		expression: filepath.Join(dir, "list.json"),
+	}
+	r := assertOnce(t, &assertedResponse{
+		body: []byte(`["a", "b", "c", "d", 5]`),
+	}, a)
+	if r.successful || len(r.violations) != 4 {
+		t.Fatalf("expected 4 violations, but got %+v", r)
+	}
+	if r.violations[1].instancePath != "$[1]" {
+		t.Errorf("expected $[1], but got %v", r.violations[1].instancePath)
+	}
+	if !strings.HasSuffix(r.errMsg, "; 1 more") {
+		t.Errorf("expected only some violations in %q", r.errMsg)
+	}
+
+	s := newAssertionStats([]assertion{a})
+	s.record(r)
+	s.record(r)
+	info := s.info(1)
+	if len(info[0].Violations) != 1 {
+		t.Fatalf("expected violations to be grouped, but got %+v", info[0].Violations)
+	}
+	v := info[0].Violations[0]
+	if v.SchemaPath != "#/items/type" || v.Count != 8 ||
+		!strings.HasPrefix(v.Example, "$[0]: ") {
+		t.Errorf("unexpected violations %+v", v)
+	}
+}
+
+func TestJsonSchemaShouldResolveIds(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/schemas/address.json" {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = rw.Write([]byte(`{"definitions": {
+				"zip": {"type": "string", "pattern": "^[0-9]{5}$"}
+			}}`))
+		}),
+	)
+	defer s.Close()
+	dir := writeSchemas(t, map[string]string{
+		"user.json": `{
+			"$id": "` + s.URL + `/schemas/user.json",
+			"type": "object",
+			"properties": {
+				"zip": {"$ref": "address.json#/definitions/zip"},
+				"name": {"$ref": "#name"},
+				"tags": {"$ref": "http://example.com/tags.json"}
+			},
+			"definitions": {
+				"name": {"$id": "#name", "type": "string"},
+				"tags": {
+					"$id": "http://example.com/tags.json",
+					"type": "array",
+					"items": {"$ref": "#/definitions/tag"},
+					"definitions": {"tag": {"type": "string"}}
+				}
+			}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+	schema, err := loadJsonSchema(filepath.Join(dir, "user.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectations := []struct {
+		body  string
+		paths []string
+	}{
+		{`{"zip": "12345", "name": "Ann", "tags": ["a"]}`, nil},
+		{`{"zip": "1"}`, []string{"address.json#/definitions/zip/pattern"}},
+		{`{"name": 1}`, []string{"#/definitions/name/type"}},
+		{`{"tags": [1]}`, []string{"#/definitions/tags/definitions/tag/type"}},
+	}
+	for _, e := range expectations {
+		var vs []schemaViolation
+		data, err := (&assertedResponse{body: []byte(e.body)}).json()
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema.validate(data, "$", &vs)
+		paths := make([]string, 0, len(vs))
+		for _, v := range vs {
+			paths = append(paths, v.schemaPath)
+		}
+		if strings.Join(paths, ",") != strings.Join(e.paths, ",") {
+			t.Errorf("%v: expected violations of %v, but got %v", e.body, e.paths, vs)
+		}
+	}
+
+	dir = writeSchemas(t, map[string]string{
+		"absent.json": `{"$ref": "` + s.URL + `/schemas/absent.json"}`,
+		"data.json":   `{"allOf": [{"enum": [{"$id": "#data"}]}, {"$ref": "#data"}]}`,
+	})
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"absent.json", "data.json"} {
+		if _, err := loadJsonSchema(filepath.Join(dir, f)); err == nil {
+			t.Errorf("%v: expected an error", f)
+		}
+	}
+}
+
+func TestLoadJsonSchemaShouldRejectInvalidSchemas(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"remote.json":  `{"$ref": "ftp://example.com/schema.json"}`,
+		"missing.json": `{"$ref": "nowhere.json"}`,
+		"pointer.json": `{"$ref": "#/definitions/nothing"}`,
+		"type.json":    `{"type": "integer-ish"}`,
+		"pattern.json": `{"pattern": "[a-"}`,
+		"broken.json":  `{"type": `,
+		"cycle.json":   `{"definitions": {"a": {"allOf": [{"$ref": "#"}]}}, "$ref": "#/definitions/a"}`,
+		"tree.json":    `{"properties": {"children": {"items": {"$ref": "#"}}}}`,
+	})
+	defer os.RemoveAll(dir)
+	files := []string{
+		"remote.json", "missing.json", "pointer.json", "type.json",
+		"pattern.json", "broken.json", "absent.json", "cycle.json",
+	}
+	for _, f := range files {
+		if _, err := loadJsonSchema(filepath.Join(dir, f)); err == nil {
+			t.Errorf("%v: expected an error", f)
+		}
+	}
+	if _, err := loadJsonSchema(filepath.Join(dir, "tree.json")); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_jsonPathAssert(t *testing.T) {
@@ -29,7 +30,7 @@ func Test_jsonPathAssert(t *testing.T) {
 		}, {
 			name: "Is null",
 			args: args{
-				data: []byte("{\"user\": {\"name\":\"Tom\"}}"),
+				data: []byte("{\"user\": {\"name\":\"Tom\"}, \"age\": null}"),
 				assertion: assertion{
 					asserter:   "JsonPath",
 					expression: "$.age",
@@ -93,9 +94,482 @@ func Test_jsonPathAssert(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := jsonPathAssert(tt.args.data, tt.args.assertion); !reflect.DeepEqual(got, tt.want) {
+			got := assertOnce(t, &assertedResponse{body: tt.args.data}, tt.args.assertion)
+			if got.successful != tt.want.successful {
 				t.Errorf("jsonPathAssert() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func assertOnce(t *testing.T, resp *assertedResponse, assertions ...assertion) assertResult {
+	t.Helper()
+	p, err := compileAssertions(assertions, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.assert(resp).first()
+}
+
+func TestAsserters(t *testing.T) {
+	resp := &assertedResponse{
+		code: 201,
+		header: func(name string) (string, bool) {
+			if name == "Content-Type" {
+				return "application/json; charset=utf-8", true
+			}
+			return "", false
+		},
+		body: []byte(`{"id": 42, "status": "created"}`),
+		took: 120 * time.Millisecond,
+	}
+	expectations := []struct {
+		assertion  assertion
+		successful bool
+	}{
+		{assertion{asserter: "StatusCode", expected: "201"}, true},
+		{assertion{asserter: "StatusCode", expected: "200"}, false},
+		{assertion{asserter: "StatusCode", condition: "IN", expected: "200, 201"}, true},
+		{assertion{asserter: "StatusCode", condition: "RANGE", expected: "2xx"}, true},
+		{assertion{asserter: "StatusCode", condition: "RANGE", expected: "202-299"}, false},
+		{assertion{asserter: "Header", expression: "Content-Type"}, true},
+		{assertion{asserter: "Header", expression: "Location"}, false},
+		{assertion{asserter: "Header", expression: "Location", condition: "NOT_EXISTS"}, true},
+		{assertion{asserter: "Header", expression: "Content-Type",
+			condition: "EQUAL", expected: "application/json"}, false},
+		{assertion{asserter: "Header", expression: "Content-Type",
+			condition: "CONTAINS", expected: "json"}, true},
+		{assertion{asserter: "Header", expression: "Content-Type",
+			condition: "MATCHES", expected: "^application/(json|xml)"}, true},
+		{assertion{asserter: "BodyContains", expected: `"created"`}, true},
+		{assertion{asserter: "BodyContains", condition: "NOT_CONTAINS", expected: "error"}, true},
+		{assertion{asserter: "BodyContains", expected: "error"}, false},
+		{assertion{asserter: "BodyRegex", expected: `"id":\s*\d+`}, true},
+		{assertion{asserter: "BodyRegex", condition: "NOT_MATCHES", expected: `"id"`}, false},
+		{assertion{asserter: "BodySize", expected: "31"}, true},
+		{assertion{asserter: "BodySize", condition: "GT", expected: "31"}, false},
+		{assertion{asserter: "BodySize", condition: "EQUAL", expected: "31"}, true},
+		{assertion{asserter: "ResponseTime", expected: "200ms"}, true},
+		{assertion{asserter: "ResponseTime", condition: "LT", expected: "100ms"}, false},
+		{assertion{asserter: "ResponseTime", condition: "GTE", expected: "120ms"}, true},
+	}
+	for _, e := range expectations {
+		if err := checkAssertion(e.assertion); err != nil {
+			t.Errorf("%+v: %v", e.assertion, err)
+			continue
+		}
+		r := assertOnce(t, resp, e.assertion)
+		if r.successful != e.successful {
+			t.Errorf("%+v: expected %v, but got %+v",
+				e.assertion, e.successful, r)
+		}
+		if !r.successful && r.errMsg == "" {
+			t.Errorf("%+v: failure is not explained", e.assertion)
+		}
+	}
+}
+
+func TestCheckAssertion(t *testing.T) {
+	invalid := []assertion{
+		{asserter: "Status"},
+		{asserter: "JsonPath", expression: "$.id"},
+		{asserter: "JsonPath", condition: "NOT_NULL"},
+		{asserter: "JsonPath", expression: "id", condition: "NOT_NULL"},
+		{asserter: "JsonPath", expression: "$.ids[a]", condition: "NOT_NULL"},
+		{asserter: "StatusCode", condition: "BETWEEN", expected: "200"},
+		{asserter: "StatusCode", expected: "OK"},
+		{asserter: "StatusCode", condition: "RANGE", expected: "299-200"},
+		{asserter: "StatusCode", condition: "IN", expected: "200,,201"},
+		{asserter: "Header", condition: "EXISTS"},
+		{asserter: "Header", expression: "Location", condition: "MATCHES", expected: "("},
+		{asserter: "BodyContains"},
+		{asserter: "BodyRegex", expected: "[a-"},
+		{asserter: "BodySize", expected: "-1"},
+		{asserter: "ResponseTime", expected: "300"},
+		{asserter: "ResponseTime", condition: "EQUAL", expected: "300ms"},
+		{asserter: "JsonSchema"},
+		{asserter: "JsonSchema", expression: "no-such-schema.json"},
+		{asserter: "XPath", condition: "EXISTS"},
+		{asserter: "XPath", expression: "//a[", condition: "EXISTS"},
+		{asserter: "XPath", expression: "//a", condition: "COUNT", expected: "many"},
+		{asserter: "XPath", expression: "//a", condition: "MATCHES", expected: "("},
+		{asserter: "HtmlSelector", condition: "EXISTS"},
+		{asserter: "HtmlSelector", condition: "EXISTS", expression: "a:hover"},
+	}
+	for _, a := range invalid {
+		if err := checkAssertion(a); err == nil {
+			t.Errorf("%+v: expected an error", a)
+		}
+	}
+}
+
+func TestAssertionsListSet(t *testing.T) {
+	expectations := []struct {
+		in  string
+		out assertion
+	}{
+		{"StatusCode 201", assertion{asserter: "StatusCode", expected: "201"}},
+		{"StatusCode RANGE 2xx",
+			assertion{asserter: "StatusCode", condition: "RANGE", expected: "2xx"}},
+		{"Header:Content-Type", assertion{asserter: "Header", expression: "Content-Type"}},
+		{" JsonPath:$.user.name  EQUAL  Tom Smith ", assertion{
+			asserter: "JsonPath", expression: "$.user.name",
+			condition: "EQUAL", expected: "Tom Smith",
+		}},
+		{"BodyContains EQUAL", assertion{asserter: "BodyContains", expected: "EQUAL"}},
+		{"XPath://a[@title='a b'] EQUAL x ] y", assertion{
+			asserter: "XPath", expression: "//a[@title='a b']",
+			condition: "EQUAL", expected: "x ] y",
+		}},
+		{`HtmlSelector:"#main > li a" NOT_EXISTS`, assertion{
+			asserter: "HtmlSelector", expression: "#main > li a",
+			condition: "NOT_EXISTS",
+		}},
+		{"JsonPath:$.a[?(@.b == 1)]", assertion{
+			asserter: "JsonPath", expression: "$.a[?(@.b == 1)]",
+		}},
+		{"[user id] JsonPath:$.id NOT_NULL", assertion{
+			name: "user id", asserter: "JsonPath", expression: "$.id",
+			condition: "NOT_NULL",
+		}},
+		{"soft ResponseTime 200ms", assertion{
+			asserter: "ResponseTime", expected: "200ms", severity: softSeverity,
+		}},
+		{"[up] abort:10 StatusCode 200", assertion{
+			name: "up", asserter: "StatusCode", expected: "200",
+			severity: abortSeverity, abortAfter: 10,
+		}},
+		{"abort not(down)", assertion{
+			group: "not", members: []assertion{{ref: "down"}},
+			severity: abortSeverity, abortAfter: 1,
+		}},
+		{"[either] anyOf(allOf(ok, has data), allOf( not found ,error ) )", assertion{
+			name: "either", group: "anyOf", members: []assertion{
+				{group: "allOf", members: []assertion{{ref: "ok"}, {ref: "has data"}}},
+				{group: "allOf", members: []assertion{{ref: "not found"}, {ref: "error"}}},
+			},
+		}},
+	}
+	for _, e := range expectations {
+		var l assertionsList
+		if err := l.Set(e.in); err != nil {
+			t.Errorf("%q: %v", e.in, err)
+			continue
+		}
+		if len(l) != 1 || !reflect.DeepEqual(l[0], e.out) {
+			t.Errorf("%q: expected %+v, but got %+v", e.in, e.out, l)
+		}
+	}
+	invalid := []string{
+		"  ", "[] StatusCode 200", "[ok StatusCode 200", "soft",
+		"anyOf(ok", "anyOf(ok,)", "allOf(ok) StatusCode 200", "not()",
+		"anyOf(ok, other(a))",
+	}
+	for _, in := range invalid {
+		var l assertionsList
+		if err := l.Set(in); err != errInvalidAssertionFormat {
+			t.Errorf("%q: expected %v, but got %v", in, errInvalidAssertionFormat, err)
+		}
+	}
+}
+
+func TestAssertionsListSetShouldRejectInvalidSeverities(t *testing.T) {
+	for _, in := range []string{"abort:0 StatusCode 200", "abort:x StatusCode 200"} {
+		var l assertionsList
+		if err := l.Set(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestJsonPathConditions(t *testing.T) {
+	data := []byte(`{
+		"id": 42, "price": "9.99", "name": "Tom", "vip": true, "note": null,
+		"tags": ["a", "b"], "roles": [{"name": "admin"}], "address": {"city": "Oslo"}
+	}`)
+	expectations := []struct {
+		expression, condition, expected string
+		successful                      bool
+	}{
+		{"$.id", "EQUAL", "42.0", true},
+		{"$.vip", "EQUAL", "true", true},
+		{"$.vip", "EQUAL", "1", true},
+		{"$.vip", "EQUAL", "false", false},
+		{"$.note", "EQUAL", "null", true},
+		{"$.note", "NULL", "", true},
+		{"$.missing", "NULL", "", false},
+		{"$.missing", "NOT_NULL", "", false},
+		{"$.address", "EQUAL", `{"city": "Oslo"}`, true},
+		{"$.tags", "EQUAL", `["b", "a"]`, false},
+		{"$.name", "NOT_EQUAL", "Ann", true},
+		{"$.missing", "NOT_EQUAL", "Ann", false},
+		{"$.id", "GT", "41", true},
+		{"$.id", "LTE", "41.5", false},
+		{"$.price", "LT", "10", true},
+		{"$.name", "GT", "1", false},
+		{"$.tags", "CONTAINS", "b", true},
+		{"$.name", "CONTAINS", "o", true},
+		{"$.address", "CONTAINS", "city", true},
+		{"$.roles", "CONTAINS", `{"name": "admin"}`, true},
+		{"$.name", "MATCHES", "^T.m$", true},
+		{"$.id", "MATCHES", `^\d+$`, true},
+		{"$.name", "IN", "Ann, Tom", true},
+		{"$.id", "IN", `[1, 42]`, true},
+		{"$.id", "IN", "1,2", false},
+		{"$.tags", "LENGTH_EQ", "2", true},
+		{"$.name", "LENGTH_GT", "3", false},
+		{"$.address", "LENGTH_EQ", "1", true},
+		{"$.id", "LENGTH_EQ", "2", false},
+		{"$.id", "IS_TYPE", "number", true},
+		{"$.note", "IS_TYPE", "null", true},
+		{"$.missing", "IS_TYPE", "null", false},
+		{"$.roles", "IS_TYPE", "array", true},
+		{"$.address", "IS_TYPE", "object", true},
+		{"$.vip", "IS_TYPE", "string", false},
+	}
+	for _, e := range expectations {
+		a := assertion{
+			asserter:   "JsonPath",
+			expression: e.expression,
+			condition:  e.condition,
+			expected:   e.expected,
+		}
+		if err := checkAssertion(a); err != nil {
+			t.Errorf("%+v: %v", a, err)
+			continue
+		}
+		resp := &assertedResponse{body: data}
+		if r := assertOnce(t, resp, a); r.successful != e.successful {
+			t.Errorf("%v %v %v: expected %v, but got %v", e.expression,
+				e.condition, e.expected, e.successful, r.successful)
+		}
+	}
+
+	missing := assertion{asserter: "JsonPath", expression: "$.missing", condition: "NULL"}
+	if r := assertOnce(t, &assertedResponse{body: data}, missing); r.reason != missingValue {
+		t.Errorf("Expected a missing value to fail NULL as %v, but got %+v",
+			missingValue, r)
+	}
+
+	invalid := []assertion{
+		{asserter: "JsonPath", expression: "$.id", condition: "GT", expected: "ten"},
+		{asserter: "JsonPath", expression: "$.id", condition: "MATCHES", expected: "("},
+		{asserter: "JsonPath", expression: "$.id", condition: "IN", expected: "[1,"},
+		{asserter: "JsonPath", expression: "$.id", condition: "LENGTH_GT", expected: "-1"},
+		{asserter: "JsonPath", expression: "$.id", condition: "IS_TYPE", expected: "int"},
+	}
+	for _, a := range invalid {
+		if err := checkAssertion(a); err == nil {
+			t.Errorf("%+v: expected an error", a)
+		}
+	}
+}
+
+func TestAssertThatShouldRenderExpectedValues(t *testing.T) {
+	a := []assertion{{
+		asserter:   "JsonPath",
+		expression: "$.id",
+		condition:  "EQUAL",
+		expected:   "${id}",
+	}}
+	if err := checkAssertion(a[0]); err != nil {
+		t.Fatal(err)
+	}
+	resp := &assertedResponse{
+		body: []byte(`{"id": 7}`),
+		vars: newVars(rowOf(map[string]string{"id": "7"}), nil, 0),
+	}
+	if r := assertOnce(t, resp, a...); !r.successful {
+		t.Errorf("Expected success, but got %+v", r)
+	}
+	resp = &assertedResponse{
+		body: []byte(`{"id": 7}`),
+		vars: newVars(rowOf(map[string]string{"id": "8"}), nil, 0),
+	}
+	if r := assertOnce(t, resp, a...); r.successful {
+		t.Error("Expected failure")
+	}
+}
+
+func TestAssertionsShouldUnescapePlaceholders(t *testing.T) {
+	resp := &assertedResponse{body: []byte("Hello, ${name}")}
+	a := assertion{asserter: "BodyContains", expected: "$${name}"}
+	if r := assertOnce(t, resp, a); !r.successful {
+		t.Errorf("Expected success, but got %+v", r)
+	}
+}
+
+func TestAssertedResponseShouldParseBodyOnce(t *testing.T) {
+	resp := &assertedResponse{body: []byte(`{"id": 1}`)}
+	a := []assertion{
+		{asserter: "JsonPath", expression: "$.id", condition: "EQUAL", expected: "1"},
+		{asserter: "JsonPath", expression: "$.id", condition: "IS_TYPE", expected: "number"},
+	}
+	if r := assertOnce(t, resp, a...); !r.successful {
+		t.Fatalf("Expected success, but got %+v", r)
+	}
+	resp.body = []byte("not JSON")
+	if r := assertOnce(t, resp, a...); !r.successful {
+		t.Errorf("Expected the parsed body to be reused, but got %+v", r)
+	}
+}
+
+func TestAssertionGroups(t *testing.T) {
+	assertions := []assertion{
+		{name: "ok", asserter: "StatusCode", expected: "200"},
+		{name: "has data", asserter: "JsonPath", expression: "$.data",
+			condition: "NOT_NULL"},
+		{name: "not found", asserter: "StatusCode", expected: "404"},
+		{name: "error code", asserter: "JsonPath", expression: "$.error",
+			condition: "EQUAL", expected: "E42"},
+		{name: "either", group: "anyOf", members: []assertion{
+			{group: "allOf", members: []assertion{{ref: "ok"}, {ref: "has data"}}},
+			{group: "allOf", members: []assertion{{ref: "not found"}, {ref: "error code"}}},
+		}},
+		{group: "not", members: []assertion{
+			{asserter: "BodyContains", expected: "panic"},
+		}},
+	}
+	p, err := compileAssertions(assertions, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, a := range p.list() {
+		names = append(names, a.displayName())
+	}
+	expectedNames := []string{"either", "not(BodyContains panic)"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected %v to be checked, but got %v", expectedNames, names)
+	}
+	expectations := []struct {
+		code       int
+		body       string
+		successful bool
+	}{
+		{200, `{"data": []}`, true},
+		{404, `{"error": "E42"}`, true},
+		{200, `{"error": "E42"}`, false},
+		{404, `{"data": []}`, false},
+		{500, `{"error": "E42"}`, false},
+		{200, `{"data": "panic"}`, false},
+	}
+	for _, e := range expectations {
+		r := p.assert(&assertedResponse{code: e.code, body: []byte(e.body)})
+		if r.successful() != e.successful {
+			t.Errorf("%v %v: expected %v, but got %+v", e.code, e.body,
+				e.successful, r)
+		}
+	}
+	r := p.assert(&assertedResponse{code: 500, body: []byte("{}")}).first()
+	expected := "none of either passed: " +
+		"allOf(ok, has data): ok: status code 500 doesn't match EQUAL 200; " +
+		"allOf(not found, error code): not found: status code 500 doesn't match EQUAL 404"
+	if r.errMsg != expected {
+		t.Errorf("Expected %q, but got %q", expected, r.errMsg)
+	}
+}
+
+func TestResolveAssertionsShouldRejectInvalidGroups(t *testing.T) {
+	ok := assertion{name: "ok", asserter: "StatusCode", expected: "200"}
+	invalid := [][]assertion{
+		{{group: "allOf", members: []assertion{{ref: "missing"}}}},
+		{{ref: "ok"}, ok},
+		{ok, {name: "loop", group: "allOf", members: []assertion{{ref: "ok"}, {ref: "loop"}}}},
+		{
+			{name: "a", group: "not", members: []assertion{{ref: "b"}}},
+			{name: "b", group: "not", members: []assertion{{ref: "a"}}},
+		},
+	}
+	for _, assertions := range invalid {
+		if _, err := compileAssertions(assertions, 1); err == nil {
+			t.Errorf("%+v: expected an error", assertions)
+		}
+	}
+	uncompilable := [][]assertion{
+		{ok, {group: "not", members: []assertion{{ref: "ok"}, {ref: "ok"}}}},
+		{{group: "anyOf"}},
+		{{group: "oneOf", members: []assertion{ok}}},
+		{{group: "allOf", asserter: "StatusCode", members: []assertion{ok}}},
+		{{name: "soft", severity: softSeverity, asserter: "StatusCode", expected: "200"},
+			{group: "allOf", members: []assertion{{ref: "soft"}}}},
+	}
+	for _, assertions := range uncompilable {
+		if _, err := compileAssertions(assertions, 1); err == nil {
+			t.Errorf("%+v: expected an error", assertions)
+		}
+	}
+}
+
+func TestSoftAssertionsShouldNotFailResponses(t *testing.T) {
+	p, err := compileAssertions([]assertion{
+		{asserter: "ResponseTime", expected: "100ms", severity: softSeverity},
+		{asserter: "StatusCode", expected: "200"},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := p.assert(&assertedResponse{code: 200, took: time.Second})
+	if !r.successful() || len(r) != 1 || r.first().assertion != 0 {
+		t.Errorf("Expected a soft failure only, but got %+v", r)
+	}
+	r = p.assert(&assertedResponse{code: 500, took: time.Second})
+	if r.successful() || len(r) != 2 || r.first().assertion != 1 {
+		t.Errorf("Expected the hard failure first, but got %+v", r)
+	}
+}
+
+func TestAssertionPlanSampling(t *testing.T) {
+	for _, sample := range []float64{0, -0.5, 1.5} {
+		if _, err := compileAssertions(nil, sample); err != errInvalidAssertSample {
+			t.Errorf("%v: expected %v, but got %v", sample, errInvalidAssertSample, err)
+		}
+	}
+	expectations := []struct {
+		sample   float64
+		asserted []bool
+	}{
+		{1, []bool{true, true, true, true}},
+		{0.5, []bool{true, false, true, false}},
+		{0.25, []bool{true, false, false, false, true, false, false, false}},
+		{0.4, []bool{true, false, true, false, false, true, false, true, false, false}},
+	}
+	for _, e := range expectations {
+		p, err := compileAssertions([]assertion{
+			{asserter: "StatusCode", expected: "200"},
+		}, e.sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asserted := make([]bool, 0, len(e.asserted))
+		for range e.asserted {
+			asserted = append(asserted, p.sampled())
+		}
+		if !reflect.DeepEqual(asserted, e.asserted) {
+			t.Errorf("%v: expected %v, but got %v", e.sample, e.asserted, asserted)
+		}
+		if scale := p.scale(); scale != 1/e.sample {
+			t.Errorf("%v: expected scale %v, but got %v", e.sample, 1/e.sample, scale)
+		}
+	}
+}
+
+func BenchmarkAssertionPlan(b *testing.B) {
+	p, err := compileAssertions([]assertion{
+		{asserter: "StatusCode", condition: "RANGE", expected: "2xx"},
+		{asserter: "JsonPath", expression: "$.user.id", condition: "GT", expected: "0"},
+		{asserter: "JsonPath", expression: "$.user.name", condition: "MATCHES", expected: "^[A-Z]"},
+		{asserter: "JsonPath", expression: "$.user.roles", condition: "CONTAINS", expected: "admin"},
+	}, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	body := []byte(`{"user": {"id": 42, "name": "Tom", "roles": ["admin", "dev"]}}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if r := p.assert(&assertedResponse{code: 200, body: body}); !r.successful() {
+			b.Fatal(r.first().errMsg)
+		}
+	}
+}
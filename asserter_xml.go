@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+var xpathConditions = []string{
+	"EXISTS", "NOT_EXISTS", "EQUAL", "CONTAINS", "MATCHES", "COUNT",
+}
+
+type xmlNodeKind int
+
+const (
+	xmlDocument xmlNodeKind = iota
+	xmlElement
+	xmlAttribute
+	xmlText
+)
+
+// xmlNode is a node of the parsed XML document. Names are local, that
+// is namespace prefixes are dropped.
+type xmlNode struct {
+	kind     xmlNodeKind
+	name     string
+	value    string
+	parent   *xmlNode
+	attrs    []*xmlNode
+	children []*xmlNode
+}
+
+func parseXML(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{kind: xmlDocument}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// the encoding is declared by the document, e.g. ISO-8859-1
+	d.CharsetReader = charset.NewReaderLabel
+	current, root := doc, false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == doc {
+				if root {
+					return nil, errors.New("more than one root element")
+				}
+				root = true
+			}
+			e := &xmlNode{kind: xmlElement, name: t.Name.Local, parent: current}
+			for _, a := range t.Attr {
+				e.attrs = append(e.attrs, &xmlNode{
+					kind:   xmlAttribute,
+					name:   a.Name.Local,
+					value:  a.Value,
+					parent: e,
+				})
+			}
+			current.children = append(current.children, e)
+			current = e
+		case xml.EndElement:
+			current = current.parent
+		case xml.CharData:
+			if current != doc {
+				current.children = append(current.children, &xmlNode{
+					kind:   xmlText,
+					value:  string(t),
+					parent: current,
+				})
+			}
+		}
+	}
+	if !root {
+		return nil, errors.New("no root element")
+	}
+	return doc, nil
+}
+
+// text returns the string value of the node, which is the text of all
+// its descendants for elements.
+func (n *xmlNode) text() string {
+	if n.kind == xmlAttribute || n.kind == xmlText {
+		return n.value
+	}
+	var b strings.Builder
+	var visit func(n *xmlNode)
+	visit = func(n *xmlNode) {
+		for _, c := range n.children {
+			if c.kind == xmlText {
+				b.WriteString(c.value)
+			} else {
+				visit(c)
+			}
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+// xpath is a compiled location path. Only a subset of XPath 1.0 is
+// supported:
+//
+//	/a/b, //b, a//b, ., .., *, @attr, @*, text()
+//
+// with predicates [n], [last()], [@attr], [name] and comparisons like
+// [@attr='v'], [name!='v'] or [text()='v']. Relative paths start at the
+// document as well.
+type xpath struct {
+	steps []xpathStep
+}
+
+type xpathAxis int
+
+const (
+	childAxis xpathAxis = iota
+	descendantAxis
+	attributeAxis
+	selfAxis
+	parentAxis
+)
+
+type xpathStep struct {
+	axis xpathAxis
+	// name is * for any name, text() selects text nodes
+	name       string
+	predicates []xpathPredicate
+}
+
+type xpathPredicate struct {
+	// position is 1-based, -1 stands for last()
+	position int
+	// operand is @attr, a child element name, text() or .
+	operand  string
+	operator string
+	literal  string
+}
+
+var xpathNameRegexp = regexp.MustCompile(`^(\*|[\p{L}_][\p{L}\p{N}_.\-]*(:[\p{L}_][\p{L}\p{N}_.\-]*)?)`)
+
+func compileXPath(expr string) (*xpath, error) {
+	p := &xpath{}
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return nil, errEmptyAssertionExpression
+	}
+	invalid := func() (*xpath, error) {
+		return nil, fmt.Errorf("Unsupported XPath %q", expr)
+	}
+	axis := childAxis
+	switch {
+	case strings.HasPrefix(rest, "//"):
+		axis, rest = descendantAxis, rest[2:]
+	case strings.HasPrefix(rest, "/"):
+		rest = rest[1:]
+	}
+	for {
+		step := xpathStep{axis: axis}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.axis, rest = parentAxis, rest[2:]
+		case strings.HasPrefix(rest, "."):
+			step.axis, rest = selfAxis, rest[1:]
+		case strings.HasPrefix(rest, "text()"):
+			step.name, rest = "text()", rest[len("text()"):]
+		default:
+			if strings.HasPrefix(rest, "@") {
+				if axis == descendantAxis {
+					return invalid()
+				}
+				step.axis, rest = attributeAxis, rest[1:]
+			}
+			name := xpathNameRegexp.FindString(rest)
+			if name == "" {
+				return invalid()
+			}
+			step.name, rest = localName(name), rest[len(name):]
+		}
+		for strings.HasPrefix(rest, "[") {
+			end := indexUnquoted(rest, "]")
+			if end < 0 {
+				return invalid()
+			}
+			pred, err := compileXPathPredicate(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("Unsupported XPath %q: %v", expr, err)
+			}
+			step.predicates = append(step.predicates, pred)
+			rest = rest[end+1:]
+		}
+		p.steps = append(p.steps, step)
+		switch {
+		case rest == "":
+			return p, nil
+		case strings.HasPrefix(rest, "//"):
+			axis, rest = descendantAxis, rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			axis, rest = childAxis, rest[1:]
+		default:
+			return invalid()
+		}
+	}
+}
+
+func compileXPathPredicate(s string) (xpathPredicate, error) {
+	s = strings.TrimSpace(s)
+	if s == "last()" {
+		return xpathPredicate{position: -1}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return xpathPredicate{}, fmt.Errorf("invalid position %v", n)
+		}
+		return xpathPredicate{position: n}, nil
+	}
+	pred := xpathPredicate{operand: s}
+	if i := indexUnquoted(s, "="); i >= 0 {
+		op := "="
+		if i > 0 && s[i-1] == '!' {
+			op, i = "!=", i-1
+		}
+		literal := strings.TrimSpace(s[i+len(op):])
+		if len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') &&
+			strings.IndexByte(literal[1:], literal[0]) == len(literal)-2 {
+			literal = literal[1 : len(literal)-1]
+		} else if _, err := strconv.ParseFloat(literal, 64); err != nil {
+			return xpathPredicate{}, fmt.Errorf("invalid literal %v", literal)
+		}
+		pred.operand = strings.TrimSpace(s[:i])
+		pred.operator, pred.literal = op, literal
+	}
+	operand := strings.TrimPrefix(pred.operand, "@")
+	if pred.operand != "." && pred.operand != "text()" &&
+		xpathNameRegexp.FindString(operand) != operand {
+		return xpathPredicate{}, fmt.Errorf("invalid predicate %v", s)
+	}
+	if strings.HasPrefix(pred.operand, "@") {
+		pred.operand = "@" + localName(operand)
+	} else if pred.operand != "." && pred.operand != "text()" {
+		pred.operand = localName(operand)
+	}
+	return pred, nil
+}
+
+// indexUnquoted returns the index of the first sep in s outside of
+// the literals quoted with ' or ", or -1 if there is none.
+func indexUnquoted(s, sep string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case strings.HasPrefix(s[i:], sep):
+			return i
+		}
+	}
+	return -1
+}
+
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// selectFrom returns the nodes the path selects in document order.
+func (p *xpath) selectFrom(doc *xmlNode) []*xmlNode {
+	nodes := []*xmlNode{doc}
+	for _, step := range p.steps {
+		var next []*xmlNode
+		seen := map[*xmlNode]bool{}
+		for _, n := range nodes {
+			for _, c := range step.apply(n) {
+				if !seen[c] {
+					seen[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s *xpathStep) apply(n *xmlNode) []*xmlNode {
+	var candidates []*xmlNode
+	switch s.axis {
+	case selfAxis:
+		candidates = []*xmlNode{n}
+	case parentAxis:
+		if n.parent != nil {
+			candidates = []*xmlNode{n.parent}
+		}
+	case attributeAxis:
+		for _, a := range n.attrs {
+			if s.name == "*" || a.name == s.name {
+				candidates = append(candidates, a)
+			}
+		}
+	case childAxis:
+		for _, c := range n.children {
+			if s.matches(c) {
+				candidates = append(candidates, c)
+			}
+		}
+	case descendantAxis:
+		// descendant-or-self::node()/child::name, so that //b[1]
+		// selects the first b of each parent
+		var visit func(n *xmlNode)
+		visit = func(n *xmlNode) {
+			var children []*xmlNode
+			for _, c := range n.children {
+				if s.matches(c) {
+					children = append(children, c)
+				}
+			}
+			candidates = append(candidates, s.filter(children)...)
+			for _, c := range n.children {
+				if c.kind == xmlElement {
+					visit(c)
+				}
+			}
+		}
+		visit(n)
+		return candidates
+	}
+	return s.filter(candidates)
+}
+
+func (s *xpathStep) matches(n *xmlNode) bool {
+	if s.name == "text()" {
+		return n.kind == xmlText
+	}
+	return n.kind == xmlElement && (s.name == "*" || n.name == s.name)
+}
+
+func (s *xpathStep) filter(nodes []*xmlNode) []*xmlNode {
+	for _, pred := range s.predicates {
+		var res []*xmlNode
+		for i, n := range nodes {
+			if pred.matches(n, i+1, len(nodes)) {
+				res = append(res, n)
+			}
+		}
+		nodes = res
+	}
+	return nodes
+}
+
+func (p *xpathPredicate) matches(n *xmlNode, position, size int) bool {
+	switch {
+	case p.position == -1:
+		return position == size
+	case p.position > 0:
+		return position == p.position
+	}
+	var values []string
+	switch {
+	case p.operand == ".":
+		values = []string{n.text()}
+	case p.operand == "text()":
+		for _, c := range n.children {
+			if c.kind == xmlText {
+				values = append(values, c.value)
+			}
+		}
+	case strings.HasPrefix(p.operand, "@"):
+		for _, a := range n.attrs {
+			if a.name == p.operand[1:] {
+				values = append(values, a.value)
+			}
+		}
+	default:
+		for _, c := range n.children {
+			if c.kind == xmlElement && c.name == p.operand {
+				values = append(values, c.text())
+			}
+		}
+	}
+	if p.operator == "" {
+		return len(values) > 0
+	}
+	// comparisons are true if any of the values satisfies them
+	for _, v := range values {
+		if (strings.TrimSpace(v) == p.literal) == (p.operator == "=") {
+			return true
+		}
+	}
+	return false
+}
+
+func checkXPathExpected(condition, expected string) (func(string) bool, error) {
+	switch condition {
+	case "EQUAL":
+		return func(v string) bool {
+			return v == expected
+		}, nil
+	case "CONTAINS":
+		return func(v string) bool {
+			return strings.Contains(v, expected)
+		}, nil
+	case "MATCHES":
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case "COUNT":
+		if n, err := strconv.Atoi(expected); err != nil || n < 0 {
+			return nil, fmt.Errorf("COUNT requires a number of nodes, but got %q",
+				expected)
+		}
+	}
+	return nil, nil
+}
+
+func compileXPathAssertion(a assertion) (assertFunc, error) {
+	path, err := compileXPath(a.expression)
+	if err != nil {
+		return nil, err
+	}
+	return withExpected(a, func(expected string) (assertFunc, error) {
+		matches, err := checkXPathExpected(a.condition, expected)
+		if err != nil {
+			return nil, err
+		}
+		return func(resp *assertedResponse) assertResult {
+			doc, err := resp.xml()
+			if err != nil {
+				return failed("body is not XML: %v", err).
+					because(invalidBody).withActual(string(resp.body))
+			}
+			nodes := path.selectFrom(doc)
+			switch a.condition {
+			case "EXISTS":
+				if len(nodes) == 0 {
+					return failed("%v not found", a.expression).
+						because(missingValue)
+				}
+				return success
+			case "NOT_EXISTS":
+				if len(nodes) > 0 {
+					return failed("%v is present", a.expression).
+						withActual(nodes[0].text())
+				}
+				return success
+			case "COUNT":
+				// validated by checkXPathExpected
+				count, _ := strconv.Atoi(expected)
+				if len(nodes) != count {
+					return failed("%v matches %v nodes, expected %v",
+						a.expression, len(nodes), count).
+						withActual(strconv.Itoa(len(nodes)))
+				}
+				return success
+			}
+			if len(nodes) == 0 {
+				return failed("%v not found", a.expression).
+					because(missingValue)
+			}
+			value := strings.TrimSpace(nodes[0].text())
+			if !matches(value) {
+				return failed("%v is %q, expected %v %q", a.expression,
+					value, a.condition, expected).withActual(value)
+			}
+			return success
+		}, nil
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+)
+
+const soapResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <m:GetOrdersResponse xmlns:m="http://example.com/orders">
+      <m:Order id="1" status="shipped"><m:Total>10.50</m:Total></m:Order>
+      <m:Order id="2" status="pending"><m:Total>7</m:Total></m:Order>
+      <m:Order id="3" status="pending"><m:Total> 42 </m:Total></m:Order>
+    </m:GetOrdersResponse>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestXPathAssertion(t *testing.T) {
+	resp := &assertedResponse{body: []byte(soapResponse)}
+	expectations := []struct {
+		expression, condition, expected string
+		successful                      bool
+	}{
+		{"/soap:Envelope/soap:Body", "", "", true},
+		{"/Envelope/Body/GetOrdersResponse", "", "", true},
+		{"/Envelope/Header", "", "", false},
+		{"/Envelope/Header", "NOT_EXISTS", "", true},
+		{"//Order", "COUNT", "3", true},
+		{"//Order", "COUNT", "2", false},
+		{"//Order[@status='pending']", "COUNT", "2", true},
+		{"//Order[@status!='pending']/@id", "EQUAL", "1", true},
+		{"//Order[2]/Total", "EQUAL", "7", true},
+		{"//Order[last()]/Total/text()", "EQUAL", "42", true},
+		{"//Order[Total=7]/@status", "EQUAL", "pending", true},
+		{"//Order[@id]/Total", "MATCHES", `^\d+\.\d+$`, true},
+		{"//Order/Total/..", "COUNT", "3", true},
+		{"//*[@id='3']/@*", "COUNT", "2", true},
+		{"/Envelope", "CONTAINS", "10.50", true},
+		{"//Order[4]", "EQUAL", "", false},
+		{".//Body/*/Order[1]/@status", "EQUAL", "pending", false},
+	}
+	for _, e := range expectations {
+		a := assertion{
+			asserter:   "XPath",
+			expression: e.expression,
+			condition:  e.condition,
+			expected:   e.expected,
+		}
+		if a.condition == "" {
+			a.condition = "EXISTS"
+		}
+		if err := checkAssertion(a); err != nil {
+			t.Errorf("%+v: %v", a, err)
+			continue
+		}
+		r := assertOnce(t, resp, a)
+		if r.successful != e.successful {
+			t.Errorf("%+v: expected %v, but got %+v", a, e.successful, r)
+		}
+	}
+
+	r := assertOnce(t, &assertedResponse{body: []byte(`{"id": 1}`)},
+		assertion{asserter: "XPath", expression: "/id", condition: "EXISTS"})
+	if r.successful || r.reason != invalidBody {
+		t.Errorf("expected %v, but got %+v", invalidBody, r)
+	}
+}
+
+func TestXPathShouldKeepQuotedLiterals(t *testing.T) {
+	resp := &assertedResponse{body: []byte(`<list>
+		<a t="x]y">1</a><a t="a!=b">2</a><a t="it's">3</a><a t="x">4</a>
+	</list>`)}
+	expectations := []struct {
+		expression, expected string
+	}{
+		{"//a[@t='x]y']", "1"},
+		{"//a[@t='a!=b']", "2"},
+		{`//a[@t="it's"]`, "3"},
+		{"//a[@t!='x]y'][@t!='a!=b'][last()]", "4"},
+	}
+	for _, e := range expectations {
+		a := assertion{
+			asserter:   "XPath",
+			expression: e.expression,
+			condition:  "EQUAL",
+			expected:   e.expected,
+		}
+		if err := checkAssertion(a); err != nil {
+			t.Errorf("%+v: %v", a, err)
+			continue
+		}
+		if r := assertOnce(t, resp, a); !r.successful {
+			t.Errorf("%v: expected %v, but got %+v", e.expression, e.expected, r)
+		}
+	}
+	for _, invalid := range []string{"//a[@t='x]", "//a[@t='x' or 'y']", "//a[@t=x]"} {
+		if _, err := compileXPath(invalid); err == nil {
+			t.Errorf("%v: expected an error", invalid)
+		}
+	}
+}
+
+func TestParseXMLShouldDecodeDeclaredEncodings(t *testing.T) {
+	body := append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><name>`),
+		0x4a, 0xfc, 0x72, 0x67, 0x65, 0x6e)
+	body = append(body, []byte(`</name>`)...)
+	doc, err := parseXML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := doc.text(); text != "Jürgen" {
+		t.Errorf("Expected %q, but got %q", "Jürgen", text)
+	}
+	_, err = parseXML([]byte(`<?xml version="1.0" encoding="no-such"?><a/>`))
+	if err == nil {
+		t.Error("Expected an unknown encoding to be rejected")
+	}
+}
+
+func TestParseXMLShouldRejectDocumentsWithoutSingleRoot(t *testing.T) {
+	bodies := []string{
+		"",
+		"plain text",
+		"<a></a><b></b>",
+		"<a><b></a>",
+	}
+	for _, body := range bodies {
+		if _, err := parseXML([]byte(body)); err == nil {
+			t.Errorf("%q: expected an error", body)
+		}
+	}
+}
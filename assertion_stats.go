@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+const (
+	defaultFailureSamples = 10
+	// maxFailureBody is the number of bytes of the body kept in a
+	// failed response sample
+	maxFailureBody = 4 << 10
+)
+
+// assertionStats accumulates failures of each assertion by reason.
+type assertionStats struct {
+	names      []string
+	severities []assertionSeverity
+	failures   []assertionFailures
+}
+
+type assertionFailures struct {
+	total  uint64
+	counts [numFailureReasons]uint64
+
+	// the first actual value seen for each reason
+	mu       sync.Mutex
+	examples [numFailureReasons]string
+	// schema path -> violations of it
+	violations map[string]*violationCount
+}
+
+type violationCount struct {
+	count   uint64
+	example string
+}
+
+func newAssertionStats(assertions []assertion) *assertionStats {
+	s := &assertionStats{
+		names:      make([]string, len(assertions)),
+		severities: make([]assertionSeverity, len(assertions)),
+		failures:   make([]assertionFailures, len(assertions)),
+	}
+	for i, a := range assertions {
+		s.names[i] = a.displayName()
+		s.severities[i] = a.severity
+	}
+	return s
+}
+
+// record counts the failure and returns the number of failures of the
+// assertion so far.
+func (s *assertionStats) record(r assertResult) uint64 {
+	if r.successful || r.assertion < 0 || r.assertion >= len(s.failures) {
+		return 0
+	}
+	f := &s.failures[r.assertion]
+	atomic.AddUint64(&f.counts[r.reason], 1)
+	total := atomic.AddUint64(&f.total, 1)
+	if r.actual == "" && len(r.violations) == 0 {
+		return total
+	}
+	f.mu.Lock()
+	if f.examples[r.reason] == "" {
+		f.examples[r.reason] = r.actual
+	}
+	for _, v := range r.violations {
+		if f.violations == nil {
+			f.violations = make(map[string]*violationCount)
+		}
+		c, ok := f.violations[v.schemaPath]
+		if !ok {
+			c = &violationCount{
+				example: excerpt(v.instancePath + ": " + v.message),
+			}
+			f.violations[v.schemaPath] = c
+		}
+		c.count++
+	}
+	f.mu.Unlock()
+	return total
+}
+
+// info returns failures of each assertion, estimated ones are scaled
+// up when only a sample of responses is asserted.
+func (s *assertionStats) info(scale float64) []internal.AssertionStats {
+	res := make([]internal.AssertionStats, 0, len(s.names))
+	for i, name := range s.names {
+		f := &s.failures[i]
+		stats := internal.AssertionStats{Name: name}
+		if s.severities[i] != hardSeverity {
+			stats.Severity = s.severities[i].String()
+		}
+		f.mu.Lock()
+		for reason := range f.counts {
+			count := atomic.LoadUint64(&f.counts[reason])
+			if count == 0 {
+				continue
+			}
+			stats.Failures += count
+			stats.Reasons = append(stats.Reasons, internal.AssertionFailureReason{
+				Reason:  failureReason(reason).String(),
+				Count:   count,
+				Example: f.examples[reason],
+			})
+		}
+		for path, c := range f.violations {
+			stats.Violations = append(stats.Violations, internal.SchemaViolations{
+				SchemaPath: path,
+				Count:      c.count,
+				Example:    c.example,
+			})
+		}
+		f.mu.Unlock()
+		stats.EstimatedFailures = uint64(math.Round(float64(stats.Failures) * scale))
+		sort.SliceStable(stats.Reasons, func(i, j int) bool {
+			return stats.Reasons[i].Count > stats.Reasons[j].Count
+		})
+		sort.Slice(stats.Violations, func(i, j int) bool {
+			vi, vj := stats.Violations[i], stats.Violations[j]
+			if vi.Count != vj.Count {
+				return vi.Count > vj.Count
+			}
+			return vi.SchemaPath < vj.SchemaPath
+		})
+		res = append(res, stats)
+	}
+	return res
+}
+
+// failureSampler keeps the first failed responses for them to be
+// inspected after the test.
+type failureSampler struct {
+	max   uint64
+	names []string
+
+	// taken is checked before anything is copied from the response
+	taken   uint64
+	mu      sync.Mutex
+	samples []internal.FailedResponse
+}
+
+func newFailureSampler(max uint64, assertions []assertion) *failureSampler {
+	s := &failureSampler{max: max, names: make([]string, len(assertions))}
+	for i, a := range assertions {
+		s.names[i] = a.displayName()
+	}
+	return s
+}
+
+// add saves the response if there are less than max samples. It must
+// be called while the response is still valid, since the headers and
+// the body are copied.
+func (s *failureSampler) add(resp *assertedResponse, r assertResult, values row) {
+	if s == nil || r.successful {
+		return
+	}
+	if atomic.AddUint64(&s.taken, 1) > s.max {
+		return
+	}
+	sample := internal.FailedResponse{
+		Reason:        r.reason.String(),
+		Error:         r.errMsg,
+		StatusCode:    resp.code,
+		BodyTruncated: resp.tooLarge,
+		Payload:       values.toMap(),
+	}
+	if r.assertion >= 0 && r.assertion < len(s.names) {
+		sample.Assertion = s.names[r.assertion]
+	}
+	if resp.headers != nil {
+		resp.headers(func(key, value string) {
+			sample.Headers = append(sample.Headers, internal.Header{
+				Key: key, Value: value,
+			})
+		})
+	}
+	body := resp.body
+	if len(body) > maxFailureBody {
+		// doesn't cut runes in half
+		i := maxFailureBody
+		for i > 0 && !utf8.RuneStart(body[i]) {
+			i--
+		}
+		body = body[:i]
+		sample.BodyTruncated = true
+	}
+	sample.Body = string(body)
+
+	s.mu.Lock()
+	s.samples = append(s.samples, sample)
+	s.mu.Unlock()
+}
+
+func (s *failureSampler) info() []internal.FailedResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]internal.FailedResponse(nil), s.samples...)
+}
+
+// save writes each sample to dir as failure-<n>.json.
+func (s *failureSampler) save(dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	for i, sample := range failedResponses(s.info()) {
+		data, err := json.MarshalIndent(sample, "", "  ")
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, fmt.Sprintf("failure-%03d.json", i+1))
+		if err := ioutil.WriteFile(name, data, 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+func TestAssertionStats(t *testing.T) {
+	s := newAssertionStats([]assertion{
+		{name: "status", asserter: "StatusCode", expected: "200"},
+		{asserter: "JsonPath", expression: "$.id", condition: "NOT_NULL"},
+		{asserter: "BodySize", expected: "10"},
+	})
+	results := []assertResult{
+		failed("").withActual("500"),
+		failed("").withActual("404"),
+		{successful: true},
+		{assertion: 1, reason: missingValue},
+		{assertion: 1, reason: invalidBody, actual: "<html>"},
+		{assertion: 1, reason: missingValue},
+		{assertion: 7, reason: wrongValue},
+	}
+	var wg sync.WaitGroup
+	for _, r := range results {
+		wg.Add(1)
+		go func(r assertResult) {
+			defer wg.Done()
+			s.record(r)
+		}(r)
+	}
+	wg.Wait()
+	info := s.info(1)
+	if len(info) != 3 {
+		t.Fatalf("Expected stats of 3 assertions, but got %+v", info)
+	}
+	if info[0].Name != "status" || info[0].Failures != 2 ||
+		len(info[0].Reasons) != 1 || info[0].Reasons[0].Count != 2 {
+		t.Errorf("Unexpected stats: %+v", info[0])
+	}
+	if e := info[0].Reasons[0].Example; e != "500" && e != "404" {
+		t.Errorf("Expected one of actual values, but got %q", e)
+	}
+	expected := internal.AssertionStats{
+		Name:              "JsonPath:$.id NOT_NULL",
+		Failures:          3,
+		EstimatedFailures: 3,
+		Reasons: []internal.AssertionFailureReason{
+			{Reason: "missing value", Count: 2},
+			{Reason: "invalid body", Count: 1, Example: "<html>"},
+		},
+	}
+	if !reflect.DeepEqual(info[1], expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info[1])
+	}
+	if info[2].Failures != 0 || info[2].Reasons != nil {
+		t.Errorf("Expected no failures, but got %+v", info[2])
+	}
+	if e := s.info(2.5)[1].EstimatedFailures; e != 8 {
+		t.Errorf("Expected 8 estimated failures, but got %v", e)
+	}
+}
+
+func TestFailureSampler(t *testing.T) {
+	s := newFailureSampler(2, []assertion{
+		{name: "status", asserter: "StatusCode", expected: "200"},
+	})
+	resp := &assertedResponse{
+		code: 500,
+		headers: func(visit func(key, value string)) {
+			visit("Set-Cookie", "a=1")
+			visit("Set-Cookie", "b=2")
+		},
+		body: []byte(strings.Repeat("x", maxFailureBody-1) + "é"),
+	}
+	values := rowOf(map[string]string{"id": "1"})
+	s.add(resp, success, values)
+	s.add(resp, failed("status code 500"), values)
+	s.add(&assertedResponse{code: 502, tooLarge: true}, failed("too large"), row{})
+	s.add(resp, failed("status code 500"), values)
+
+	samples := s.info()
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, but got %v", len(samples))
+	}
+	first := samples[0]
+	if first.Assertion != "status" || first.StatusCode != 500 ||
+		first.Error != "status code 500" || first.Payload["id"] != "1" {
+		t.Errorf("Unexpected sample: %+v", first)
+	}
+	if !first.BodyTruncated || len(first.Body) != maxFailureBody-1 {
+		t.Errorf("Expected the body to be cut before the last rune, "+
+			"but got %v bytes", len(first.Body))
+	}
+	if len(first.Headers) != 2 {
+		t.Errorf("Expected both headers, but got %v", first.Headers)
+	}
+	if !samples[1].BodyTruncated || samples[1].Payload != nil {
+		t.Errorf("Unexpected sample: %+v", samples[1])
+	}
+
+	var nilSampler *failureSampler
+	nilSampler.add(resp, failed(""), values)
+}
+
+func TestFailedResponses(t *testing.T) {
+	res := failedResponses([]internal.FailedResponse{{
+		StatusCode: 500,
+		Headers: []internal.Header{
+			{Key: "Set-Cookie", Value: "a=1"},
+			{Key: "Set-Cookie", Value: "b=2"},
+		},
+	}})
+	expected := map[string][]string{"Set-Cookie": {"a=1", "b=2"}}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Headers, expected) {
+		t.Errorf("Expected headers %v, but got %+v", expected, res)
+	}
+	if failedResponses(nil) != nil {
+		t.Error("Expected no failed responses")
+	}
+}
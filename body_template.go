@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+	uuid "github.com/satori/go.uuid"
+)
+
+// templateFuncs returns helpers shared by output and body templates.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"FormatBinary": formatBinary,
+		"FormatTimeUs": formatTimeUs,
+		"FormatTimeUsUint64": func(us uint64) string {
+			return formatTimeUs(float64(us))
+		},
+		"FormatDuration": func(d time.Duration) string {
+			return formatTimeUs(float64(d.Nanoseconds()) / 1000)
+		},
+		"KeyCounts": internal.HistogramToKeyCounts,
+		"FloatsToArray": func(ps ...float64) []float64 {
+			return ps
+		},
+		"Multiply": func(num, coeff float64) float64 {
+			return num * coeff
+		},
+		"Add": func(a, b int) int {
+			return a + b
+		},
+		"Int": strconv.Atoi,
+		"StringToBytes": func(s string) []byte {
+			return []byte(s)
+		},
+		"UUIDV1": uuid.NewV1,
+		"UUIDV2": uuid.NewV2,
+		"UUIDV3": uuid.NewV3,
+		"UUIDV4": uuid.NewV4,
+		"UUIDV5": uuid.NewV5,
+		"RandInt": func(min, max int) int {
+			if max <= min {
+				return min
+			}
+			return int(randInt(int64(min), int64(max)))
+		},
+		"RandFloat": func(min, max float64) float64 {
+			return min + rand.Float64()*(max-min)
+		},
+		"RandString": randString,
+		"Pick": func(choices ...interface{}) interface{} {
+			if len(choices) == 0 {
+				return nil
+			}
+			return choices[rand.Intn(len(choices))]
+		},
+		"Seq": func(n int) []int {
+			if n < 0 {
+				n = 0
+			}
+			res := make([]int, n)
+			for i := range res {
+				res[i] = i
+			}
+			return res
+		},
+		"Now":  time.Now,
+		"JSON": toJSON,
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// bodyTemplate renders request bodies with text/template, the row of
+// the payload is passed to it as data.
+type bodyTemplate struct {
+	tmpl *template.Template
+}
+
+func newBodyTemplate(source string) (*bodyTemplate, error) {
+	tmpl, err := template.New("body-template").
+		Funcs(templateFuncs()).
+		Option("missingkey=error").
+		Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return &bodyTemplate{tmpl: tmpl}, nil
+}
+
+// execute renders the template with row into w.
+func (b *bodyTemplate) execute(w io.Writer, row map[string]string) error {
+	return b.tmpl.Execute(w, row)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestBodyTemplateShouldRender(t *testing.T) {
+	tmpl, err := newBodyTemplate(
+		`{"user":{{JSON .name}},"items":[` +
+			`{{range $i, $_ := Seq 3}}{{if $i}},{{end}}` +
+			`{"n":{{Add $i 1}},"qty":{{RandInt 1 5}}}{{end}}]}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.execute(&buf, map[string]string{"name": `Tom "T"`}); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		User  string
+		Items []struct{ N, Qty int }
+	}
+	if err := json.Unmarshal(buf.Bytes(), &body); err != nil {
+		t.Fatalf("%q: %v", buf.String(), err)
+	}
+	if body.User != `Tom "T"` || len(body.Items) != 3 {
+		t.Errorf("Unexpected body %q", buf.String())
+	}
+	for i, item := range body.Items {
+		if item.N != i+1 || item.Qty < 1 || item.Qty > 5 {
+			t.Errorf("Unexpected item %v: %+v", i, item)
+		}
+	}
+}
+
+func TestBodyTemplateShouldFailOnMissingKeys(t *testing.T) {
+	tmpl, err := newBodyTemplate(`{{.missing}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.execute(&buf, map[string]string{"name": "Tom"}); err == nil {
+		t.Errorf("Expected an error, but got %q", buf.String())
+	}
+	if _, err := newBodyTemplate(`{{.name`); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
+
+func TestBodyTemplateShouldRenderWideRandInts(t *testing.T) {
+	maxInt := int(^uint(0) >> 1)
+	for _, bounds := range [][2]int{{0, maxInt}, {-maxInt - 1, 0}, {-maxInt - 1, maxInt}} {
+		tmpl, err := newBodyTemplate(
+			fmt.Sprintf("{{RandInt %d %d}}", bounds[0], bounds[1]),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.execute(&buf, nil); err != nil {
+			t.Fatalf("%v: %v", bounds, err)
+		}
+		v, err := strconv.Atoi(buf.String())
+		if err != nil || v < bounds[0] || v > bounds[1] {
+			t.Errorf("%v: unexpected value %q", bounds, buf.String())
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,7 +17,6 @@ import (
 
 	fhist "github.com/codesenberg/concurrent/float64/histogram"
 	uhist "github.com/codesenberg/concurrent/uint64/histogram"
-	uuid "github.com/satori/go.uuid"
 )
 
 type bombardier struct {
@@ -31,6 +31,8 @@ type bombardier struct {
 	others uint64
 
 	errorCount uint64
+	// assertFailures is the number of responses failed by assertions
+	assertFailures uint64
 
 	conf        config
 	barrier     completionBarrier
@@ -52,6 +54,32 @@ type bombardier struct {
 	// Errors
 	errors *errorMap
 
+	// Redirects, nil unless redirects are followed
+	redirects *redirectStats
+
+	// Compression, nil unless bodies are compressed
+	compression *compressionStats
+
+	// Assertions and their failures, nil unless responses are asserted
+	plan       *assertionPlan
+	assertions *assertionStats
+	failures   *failureSampler
+
+	// Payload, nil if there is none
+	payload *payload
+
+	// Intervals of the test, nil unless abort conditions are checked or
+	// the time series is recorded
+	intervals  *intervalRecorder
+	timeseries *timeseries
+
+	// Baseline the test is compared with, nil if there is none
+	baseline *runSummary
+
+	// abortOnce guards aborted, the reason the test was stopped early
+	abortOnce sync.Once
+	aborted   string
+
 	// Progress bar
 	// bar *pb.ProgressBar
 
@@ -128,44 +156,179 @@ func newBombardier(c config) (*bombardier, error) {
 	}
 
 	var payload *payload
+	strategy, _ := getPayloadStrategy(c.payloadStrategy)
 	if c.payloadFile != "" {
-		payload, err = loadFromFile(c.payloadFile, strings.Split(c.varNames, ","), c.startLine)
-	} else if c.payloadUrl != "" {
-		if c.scope == request {
-			payload, err = loadFromUrl(c.payloadUrl, strings.Split(c.varNames, ","), c.startLine, uint32(*c.numReqs))
+		opts := payloadFileOptions{
+			format:     c.payloadFormat,
+			columns:    c.variableNames(),
+			header:     c.payloadHeader,
+			delimiter:  c.payloadDelimiter,
+			lazyQuotes: c.payloadLazyQuotes,
+			bufferSize: int(c.payloadBufferSize),
+			rewind:     c.payloadRewind,
+		}
+		if c.payloadStream {
+			var pinned uint64
+			if c.scope == thread {
+				pinned = c.numConns
+			}
+			payload, err = streamFromFile(c.payloadFile, opts, c.startLine, pinned)
 		} else {
-			payload, err = loadFromUrl(c.payloadUrl, strings.Split(c.varNames, ","), c.startLine, uint32(c.numConns))
+			payload, err = loadFromFile(c.payloadFile, opts, c.startLine)
+		}
+	} else if c.payloadUrl != "" {
+		opts := payloadURLOptions{
+			columns:  c.variableNames(),
+			headers:  c.payloadHeaders,
+			token:    c.payloadToken,
+			pageSize: c.payloadPageSize,
+			retries:  defaultPayloadRetries,
+			timeout:  c.payloadTimeout,
+			// rows of the URL are gone through over and over again
+			// unless every one of them has to be used once
+			rewind: strategy != uniquePayload,
+		}
+		if c.payloadRetries != nil {
+			opts.retries = *c.payloadRetries
+		}
+		var pinned uint64
+		if c.scope == thread {
+			pinned = c.numConns
+		}
+		payload, err = streamFromURL(
+			c.payloadUrl, opts, uint64(c.startLine),
+			int(c.payloadBufferSize), pinned,
+		)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		err = payload.useStrategy(payloadStrategyOptions{
+			strategy:     strategy,
+			workers:      c.numConns,
+			seed:         c.payloadSeed,
+			zipfExponent: c.payloadZipfExponent,
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
+	b.payload = payload
 
+	var bodyTmpl *bodyTemplate
+	if c.bodyTemplate {
+		bodyTmpl, err = prepareBodyTemplate(*pbody, payload)
+		if err != nil {
+			return nil, err
+		}
+		pbody = nil
+	}
+
+	rawURL, err := url.PathUnescape(c.url)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	if payload != nil {
+		columns = payload.columns()
+	}
+	gens, err := preparePlaceholders(c, rawURL, pbody, columns)
 	if err != nil {
 		return nil, err
 	}
+	// placeholders are only resolved if there is anything to resolve
+	// them with
+	needsResolving := func(s string) bool {
+		return compileTemplate(s).resolvable(payload != nil)
+	}
 
 	var (
 		resolveUrl     = false
 		resolveHerader = false
 		resolveBody    = false
 	)
-	if payload != nil {
-		c.url, err = url.PathUnescape(c.url)
+	if needsResolving(rawURL) {
+		c.url, resolveUrl = rawURL, true
+	}
+	if c.headers != nil {
+		for _, header := range *c.headers {
+			if needsResolving(header.value) {
+				resolveHerader = true
+				break
+			}
+		}
+	}
+	if pbody != nil {
+		resolveBody = needsResolving(*pbody)
+		if !resolveBody && (payload != nil || gens != nil) {
+			// escaped placeholders still have to be unescaped
+			static := compileTemplate(*pbody).render(nil)
+			pbody = &static
+		}
+	}
+
+	if c.maxRedirects > 0 {
+		b.redirects = newRedirectStats()
+	}
+
+	headers := c.headers
+	var responseStats *compressionStats
+	if c.compression != "" || c.acceptEncoding != "" {
+		b.compression = new(compressionStats)
+		headers = withCompressionHeaders(
+			c.headers, c.compression, c.acceptEncoding,
+		)
+	}
+	if c.acceptEncoding != "" {
+		responseStats = b.compression
+	}
+
+	if c.assertions != nil {
+		if len(*c.assertions) > 0 {
+			b.plan, err = compileAssertions(*c.assertions, c.assertSampleRate())
+			if err != nil {
+				return nil, err
+			}
+		}
+		b.assertions = newAssertionStats(b.plan.list())
+		if n := c.failureSamplesCount(); n > 0 {
+			b.failures = newFailureSampler(n, b.plan.list())
+		}
+	}
+
+	b.baseline = c.baseline
+	if b.baseline == nil && c.baselineFile != "" {
+		baseline, err := loadRunSummary(c.baselineFile)
 		if err != nil {
 			return nil, err
 		}
-		resolveUrl = containsPlaceholder(c.url)
+		b.baseline = &baseline
+	}
 
-		if c.headers != nil {
-			for _, header := range *c.headers {
-				if containsPlaceholder(header.value) {
-					resolveHerader = true
-					break
-				}
+	var form *formBody
+	if c.form != nil {
+		form, err = newFormBody(*c.form, c.multipart)
+		if err != nil {
+			return nil, err
+		}
+		if !headers.has("Content-Type") {
+			headers = headers.with(header{"Content-Type", form.contentType()})
+		}
+		if !anyNeedsResolving(*c.form, needsResolving) {
+			// the same body is sent with every request
+			body, err := form.build(nil)
+			if err != nil {
+				return nil, err
 			}
+			pbody, form = &body, nil
 		}
+	}
 
-		if pbody != nil {
-			resolveBody = containsPlaceholder(*pbody)
-		}
+	var sessions *sessions
+	if c.cookieJar {
+		sessions = newSessions(c.numConns, c.resetSessionEvery, c.cookies)
 	}
 
 	cc := &clientOpts{
@@ -175,20 +338,36 @@ func newBombardier(c config) (*bombardier, error) {
 		tlsConfig: tlsConfig,
 
 		payload:       payload,
+		generators:    gens,
 		scope:         c.scope,
 		resolveUrl:    resolveUrl,
 		resolveHeader: resolveHerader,
 		resolveBody:   resolveBody,
 
-		headers:      c.headers,
+		headers:      headers,
+		host:         c.host,
+		omitHeaders:  c.omitHeaders,
 		url:          c.url,
 		method:       c.method,
 		body:         pbody,
+		form:         form,
+		bodyTemplate: bodyTmpl,
 		bodProd:      bsp,
 		bytesRead:    &b.bytesRead,
 		bytesWritten: &b.bytesWritten,
 
-		assertions: c.assertions,
+		maxRedirects: c.maxRedirects,
+		redirects:    b.redirects,
+
+		sessions: sessions,
+
+		compression:      c.compression,
+		compressionStats: b.compression,
+		responseStats:    responseStats,
+
+		assertions:    b.plan,
+		maxAssertBody: c.assertMaxBodySize(),
+		failures:      b.failures,
 	}
 	b.client = makeHTTPClient(c.clientType, cc)
 
@@ -202,12 +381,121 @@ func newBombardier(c config) (*bombardier, error) {
 		return nil, err
 	}
 
+	// the file of the time series is created last, when nothing else
+	// can fail
+	if c.timeseries || c.timeseriesFile != "" {
+		b.timeseries, err = newTimeseries(c.timeseriesFile, c.timeseriesFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.abortConditions != nil || b.timeseries != nil {
+		keep := 0
+		if c.abortConditions != nil {
+			for _, ac := range *c.abortConditions {
+				if n := ac.intervals(); n > keep {
+					keep = n
+				}
+			}
+		}
+		b.intervals = newIntervalRecorder(keep)
+	}
+
 	b.workers.Add(int(c.numConns))
 	b.errors = newErrorMap()
 	b.doneChan = make(chan struct{}, 1)
 	return b, nil
 }
 
+// preparePlaceholders verifies placeholders used in the request and
+// prepares generators, nil is returned if there are none. Variables
+// must be provided by the payload, unless they have defaults, columns
+// are nil if there is no payload.
+func preparePlaceholders(
+	c config, rawURL string, body *string, columns []string,
+) (*generators, error) {
+	sources := []string{rawURL, c.host}
+	if body != nil {
+		sources = append(sources, *body)
+	}
+	if c.headers != nil {
+		for _, h := range *c.headers {
+			sources = append(sources, h.value)
+		}
+	}
+	if c.form != nil {
+		sources = append(sources, *c.form...)
+	}
+	if c.cookies != nil {
+		sources = append(sources, *c.cookies...)
+	}
+	if c.assertions != nil {
+		for _, a := range *c.assertions {
+			sources = append(sources, a.expected)
+		}
+	}
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+	withPayload := columns != nil
+	gens := newGenerators(c.numConns)
+	found := false
+	for _, source := range sources {
+		for _, ph := range compileTemplate(source).placeholders() {
+			if ph.err != nil {
+				return nil, ph.err
+			}
+			if !ph.resolvable(withPayload) {
+				continue
+			}
+			for _, v := range ph.filterVars {
+				if !known[v] {
+					return nil, &unknownVariableError{v, ph.raw}
+				}
+			}
+			if isGenerator(ph.key) {
+				if _, err := gens.compile(ph.key); err != nil {
+					return nil, err
+				}
+				found = true
+			} else if !known[ph.key] && !ph.hasDefault {
+				return nil, &unknownVariableError{ph.key, ph.raw}
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return gens, nil
+}
+
+// prepareBodyTemplate compiles the body template and renders it once
+// with the first row of the payload to report errors before the test.
+func prepareBodyTemplate(source string, payload *payload) (*bodyTemplate, error) {
+	tmpl, err := newBodyTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+	var row map[string]string
+	if payload != nil {
+		row = payload.first().toMap()
+	}
+	if err := tmpl.execute(ioutil.Discard, row); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func anyNeedsResolving(sources []string, needsResolving func(string) bool) bool {
+	for _, s := range sources {
+		if needsResolving(s) {
+			return true
+		}
+	}
+	return false
+}
+
 func makeHTTPClient(clientType clientTyp, cc *clientOpts) client {
 	var cl client
 	switch clientType {
@@ -240,31 +528,16 @@ func (b *bombardier) prepareTemplate() (*template.Template, error) {
 	default:
 		panic("format can't be nil at this point, this is a bug")
 	}
+	funcs := templateFuncs()
+	funcs["WithLatencies"] = func() bool {
+		return b.conf.printLatencies
+	}
+	funcs["WithHistogram"] = func() bool {
+		return b.conf.latencyHistogram
+	}
 	outputTemplate, err := template.New("output-template").
-		Funcs(template.FuncMap{
-			"WithLatencies": func() bool {
-				return b.conf.printLatencies
-			},
-			"FormatBinary": formatBinary,
-			"FormatTimeUs": formatTimeUs,
-			"FormatTimeUsUint64": func(us uint64) string {
-				return formatTimeUs(float64(us))
-			},
-			"FloatsToArray": func(ps ...float64) []float64 {
-				return ps
-			},
-			"Multiply": func(num, coeff float64) float64 {
-				return num * coeff
-			},
-			"StringToBytes": func(s string) []byte {
-				return []byte(s)
-			},
-			"UUIDV1": uuid.NewV1,
-			"UUIDV2": uuid.NewV2,
-			"UUIDV3": uuid.NewV3,
-			"UUIDV4": uuid.NewV4,
-			"UUIDV5": uuid.NewV5,
-		}).Parse(string(templateBytes))
+		Funcs(funcs).
+		Parse(string(templateBytes))
 
 	if err != nil {
 		return nil, err
@@ -273,9 +546,12 @@ func (b *bombardier) prepareTemplate() (*template.Template, error) {
 }
 
 func (b *bombardier) writeStatistics(
-	code int, msTaken uint64, assertResult assertResult,
+	code int, msTaken uint64, failures assertResults,
 ) {
 	b.latencies.Increment(msTaken)
+	if b.intervals != nil {
+		b.intervals.record(msTaken)
+	}
 	b.rpl.Lock()
 	b.reqs++
 	b.rpl.Unlock()
@@ -296,17 +572,49 @@ func (b *bombardier) writeStatistics(
 	}
 	atomic.AddUint64(counter, 1)
 
-	if !assertResult.successful {
+	if !failures.successful() {
 		atomic.AddUint64(&b.errorCount, 1)
 	}
 }
 
-func (b *bombardier) performSingleRequest(idx uint64) {
-	code, msTaken, assertResult, err := b.client.do(idx)
+// performSingleRequest returns false if the request wasn't sent,
+// since there is no more work to do.
+func (b *bombardier) performSingleRequest(idx uint64) bool {
+	code, msTaken, failures, err := b.client.do(idx)
+	if err == errPayloadExhausted {
+		// every row is used, the test is over
+		b.barrier.cancel()
+		return false
+	}
+	if perr, ok := err.(*payloadReadError); ok {
+		b.abort("reading of payload failed: " + perr.Error())
+		return false
+	}
 	if err != nil {
 		b.errors.add(err)
+	} else if b.assertions != nil {
+		if !failures.successful() {
+			atomic.AddUint64(&b.assertFailures, 1)
+		}
+		for _, r := range failures {
+			n := b.assertions.record(r)
+			a := b.plan.assertions[r.assertion]
+			if a.severity == abortSeverity && n == a.abortAfter {
+				b.abort(fmt.Sprintf("assertion %v failed %v times",
+					a.displayName(), n))
+			}
+		}
 	}
-	b.writeStatistics(code, msTaken, assertResult)
+	b.writeStatistics(code, msTaken, failures)
+	return true
+}
+
+// abort stops the test early, only the first reason is kept.
+func (b *bombardier) abort(reason string) {
+	b.abortOnce.Do(func() {
+		b.aborted = reason
+	})
+	b.barrier.cancel()
 }
 
 func (b *bombardier) worker(idx uint64) {
@@ -315,7 +623,9 @@ func (b *bombardier) worker(idx uint64) {
 		if b.ratelimiter.pace(done) == brk {
 			break
 		}
-		b.performSingleRequest(idx)
+		if !b.performSingleRequest(idx) {
+			break
+		}
 		b.barrier.jobDone()
 	}
 }
@@ -351,15 +661,28 @@ func (b *bombardier) rateMeter() {
 	ticker := time.NewTicker(requestsInterval)
 	defer ticker.Stop()
 	tick := ticker.C
+	var statsTick <-chan time.Time
+	if b.intervals != nil {
+		statsTicker := time.NewTicker(statsInterval)
+		defer statsTicker.Stop()
+		statsTick = statsTicker.C
+	}
 	done := b.barrier.done()
 	for {
 		select {
 		case <-tick:
 			b.recordRps()
 			continue
+		case now := <-statsTick:
+			b.nextInterval(now)
+			b.checkAbortConditions()
+			continue
 		case <-done:
 			b.workers.Wait()
 			b.recordRps()
+			if b.intervals != nil {
+				b.finishIntervals()
+			}
 			b.doneChan <- struct{}{}
 			return
 		}
@@ -378,6 +701,67 @@ func (b *bombardier) recordRps() {
 	b.requests.Increment(reqsf)
 }
 
+// totals returns the running totals of the test.
+func (b *bombardier) totals() counters {
+	c := counters{
+		req1xx:         atomic.LoadUint64(&b.req1xx),
+		req2xx:         atomic.LoadUint64(&b.req2xx),
+		req3xx:         atomic.LoadUint64(&b.req3xx),
+		req4xx:         atomic.LoadUint64(&b.req4xx),
+		req5xx:         atomic.LoadUint64(&b.req5xx),
+		others:         atomic.LoadUint64(&b.others),
+		errors:         b.errors.sum(),
+		assertFailures: atomic.LoadUint64(&b.assertFailures),
+		bytesRead:      uint64(atomic.LoadInt64(&b.bytesRead)),
+		bytesWritten:   uint64(atomic.LoadInt64(&b.bytesWritten)),
+	}
+	if b.plan != nil {
+		c.asserted = atomic.LoadUint64(&b.plan.asserted)
+	}
+	return c
+}
+
+// nextInterval closes the interval in progress and starts the next one.
+func (b *bombardier) nextInterval(now time.Time) {
+	i := b.intervals.next(now, b.totals())
+	if b.timeseries != nil {
+		b.timeseries.add(i.summary(b.timeseries.begin))
+	}
+}
+
+// finishIntervals closes the last interval, cut short by the end of
+// the test, and the time series.
+func (b *bombardier) finishIntervals() {
+	i := b.intervals.next(time.Now(), b.totals())
+	if b.timeseries == nil {
+		return
+	}
+	if i.counts.total() > 0 {
+		b.timeseries.add(i.summary(b.timeseries.begin))
+	}
+	if err := b.timeseries.close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// checkAbortConditions aborts the test once the last intervals breach
+// any of the abort conditions.
+func (b *bombardier) checkAbortConditions() {
+	if b.conf.abortConditions == nil {
+		return
+	}
+	for _, c := range *b.conf.abortConditions {
+		r, ok := b.intervals.window(c.intervals())
+		if !ok {
+			continue
+		}
+		if reason, breached := c.breached(&r); breached {
+			b.abort(reason)
+			return
+		}
+	}
+}
+
 func (b *bombardier) bombard() {
 	if b.conf.printIntro {
 		b.printIntro()
@@ -385,6 +769,12 @@ func (b *bombardier) bombard() {
 	// b.bar.Start()
 	bombardmentBegin := time.Now()
 	b.start = time.Now()
+	if b.intervals != nil {
+		b.intervals.start = bombardmentBegin
+	}
+	if b.timeseries != nil {
+		b.timeseries.begin = bombardmentBegin
+	}
 	for i := uint64(0); i < b.conf.numConns; i++ {
 		i := i
 		go func() {
@@ -396,6 +786,14 @@ func (b *bombardier) bombard() {
 	// go b.barUpdater()
 	b.workers.Wait()
 	b.timeTaken = time.Since(bombardmentBegin)
+	if b.payload != nil {
+		b.payload.close()
+	}
+	if b.failures != nil && b.conf.failuresDir != "" {
+		if err := b.failures.save(b.conf.failuresDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
 	<-b.doneChan
 	// <-b.doneChan
 }
@@ -425,11 +823,17 @@ func (b *bombardier) gatherInfo() internal.TestInfo {
 			CertPath: b.conf.certPath,
 			KeyPath:  b.conf.keyPath,
 
-			Stream:     b.conf.stream,
-			Timeout:    b.conf.timeout,
-			ClientType: internal.ClientType(b.conf.clientType),
+			Stream:       b.conf.stream,
+			Timeout:      b.conf.timeout,
+			ClientType:   internal.ClientType(b.conf.clientType),
+			MaxRedirects: b.conf.maxRedirects,
+
+			Compression:    b.conf.compression,
+			AcceptEncoding: b.conf.acceptEncoding,
 
 			Rate: b.conf.rate,
+
+			AssertSample: b.conf.assertSampleRate(),
 		},
 		Result: internal.Results{
 			BytesRead:    b.bytesRead,
@@ -443,6 +847,8 @@ func (b *bombardier) gatherInfo() internal.TestInfo {
 			Req5XX: b.req5xx,
 			Others: b.others,
 
+			Aborted: b.aborted,
+
 			Latencies: b.latencies,
 			Requests:  b.requests,
 		},
@@ -466,6 +872,25 @@ func (b *bombardier) gatherInfo() internal.TestInfo {
 		}
 	}
 
+	if b.redirects != nil {
+		info.Result.Redirects = b.redirects.info()
+	}
+	if b.compression != nil {
+		info.Result.Compression = b.compression.info()
+	}
+	if b.assertions != nil {
+		scale := 1.0
+		if b.plan != nil {
+			scale = b.plan.scale()
+			info.Result.AssertedResponses = atomic.LoadUint64(&b.plan.asserted)
+		}
+		info.Result.AssertFailures = atomic.LoadUint64(&b.assertFailures)
+		info.Result.Assertions = b.assertions.info(scale)
+	}
+	if b.failures != nil {
+		info.Result.FailedResponses = b.failures.info()
+	}
+
 	for _, ewc := range b.errors.byFrequency() {
 		info.Result.Errors = append(info.Result.Errors,
 			internal.ErrorWithCount{
@@ -473,6 +898,13 @@ func (b *bombardier) gatherInfo() internal.TestInfo {
 				Count: ewc.count,
 			})
 	}
+	if b.timeseries != nil {
+		info.Result.Timeseries = b.timeseries.intervals
+	}
+	if b.conf.thresholds != nil {
+		// checked last, since they look at the rest of the results
+		info.Result.Thresholds = checkThresholds(*b.conf.thresholds, &info.Result)
+	}
 
 	return info
 }
@@ -485,6 +917,25 @@ func (b *bombardier) printStats() {
 	}
 }
 
+// comparison compares the results with the baseline, it's nil if there
+// is none.
+func (b *bombardier) comparison(r *internal.Results) *internal.Comparison {
+	if b.baseline == nil {
+		return nil
+	}
+	opts := comparisonOptions{significance: b.conf.significance}
+	if b.conf.tolerances != nil {
+		opts.tolerances = *b.conf.tolerances
+	}
+	return compareRuns(*b.baseline, summaryOf(r), opts)
+}
+
+func (b *bombardier) printComparison(c *internal.Comparison) {
+	if err := printComparison(b.out, b.conf.compareFormat, c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
 func (b *bombardier) redirectOutputTo(out io.Writer) {
 	// b.bar.Output = out
 	// b.out = out
@@ -495,25 +946,59 @@ func (b *bombardier) disableOutput() {
 	// 	b.bar.NotPrint = true
 }
 
+// run runs the test described by the command line and returns the
+// exit status of bombardier.
+func run(p argsParser, args []string, out io.Writer) int {
+	if len(args) > 1 && args[1] == compareCommand {
+		regressed, err := compare(args[1:], out)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return exitFailure
+		}
+		if regressed {
+			return exitRegressed
+		}
+		return exitSuccess
+	}
+	cfg, err := p.parse(args)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return exitFailure
+	}
+	bombardier, err := newBombardier(cfg)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return exitFailure
+	}
+	bombardier.out = out
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	defer signal.Stop(c)
+	go func() {
+		select {
+		case <-c:
+			bombardier.barrier.cancel()
+		case <-bombardier.barrier.done():
+		}
+	}()
+	bombardier.bombard()
+	if bombardier.conf.printResult {
+		bombardier.printStats()
+	}
+	result := bombardier.gatherInfo().Result
+	comparison := bombardier.comparison(&result)
+	if comparison != nil {
+		bombardier.printComparison(comparison)
+	}
+	if !result.Passed() {
+		return exitThresholdsNotMet
+	}
+	if comparison != nil && comparison.Regressed {
+		return exitRegressed
+	}
+	return exitSuccess
+}
+
 //func main() {
-//	cfg, err := parser.parse(os.Args)
-//	if err != nil {
-//		fmt.Println(err)
-//		os.Exit(exitFailure)
-//	}
-//	bombardier, err := newBombardier(cfg)
-//	if err != nil {
-//		fmt.Println(err)
-//		os.Exit(exitFailure)
-//	}
-//	c := make(chan os.Signal, 1)
-//	signal.Notify(c, os.Interrupt)
-//	go func() {
-//		<-c
-//		bombardier.barrier.cancel()
-//	}()
-//	bombardier.bombard()
-//	if bombardier.conf.printResult {
-//		bombardier.printStats()
-//	}
+//	os.Exit(run(parser, os.Args, os.Stdout))
 //}
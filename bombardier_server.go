@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"os"
@@ -10,16 +15,29 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/codesenberg/bombardier/internal"
+
 	"github.com/buaazp/fasthttprouter"
 	"github.com/fasthttp/websocket"
 	"github.com/valyala/fasthttp"
 )
 
 type Assertion struct {
+	Name       string
 	Asserter   string
 	Expression string
 	Condition  string
 	Expected   string
+	// Severity is hard, soft, abort or abort:<failures>
+	Severity string
+
+	// groups of assertions are given instead of the asserter
+	AllOf []Assertion
+	AnyOf []Assertion
+	Not   *Assertion
+	// Ref is the name of another assertion, which is then checked only
+	// as a part of the group
+	Ref string
 }
 
 type Latency struct {
@@ -28,6 +46,13 @@ type Latency struct {
 	Max         string            `json:"max"`
 	Min         string            `json:"min"`
 	Percentiles map[string]string `json:"percentiles"`
+	// Histogram is in microseconds, it's only there if asked for
+	Histogram []LatencyCount `json:"histogram,omitempty"`
+}
+
+type LatencyCount struct {
+	Latency uint64 `json:"latency"`
+	Count   uint64 `json:"count"`
 }
 
 type Status struct {
@@ -39,19 +64,125 @@ type Status struct {
 	Others uint64 `json:"other"`
 }
 
+type Redirects struct {
+	MeanHops   string            `json:"meanHops"`
+	Time       string            `json:"time"`
+	Loops      uint64            `json:"loops"`
+	TooMany    uint64            `json:"tooManyRedirects"`
+	Hops       map[uint64]uint64 `json:"hops"`
+	FinalCodes map[uint64]uint64 `json:"finalCodes"`
+}
+
+type Compression struct {
+	RequestBytes           int64  `json:"requestBytes"`
+	CompressedRequestBytes int64  `json:"compressedRequestBytes"`
+	RequestRatio           string `json:"requestRatio"`
+	DecodedResponses       uint64 `json:"decodedResponses"`
+	EncodedResponseBytes   int64  `json:"encodedResponseBytes"`
+	DecodedResponseBytes   int64  `json:"decodedResponseBytes"`
+	ResponseRatio          string `json:"responseRatio"`
+	DecompressionTime      string `json:"decompressionTime"`
+}
+
+type AssertionReport struct {
+	Name              string           `json:"name"`
+	Severity          string           `json:"severity,omitempty"`
+	Failures          uint64           `json:"failures"`
+	EstimatedFailures uint64           `json:"estimatedFailures"`
+	Reasons           []FailureCount   `json:"reasons,omitempty"`
+	Violations        []ViolationCount `json:"violations,omitempty"`
+}
+
+type FailureCount struct {
+	Reason  string `json:"reason"`
+	Count   uint64 `json:"count"`
+	Example string `json:"example,omitempty"`
+}
+
+type ViolationCount struct {
+	SchemaPath string `json:"schemaPath"`
+	Count      uint64 `json:"count"`
+	Example    string `json:"example"`
+}
+
+type FailedResponse struct {
+	Assertion     string              `json:"assertion"`
+	Reason        string              `json:"reason"`
+	Error         string              `json:"error"`
+	StatusCode    int                 `json:"statusCode"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"bodyTruncated,omitempty"`
+	Payload       map[string]string   `json:"payload,omitempty"`
+}
+
 type BombardierRequest struct {
-	NumConns      uint64
-	NumReqs       uint64
-	Url           string
-	Method        string
-	Headers       []string
-	Body          string
-	PayloadFile   string `json:"payloadFile"`
-	PayloadUrl    string `json:"payloadUrl"`
-	VariableNames string
-	StartLine     uint32
-	Scope         string
-	Assertions    []Assertion
+	NumConns        uint64
+	NumReqs         uint64
+	Url             string
+	Method          string
+	Headers         []string
+	Host            string
+	OmitHeaders     []string
+	Body            string
+	BodyTemplate    bool
+	Form            []string
+	Multipart       bool
+	FollowRedirects uint64
+	CookieJar       bool
+	Cookies         []string
+	ResetSession    uint64
+	Compression     string
+	AcceptEncoding  string
+	PayloadFile     string `json:"payloadFile"`
+	PayloadUrl      string `json:"payloadUrl"`
+	Dataset         string `json:"dataset"`
+	VariableNames   string
+	PayloadFormat   string
+	PayloadHeader   bool
+	Delimiter       string
+	LazyQuotes      bool
+	PayloadStream   bool
+	PayloadBuffer   uint64
+	PayloadRewind   bool
+	PayloadStrategy string
+	PayloadSeed     int64
+	ZipfExponent    float64
+	PayloadHeaders  []string
+	PayloadToken    string
+	PayloadPageSize uint64
+	PayloadRetries  *uint64
+	PayloadTimeout  string
+	StartLine       uint32
+	Scope           string
+	Assertions      []Assertion
+	AssertMaxBody   uint64
+	AssertSample    float64
+	FailureSamples  *uint64
+	// Thresholds are like p99<300ms or errors<0.1%
+	Thresholds []string
+	// AbortIf are like errors>20% over 30s or p99>2s over 10s
+	AbortIf []string
+	// LatencyHistogram tells to include every latency in the response
+	LatencyHistogram bool
+	// Baseline is the result of an earlier test to compare with, as
+	// returned by the server or printed with --format json
+	Baseline     json.RawMessage
+	Tolerances   []string
+	Significance float64
+	// Timeseries tells to include the results of every second
+	Timeseries bool
+}
+
+// CompareRequest compares two results of tests, each is as returned by
+// the server or printed with --format json.
+type CompareRequest struct {
+	Baseline     json.RawMessage
+	Current      json.RawMessage
+	Tolerances   []string
+	Significance float64
+	// Format is json, plain-text or markdown
+	Format string
 }
 
 type BombardierResponse struct {
@@ -61,10 +192,84 @@ type BombardierResponse struct {
 	Status   Status  `json:"status"`
 	Latency  Latency `json:"latency"`
 	Tps      string  `json:"tps"`
+	// Rps and Errors are measured the same way as in the JSON results
+	// of bombardier, so that both can be compared with each other
+	Rps    float64 `json:"rps"`
+	Errors uint64  `json:"errors"`
+
+	Redirects   *Redirects   `json:"redirects,omitempty"`
+	Compression *Compression `json:"compression,omitempty"`
+
+	Assertions        []AssertionReport `json:"assertions,omitempty"`
+	AssertedResponses uint64            `json:"assertedResponses,omitempty"`
+	FailedResponses   []FailedResponse  `json:"failedResponses,omitempty"`
+
+	Aborted string `json:"aborted,omitempty"`
+
+	// Passed is false if any threshold isn't met or the test was aborted
+	Passed     bool              `json:"passed"`
+	Thresholds []ThresholdReport `json:"thresholds,omitempty"`
+
+	Comparison *ComparisonReport `json:"comparison,omitempty"`
+
+	Timeseries []IntervalReport `json:"timeseries,omitempty"`
 
 	ErrorCount uint64 `json:"errorCount"`
 }
 
+// IntervalReport is a line of the time series, latencies are in
+// microseconds.
+type IntervalReport struct {
+	Time            time.Time `json:"time"`
+	OffsetSeconds   float64   `json:"offsetSeconds"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Rps             float64   `json:"rps"`
+	LatencyMin      float64   `json:"latencyMin"`
+	LatencyMean     float64   `json:"latencyMean"`
+	LatencyP50      float64   `json:"latencyP50"`
+	LatencyP90      float64   `json:"latencyP90"`
+	LatencyP99      float64   `json:"latencyP99"`
+	LatencyMax      float64   `json:"latencyMax"`
+	Req1xx          uint64    `json:"req1xx"`
+	Req2xx          uint64    `json:"req2xx"`
+	Req3xx          uint64    `json:"req3xx"`
+	Req4xx          uint64    `json:"req4xx"`
+	Req5xx          uint64    `json:"req5xx"`
+	Others          uint64    `json:"others"`
+	Errors          uint64    `json:"errors"`
+	BytesRead       uint64    `json:"bytesRead"`
+	BytesWritten    uint64    `json:"bytesWritten"`
+}
+
+type ComparisonReport struct {
+	Metrics      []ComparedMetric    `json:"metrics"`
+	Significance *SignificanceReport `json:"significance,omitempty"`
+	Regressed    bool                `json:"regressed"`
+}
+
+type ComparedMetric struct {
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`
+	Baseline  float64 `json:"baseline"`
+	Current   float64 `json:"current"`
+	Delta     float64 `json:"delta"`
+	Tolerance float64 `json:"tolerance"`
+	Verdict   string  `json:"verdict"`
+}
+
+type SignificanceReport struct {
+	Statistic   float64 `json:"statistic"`
+	PValue      float64 `json:"pValue"`
+	Level       float64 `json:"level"`
+	Significant bool    `json:"significant"`
+}
+
+type ThresholdReport struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
 type RestStatus struct {
 	Code    int    `json:"code"`
 	Status  string `json:"status"`
@@ -80,18 +285,57 @@ func readBombardierRequest(ctx *fasthttp.RequestCtx) (*BombardierRequest, error)
 func newConfig(req *BombardierRequest) (*config, error) {
 
 	config := &config{
-		numReqs:     &req.NumReqs,
-		numConns:    req.NumConns,
-		url:         req.Url,
-		method:      req.Method,
-		headers:     &headersList{},
-		body:        req.Body,
-		format:      formatFromString("pt"),
-		payloadFile: req.PayloadFile,
-		payloadUrl:  req.PayloadUrl,
-		varNames:    req.VariableNames,
-		startLine:   req.StartLine,
-		scope:       getScope(req.Scope),
+		numReqs:             &req.NumReqs,
+		numConns:            req.NumConns,
+		url:                 req.Url,
+		method:              req.Method,
+		headers:             &headersList{},
+		host:                req.Host,
+		body:                req.Body,
+		bodyTemplate:        req.BodyTemplate,
+		multipart:           req.Multipart,
+		maxRedirects:        req.FollowRedirects,
+		cookieJar:           req.CookieJar,
+		resetSessionEvery:   req.ResetSession,
+		compression:         req.Compression,
+		acceptEncoding:      req.AcceptEncoding,
+		format:              formatFromString("pt"),
+		payloadFile:         req.PayloadFile,
+		payloadUrl:          req.PayloadUrl,
+		varNames:            req.VariableNames,
+		payloadFormat:       req.PayloadFormat,
+		payloadDelimiter:    req.Delimiter,
+		payloadHeader:       req.PayloadHeader,
+		payloadLazyQuotes:   req.LazyQuotes,
+		payloadStream:       req.PayloadStream,
+		payloadBufferSize:   req.PayloadBuffer,
+		payloadRewind:       req.PayloadRewind,
+		payloadStrategy:     req.PayloadStrategy,
+		payloadSeed:         req.PayloadSeed,
+		payloadZipfExponent: req.ZipfExponent,
+		payloadToken:        req.PayloadToken,
+		payloadPageSize:     req.PayloadPageSize,
+		payloadRetries:      req.PayloadRetries,
+		startLine:           req.StartLine,
+		assertMaxBody:       req.AssertMaxBody,
+		assertSample:        req.AssertSample,
+		failureSamples:      req.FailureSamples,
+		scope:               getScope(req.Scope),
+	}
+	if req.OmitHeaders != nil {
+		config.omitHeaders = &req.OmitHeaders
+	}
+	if req.Cookies != nil {
+		config.cookies = &req.Cookies
+	}
+	if req.Form != nil {
+		// the files would be read from the disk of the server
+		for _, spec := range req.Form {
+			if f, err := parseFormField(spec); err == nil && f.file {
+				return nil, errServerFormFile
+			}
+		}
+		config.form = &req.Form
 	}
 	if req.Headers != nil {
 		for _, header := range req.Headers {
@@ -100,21 +344,135 @@ func newConfig(req *BombardierRequest) (*config, error) {
 			}
 		}
 	}
+	if req.PayloadHeaders != nil {
+		config.payloadHeaders = new(headersList)
+		for _, header := range req.PayloadHeaders {
+			if err := config.payloadHeaders.Set(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req.PayloadTimeout != "" {
+		timeout, err := time.ParseDuration(req.PayloadTimeout)
+		if err != nil {
+			return nil, err
+		}
+		config.payloadTimeout = timeout
+	}
+	if req.Dataset != "" {
+		if err := useDataset(config, req.Dataset); err != nil {
+			return nil, err
+		}
+	}
 	assertions := make([]assertion, 0)
 	if req.Assertions != nil {
 		for _, a := range req.Assertions {
-			assertions = append(assertions, assertion{
-				asserter:   a.Asserter,
-				expression: a.Expression,
-				condition:  a.Condition,
-				expected:   a.Expected,
-			})
+			converted, err := toAssertion(a)
+			if err != nil {
+				return nil, err
+			}
+			assertions = append(assertions, converted)
 		}
 	}
 	config.assertions = &assertions
+	if len(req.Thresholds) > 0 {
+		thresholds := make([]threshold, 0, len(req.Thresholds))
+		for _, expr := range req.Thresholds {
+			t, err := parseThreshold(expr)
+			if err != nil {
+				return nil, err
+			}
+			thresholds = append(thresholds, t)
+		}
+		config.thresholds = &thresholds
+	}
+	if len(req.AbortIf) > 0 {
+		conditions := make([]abortCondition, 0, len(req.AbortIf))
+		for _, expr := range req.AbortIf {
+			c, err := parseAbortCondition(expr)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, c)
+		}
+		config.abortConditions = &conditions
+	}
+	config.latencyHistogram = req.LatencyHistogram
+	if len(req.Baseline) > 0 {
+		baseline, err := parseRunSummary(req.Baseline)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid baseline: %v", err)
+		}
+		config.baseline = &baseline
+	}
+	tolerances, err := parseTolerances(req.Tolerances)
+	if err != nil {
+		return nil, err
+	}
+	config.tolerances = tolerances
+	config.significance = req.Significance
+	config.timeseries = req.Timeseries
 	return config, nil
 }
 
+func toAssertion(a Assertion) (assertion, error) {
+	severity, abortAfter, err := parseAssertionSeverity(a.Severity)
+	if err != nil {
+		return assertion{}, err
+	}
+	res := assertion{
+		name:       a.Name,
+		asserter:   a.Asserter,
+		expression: a.Expression,
+		condition:  a.Condition,
+		expected:   a.Expected,
+		severity:   severity,
+		abortAfter: abortAfter,
+		ref:        a.Ref,
+	}
+	var members []Assertion
+	switch {
+	case a.AllOf != nil:
+		res.group, members = "allOf", a.AllOf
+	case a.AnyOf != nil:
+		res.group, members = "anyOf", a.AnyOf
+	case a.Not != nil:
+		res.group, members = "not", []Assertion{*a.Not}
+	}
+	for _, m := range members {
+		member, err := toAssertion(m)
+		if err != nil {
+			return assertion{}, err
+		}
+		res.members = append(res.members, member)
+	}
+	return res, nil
+}
+
+// useDataset sets the payload file of the config to the uploaded dataset
+// along with the options it was uploaded with.
+func useDataset(config *config, id string) error {
+	if config.payloadFile != "" || config.payloadUrl != "" {
+		return errDatasetPayloadFile
+	}
+	if datasets == nil {
+		return errNoDatasetStore
+	}
+	d, err := datasets.get(id)
+	if err != nil {
+		return err
+	}
+	opts := d.fileOptions()
+	config.payloadFile = datasets.path(d)
+	config.payloadFormat = opts.format
+	if config.payloadDelimiter == "" {
+		config.payloadDelimiter = opts.delimiter
+	}
+	config.payloadLazyQuotes = config.payloadLazyQuotes || opts.lazyQuotes
+	config.payloadHeader = opts.header
+	return nil
+}
+
 func gatherInfo(bombardier *bombardier) *BombardierResponse {
 	info := bombardier.gatherInfo()
 	percentiles := []float64{0.25, 0.5, 0.75, 0.9, 0.95, 0.99}
@@ -134,6 +492,13 @@ func gatherInfo(bombardier *bombardier) *BombardierResponse {
 		},
 	}
 
+	if bombardier.conf.latencyHistogram {
+		for _, kc := range internal.HistogramToKeyCounts(info.Result.Latencies) {
+			latency.Histogram = append(latency.Histogram,
+				LatencyCount{Latency: kc.Key, Count: kc.Count})
+		}
+	}
+
 	tps := float64(*bombardier.conf.numReqs) / bombardier.timeTaken.Seconds()
 	status := Status{Req1xx: info.Result.Req1XX,
 		Req2xx: info.Result.Req2XX,
@@ -142,16 +507,247 @@ func gatherInfo(bombardier *bombardier) *BombardierResponse {
 		Req5xx: info.Result.Req5XX,
 		Others: info.Result.Others}
 	return &BombardierResponse{
-		Url:        bombardier.conf.url,
-		NumConns:   bombardier.conf.numConns,
-		NumReqs:    *bombardier.conf.numReqs,
-		Status:     status,
-		Latency:    latency,
-		Tps:        fmt.Sprintf("%.2f", tps),
+		Url:         bombardier.conf.url,
+		NumConns:    bombardier.conf.numConns,
+		NumReqs:     *bombardier.conf.numReqs,
+		Status:      status,
+		Latency:     latency,
+		Tps:         fmt.Sprintf("%.2f", tps),
+		Rps:         rpsOf(&info.Result),
+		Errors:      errorsOf(&info.Result),
+		Redirects:   redirects(info.Result.Redirects),
+		Compression: compression(info.Result.Compression),
+
+		Assertions:        assertionReports(info.Result.Assertions),
+		AssertedResponses: info.Result.AssertedResponses,
+		FailedResponses:   failedResponses(info.Result.FailedResponses),
+
+		Aborted: info.Result.Aborted,
+
+		Passed:     info.Result.Passed(),
+		Thresholds: thresholdReports(info.Result.Thresholds),
+
+		Comparison: comparisonReport(bombardier.comparison(&info.Result)),
+
+		Timeseries: intervalReports(info.Result.Timeseries),
+
 		ErrorCount: bombardier.errorCount,
 	}
 }
 
+func intervalReport(i internal.Interval) IntervalReport {
+	return IntervalReport{
+		Time:            i.Start,
+		OffsetSeconds:   i.Offset.Seconds(),
+		DurationSeconds: i.Duration.Seconds(),
+		Rps:             i.Rps,
+		LatencyMin:      i.LatencyMin,
+		LatencyMean:     i.LatencyMean,
+		LatencyP50:      i.LatencyP50,
+		LatencyP90:      i.LatencyP90,
+		LatencyP99:      i.LatencyP99,
+		LatencyMax:      i.LatencyMax,
+		Req1xx:          i.Req1XX,
+		Req2xx:          i.Req2XX,
+		Req3xx:          i.Req3XX,
+		Req4xx:          i.Req4XX,
+		Req5xx:          i.Req5XX,
+		Others:          i.Others,
+		Errors:          i.Errors,
+		BytesRead:       i.BytesRead,
+		BytesWritten:    i.BytesWritten,
+	}
+}
+
+func intervalReports(series []internal.Interval) []IntervalReport {
+	if len(series) == 0 {
+		return nil
+	}
+	reports := make([]IntervalReport, 0, len(series))
+	for _, i := range series {
+		reports = append(reports, intervalReport(i))
+	}
+	return reports
+}
+
+func comparisonReport(c *internal.Comparison) *ComparisonReport {
+	if c == nil {
+		return nil
+	}
+	report := &ComparisonReport{
+		Metrics:   make([]ComparedMetric, 0, len(c.Metrics)),
+		Regressed: c.Regressed,
+	}
+	for _, m := range c.Metrics {
+		report.Metrics = append(report.Metrics, ComparedMetric{
+			Name:      m.Name,
+			Kind:      m.Kind,
+			Baseline:  m.Baseline,
+			Current:   m.Current,
+			Delta:     m.Delta,
+			Tolerance: m.Tolerance,
+			Verdict:   m.Verdict,
+		})
+	}
+	if s := c.Significance; s != nil {
+		report.Significance = &SignificanceReport{
+			Statistic:   s.Statistic,
+			PValue:      s.PValue,
+			Level:       s.Level,
+			Significant: s.Significant,
+		}
+	}
+	return report
+}
+
+func redirects(stats *internal.RedirectStats) *Redirects {
+	if stats == nil {
+		return nil
+	}
+	r := &Redirects{
+		MeanHops:   fmt.Sprintf("%.2f", stats.MeanHops()),
+		Time:       fmt.Sprintf("%.2f", float64(stats.TimeTaken.Microseconds())/1000),
+		Loops:      stats.Loops,
+		TooMany:    stats.TooManyRedirects,
+		Hops:       map[uint64]uint64{},
+		FinalCodes: map[uint64]uint64{},
+	}
+	for _, h := range stats.Hops {
+		r.Hops[h.Key] = h.Count
+	}
+	for _, c := range stats.FinalCodes {
+		r.FinalCodes[c.Key] = c.Count
+	}
+	return r
+}
+
+func compression(stats *internal.CompressionStats) *Compression {
+	if stats == nil {
+		return nil
+	}
+	return &Compression{
+		RequestBytes:           stats.RequestBytes,
+		CompressedRequestBytes: stats.CompressedRequestBytes,
+		RequestRatio:           fmt.Sprintf("%.2f", stats.RequestRatio()),
+		DecodedResponses:       stats.DecodedResponses,
+		EncodedResponseBytes:   stats.EncodedResponseBytes,
+		DecodedResponseBytes:   stats.DecodedResponseBytes,
+		ResponseRatio:          fmt.Sprintf("%.2f", stats.ResponseRatio()),
+		DecompressionTime: fmt.Sprintf("%.2f",
+			float64(stats.DecompressionTime.Microseconds())/1000),
+	}
+}
+
+func assertionReports(stats []internal.AssertionStats) []AssertionReport {
+	if len(stats) == 0 {
+		return nil
+	}
+	reports := make([]AssertionReport, 0, len(stats))
+	for _, s := range stats {
+		r := AssertionReport{
+			Name:              s.Name,
+			Severity:          s.Severity,
+			Failures:          s.Failures,
+			EstimatedFailures: s.EstimatedFailures,
+		}
+		for _, reason := range s.Reasons {
+			r.Reasons = append(r.Reasons, FailureCount{
+				Reason:  reason.Reason,
+				Count:   reason.Count,
+				Example: reason.Example,
+			})
+		}
+		for _, v := range s.Violations {
+			r.Violations = append(r.Violations, ViolationCount{
+				SchemaPath: v.SchemaPath,
+				Count:      v.Count,
+				Example:    v.Example,
+			})
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+func thresholdReports(results []internal.ThresholdResult) []ThresholdReport {
+	if len(results) == 0 {
+		return nil
+	}
+	reports := make([]ThresholdReport, 0, len(results))
+	for _, r := range results {
+		reports = append(reports, ThresholdReport{
+			Threshold: r.Threshold,
+			Actual:    r.Actual,
+			Passed:    r.Passed,
+		})
+	}
+	return reports
+}
+
+func failedResponses(samples []internal.FailedResponse) []FailedResponse {
+	if len(samples) == 0 {
+		return nil
+	}
+	res := make([]FailedResponse, 0, len(samples))
+	for _, s := range samples {
+		f := FailedResponse{
+			Assertion:     s.Assertion,
+			Reason:        s.Reason,
+			Error:         s.Error,
+			StatusCode:    s.StatusCode,
+			Body:          s.Body,
+			BodyTruncated: s.BodyTruncated,
+			Payload:       s.Payload,
+		}
+		if len(s.Headers) > 0 {
+			f.Headers = make(map[string][]string, len(s.Headers))
+			for _, h := range s.Headers {
+				f.Headers[h.Key] = append(f.Headers[h.Key], h.Value)
+			}
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// postBodyReader returns the body of the request, which is streamed by
+// the server.
+func postBodyReader(ctx *fasthttp.RequestCtx) io.Reader {
+	if stream := ctx.RequestBodyStream(); stream != nil {
+		return stream
+	}
+	return bytes.NewReader(ctx.PostBody())
+}
+
+// limitBody reads bodies of requests to h up to maxSize bytes and
+// rejects larger ones. Only dataset uploads may be larger, although the
+// server streams bodies of all the requests.
+func limitBody(h fasthttp.RequestHandler, maxSize int) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		// chunked bodies are rejected, since the stream of fasthttp
+		// loses the chunks larger than the buffer they are read into
+		size := ctx.Request.Header.ContentLength()
+		if size < 0 {
+			ctx.SetConnectionClose()
+			errorHandling(ctx, http.StatusLengthRequired, errBodyLengthRequired)
+			return
+		}
+		if size > maxSize {
+			ctx.SetConnectionClose()
+			errorHandling(ctx, http.StatusRequestEntityTooLarge, fasthttp.ErrBodyTooLarge)
+			return
+		}
+		body, err := ioutil.ReadAll(postBodyReader(ctx))
+		if err != nil {
+			ctx.SetConnectionClose()
+			errorHandling(ctx, http.StatusBadRequest, err)
+			return
+		}
+		ctx.Request.SetBody(body)
+		h(ctx)
+	}
+}
+
 func errorHandling(ctx *fasthttp.RequestCtx, code int, err error) {
 	status := RestStatus{}
 	status.Code = code
@@ -197,6 +793,218 @@ func requestHandling(ctx *fasthttp.RequestCtx) {
 	ctx.SetContentType("application/json")
 }
 
+func compareHandling(ctx *fasthttp.RequestCtx) {
+	req := &CompareRequest{}
+	if err := json.Unmarshal(ctx.PostBody(), req); err != nil {
+		errorHandling(ctx, http.StatusBadRequest, err)
+		return
+	}
+	format, ok := comparisonFormatFromString(req.Format)
+	if req.Format == "" {
+		format, ok = "json", true
+	}
+	if !ok {
+		errorHandling(ctx, http.StatusBadRequest,
+			fmt.Errorf("unknown comparison format %q", req.Format))
+		return
+	}
+	if req.Significance < 0 || req.Significance >= 1 {
+		errorHandling(ctx, http.StatusBadRequest, errInvalidSignificance)
+		return
+	}
+	baseline, err := parseRunSummary(req.Baseline)
+	if err != nil {
+		errorHandling(ctx, http.StatusBadRequest, fmt.Errorf("Invalid baseline: %v", err))
+		return
+	}
+	current, err := parseRunSummary(req.Current)
+	if err != nil {
+		errorHandling(ctx, http.StatusBadRequest, fmt.Errorf("Invalid current: %v", err))
+		return
+	}
+	tolerances, err := parseTolerances(req.Tolerances)
+	if err != nil {
+		errorHandling(ctx, http.StatusBadRequest, err)
+		return
+	}
+	opts := comparisonOptions{significance: req.Significance}
+	if tolerances != nil {
+		opts.tolerances = *tolerances
+	}
+	c := compareRuns(baseline, current, opts)
+	if format == "json" {
+		jsonResponse(ctx, http.StatusOK, comparisonReport(c))
+		return
+	}
+	if err := printComparison(ctx, format, c); err != nil {
+		errorHandling(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.SetStatusCode(http.StatusOK)
+	if format == "markdown" {
+		ctx.SetContentType("text/markdown; charset=utf-8")
+	} else {
+		ctx.SetContentType("text/plain; charset=utf-8")
+	}
+}
+
+// datasets are stored in the directory set by BOMBARDIER_DATA_DIR
+var datasets *datasetStore
+
+func datasetErrorHandling(ctx *fasthttp.RequestCtx, err error) {
+	switch err {
+	case errDatasetNotFound:
+		errorHandling(ctx, http.StatusNotFound, err)
+	case errDatasetTooLarge:
+		errorHandling(ctx, http.StatusRequestEntityTooLarge, err)
+	default:
+		// the rest of the filesystem errors are server's fault, while
+		// the others come from the file being invalid
+		var (
+			perr *os.PathError
+			lerr *os.LinkError
+		)
+		if errors.As(err, &perr) || errors.As(err, &lerr) {
+			errorHandling(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		errorHandling(ctx, http.StatusBadRequest, err)
+	}
+}
+
+func jsonResponse(ctx *fasthttp.RequestCtx, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		errorHandling(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.SetBody(body)
+	ctx.SetStatusCode(code)
+	ctx.SetContentType("application/json")
+}
+
+// maxUploadOverhead leaves room for the rest of the multipart form
+// besides the file of the dataset, the fields are kept in memory up to
+// this size as well.
+const maxUploadOverhead = 1 << 20
+
+// datasetUploadHandling stores the file of the multipart form field
+// "file". Optional fields are format, delimiter, lazyQuotes and sha256,
+// the checksum of the file in hex. The form is streamed to temporary
+// files instead of being buffered in memory.
+func datasetUploadHandling(ctx *fasthttp.RequestCtx) {
+	size := ctx.Request.Header.ContentLength()
+	if size < 0 {
+		ctx.SetConnectionClose()
+		errorHandling(ctx, http.StatusLengthRequired, errBodyLengthRequired)
+		return
+	}
+	if int64(size) > datasets.maxSize+maxUploadOverhead {
+		ctx.SetConnectionClose()
+		datasetErrorHandling(ctx, errDatasetTooLarge)
+		return
+	}
+	boundary := string(ctx.Request.Header.MultipartFormBoundary())
+	if boundary == "" {
+		errorHandling(ctx, http.StatusBadRequest, errNotMultipartForm)
+		return
+	}
+	form, err := multipart.NewReader(postBodyReader(ctx), boundary).
+		ReadForm(maxUploadOverhead)
+	if err != nil {
+		errorHandling(ctx, http.StatusBadRequest, err)
+		return
+	}
+	defer form.RemoveAll()
+	files := form.File["file"]
+	if len(files) != 1 {
+		errorHandling(ctx, http.StatusBadRequest,
+			fmt.Errorf("Expected one file in the \"file\" field, but got %v", len(files)))
+		return
+	}
+	value := func(key string) string {
+		if v := form.Value[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	opts := payloadFileOptions{
+		format:    value("format"),
+		delimiter: value("delimiter"),
+	}
+	if lazyQuotes := value("lazyQuotes"); lazyQuotes != "" {
+		if opts.lazyQuotes, err = strconv.ParseBool(lazyQuotes); err != nil {
+			errorHandling(ctx, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if files[0].Size > datasets.maxSize {
+		datasetErrorHandling(ctx, errDatasetTooLarge)
+		return
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		errorHandling(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+	d, err := datasets.add(files[0].Filename, file, opts, value("sha256"))
+	if err != nil {
+		datasetErrorHandling(ctx, err)
+		return
+	}
+	jsonResponse(ctx, http.StatusCreated, d)
+}
+
+func datasetListHandling(ctx *fasthttp.RequestCtx) {
+	list, err := datasets.list()
+	if err != nil {
+		errorHandling(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	jsonResponse(ctx, http.StatusOK, list)
+}
+
+func datasetHandling(ctx *fasthttp.RequestCtx) {
+	d, err := datasets.get(ctx.UserValue("id").(string))
+	if err != nil {
+		datasetErrorHandling(ctx, err)
+		return
+	}
+	jsonResponse(ctx, http.StatusOK, d)
+}
+
+// datasetPreviewHandling returns the first rows of the dataset, their
+// number is set by the rows query parameter.
+func datasetPreviewHandling(ctx *fasthttp.RequestCtx) {
+	n := defaultPreviewRows
+	if rows := ctx.QueryArgs().Peek("rows"); len(rows) > 0 {
+		var err error
+		if n, err = strconv.Atoi(string(rows)); err != nil || n < 1 {
+			errorHandling(ctx, http.StatusBadRequest,
+				fmt.Errorf("Invalid number of rows %q", rows))
+			return
+		}
+		if n > maxPreviewRows {
+			n = maxPreviewRows
+		}
+	}
+	p, err := datasets.preview(ctx.UserValue("id").(string), n)
+	if err != nil {
+		datasetErrorHandling(ctx, err)
+		return
+	}
+	jsonResponse(ctx, http.StatusOK, p)
+}
+
+func datasetDeleteHandling(ctx *fasthttp.RequestCtx) {
+	if err := datasets.remove(ctx.UserValue("id").(string)); err != nil {
+		datasetErrorHandling(ctx, err)
+		return
+	}
+	ctx.SetStatusCode(http.StatusNoContent)
+}
+
 var upgrader = websocket.FastHTTPUpgrader{} // use default options
 
 func webSocketRequestHandling(c *websocket.Conn) {
@@ -254,6 +1062,31 @@ func webSocketRequestHandling(c *websocket.Conn) {
 	c.WriteMessage(websocket.TextMessage, respData)
 }
 
+// newServer returns the server of the API. Bodies of requests are
+// streamed, so that datasets are uploaded straight to the disk, and
+// limited by the routes.
+func newServer() *fasthttp.Server {
+	router := fasthttprouter.New()
+
+	router.POST("/api/pt", limitBody(requestHandling, fasthttp.DefaultMaxRequestBodySize))
+	router.POST("/api/compare", limitBody(compareHandling, fasthttp.DefaultMaxRequestBodySize))
+	router.POST("/api/datasets", datasetUploadHandling)
+	router.GET("/api/datasets", datasetListHandling)
+	router.GET("/api/datasets/:id", datasetHandling)
+	router.GET("/api/datasets/:id/preview", datasetPreviewHandling)
+	router.DELETE("/api/datasets/:id", datasetDeleteHandling)
+
+	router.GET("/ws", func(ctx *fasthttp.RequestCtx) {
+		upgrader.Upgrade(ctx, webSocketRequestHandling)
+	})
+
+	return &fasthttp.Server{
+		Handler:                      router.Handler,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	}
+}
+
 func main() {
 	ln, err := net.Listen("tcp4", ":8081")
 	if err != nil {
@@ -261,13 +1094,21 @@ func main() {
 		os.Exit(-5)
 	}
 
-	router := fasthttprouter.New()
-
-	router.POST("/api/pt", requestHandling)
-
-	router.GET("/ws", func(ctx *fasthttp.RequestCtx) {
-		upgrader.Upgrade(ctx, webSocketRequestHandling)
-	})
+	dataDir := os.Getenv("BOMBARDIER_DATA_DIR")
+	if dataDir == "" {
+		dataDir = defaultDatasetDir
+	}
+	maxSize := int64(defaultMaxDatasetSize)
+	if size := os.Getenv("BOMBARDIER_MAX_DATASET_SIZE"); size != "" {
+		if maxSize, err = strconv.ParseInt(size, decBase, 64); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-5)
+		}
+	}
+	if datasets, err = newDatasetStore(dataDir, maxSize); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-5)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -275,5 +1116,6 @@ func main() {
 		<-c
 		_ = ln.Close()
 	}()
-	_ = fasthttp.Serve(ln, router.Handler)
+	server := newServer()
+	_ = server.Serve(ln)
 }
@@ -5,18 +5,24 @@ import (
 	"container/ring"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/codesenberg/bombardier/internal"
+
 	"github.com/valyala/fasthttp"
 )
 
@@ -110,19 +116,14 @@ func testBombardierShouldSendHeaders(clientType clientTyp, t *testing.T) {
 	requestHeaders := headersList([]header{
 		{"Header1", "Value1"},
 		{"Header-Two", "value-two"},
+		{"host", "web"},
 	})
 
-	// It's a bit hacky, but FastHTTP can't send Host header correctly
-	// as of now
-	if clientType != fhttp {
-		requestHeaders = append(requestHeaders, header{"Host", "web"})
-	}
-
 	s := httptest.NewServer(
 		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 			for _, h := range requestHeaders {
 				av := r.Header.Get(h.key)
-				if h.key == "Host" {
+				if h.key == "host" {
 					av = r.Host
 				}
 				if av != h.value {
@@ -740,3 +741,1781 @@ func testBombardierShouldSendCustomHostHeader(
 	b.disableOutput()
 	b.bombard()
 }
+
+func TestBombardierShouldOverrideHostHeader(t *testing.T) {
+	testAllClients(t, testBombardierShouldOverrideHostHeader)
+}
+
+func testBombardierShouldOverrideHostHeader(
+	clientType clientTyp, t *testing.T,
+) {
+	host := "override-host"
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.Host != host {
+				t.Errorf("Host must be %q, but it's %q", host, r.Host)
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	headers := headersList([]header{
+		{"Host", "custom-host"},
+	})
+	b, e := newBombardier(config{
+		numConns:   defaultNumberOfConns,
+		numReqs:    &numReqs,
+		url:        s.URL,
+		headers:    &headers,
+		host:       host,
+		timeout:    defaultTimeout,
+		method:     "GET",
+		body:       "",
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+}
+
+func TestBombardierShouldSendRepeatedHeaders(t *testing.T) {
+	testAllClients(t, testBombardierShouldSendRepeatedHeaders)
+}
+
+func testBombardierShouldSendRepeatedHeaders(
+	clientType clientTyp, t *testing.T,
+) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			e := []string{"first", "second", "third"}
+			if a := r.Header["X-Repeated"]; !reflect.DeepEqual(e, a) {
+				t.Errorf("Expected %v, but got %v", e, a)
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	headers := headersList([]header{
+		{"X-Repeated", "first"},
+		{"X-Other", "value"},
+		{"X-Repeated", "second"},
+		{"X-Repeated", "third"},
+	})
+	b, e := newBombardier(config{
+		numConns:   defaultNumberOfConns,
+		numReqs:    &numReqs,
+		url:        s.URL,
+		headers:    &headers,
+		timeout:    defaultTimeout,
+		method:     "GET",
+		body:       "",
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+}
+
+func TestBombardierShouldOmitDefaultHeaders(t *testing.T) {
+	testAllClients(t, testBombardierShouldOmitDefaultHeaders)
+}
+
+func testBombardierShouldOmitDefaultHeaders(
+	clientType clientTyp, t *testing.T,
+) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			for _, h := range omittableHeaders {
+				if v, ok := r.Header[h]; ok {
+					t.Errorf("%v header must be omitted, but got %v", h, v)
+				}
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	omitHeaders := []string{"user-agent", "Accept-Encoding", "connection"}
+	b, e := newBombardier(config{
+		numConns:    defaultNumberOfConns,
+		numReqs:     &numReqs,
+		url:         s.URL,
+		headers:     new(headersList),
+		omitHeaders: &omitHeaders,
+		timeout:     defaultTimeout,
+		method:      "GET",
+		body:        "",
+		clientType:  clientType,
+		format:      knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs {
+		t.Errorf("Expected %v successful requests, but got %v",
+			numReqs, b.req2xx)
+	}
+}
+
+func TestBombardierShouldFollowRedirects(t *testing.T) {
+	testAllClients(t, testBombardierShouldFollowRedirects)
+}
+
+func testBombardierShouldFollowRedirects(
+	clientType clientTyp, t *testing.T,
+) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/":
+				http.Redirect(rw, r, "/middle", http.StatusFound)
+			case "/middle":
+				http.Redirect(rw, r, "/end", http.StatusSeeOther)
+			case "/loop":
+				http.Redirect(rw, r, "/loop", http.StatusFound)
+			case "/app":
+				if _, err := r.Cookie("sid"); err != nil {
+					http.Redirect(rw, r, "/login", http.StatusFound)
+				}
+			case "/login":
+				http.SetCookie(rw, &http.Cookie{Name: "sid", Value: "1"})
+				http.Redirect(rw, r, "/app", http.StatusFound)
+			case "/post":
+				http.Redirect(rw, r, "/echo", http.StatusTemporaryRedirect)
+			case "/echo":
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil || r.Method != "POST" || string(body) != "data" {
+					rw.WriteHeader(http.StatusBadRequest)
+				}
+			}
+		}),
+	)
+	defer s.Close()
+	expectations := []struct {
+		path         string
+		method, body string
+		bodyTemplate bool
+		cookieJar    bool
+		maxRedirects uint64
+		hops         uint64
+		code         uint64
+		loops        uint64
+		tooMany      uint64
+	}{
+		{"/", "GET", "", false, false, 2, 2, 200, 0, 0},
+		{"/", "GET", "", false, false, 1, 1, 303, 0, 10},
+		{"/loop", "GET", "", false, false, 5, 0, 302, 10, 0},
+		{"/app", "GET", "", false, false, 5, 1, 302, 10, 0},
+		{"/app", "GET", "", false, true, 5, 2, 200, 0, 0},
+		{"/post", "POST", "data", false, false, 1, 1, 200, 0, 0},
+		{"/post", "POST", `{{ print "da" "ta" }}`, true, false, 1, 1, 200, 0, 0},
+	}
+	for _, e := range expectations {
+		numReqs := uint64(10)
+		b, err := newBombardier(config{
+			numConns:     defaultNumberOfConns,
+			numReqs:      &numReqs,
+			url:          s.URL + e.path,
+			headers:      new(headersList),
+			timeout:      defaultTimeout,
+			method:       e.method,
+			body:         e.body,
+			bodyTemplate: e.bodyTemplate,
+			maxRedirects: e.maxRedirects,
+			cookieJar:    e.cookieJar,
+			clientType:   clientType,
+			format:       knownFormat("plain-text"),
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b.disableOutput()
+		b.bombard()
+		info := b.redirects.info()
+		if len(info.Hops) != 1 || info.Hops[0] != (internal.KeyCount{
+			Key: e.hops, Count: numReqs,
+		}) {
+			t.Errorf("%v: unexpected hops %v", e, info.Hops)
+		}
+		if len(info.FinalCodes) != 1 || info.FinalCodes[0] != (internal.KeyCount{
+			Key: e.code, Count: numReqs,
+		}) {
+			t.Errorf("%v: unexpected final codes %v", e, info.FinalCodes)
+		}
+		if info.Loops != e.loops || info.TooManyRedirects != e.tooMany {
+			t.Errorf("%v: expected %v loops and %v too many redirects, "+
+				"but got %v and %v", e, e.loops, e.tooMany,
+				info.Loops, info.TooManyRedirects)
+		}
+	}
+}
+
+func TestBombardierShouldKeepSessions(t *testing.T) {
+	testAllClients(t, testBombardierShouldKeepSessions)
+}
+
+func testBombardierShouldKeepSessions(clientType clientTyp, t *testing.T) {
+	sessionsStarted := uint64(0)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if _, err := r.Cookie("sid"); err != nil {
+				atomic.AddUint64(&sessionsStarted, 1)
+				http.SetCookie(rw, &http.Cookie{Name: "sid", Value: "1"})
+				http.Redirect(rw, r, "/home", http.StatusFound)
+				return
+			}
+			if r.URL.Path != "/home" {
+				http.Redirect(rw, r, "/home", http.StatusFound)
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(20)
+	b, e := newBombardier(config{
+		numConns:          1,
+		numReqs:           &numReqs,
+		url:               s.URL,
+		headers:           new(headersList),
+		timeout:           defaultTimeout,
+		method:            "GET",
+		body:              "",
+		maxRedirects:      1,
+		cookieJar:         true,
+		resetSessionEvery: 5,
+		clientType:        clientType,
+		format:            knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs {
+		t.Errorf("Expected %v successful requests, but got %v",
+			numReqs, b.req2xx)
+	}
+	if e, a := numReqs/5, sessionsStarted; e != a {
+		t.Errorf("Expected %v sessions, but got %v", e, a)
+	}
+}
+
+func TestBombardierShouldCompressBodies(t *testing.T) {
+	testAllClients(t, testBombardierShouldCompressBodies)
+}
+
+func testBombardierShouldCompressBodies(clientType clientTyp, t *testing.T) {
+	requestBody := strings.Repeat("payload", 100)
+	responseBody := `{"user":{"name":"` + strings.Repeat("Tom", 100) + `"}}`
+	compressedResponse := compressBody("gzip", []byte(responseBody))
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err == nil {
+				body, err = decompressBody(
+					r.Header.Get("Content-Encoding"), body, defaultAssertMaxBody,
+				)
+			}
+			if err != nil || string(body) != requestBody {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				rw.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			rw.Header().Set("Content-Encoding", "gzip")
+			_, _ = rw.Write(compressedResponse)
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	b, e := newBombardier(config{
+		numConns:       1,
+		numReqs:        &numReqs,
+		url:            s.URL,
+		headers:        new(headersList),
+		timeout:        defaultTimeout,
+		method:         "POST",
+		body:           requestBody,
+		compression:    "deflate",
+		acceptEncoding: "gzip",
+		clientType:     clientType,
+		format:         knownFormat("plain-text"),
+		assertions: &[]assertion{{
+			asserter:   "JsonPath",
+			expression: "$.user.name",
+			condition:  "NOT_NULL",
+		}},
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs || b.errorCount != 0 {
+		t.Errorf("Expected %v successful requests, but got %v (%v failed)",
+			numReqs, b.req2xx, b.errorCount)
+	}
+	info := b.compression.info()
+	if e, a := int64(len(requestBody))*int64(numReqs), info.RequestBytes; e != a {
+		t.Errorf("Expected %v raw request bytes, but got %v", e, a)
+	}
+	if info.CompressedRequestBytes >= info.RequestBytes {
+		t.Errorf("Request bodies weren't compressed: %v >= %v",
+			info.CompressedRequestBytes, info.RequestBytes)
+	}
+	if info.DecodedResponses != numReqs {
+		t.Errorf("Expected %v decoded responses, but got %v",
+			numReqs, info.DecodedResponses)
+	}
+	if e, a := int64(len(responseBody))*int64(numReqs), info.DecodedResponseBytes; e != a {
+		t.Errorf("Expected %v decoded bytes, but got %v", e, a)
+	}
+}
+
+func TestBombardierShouldOnlyDecodeResponsesAskedFor(t *testing.T) {
+	testAllClients(t, testBombardierShouldOnlyDecodeResponsesAskedFor)
+}
+
+func testBombardierShouldOnlyDecodeResponsesAskedFor(
+	clientType clientTyp, t *testing.T,
+) {
+	// a bomb decoded to far more than the limit of bodies
+	bomb := compressBody("gzip", make([]byte, 4*defaultAssertMaxBody))
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Encoding", "gzip")
+			_, _ = rw.Write(bomb)
+		}),
+	)
+	defer s.Close()
+	expectations := []struct {
+		compression, acceptEncoding string
+		decoded                     uint64
+	}{
+		{"gzip", "", 0},
+		{"", "gzip", 10},
+	}
+	for _, e := range expectations {
+		numReqs := uint64(10)
+		b, err := newBombardier(config{
+			numConns:       1,
+			numReqs:        &numReqs,
+			url:            s.URL,
+			headers:        new(headersList),
+			timeout:        defaultTimeout,
+			method:         "POST",
+			body:           "body",
+			compression:    e.compression,
+			acceptEncoding: e.acceptEncoding,
+			clientType:     clientType,
+			format:         knownFormat("plain-text"),
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b.disableOutput()
+		b.bombard()
+		if b.req2xx != numReqs || b.errorCount != 0 {
+			t.Errorf("%+v: expected %v successful requests, but got %v (%v failed)",
+				e, numReqs, b.req2xx, b.errorCount)
+		}
+		info := b.compression.info()
+		if info.DecodedResponses != e.decoded {
+			t.Errorf("%+v: expected %v decoded responses, but got %v",
+				e, e.decoded, info.DecodedResponses)
+		}
+		if max := int64(numReqs) * (defaultAssertMaxBody + 1); info.DecodedResponseBytes > max {
+			t.Errorf("%+v: expected at most %v decoded bytes, but got %v",
+				e, max, info.DecodedResponseBytes)
+		}
+	}
+}
+
+func TestBombardierShouldUploadForms(t *testing.T) {
+	testAllClients(t, testBombardierShouldUploadForms)
+}
+
+func testBombardierShouldUploadForms(clientType clientTyp, t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{"a.txt", "b.txt"}
+	for _, name := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	payloadFile := filepath.Join(dir, "payload.csv")
+	err = ioutil.WriteFile(payloadFile, []byte("a.txt\nb.txt\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		received = map[string]int{}
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			f, fh, err := r.FormFile("doc")
+			if err != nil || r.ContentLength <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			content, _ := ioutil.ReadAll(f)
+			if string(content) != fh.Filename ||
+				r.FormValue("owner") != "bombardier" {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			received[fh.Filename]++
+			mu.Unlock()
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	b, e := newBombardier(config{
+		numConns:    1,
+		numReqs:     &numReqs,
+		url:         s.URL,
+		headers:     new(headersList),
+		timeout:     defaultTimeout,
+		method:      "POST",
+		form:        &[]string{"owner=bombardier", "doc=@" + dir + "/${file}"},
+		payloadFile: payloadFile,
+		varNames:    "file",
+		clientType:  clientType,
+		format:      knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs {
+		t.Errorf("Expected %v successful requests, but got %v",
+			numReqs, b.req2xx)
+	}
+	for _, name := range files {
+		if received[name] != int(numReqs)/len(files) {
+			t.Errorf("Expected %v uploads of %v, but got %v",
+				int(numReqs)/len(files), name, received[name])
+		}
+	}
+}
+
+func TestBombardierShouldEvaluateGenerators(t *testing.T) {
+	testAllClients(t, testBombardierShouldEvaluateGenerators)
+}
+
+func testBombardierShouldEvaluateGenerators(clientType clientTyp, t *testing.T) {
+	var (
+		mu       sync.Mutex
+		paths    = map[string]bool{}
+		keys     = map[string]bool{}
+		bodies   = map[string]bool{}
+		failures uint64
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			paths[r.URL.Path] = true
+			keys[r.Header.Get("Idempotency-Key")] = true
+			bodies[string(body)] = true
+			if r.URL.Query().Get("n") == "" {
+				failures++
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(50)
+	headers := new(headersList)
+	_ = headers.Set("Idempotency-Key: ${__uuid}")
+	b, e := newBombardier(config{
+		numConns:   5,
+		numReqs:    &numReqs,
+		url:        s.URL + "/orders/${__seq}?n=${__randInt(1,10)}",
+		headers:    headers,
+		timeout:    defaultTimeout,
+		method:     "POST",
+		body:       `{"worker":"${__threadSeq}","id":"${__seq}"}`,
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs || failures != 0 {
+		t.Errorf("Expected %v successful requests, but got %v (%v failed)",
+			numReqs, b.req2xx, failures)
+	}
+	for name, values := range map[string]map[string]bool{
+		"paths": paths, "keys": keys, "bodies": bodies,
+	} {
+		if uint64(len(values)) != numReqs {
+			t.Errorf("Expected %v distinct %v, but got %v",
+				numReqs, name, len(values))
+		}
+	}
+}
+
+func TestBombardierShouldRejectInvalidGenerators(t *testing.T) {
+	numReqs := uint64(1)
+	_, e := newBombardier(config{
+		numConns: 1,
+		numReqs:  &numReqs,
+		url:      "http://localhost/${__randInt(5,1)}",
+		headers:  new(headersList),
+		timeout:  defaultTimeout,
+		method:   "GET",
+		format:   knownFormat("plain-text"),
+	})
+	if e == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestBombardierShouldVerifyPlaceholders(t *testing.T) {
+	payloadFile, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(payloadFile.Name())
+	_, _ = payloadFile.WriteString("Tom,secret\n")
+	_ = payloadFile.Close()
+
+	expectations := []struct {
+		url, payloadFile string
+		valid            bool
+	}{
+		{"http://localhost/${name}", payloadFile.Name(), true},
+		{"http://localhost/${name|hmacSHA256:key}", payloadFile.Name(), true},
+		{"http://localhost/${age}", payloadFile.Name(), false},
+		{"http://localhost/${age:-42}", payloadFile.Name(), true},
+		{"http://localhost/${name|hmacSHA256:salt}", payloadFile.Name(), false},
+		{"http://localhost/${name|unknown}", payloadFile.Name(), false},
+		// without payload variables are only resolved if they have
+		// defaults
+		{"http://localhost/${name}", "", true},
+		{"http://localhost/${name:-Tom|hmacSHA256:key}", "", false},
+	}
+	for _, e := range expectations {
+		numReqs := uint64(1)
+		_, err := newBombardier(config{
+			numConns:    1,
+			numReqs:     &numReqs,
+			url:         e.url,
+			headers:     new(headersList),
+			timeout:     defaultTimeout,
+			method:      "GET",
+			payloadFile: e.payloadFile,
+			varNames:    "name,key",
+			format:      knownFormat("plain-text"),
+		})
+		if (err == nil) != e.valid {
+			t.Errorf("%v (payload %q): expected valid = %v, but got %v",
+				e.url, e.payloadFile, e.valid, err)
+		}
+	}
+}
+
+func TestBombardierShouldApplyFiltersAndDefaults(t *testing.T) {
+	testAllClients(t, testBombardierShouldApplyFiltersAndDefaults)
+}
+
+func testBombardierShouldApplyFiltersAndDefaults(
+	clientType clientTyp, t *testing.T,
+) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		query  []string
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			bodies = append(bodies, string(body))
+			query = append(query, r.URL.Query().Get("q"))
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(1)
+	b, e := newBombardier(config{
+		numConns:   1,
+		numReqs:    &numReqs,
+		url:        s.URL + "/?q=${query:-a&b c|urlencode}",
+		headers:    new(headersList),
+		timeout:    defaultTimeout,
+		method:     "POST",
+		body:       `{"name":"${name:-"Tom"|json}","literal":"$${name}"}`,
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	expectedBody := `{"name":"\"Tom\"","literal":"${name}"}`
+	if len(bodies) != 1 || bodies[0] != expectedBody || query[0] != "a&b c" {
+		t.Errorf("Expected %q and %q, but got %q and %q",
+			expectedBody, "a&b c", bodies, query)
+	}
+}
+
+func TestBombardierShouldRenderBodyTemplates(t *testing.T) {
+	testAllClients(t, testBombardierShouldRenderBodyTemplates)
+}
+
+func testBombardierShouldRenderBodyTemplates(clientType clientTyp, t *testing.T) {
+	payloadFile, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(payloadFile.Name())
+	_, _ = payloadFile.WriteString("Tom,1\nAnn,3\n")
+	_ = payloadFile.Close()
+
+	var (
+		mu       sync.Mutex
+		failures uint64
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			var order struct {
+				User  string
+				Items []int
+			}
+			err := json.NewDecoder(r.Body).Decode(&order)
+			mu.Lock()
+			defer mu.Unlock()
+			expected := map[string]int{"Tom": 1, "Ann": 3}[order.User]
+			if err != nil || expected == 0 || len(order.Items) != expected {
+				failures++
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(20)
+	b, e := newBombardier(config{
+		numConns: 2,
+		numReqs:  &numReqs,
+		url:      s.URL,
+		headers:  new(headersList),
+		timeout:  defaultTimeout,
+		method:   "POST",
+		body: `{"user":{{JSON .name}},"items":[` +
+			`{{range $i, $_ := Seq (Int .count)}}{{if $i}},{{end}}{{$i}}{{end}}]}`,
+		bodyTemplate: true,
+		payloadFile:  payloadFile.Name(),
+		varNames:     "name,count",
+		clientType:   clientType,
+		format:       knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs || failures != 0 {
+		t.Errorf("Expected %v successful requests, but got %v (%v failed)",
+			numReqs, b.req2xx, failures)
+	}
+}
+
+func TestBombardierShouldStreamPayloads(t *testing.T) {
+	testAllClients(t, testBombardierShouldStreamPayloads)
+}
+
+func testBombardierShouldStreamPayloads(clientType clientTyp, t *testing.T) {
+	payloadFile, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(payloadFile.Name())
+	const numRows = 100
+	_, _ = payloadFile.WriteString("id\n")
+	for i := 0; i < numRows; i++ {
+		_, _ = payloadFile.WriteString(strconv.Itoa(i) + "\n")
+	}
+	_ = payloadFile.Close()
+
+	var (
+		mu    sync.Mutex
+		paths = map[string]bool{}
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			paths[r.URL.Path] = true
+		}),
+	)
+	defer s.Close()
+	// the test stops once the payload is exhausted, timed ones too
+	numReqs, duration := uint64(numRows+10), 10*time.Second
+	for _, c := range []config{
+		{numReqs: &numReqs},
+		{duration: &duration},
+	} {
+		paths = map[string]bool{}
+		c.numConns = 5
+		c.url = s.URL + "/users/${id}"
+		c.headers = new(headersList)
+		c.timeout = defaultTimeout
+		c.method = "GET"
+		c.payloadFile = payloadFile.Name()
+		c.payloadStream = true
+		c.payloadBufferSize = 8
+		c.clientType = clientType
+		c.format = knownFormat("plain-text")
+		b, e := newBombardier(c)
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		b.disableOutput()
+		start := time.Now()
+		b.bombard()
+		if b.req2xx != numRows || len(paths) != numRows {
+			t.Errorf("Expected %v distinct successful requests, but got %v (%v)",
+				numRows, len(paths), b.req2xx)
+		}
+		if b.errorCount != 0 || b.errors.sum() != 0 || b.others != 0 {
+			t.Errorf("Expected no errors, but got %v, %v, %v",
+				b.errorCount, b.errors.sum(), b.others)
+		}
+		if elapsed := time.Since(start); elapsed > duration/2 {
+			t.Errorf("Expected the test to stop after the last row, "+
+				"but it took %v", elapsed)
+		}
+	}
+}
+
+func TestBombardierShouldAbortWhenPayloadStreamFails(t *testing.T) {
+	testAllClients(t, testBombardierShouldAbortWhenPayloadStreamFails)
+}
+
+func testBombardierShouldAbortWhenPayloadStreamFails(
+	clientType clientTyp, t *testing.T,
+) {
+	payloadFile, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(payloadFile.Name())
+	// the third row has too many fields
+	_, _ = payloadFile.WriteString("id\n1\n2\n3,4\n5\n")
+	_ = payloadFile.Close()
+
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}),
+	)
+	defer s.Close()
+	duration := 10 * time.Second
+	b, e := newBombardier(config{
+		numConns:          2,
+		duration:          &duration,
+		url:               s.URL + "/users/${id}",
+		headers:           new(headersList),
+		timeout:           defaultTimeout,
+		method:            "GET",
+		payloadFile:       payloadFile.Name(),
+		payloadStream:     true,
+		payloadBufferSize: 1,
+		clientType:        clientType,
+		format:            knownFormat("plain-text"),
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	b.disableOutput()
+	start := time.Now()
+	b.bombard()
+	if elapsed := time.Since(start); elapsed > duration/2 {
+		t.Errorf("Expected the test to be aborted, but it took %v", elapsed)
+	}
+	if b.req2xx != 2 || b.errors.sum() != 0 {
+		t.Errorf("Expected 2 successful requests and no errors, but got %v, %v",
+			b.req2xx, b.errors.sum())
+	}
+	if !strings.HasPrefix(b.aborted, "reading of payload failed: ") {
+		t.Errorf("Unexpected reason of abort %q", b.aborted)
+	}
+}
+
+func TestBombardierShouldStartPayloadURLOver(t *testing.T) {
+	testAllClients(t, testBombardierShouldStartPayloadURLOver)
+}
+
+func testBombardierShouldStartPayloadURLOver(clientType clientTyp, t *testing.T) {
+	const numRows = 3
+	payloadServer := newPayloadServer(numRows, "json", nil)
+	defer payloadServer.Close()
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}),
+	)
+	defer s.Close()
+	expectations := []struct {
+		strategy string
+		requests uint64
+	}{
+		{"", 10},
+		{"unique", numRows},
+	}
+	for _, e := range expectations {
+		numReqs := uint64(10)
+		b, err := newBombardier(config{
+			numConns:        2,
+			numReqs:         &numReqs,
+			url:             s.URL + "/users/${id}",
+			headers:         new(headersList),
+			timeout:         defaultTimeout,
+			method:          "GET",
+			payloadUrl:      payloadServer.URL,
+			payloadStrategy: e.strategy,
+			clientType:      clientType,
+			format:          knownFormat("plain-text"),
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b.disableOutput()
+		b.bombard()
+		if b.req2xx != e.requests || b.errors.sum() != 0 {
+			t.Errorf("%q: expected %v successful requests, but got %v (%v errors)",
+				e.strategy, e.requests, b.req2xx, b.errors.sum())
+		}
+	}
+}
+
+func TestBombardierShouldStopWhenUniquePayloadIsExhausted(t *testing.T) {
+	testAllClients(t, testBombardierShouldStopWhenUniquePayloadIsExhausted)
+}
+
+func testBombardierShouldStopWhenUniquePayloadIsExhausted(
+	clientType clientTyp, t *testing.T,
+) {
+	payloadFile, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(payloadFile.Name())
+	const numRows = 30
+	_, _ = payloadFile.WriteString("code\n")
+	for i := 0; i < numRows; i++ {
+		_, _ = payloadFile.WriteString("coupon" + strconv.Itoa(i) + "\n")
+	}
+	_ = payloadFile.Close()
+
+	for _, stream := range []bool{false, true} {
+		var (
+			mu    sync.Mutex
+			codes = map[string]int{}
+		)
+		s := httptest.NewServer(
+			http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				codes[r.URL.Query().Get("code")]++
+			}),
+		)
+		numReqs := uint64(1000)
+		b, e := newBombardier(config{
+			numConns:        4,
+			numReqs:         &numReqs,
+			url:             s.URL + "/redeem?code=${code}",
+			headers:         new(headersList),
+			timeout:         defaultTimeout,
+			method:          "GET",
+			payloadFile:     payloadFile.Name(),
+			payloadStream:   stream,
+			payloadStrategy: "unique",
+			clientType:      clientType,
+			format:          knownFormat("plain-text"),
+		})
+		if e != nil {
+			t.Error(e)
+			s.Close()
+			return
+		}
+		b.disableOutput()
+		b.bombard()
+		s.Close()
+		if b.req2xx != numRows || b.errorCount != 0 {
+			t.Errorf("Stream %v: expected %v successful requests, but got "+
+				"%v (%v errors)", stream, numRows, b.req2xx, b.errorCount)
+		}
+		for code, count := range codes {
+			if count != 1 {
+				t.Errorf("Stream %v: %v was used %v times", stream, code, count)
+			}
+		}
+	}
+}
+
+func TestBombardierShouldCountFailedAssertions(t *testing.T) {
+	testAllClients(t, testBombardierShouldCountFailedAssertions)
+}
+
+func testBombardierShouldCountFailedAssertions(clientType clientTyp, t *testing.T) {
+	var reqs uint64
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			if atomic.AddUint64(&reqs, 1)%2 == 0 {
+				rw.WriteHeader(http.StatusAccepted)
+			}
+			_, _ = rw.Write([]byte(`{"status":"ok"}`))
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	b, e := newBombardier(config{
+		numConns:   1,
+		numReqs:    &numReqs,
+		url:        s.URL,
+		headers:    new(headersList),
+		timeout:    defaultTimeout,
+		method:     "GET",
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+		assertions: &[]assertion{
+			{asserter: "StatusCode", expected: "200"},
+			{asserter: "Header", expression: "Content-Type",
+				condition: "EQUAL", expected: "application/json"},
+			{asserter: "BodyContains", expected: `"ok"`},
+			{asserter: "ResponseTime", expected: "10s"},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs || b.errorCount != numReqs/2 {
+		t.Errorf("Expected %v failed assertions, but got %v",
+			numReqs/2, b.errorCount)
+	}
+}
+
+func TestBombardierShouldLimitAssertedBodies(t *testing.T) {
+	testAllClients(t, testBombardierShouldLimitAssertedBodies)
+}
+
+func testBombardierShouldLimitAssertedBodies(clientType clientTyp, t *testing.T) {
+	var reqs uint64
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body := `{"status":"ok"}`
+			if atomic.AddUint64(&reqs, 1)%2 == 0 {
+				body += strings.Repeat(" ", 64)
+			}
+			_, _ = rw.Write([]byte(body))
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	b, e := newBombardier(config{
+		numConns:      1,
+		numReqs:       &numReqs,
+		url:           s.URL,
+		headers:       new(headersList),
+		timeout:       defaultTimeout,
+		method:        "GET",
+		clientType:    clientType,
+		format:        knownFormat("plain-text"),
+		assertMaxBody: 32,
+		assertions: &[]assertion{
+			{asserter: "JsonPath", expression: "$.status",
+				condition: "EQUAL", expected: "ok"},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.req2xx != numReqs || b.errorCount != numReqs/2 {
+		t.Errorf("Expected %v failed assertions, but got %v",
+			numReqs/2, b.errorCount)
+	}
+}
+
+func TestBombardierShouldAssertEchoedPayload(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			id := strings.TrimPrefix(r.URL.Path, "/users/")
+			if id == "3" {
+				id = "0"
+			}
+			_, _ = rw.Write([]byte(`{"id": ` + id + `}`))
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(4)
+	newConfig := func(expected string) config {
+		return config{
+			numConns:    1,
+			numReqs:     &numReqs,
+			url:         s.URL + "/users/${id}",
+			headers:     new(headersList),
+			timeout:     defaultTimeout,
+			method:      "GET",
+			payloadFile: writePayloadFile(t, "ids.csv", "id\n1\n2\n3\n4\n"),
+			clientType:  nhttp2,
+			format:      knownFormat("plain-text"),
+			assertions: &[]assertion{{
+				asserter:   "JsonPath",
+				expression: "$.id",
+				condition:  "EQUAL",
+				expected:   expected,
+			}},
+		}
+	}
+	c := newConfig("${id}")
+	defer os.RemoveAll(filepath.Dir(c.payloadFile))
+	b, e := newBombardier(c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.errorCount != 1 {
+		t.Errorf("Expected 1 failed assertion, but got %v", b.errorCount)
+	}
+
+	c = newConfig("${userId}")
+	defer os.RemoveAll(filepath.Dir(c.payloadFile))
+	if _, e := newBombardier(c); e == nil {
+		t.Error("Expected unknown variable to be reported")
+	}
+}
+
+func TestBombardierShouldReportAssertionFailures(t *testing.T) {
+	testAllClients(t, testBombardierShouldReportAssertionFailures)
+}
+
+func testBombardierShouldReportAssertionFailures(clientType clientTyp, t *testing.T) {
+	var reqs uint64
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if atomic.AddUint64(&reqs, 1)%2 == 1 {
+				rw.WriteHeader(http.StatusInternalServerError)
+				_, _ = rw.Write([]byte("oops"))
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			_, _ = rw.Write([]byte(`{"status":"down"}`))
+		}),
+	)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	numReqs, samples := uint64(10), uint64(3)
+	b, e := newBombardier(config{
+		numConns:       1,
+		numReqs:        &numReqs,
+		url:            s.URL,
+		headers:        new(headersList),
+		timeout:        defaultTimeout,
+		method:         "GET",
+		clientType:     clientType,
+		format:         knownFormat("plain-text"),
+		failureSamples: &samples,
+		failuresDir:    dir,
+		assertions: &[]assertion{
+			{name: "ok", asserter: "StatusCode", expected: "200"},
+			{asserter: "JsonPath", expression: "$.status",
+				condition: "EQUAL", expected: "up"},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+
+	info := b.gatherInfo().Result
+	expected := []internal.AssertionStats{
+		{Name: "ok", Failures: 5, EstimatedFailures: 5,
+			Reasons: []internal.AssertionFailureReason{
+				{Reason: "wrong value", Count: 5, Example: "500"},
+			}},
+		// every assertion is checked, even if the response fails
+		{Name: "JsonPath:$.status EQUAL up", Failures: 10, EstimatedFailures: 10,
+			Reasons: []internal.AssertionFailureReason{
+				{Reason: "wrong value", Count: 5, Example: "down"},
+				{Reason: "invalid body", Count: 5, Example: "oops"},
+			}},
+	}
+	if !reflect.DeepEqual(info.Assertions, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info.Assertions)
+	}
+	if len(info.FailedResponses) != int(samples) {
+		t.Fatalf("Expected %v failed responses, but got %v",
+			samples, len(info.FailedResponses))
+	}
+	first := info.FailedResponses[0]
+	if first.Assertion != "ok" || first.StatusCode != 500 || first.Body != "oops" {
+		t.Errorf("Unexpected failed response: %+v", first)
+	}
+	second := info.FailedResponses[1]
+	if second.Body != `{"status":"down"}` || second.Reason != "wrong value" {
+		t.Errorf("Unexpected failed response: %+v", second)
+	}
+	hasContentType := false
+	for _, h := range second.Headers {
+		hasContentType = hasContentType ||
+			(strings.EqualFold(h.Key, "Content-Type") && h.Value == "application/json")
+	}
+	if !hasContentType {
+		t.Errorf("Expected headers of the response, but got %v", second.Headers)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "failure-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != int(samples) {
+		t.Errorf("Expected %v saved responses, but got %v", samples, files)
+	}
+}
+
+func TestBombardierShouldPrintAssertionFailures(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			_, _ = rw.Write([]byte(`{"id": null}`))
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(2)
+	newConfig := func(format format) config {
+		return config{
+			numConns:    1,
+			numReqs:     &numReqs,
+			url:         s.URL + "/users/${id}",
+			headers:     new(headersList),
+			timeout:     defaultTimeout,
+			method:      "GET",
+			payloadFile: writePayloadFile(t, "ids.csv", "id\n\"1\"\"\"\n"),
+			clientType:  nhttp1,
+			format:      format,
+			assertions: &[]assertion{{
+				name:       "user \"id\"",
+				asserter:   "JsonPath",
+				expression: "$.id",
+				condition:  "NOT_NULL",
+			}},
+		}
+	}
+	for _, format := range []format{knownFormat("plain-text"), knownFormat("json")} {
+		c := newConfig(format)
+		defer os.RemoveAll(filepath.Dir(c.payloadFile))
+		b, e := newBombardier(c)
+		if e != nil {
+			t.Fatal(e)
+		}
+		b.disableOutput()
+		b.bombard()
+		out := new(bytes.Buffer)
+		b.out = out
+		b.printStats()
+		if format == knownFormat("plain-text") {
+			if !strings.Contains(out.String(), "user \"id\" - 2 failed") {
+				t.Errorf("Expected assertion failures in %q", out.String())
+			}
+			continue
+		}
+		var res struct {
+			Result struct {
+				Assertions []struct {
+					Name     string
+					Failures uint64
+				}
+				FailedResponses []struct {
+					Headers []struct{ Key, Value string }
+					Payload map[string]string
+				}
+			}
+		}
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("%v: %v", err, out.String())
+		}
+		if len(res.Result.Assertions) != 1 ||
+			res.Result.Assertions[0].Name != "user \"id\"" ||
+			res.Result.Assertions[0].Failures != 2 {
+			t.Errorf("Unexpected assertions: %+v", res.Result.Assertions)
+		}
+		if len(res.Result.FailedResponses) != 2 ||
+			len(res.Result.FailedResponses[0].Headers) == 0 ||
+			res.Result.FailedResponses[0].Payload["id"] != "1\"" {
+			t.Errorf("Unexpected failed responses: %+v", res.Result.FailedResponses)
+		}
+	}
+}
+
+func TestBombardierShouldSampleAssertions(t *testing.T) {
+	testAllClients(t, testBombardierShouldSampleAssertions)
+}
+
+func testBombardierShouldSampleAssertions(clientType clientTyp, t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	b, e := newBombardier(config{
+		numConns:     1,
+		numReqs:      &numReqs,
+		url:          s.URL,
+		headers:      new(headersList),
+		timeout:      defaultTimeout,
+		method:       "GET",
+		clientType:   clientType,
+		format:       knownFormat("plain-text"),
+		assertSample: 0.2,
+		assertions: &[]assertion{
+			{asserter: "StatusCode", expected: "200"},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	info := b.gatherInfo().Result
+	if b.errorCount != 2 || info.AssertedResponses != 2 {
+		t.Errorf("Expected 2 asserted responses, but got %v failed of %v",
+			b.errorCount, info.AssertedResponses)
+	}
+	if a := info.Assertions[0]; a.Failures != 2 || a.EstimatedFailures != numReqs {
+		t.Errorf("Expected %v estimated failures, but got %+v", numReqs, a)
+	}
+}
+
+func TestBombardierShouldAbortOnAssertionFailures(t *testing.T) {
+	testAllClients(t, testBombardierShouldAbortOnAssertionFailures)
+}
+
+func testBombardierShouldAbortOnAssertionFailures(clientType clientTyp, t *testing.T) {
+	var reqs uint64
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if atomic.AddUint64(&reqs, 1) > 5 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(1000)
+	b, e := newBombardier(config{
+		numConns:   1,
+		numReqs:    &numReqs,
+		url:        s.URL,
+		headers:    new(headersList),
+		timeout:    defaultTimeout,
+		method:     "GET",
+		clientType: clientType,
+		format:     knownFormat("plain-text"),
+		assertions: &[]assertion{
+			{asserter: "ResponseTime", expected: "1ns", severity: softSeverity},
+			{name: "up", asserter: "StatusCode", expected: "200",
+				severity: abortSeverity, abortAfter: 3},
+		},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	info := b.gatherInfo().Result
+	if sent := atomic.LoadUint64(&reqs); sent != 8 {
+		t.Errorf("Expected the test to stop after 8 requests, but %v were sent", sent)
+	}
+	if b.errorCount != 3 {
+		t.Errorf("Expected soft failures to be ignored, but got %v errors", b.errorCount)
+	}
+	if info.Aborted != "assertion up failed 3 times" {
+		t.Errorf("Unexpected reason to abort: %q", info.Aborted)
+	}
+	soft := info.Assertions[0]
+	if soft.Severity != "soft" || soft.Failures != 8 {
+		t.Errorf("Expected every response to fail the soft assertion, but got %+v", soft)
+	}
+
+	b.out = new(bytes.Buffer)
+	b.printStats()
+	out := b.out.(*bytes.Buffer).String()
+	for _, line := range []string{
+		"ResponseTime LTE 1ns (soft) - 8 failed",
+		"up (abort) - 3 failed",
+		"Aborted: assertion up failed 3 times",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in:\n%v", line, out)
+		}
+	}
+
+	b.conf.format = knownFormat("json")
+	if b.template, e = b.prepareTemplate(); e != nil {
+		t.Fatal(e)
+	}
+	b.out = new(bytes.Buffer)
+	b.printStats()
+	var res struct {
+		Result struct {
+			Assertions []struct{ Name, Severity string }
+			Aborted    string
+		}
+	}
+	if err := json.Unmarshal(b.out.(*bytes.Buffer).Bytes(), &res); err != nil {
+		t.Fatalf("%v: %v", err, b.out)
+	}
+	if len(res.Result.Assertions) != 2 ||
+		res.Result.Assertions[1].Severity != "abort" ||
+		res.Result.Aborted != info.Aborted {
+		t.Errorf("Unexpected results: %+v", res.Result)
+	}
+}
+
+func TestRunShouldExitWithStatusOfThresholds(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+	)
+	defer s.Close()
+	expectations := []struct {
+		args   []string
+		status int
+	}{
+		{[]string{"--threshold", "5xx<1%", s.URL}, exitSuccess},
+		{[]string{"--threshold", "5xx<1%", s.URL + "/fail"}, exitThresholdsNotMet},
+		{[]string{"--threshold", "5xx", s.URL}, exitFailure},
+	}
+	for _, e := range expectations {
+		args := append([]string{programName, "-c", "1", "-n", "10"}, e.args...)
+		out := new(bytes.Buffer)
+		if status := run(newKingpinParser(), args, out); status != e.status {
+			t.Errorf("%v: expected exit status %v, but got %v:\n%v",
+				e.args, e.status, status, out)
+		}
+	}
+}
+
+func TestRunShouldExitWithStatusOfComparison(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	result := func(name, rps string) string {
+		path := filepath.Join(dir, name)
+		data := `{"result":{"timeTakenSeconds":1,"req2xx":10,` +
+			`"rps":{"mean":` + rps + `}}}`
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	slow, fast := result("slow.json", "1"), result("fast.json", "1e12")
+	expectations := []struct {
+		args   []string
+		status int
+	}{
+		{[]string{compareCommand, slow, fast}, exitSuccess},
+		{[]string{compareCommand, fast, slow}, exitRegressed},
+		{[]string{compareCommand, "-o", "md", fast, slow}, exitRegressed},
+		{[]string{compareCommand, fast}, exitFailure},
+		{[]string{compareCommand, filepath.Join(dir, "absent.json"), slow}, exitFailure},
+		{[]string{"-c", "1", "-n", "10", "--baseline", slow, s.URL}, exitSuccess},
+		{[]string{"-c", "1", "-n", "10", "--baseline", fast, s.URL}, exitRegressed},
+		{[]string{"-c", "1", "-n", "10", "--baseline", fast,
+			"--threshold", "2xx<1", s.URL}, exitThresholdsNotMet},
+	}
+	for _, e := range expectations {
+		args := append([]string{programName}, e.args...)
+		out := new(bytes.Buffer)
+		if status := run(newKingpinParser(), args, out); status != e.status {
+			t.Errorf("%v: expected exit status %v, but got %v:\n%v",
+				e.args, e.status, status, out)
+		}
+		if e.status == exitRegressed && !strings.Contains(out.String(), "regressed") {
+			t.Errorf("%v: expected the comparison to be printed, but got:\n%v",
+				e.args, out)
+		}
+	}
+}
+
+func TestBombardierShouldCheckThresholds(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusNotFound)
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(10)
+	thresholds := make([]threshold, 0)
+	for _, expr := range []string{"p99<1h", "4xx<10%", "errors==0"} {
+		th, err := parseThreshold(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thresholds = append(thresholds, th)
+	}
+	for _, format := range []format{knownFormat("plain-text"), knownFormat("json")} {
+		b, e := newBombardier(config{
+			numConns:   1,
+			numReqs:    &numReqs,
+			url:        s.URL,
+			headers:    new(headersList),
+			timeout:    defaultTimeout,
+			method:     "GET",
+			clientType: fhttp,
+			format:     format,
+			thresholds: &thresholds,
+		})
+		if e != nil {
+			t.Fatal(e)
+		}
+		b.disableOutput()
+		b.bombard()
+		info := b.gatherInfo().Result
+		passed := []bool{true, false, true}
+		if len(info.Thresholds) != len(passed) {
+			t.Fatalf("Expected %v thresholds, but got %+v", len(passed), info.Thresholds)
+		}
+		for i, th := range info.Thresholds {
+			if th.Passed != passed[i] {
+				t.Errorf("Expected passed %v, but got %+v", passed[i], th)
+			}
+		}
+		if info.Passed() {
+			t.Error("Expected the test to fail")
+		}
+
+		out := new(bytes.Buffer)
+		b.out = out
+		b.printStats()
+		if format == knownFormat("plain-text") {
+			for _, line := range []string{
+				"4xx<10% - failed, actual 100.00%",
+				"errors==0 - passed, actual 0",
+				"Result: failed",
+			} {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("Expected %q in:\n%v", line, out.String())
+				}
+			}
+			continue
+		}
+		var res struct {
+			Result struct {
+				Thresholds []struct {
+					Threshold, Actual string
+					Passed            bool
+				}
+				Passed *bool
+			}
+		}
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			t.Fatalf("%v: %v", err, out.String())
+		}
+		if res.Result.Passed == nil || *res.Result.Passed ||
+			len(res.Result.Thresholds) != 3 ||
+			res.Result.Thresholds[1].Actual != "100.00%" {
+			t.Errorf("Unexpected thresholds: %+v", res.Result)
+		}
+	}
+}
+
+func TestBombardierShouldAbortWhenConditionsAreBreached(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}),
+	)
+	defer s.Close()
+	conditions := make([]abortCondition, 0)
+	for _, expr := range []string{"p99>1h over 1s", "5xx>50% over 1s"} {
+		c, err := parseAbortCondition(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conditions = append(conditions, c)
+	}
+	duration := 10 * time.Second
+	b, e := newBombardier(config{
+		numConns:        1,
+		duration:        &duration,
+		url:             s.URL,
+		headers:         new(headersList),
+		timeout:         defaultTimeout,
+		method:          "GET",
+		clientType:      fhttp,
+		format:          knownFormat("plain-text"),
+		abortConditions: &conditions,
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	if b.timeTaken >= duration/2 {
+		t.Errorf("Expected the test to be aborted early, but it took %v", b.timeTaken)
+	}
+	info := b.gatherInfo().Result
+	if info.Aborted != "5xx>50% over 1s, actual 100.00%" {
+		t.Errorf("Unexpected reason to abort: %q", info.Aborted)
+	}
+
+	b.out = new(bytes.Buffer)
+	b.printStats()
+	out := b.out.(*bytes.Buffer).String()
+	for _, line := range []string{
+		"Aborted: 5xx>50% over 1s, actual 100.00%",
+		"Result: failed",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in:\n%v", line, out)
+		}
+	}
+}
+
+func TestBombardierShouldCompareWithBaseline(t *testing.T) {
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer s.Close()
+	numReqs := uint64(100)
+	newConfig := func() config {
+		return config{
+			numConns:         2,
+			numReqs:          &numReqs,
+			url:              s.URL,
+			headers:          new(headersList),
+			timeout:          defaultTimeout,
+			method:           "GET",
+			clientType:       fhttp,
+			format:           knownFormat("json"),
+			latencyHistogram: true,
+		}
+	}
+	b, e := newBombardier(newConfig())
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	out := new(bytes.Buffer)
+	b.out = out
+	b.printStats()
+	var res struct {
+		Result struct {
+			Latency struct {
+				Histogram []LatencyCount
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %v", err, out)
+	}
+	count := uint64(0)
+	for _, lc := range res.Result.Latency.Histogram {
+		count += lc.Count
+	}
+	if count != numReqs {
+		t.Errorf("Expected %v latencies in the histogram, but got %v", numReqs, count)
+	}
+
+	dir, err := ioutil.TempDir("", "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	baseline := filepath.Join(dir, "baseline.json")
+	if err := ioutil.WriteFile(baseline, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newConfig()
+	c.baselineFile = baseline
+	c.compareFormat = "md"
+	b, e = newBombardier(c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	info := b.gatherInfo()
+	response, err := json.Marshal(gatherInfo(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := parseRunSummary(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := summaryOf(&info.Result); summary.rps != expected.rps ||
+		summary.errors != expected.errors {
+		t.Errorf("Expected the response of the server to be summarized as %+v, but got %+v",
+			expected, summary)
+	}
+	comparison := b.comparison(&info.Result)
+	if comparison == nil || comparison.Significance == nil {
+		t.Fatalf("Expected latency distributions to be compared, but got %+v", comparison)
+	}
+	for _, m := range comparison.Metrics {
+		if m.Kind == rateKind && (m.Baseline != 0 || m.Current != 0) {
+			t.Errorf("Unexpected rate %+v", m)
+		}
+	}
+	out.Reset()
+	b.out = out
+	b.printComparison(comparison)
+	if !strings.Contains(out.String(), "| errors | 0.00% | 0.00% | +0.00pp | ±1.00pp | unchanged |") {
+		t.Errorf("Unexpected comparison:\n%v", out)
+	}
+
+	c.baselineFile = filepath.Join(dir, "absent.json")
+	if _, e := newBombardier(c); e == nil {
+		t.Error("Expected a missing baseline to be rejected")
+	}
+}
+
+func TestBombardierShouldRecordTimeseries(t *testing.T) {
+	var reqs uint64
+	s := httptest.NewServer(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if atomic.AddUint64(&reqs, 1)%10 == 0 {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+			time.Sleep(time.Millisecond)
+		}),
+	)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "timeseries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "series.jsonl")
+	duration := 1500 * time.Millisecond
+	b, e := newBombardier(config{
+		numConns:       2,
+		duration:       &duration,
+		url:            s.URL,
+		headers:        new(headersList),
+		timeout:        defaultTimeout,
+		method:         "GET",
+		clientType:     fhttp,
+		format:         knownFormat("json"),
+		timeseriesFile: path,
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	b.disableOutput()
+	b.bombard()
+	info := b.gatherInfo().Result
+	if len(info.Timeseries) != 2 {
+		t.Fatalf("Expected a second and the rest of the test, but got %+v",
+			info.Timeseries)
+	}
+	var total, failed, read uint64
+	for _, i := range info.Timeseries {
+		total += i.Req2XX + i.Req5XX
+		failed += i.Req5XX
+		read += i.BytesRead
+		if i.Rps <= 0 || i.LatencyP50 <= 0 || i.LatencyMax < i.LatencyP99 {
+			t.Errorf("Unexpected interval %+v", i)
+		}
+	}
+	if total != totalRequests(&info) || failed != info.Req5XX ||
+		read != uint64(info.BytesRead) {
+		t.Errorf("Expected the intervals to add up to the results, but got %+v",
+			info.Timeseries)
+	}
+	if offset := info.Timeseries[1].Offset; offset < 900*time.Millisecond ||
+		offset > 1100*time.Millisecond {
+		t.Errorf("Unexpected offset of the second interval %v", offset)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != len(info.Timeseries) {
+		t.Errorf("Expected %v lines, but got:\n%s", len(info.Timeseries), data)
+	}
+
+	out := new(bytes.Buffer)
+	b.out = out
+	b.printStats()
+	var res struct {
+		Result struct {
+			Timeseries []IntervalReport
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %v", err, out)
+	}
+	if len(res.Result.Timeseries) != len(info.Timeseries) {
+		t.Fatalf("Expected the time series in the result, but got %+v", res.Result)
+	}
+	for i, r := range res.Result.Timeseries {
+		expected := intervalReport(info.Timeseries[i])
+		if !r.Time.Equal(expected.Time) || r.Req2xx != expected.Req2xx ||
+			r.LatencyP99 != expected.LatencyP99 {
+			t.Errorf("Expected %+v, but got %+v", expected, r)
+		}
+	}
+}
@@ -1,20 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
 	"golang.org/x/net/http2"
 )
 
 type client interface {
-	do(idx uint64) (code int, msTaken uint64, assertResult assertResult, err error)
+	do(idx uint64) (code int, msTaken uint64, failures assertResults, err error)
 }
 
 type bodyStreamProducer func() (io.ReadCloser, error)
@@ -27,42 +29,84 @@ type clientOpts struct {
 	tlsConfig *tls.Config
 
 	payload       *payload
+	generators    *generators
 	scope         scope
 	resolveHeader bool
 	resolveUrl    bool
 	resolveBody   bool
 
 	headers     *headersList
+	host        string
+	omitHeaders *[]string
 	url, method string
 
 	body    *string
+	form    *formBody
 	bodProd bodyStreamProducer
 
+	bodyTemplate *bodyTemplate
+
 	bytesRead, bytesWritten *int64
 
-	assertions *[]assertion
+	maxRedirects uint64
+	redirects    *redirectStats
+
+	sessions *sessions
+
+	compression      string
+	compressionStats *compressionStats
+	// responseStats records decoded responses, it's nil unless
+	// decoding of them was asked for
+	responseStats *compressionStats
+
+	assertions *assertionPlan
+	// maxAssertBody is the limit of response body read for assertions
+	maxAssertBody int64
+	// failures keeps the first failed responses, may be nil
+	failures *failureSampler
 }
 
 type fasthttpClient struct {
 	client *fasthttp.HostClient
+	// used to follow redirects to other hosts
+	redirectClient *fasthttp.Client
 
 	payload       *payload
+	generators    *generators
 	scope         scope
 	resolveUrl    bool
 	resolveHeader bool
 	resolveBody   bool
 
-	rawUrl    string
-	rawHeader *headersList
+	urlTmpl     *valueTemplate
+	headerTmpls []headerTemplate
+	bodyTmpl    *valueTemplate
 
 	headers *fasthttp.RequestHeader
+	host    *valueTemplate
 	url     *url.URL
 	method  string
 
 	body    *string
+	form    *formBody
 	bodProd bodyStreamProducer
 
-	assertions *[]assertion
+	bodyTemplate *bodyTemplate
+
+	maxRedirects int
+	redirects    *redirectStats
+
+	sessions *sessions
+
+	compression      string
+	compressionStats *compressionStats
+	responseStats    *compressionStats
+	// length of the static body before compression
+	rawBodyLen int
+
+	assertions    *assertionPlan
+	maxAssertBody int64
+	failures      *failureSampler
 }
 
 func newFastHTTPClient(opts *clientOpts) client {
@@ -74,7 +118,7 @@ func newFastHTTPClient(opts *clientOpts) client {
 	c.resolveBody = opts.resolveBody
 
 	if c.resolveUrl {
-		c.rawUrl = opts.url
+		c.urlTmpl = compileTemplate(opts.url)
 	} else {
 		u, err := url.Parse(opts.url)
 		if err != nil {
@@ -84,56 +128,91 @@ func newFastHTTPClient(opts *clientOpts) client {
 		c.url = u
 	}
 
+	omitted := newOmittedHeaders(opts.omitHeaders)
 	c.client = &fasthttp.HostClient{
 		MaxConns:                      int(opts.maxConns),
 		ReadTimeout:                   opts.timeout,
 		WriteTimeout:                  opts.timeout,
 		DisableHeaderNamesNormalizing: true,
+		NoDefaultUserAgentHeader:      omitted.has("User-Agent"),
 		TLSConfig:                     opts.tlsConfig,
 		Dial: fasthttpDialFunc(
 			opts.bytesRead, opts.bytesWritten,
 		),
 	}
 
+	if opts.maxRedirects > 0 {
+		c.maxRedirects = int(opts.maxRedirects)
+		c.redirects = opts.redirects
+		c.redirectClient = &fasthttp.Client{
+			MaxConnsPerHost:               int(opts.maxConns),
+			ReadTimeout:                   opts.timeout,
+			WriteTimeout:                  opts.timeout,
+			DisableHeaderNamesNormalizing: true,
+			NoDefaultUserAgentHeader:      c.client.NoDefaultUserAgentHeader,
+			TLSConfig:                     opts.tlsConfig,
+			Dial:                          c.client.Dial,
+		}
+	}
+
 	if c.resolveHeader {
-		c.rawHeader = opts.headers
+		c.headerTmpls = compileHeaders(opts.headers)
 	} else {
 		c.headers = headersToFastHTTPHeaders(opts.headers, nil)
 	}
 
+	if opts.host != "" {
+		c.host = compileTemplate(opts.host)
+	}
 	c.method, c.body = opts.method, opts.body
-	c.bodProd = opts.bodProd
-	c.payload = opts.payload
+	c.form, c.bodProd = opts.form, opts.bodProd
+	c.bodyTemplate = opts.bodyTemplate
+	c.compression, c.compressionStats = opts.compression, opts.compressionStats
+	c.responseStats = opts.responseStats
+	c.body, c.rawBodyLen = compressStaticBody(
+		c.body, c.resolveBody, c.compression,
+	)
+	if c.resolveBody {
+		c.bodyTmpl = compileTemplate(*c.body)
+	}
+	c.payload, c.generators = opts.payload, opts.generators
 	c.scope = opts.scope
+	c.sessions = opts.sessions
 
 	c.assertions = opts.assertions
+	c.failures = opts.failures
+	c.maxAssertBody = opts.maxAssertBody
 	return client(c)
 }
 
 func (c *fasthttpClient) do(idx uint64) (
-	code int, msTaken uint64, assertResult assertResult, err error,
+	code int, msTaken uint64, failures assertResults, err error,
 ) {
+	var values row
+	if c.payload != nil {
+		if values, err = c.payload.get(c.scope, idx); err != nil {
+			return 0, 0, notSent, err
+		}
+	}
+	ctx := newVars(values, c.generators, idx)
+
 	// prepare the request
 	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
-
-	var ctx map[string]string
-	if c.payload != nil {
-		ctx = c.payload.get(c.scope, idx)
-	}
+	defer fasthttp.ReleaseResponse(resp)
 
 	if c.resolveHeader {
-		c.headers = headersToFastHTTPHeaders(c.rawHeader, ctx)
-	}
-	if c.headers != nil {
+		writeFastHTTPHeaders(&req.Header, c.headerTmpls, ctx)
+	} else if c.headers != nil {
 		c.headers.CopyTo(&req.Header)
 	}
 	req.Header.SetMethod(c.method)
 
 	if c.resolveUrl {
-		u, err := url.Parse(replace(c.rawUrl, ctx))
+		u, err := url.Parse(c.urlTmpl.render(ctx))
 		if err != nil {
-			return 0, 0, failure, err
+			return 0, 0, notSent, err
 		}
 		c.url = u
 	}
@@ -141,20 +220,67 @@ func (c *fasthttpClient) do(idx uint64) (
 	c.client.Addr = c.url.Host
 	c.client.IsTLS = c.url.Scheme == "https"
 
-	if len(req.Header.Host()) == 0 {
+	if c.host != nil {
+		req.Header.SetHost(c.host.render(ctx))
+	} else if len(req.Header.Host()) == 0 {
 		req.Header.SetHost(c.url.Host)
 	}
 
-	if c.body != nil {
+	var sess *session
+	if c.sessions != nil {
+		sess = c.sessions.acquire(idx, c.url, ctx)
+		sess.applyTo(req, c.url)
+	}
+
+	if c.bodyTemplate != nil {
+		buf := renderPool.Get()
+		terr := c.bodyTemplate.execute(buf, values.toMap())
+		if terr != nil {
+			renderPool.Put(buf)
+			return 0, 0, notSent, terr
+		}
+		if c.compression != "" {
+			req.SetBody(c.compressionStats.encodeRequestBody(
+				c.compression, buf.B,
+			))
+		} else {
+			req.SetBody(buf.B)
+		}
+		renderPool.Put(buf)
+	} else if c.form != nil {
+		body, ferr := c.form.build(ctx)
+		if ferr != nil {
+			return 0, 0, notSent, ferr
+		}
+		if c.compression != "" {
+			req.SetBody(c.compressionStats.encodeRequestBody(
+				c.compression, []byte(body),
+			))
+		} else {
+			req.SetBodyString(body)
+		}
+	} else if c.body != nil {
 		if c.resolveBody {
-			req.SetBodyString(replace(*c.body, ctx))
+			buf := renderPool.Get()
+			buf.B = c.bodyTmpl.appendTo(buf.B, ctx)
+			if c.compression != "" {
+				req.SetBody(c.compressionStats.encodeRequestBody(
+					c.compression, buf.B,
+				))
+			} else {
+				req.SetBody(buf.B)
+			}
+			renderPool.Put(buf)
 		} else {
+			if c.compression != "" {
+				c.compressionStats.recordRequest(c.rawBodyLen, len(*c.body))
+			}
 			req.SetBodyString(*c.body)
 		}
 	} else {
 		bs, bserr := c.bodProd()
 		if bserr != nil {
-			return 0, 0, failure, bserr
+			return 0, 0, notSent, bserr
 		}
 		req.SetBodyStream(bs, -1)
 	}
@@ -162,52 +288,183 @@ func (c *fasthttpClient) do(idx uint64) (
 	// fire the request
 	start := time.Now()
 	err = c.client.Do(req, resp)
-	if err != nil {
+	if err == nil && sess != nil {
+		sess.update(resp, c.url)
+	}
+	if err == nil && c.maxRedirects > 0 {
+		chain := newRedirectChain(c.maxRedirects, start)
+		if sess != nil {
+			chain.jar = sess.jar
+		}
+		err = c.followRedirects(req, resp, chain, sess)
+		code = resp.StatusCode()
+		if err != nil && !isRedirectError(err) {
+			code = -1
+		}
+		c.redirects.record(code, chain.hops, chain.usTaken(start), err)
+	} else if err != nil {
 		code = -1
 	} else {
 		code = resp.StatusCode()
 	}
 	msTaken = uint64(time.Since(start).Nanoseconds() / 1000)
 
-	assertResult = success
-	if len(*c.assertions) > 0 {
-		assertResult = assertThat(resp.Body(), *c.assertions)
+	asserts := c.assertions != nil && c.assertions.sampled()
+	needsBody := asserts && c.assertions.needsBody
+	var body []byte
+	if needsBody || (err == nil && c.responseStats != nil) {
+		body = resp.Body()
+		if err == nil && int64(len(body)) <= c.maxAssertBody {
+			encoding := string(resp.Header.Peek("Content-Encoding"))
+			body, err = decodeResponseBody(
+				c.responseStats, encoding, body, c.maxAssertBody,
+			)
+		}
+	}
+	if asserts {
+		tooLarge := int64(len(body)) > c.maxAssertBody
+		if tooLarge {
+			body = nil
+		}
+		asserted := &assertedResponse{
+			code: code,
+			header: func(name string) (string, bool) {
+				v := resp.Header.Peek(name)
+				return string(v), v != nil
+			},
+			headers: func(visit func(key, value string)) {
+				resp.Header.VisitAll(func(k, v []byte) {
+					visit(string(k), string(v))
+				})
+			},
+			body:     body,
+			tooLarge: tooLarge,
+			took:     time.Duration(msTaken) * time.Microsecond,
+			vars:     ctx,
+		}
+		failures = c.assertions.assert(asserted)
+		if err == nil {
+			c.failures.add(asserted, failures.first(), values)
+		}
 	}
-
-	// release resources
-	fasthttp.ReleaseRequest(req)
-	fasthttp.ReleaseResponse(resp)
 
 	return
 }
 
+// followRedirects follows redirects starting with the response to
+// the initial request. Requests to hosts other than the target one are
+// performed with redirectClient. Cookies are carried across hops if
+// session is not nil.
+func (c *fasthttpClient) followRedirects(
+	req *fasthttp.Request, resp *fasthttp.Response,
+	chain *redirectChain, sess *session,
+) error {
+	current := c.url
+	host := string(req.Header.Host())
+	for isRedirect(resp.StatusCode()) {
+		location := resp.Header.Peek("Location")
+		if len(location) == 0 {
+			return nil
+		}
+		next, err := chain.next(current, string(location))
+		if err != nil {
+			return err
+		}
+
+		method, keepBody := redirectMethod(resp.StatusCode(), c.method)
+		req.Header.SetMethod(method)
+		if !keepBody {
+			req.ResetBody()
+		} else if c.streamsBody() {
+			// the stream was read by the previous hop, the bodies set
+			// otherwise are still in req
+			bs, bserr := c.bodProd()
+			if bserr != nil {
+				return bserr
+			}
+			req.SetBodyStream(bs, -1)
+		}
+
+		if sess != nil {
+			req.Header.DelAllCookies()
+			sess.applyTo(req, next)
+		}
+
+		if next.Host == c.url.Host && next.Scheme == c.url.Scheme {
+			req.Header.SetHost(host)
+			req.SetRequestURI(next.RequestURI())
+			err = c.client.Do(req, resp)
+		} else {
+			req.Header.SetHost(next.Host)
+			req.SetRequestURI(next.String())
+			err = c.redirectClient.Do(req, resp)
+		}
+		if err != nil {
+			return err
+		}
+		if sess != nil {
+			sess.update(resp, next)
+		}
+		current = next
+	}
+	return nil
+}
+
+// streamsBody tells whether bodies of requests are read from the
+// streams of bodProd.
+func (c *fasthttpClient) streamsBody() bool {
+	return c.bodyTemplate == nil && c.form == nil && c.body == nil
+}
+
 type httpClient struct {
 	client *http.Client
 
 	payload       *payload
+	generators    *generators
 	scope         scope
 	resolveUrl    bool
 	resolveHeader bool
 	resolveBody   bool
 
-	rawUrl    string
-	rawHeader *headersList
+	urlTmpl     *valueTemplate
+	headerTmpls []headerTemplate
+	bodyTmpl    *valueTemplate
 
-	headers http.Header
-	url     *url.URL
-	method  string
+	headers     http.Header
+	host        *valueTemplate
+	omitHeaders omittedHeaders
+	url         *url.URL
+	method      string
 
 	body    *string
+	form    *formBody
 	bodProd bodyStreamProducer
 
-	assertions *[]assertion
+	bodyTemplate *bodyTemplate
+
+	maxRedirects int
+	redirects    *redirectStats
+
+	sessions *sessions
+
+	compression      string
+	compressionStats *compressionStats
+	responseStats    *compressionStats
+	// length of the static body before compression
+	rawBodyLen int
+
+	assertions    *assertionPlan
+	maxAssertBody int64
+	failures      *failureSampler
 }
 
 func newHTTPClient(opts *clientOpts) client {
 	c := new(httpClient)
+	c.omitHeaders = newOmittedHeaders(opts.omitHeaders)
 	tr := &http.Transport{
 		TLSClientConfig:     opts.tlsConfig,
 		MaxIdleConnsPerHost: int(opts.maxConns),
+		DisableCompression:  c.omitHeaders.has("Accept-Encoding"),
 	}
 	tr.DialContext = httpDialContextFunc(opts.bytesRead, opts.bytesWritten)
 	if opts.HTTP2 {
@@ -218,30 +475,43 @@ func newHTTPClient(opts *clientOpts) client {
 		)
 	}
 
+	c.maxRedirects = int(opts.maxRedirects)
+	c.redirects = opts.redirects
 	cl := &http.Client{
-		Transport: tr,
-		Timeout:   opts.timeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+		Transport:     tr,
+		Timeout:       opts.timeout,
+		CheckRedirect: checkRedirectFunc(c.maxRedirects),
 	}
 	c.client = cl
-	c.payload = opts.payload
+	c.sessions = opts.sessions
+	c.payload, c.generators = opts.payload, opts.generators
 	c.scope = opts.scope
 	c.resolveUrl = opts.resolveUrl
 	c.resolveHeader = opts.resolveHeader
 	c.resolveBody = opts.resolveBody
 
 	if c.resolveHeader {
-		c.rawHeader = opts.headers
+		c.headerTmpls = compileHeaders(opts.headers)
 	} else {
-		c.headers = headersToHTTPHeaders(opts.headers, nil)
+		c.headers = c.withDefaults(headersToHTTPHeaders(opts.headers, nil))
 	}
 
+	if opts.host != "" {
+		c.host = compileTemplate(opts.host)
+	}
 	c.method, c.body, c.bodProd = opts.method, opts.body, opts.bodProd
+	c.form, c.bodyTemplate = opts.form, opts.bodyTemplate
+	c.compression, c.compressionStats = opts.compression, opts.compressionStats
+	c.responseStats = opts.responseStats
+	c.body, c.rawBodyLen = compressStaticBody(
+		c.body, c.resolveBody, c.compression,
+	)
+	if c.resolveBody {
+		c.bodyTmpl = compileTemplate(*c.body)
+	}
 
 	if c.resolveUrl {
-		c.rawUrl = opts.url
+		c.urlTmpl = compileTemplate(opts.url)
 	} else {
 		var err error
 		c.url, err = url.Parse(opts.url)
@@ -252,66 +522,144 @@ func newHTTPClient(opts *clientOpts) client {
 	}
 
 	c.assertions = opts.assertions
+	c.failures = opts.failures
+	c.maxAssertBody = opts.maxAssertBody
 	return client(c)
 }
 
 func (c *httpClient) do(idx uint64) (
-	code int, msTaken uint64, assertResult assertResult, err error,
+	code int, msTaken uint64, failures assertResults, err error,
 ) {
 	req := &http.Request{}
 
-	var ctx map[string]string
-
+	var values row
 	if c.payload != nil {
-		ctx = c.payload.get(c.scope, idx)
+		if values, err = c.payload.get(c.scope, idx); err != nil {
+			return 0, 0, notSent, err
+		}
 	}
+	ctx := newVars(values, c.generators, idx)
 
 	if c.resolveHeader {
-		req.Header = headersToHTTPHeaders(c.rawHeader, ctx)
+		req.Header = c.withDefaults(renderHTTPHeaders(c.headerTmpls, ctx))
+	} else if c.sessions != nil {
+		// cookies from the jar are added to the request's headers
+		req.Header = c.headers.Clone()
 	} else {
 		req.Header = c.headers
 	}
 
 	req.Method = c.method
 	if c.resolveUrl {
-		req.URL, err = url.Parse(replace(c.rawUrl, ctx))
+		req.URL, err = url.Parse(c.urlTmpl.render(ctx))
 		if err != nil {
-			return 0, 0, failure, err
+			return 0, 0, notSent, err
 		}
 	} else {
 		req.URL = c.url
 	}
 
-	if host := req.Header.Get("Host"); host != "" {
+	if c.host != nil {
+		req.Host = c.host.render(ctx)
+	} else if host := req.Header.Get("Host"); host != "" {
 		req.Host = host
 	}
 
-	if c.body != nil {
-		var body string
-		if c.resolveBody {
-			body = replace(*c.body, ctx)
-		} else {
-			body = *c.body
+	if c.bodyTemplate != nil || c.form != nil || c.body != nil {
+		var (
+			body []byte
+			buf  *bytebufferpool.ByteBuffer
+		)
+		if c.bodyTemplate != nil {
+			buf = renderPool.Get()
+			if err = c.bodyTemplate.execute(buf, values.toMap()); err != nil {
+				renderPool.Put(buf)
+				return 0, 0, notSent, err
+			}
+			body = buf.B
+		} else if c.form != nil {
+			var form string
+			form, err = c.form.build(ctx)
+			if err != nil {
+				return 0, 0, notSent, err
+			}
+			body = []byte(form)
+		} else if c.resolveBody {
+			buf = renderPool.Get()
+			buf.B = c.bodyTmpl.appendTo(buf.B, ctx)
+			body = buf.B
+		}
+		if body != nil && c.compression != "" {
+			body = c.compressionStats.encodeRequestBody(c.compression, body)
+			if buf != nil {
+				renderPool.Put(buf)
+				buf = nil
+			}
+		} else if body == nil {
+			body = []byte(*c.body)
+			if c.compression != "" {
+				c.compressionStats.recordRequest(c.rawBodyLen, len(body))
+			}
 		}
-		br := strings.NewReader(body)
+		rb := newRequestBody(body, buf)
+		defer rb.release()
 		req.ContentLength = int64(len(body))
-		req.Body = ioutil.NopCloser(br)
+		req.Body = rb.reader()
+		// net/http only follows 307 and 308 with a body it can send again
+		req.GetBody = func() (io.ReadCloser, error) {
+			return rb.reader(), nil
+		}
 	} else {
 		bs, bserr := c.bodProd()
 		if bserr != nil {
-			return 0, 0, failure, bserr
+			return 0, 0, notSent, bserr
 		}
 		req.Body = bs
+		req.GetBody = c.bodProd
 	}
 
 	start := time.Now()
-	resp, err := c.client.Do(req)
-	if err != nil {
+	var chain *redirectChain
+	if c.maxRedirects > 0 {
+		chain = newRedirectChain(c.maxRedirects, start)
+		req = req.WithContext(withRedirectChain(req.Context(), chain))
+	}
+	cl := c.client
+	if c.sessions != nil {
+		sessionClient := *c.client
+		sessionClient.Jar = c.sessions.acquire(idx, req.URL, ctx).jar
+		cl = &sessionClient
+		if chain != nil {
+			chain.jar = sessionClient.Jar
+		}
+	}
+	asserts := c.assertions != nil && c.assertions.sampled()
+	needsBody := asserts && c.assertions.needsBody
+	var (
+		body     []byte
+		tooLarge bool
+		header   http.Header
+	)
+	resp, err := cl.Do(req)
+	if uerr, ok := err.(*url.Error); ok && isRedirectError(uerr.Err) {
+		// the body of the last response is already closed by net/http
+		err = uerr.Err
+		code = resp.StatusCode
+		header = resp.Header
+	} else if err != nil {
 		code = -1
 	} else {
 		code = resp.StatusCode
+		header = resp.Header
 
-		_, berr := io.Copy(ioutil.Discard, resp.Body)
+		var berr error
+		if needsBody || c.responseStats != nil {
+			body, tooLarge, berr = c.readBody(resp)
+		}
+		// the rest of the body is read for the connection to be reused
+		if _, derr := io.Copy(ioutil.Discard, resp.Body); berr == nil {
+			berr = derr
+		}
 		if berr != nil {
 			err = berr
 		}
@@ -321,30 +669,166 @@ func (c *httpClient) do(idx uint64) (
 		}
 	}
 	msTaken = uint64(time.Since(start).Nanoseconds() / 1000)
+	if chain != nil {
+		c.redirects.record(code, chain.hops, chain.usTaken(start), err)
+	}
 
-	assertResult = success
+	if asserts {
+		if tooLarge {
+			body = nil
+		}
+		asserted := &assertedResponse{
+			code: code,
+			header: func(name string) (string, bool) {
+				values, ok := header[http.CanonicalHeaderKey(name)]
+				if !ok || len(values) == 0 {
+					return "", false
+				}
+				return values[0], true
+			},
+			headers: func(visit func(key, value string)) {
+				for k, values := range header {
+					for _, v := range values {
+						visit(k, v)
+					}
+				}
+			},
+			body:     body,
+			tooLarge: tooLarge,
+			took:     time.Duration(msTaken) * time.Microsecond,
+			vars:     ctx,
+		}
+		failures = c.assertions.assert(asserted)
+		if err == nil {
+			c.failures.add(asserted, failures.first(), values)
+		}
+	}
 	return
 }
 
-func headersToFastHTTPHeaders(h *headersList, ctx map[string]string) *fasthttp.RequestHeader {
-	if len(*h) == 0 {
+// requestBody is the body of a request sent by net/http, which may be
+// rendered into a buffer of renderPool. net/http may still read and
+// close the body after the response is back, so the buffer is only put
+// back once both the request and every reader of the body are done.
+type requestBody struct {
+	body []byte
+	buf  *bytebufferpool.ByteBuffer
+	refs int32
+}
+
+func newRequestBody(body []byte, buf *bytebufferpool.ByteBuffer) *requestBody {
+	return &requestBody{body: body, buf: buf, refs: 1}
+}
+
+func (b *requestBody) reader() io.ReadCloser {
+	atomic.AddInt32(&b.refs, 1)
+	return &requestBodyReader{Reader: bytes.NewReader(b.body), body: b}
+}
+
+// release is called by the request once it's done with the body.
+func (b *requestBody) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 && b.buf != nil {
+		renderPool.Put(b.buf)
+	}
+}
+
+type requestBodyReader struct {
+	*bytes.Reader
+	body   *requestBody
+	closed int32
+}
+
+func (r *requestBodyReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.body.release()
+	}
+	return nil
+}
+
+// readBody reads up to maxAssertBody bytes of the response body for
+// assertions and decoded responses, the rest of it is left unread.
+func (c *httpClient) readBody(resp *http.Response) ([]byte, bool, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxAssertBody+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > c.maxAssertBody {
+		return nil, true, nil
+	}
+	// net/http only decodes gzip it asked for on its own
+	body, err = decodeResponseBody(
+		c.responseStats, resp.Header.Get("Content-Encoding"), body,
+		c.maxAssertBody,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, int64(len(body)) > c.maxAssertBody, nil
+}
+
+// withDefaults suppresses default headers net/http would otherwise add
+// to the request.
+func (c *httpClient) withDefaults(h http.Header) http.Header {
+	if _, ok := h["User-Agent"]; !ok && c.omitHeaders.has("User-Agent") {
+		// net/http doesn't send User-Agent if it's explicitly empty
+		h["User-Agent"] = []string{""}
+	}
+	return h
+}
+
+// compressStaticBody compresses body once if it doesn't need to be
+// resolved for each request. Length of the body before compression
+// is returned alongside.
+func compressStaticBody(
+	body *string, resolveBody bool, encoding string,
+) (*string, int) {
+	if body == nil || resolveBody || encoding == "" {
+		return body, 0
+	}
+	compressed := string(compressBody(encoding, []byte(*body)))
+	return &compressed, len(*body)
+}
+
+func headersToFastHTTPHeaders(h *headersList, ctx *vars) *fasthttp.RequestHeader {
+	if h == nil || len(*h) == 0 {
 		return nil
 	}
 	res := new(fasthttp.RequestHeader)
-	for _, header := range *h {
-		res.Set(header.key, replace(header.value, ctx))
-	}
+	writeFastHTTPHeaders(res, compileHeaders(h), ctx)
 	return res
 }
 
-func headersToHTTPHeaders(h *headersList, ctx map[string]string) http.Header {
-	if len(*h) == 0 {
+// writeFastHTTPHeaders renders headers straight into dst. Header names
+// are sent exactly as they were specified by the user, except for the
+// special ones, which fasthttp keeps apart and writes before all the
+// others.
+func writeFastHTTPHeaders(
+	dst *fasthttp.RequestHeader, headers []headerTemplate, ctx *vars,
+) {
+	dst.DisableNormalizing()
+	buf := renderPool.Get()
+	for _, h := range headers {
+		buf.B = h.value.appendTo(buf.B[:0], ctx)
+		if h.special {
+			dst.SetBytesV(h.key, buf.B)
+		} else {
+			dst.AddBytesV(h.key, buf.B)
+		}
+	}
+	renderPool.Put(buf)
+}
+
+func headersToHTTPHeaders(h *headersList, ctx *vars) http.Header {
+	if h == nil || len(*h) == 0 {
 		return http.Header{}
 	}
-	headers := http.Header{}
+	return renderHTTPHeaders(compileHeaders(h), ctx)
+}
 
-	for _, header := range *h {
-		headers[header.key] = []string{replace(header.value, ctx)}
+func renderHTTPHeaders(headers []headerTemplate, ctx *vars) http.Header {
+	res := http.Header{}
+	for _, h := range headers {
+		res[h.key] = append(res[h.key], h.value.render(ctx))
 	}
-	return headers
+	return res
 }
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"crypto/tls"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -56,6 +59,45 @@ func TestShouldProperlyConvertToHttpHeaders(t *testing.T) {
 	}
 }
 
+func TestShouldPreserveHeadersOrderAndCase(t *testing.T) {
+	h := new(headersList)
+	for _, hs := range []string{
+		"x-lower: 1", "X-Repeated: a", "user-agent: agent",
+		"X-MiXeD: 2", "X-Repeated: b",
+	} {
+		if err := h.Set(hs); err != nil {
+			t.Error(err)
+		}
+	}
+	fh := headersToFastHTTPHeaders(h, nil)
+	if e, a := []byte("agent"), fh.UserAgent(); !bytes.Equal(e, a) {
+		t.Errorf("Expected %s, but got %s", e, a)
+	}
+	raw := fh.String()
+	expected := []string{
+		"x-lower: 1", "X-Repeated: a", "X-MiXeD: 2", "X-Repeated: b",
+	}
+	prev := -1
+	for _, e := range expected {
+		i := strings.Index(raw, e)
+		if i <= prev {
+			t.Errorf("%q is missing or out of order in:\n%v", e, raw)
+		}
+		prev = i
+	}
+
+	nh := headersToHTTPHeaders(h, nil)
+	if e, a := []string{"a", "b"}, nh["X-Repeated"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if e, a := "agent", nh.Get("User-Agent"); e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if e, a := []string{"1"}, nh["x-lower"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+}
+
 func TestHTTP2Client(t *testing.T) {
 	responseSize := 1024
 	response := bytes.Repeat([]byte{'a'}, responseSize)
@@ -179,3 +221,25 @@ func TestHTTP1Clients(t *testing.T) {
 		}
 	}
 }
+
+func TestRequestBodyShouldOutliveTheRequest(t *testing.T) {
+	buf := renderPool.Get()
+	buf.B = append(buf.B, "body"...)
+	rb := newRequestBody(buf.B, buf)
+	first, second := rb.reader(), rb.reader()
+	rb.release()
+	// net/http may still close the body after the response is back
+	if data, err := ioutil.ReadAll(first); err != nil || string(data) != "body" {
+		t.Errorf("Expected the body to be intact, but got %q, %v", data, err)
+	}
+	_ = first.Close()
+	_ = first.Close()
+	if rb.refs != 1 {
+		t.Errorf("Expected the second reader to hold the body, but got %v refs",
+			rb.refs)
+	}
+	_ = second.Close()
+	if rb.refs != 0 {
+		t.Errorf("Expected the body to be released, but got %v refs", rb.refs)
+	}
+}
@@ -0,0 +1,21 @@
+/*
+Stand-in for the payload URL service used for testing, serves rows of
+a file through the same API bombardier uses with --payload-url:
+
+	GET /?columns=a,b&offset=0&limit=100
+
+Rows are returned as a JSON array of objects, or as CSV with a header
+row if the client only accepts text/csv. A page with less than limit
+rows is the last one, unless --loop is specified.
+
+Following options are available:
+      --help          Show context-sensitive help (also try --help-long and
+                      --help-man).
+  -p, --port="8082"   port to serve the payload on
+  -f, --file=FILE     CSV file with a header row, JSON array or JSON Lines
+                      file to serve
+      --token=""      bearer token clients have to provide
+      --loop          start over after the last row, so that rows never
+                      run out
+*/
+package main
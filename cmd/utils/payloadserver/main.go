@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/valyala/fasthttp"
+)
+
+var serverPort = kingpin.Flag("port", "port to serve the payload on").
+	Default("8082").
+	Short('p').
+	String()
+var payloadFile = kingpin.Flag("file", "CSV file with a header row, "+
+	"JSON array or JSON Lines file to serve").
+	Short('f').
+	Required().
+	String()
+var token = kingpin.Flag("token", "bearer token clients have to provide").
+	Default("").
+	String()
+var loop = kingpin.Flag("loop", "start over after the last row, so that "+
+	"rows never run out").
+	Bool()
+
+func main() {
+	kingpin.Parse()
+	rows, err := readRows(*payloadFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	addr := "localhost:" + *serverPort
+	log.Printf("Serving %v rows of %v on: %v\n", len(rows), *payloadFile, addr)
+	err = fasthttp.ListenAndServe(addr, func(c *fasthttp.RequestCtx) {
+		serve(c, rows)
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func serve(c *fasthttp.RequestCtx, rows []map[string]string) {
+	if *token != "" &&
+		string(c.Request.Header.Peek("Authorization")) != "Bearer "+*token {
+		c.Error("invalid token", fasthttp.StatusUnauthorized)
+		return
+	}
+	args := c.QueryArgs()
+	offset, err := strconv.Atoi(string(args.Peek("offset")))
+	if err != nil && args.Has("offset") || offset < 0 {
+		c.Error("invalid offset", fasthttp.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(string(args.Peek("limit")))
+	if err != nil || limit < 0 {
+		c.Error("invalid limit", fasthttp.StatusBadRequest)
+		return
+	}
+	var columns []string
+	if args.Has("columns") {
+		columns = strings.Split(string(args.Peek("columns")), ",")
+	}
+
+	page := make([]map[string]string, 0, limit)
+	for i := offset; len(page) < limit && len(rows) > 0; i++ {
+		if i >= len(rows) {
+			if !*loop {
+				break
+			}
+			i %= len(rows)
+		}
+		row, err := selectColumns(rows[i], columns)
+		if err != nil {
+			c.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		page = append(page, row)
+	}
+
+	if strings.Contains(string(c.Request.Header.Peek("Accept")), "text/csv") &&
+		!strings.Contains(string(c.Request.Header.Peek("Accept")), "json") {
+		writeCSV(c, page, columns)
+		return
+	}
+	c.SetContentType("application/json")
+	if err := json.NewEncoder(c).Encode(page); err != nil {
+		log.Println(err)
+	}
+}
+
+func selectColumns(row map[string]string, columns []string) (map[string]string, error) {
+	if columns == nil {
+		return row, nil
+	}
+	res := make(map[string]string, len(columns))
+	for _, column := range columns {
+		value, ok := row[column]
+		if !ok {
+			return nil, errors.New("unknown column " + column)
+		}
+		res[column] = value
+	}
+	return res, nil
+}
+
+func writeCSV(c *fasthttp.RequestCtx, page []map[string]string, columns []string) {
+	if columns == nil && len(page) > 0 {
+		for column := range page[0] {
+			columns = append(columns, column)
+		}
+	}
+	c.SetContentType("text/csv")
+	w := csv.NewWriter(c)
+	_ = w.Write(columns)
+	for _, row := range page {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+}
+
+func readRows(path string) ([]map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(content, &rows); err != nil {
+			return nil, err
+		}
+		return stringify(rows), nil
+	case ".jsonl", ".ndjson":
+		var rows []map[string]interface{}
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var row map[string]interface{}
+			if err := json.Unmarshal(line, &row); err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		return stringify(rows), nil
+	}
+	r := csv.NewReader(bytes.NewReader(content))
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		r.Comma = '\t'
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header row in " + path)
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func stringify(rows []map[string]interface{}) []map[string]string {
+	res := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		res[i] = make(map[string]string, len(row))
+		for k, v := range row {
+			if s, ok := v.(string); ok {
+				res[i][k] = s
+				continue
+			}
+			b, _ := json.Marshal(v)
+			res[i][k] = string(b)
+		}
+	}
+	return res
+}
@@ -12,7 +12,29 @@ const (
 	rateLimitInterval = 10 * time.Millisecond
 	oneSecond         = 1 * time.Second
 
+	exitSuccess = 0
 	exitFailure = 1
+	// exitThresholdsNotMet is the exit status of tests that failed
+	// thresholds or were aborted
+	exitThresholdsNotMet = 2
+	// exitRegressed is the exit status of tests that regressed
+	// compared to the baseline
+	exitRegressed = 3
+
+	defaultPayloadBufferSize = 1024
+	// defaultAssertMaxBody is the size of the largest response body
+	// assertions are checked against
+	defaultAssertMaxBody = 1 << 20
+
+	// defaultTolerance is the change in percents throughput and
+	// latencies may get worse by before it's a regression
+	defaultTolerance = 10.0
+	// defaultRateTolerance is the same for the rates of errors, in
+	// percentage points
+	defaultRateTolerance = 1.0
+	// defaultSignificance is the p-value below which latency
+	// distributions are told apart
+	defaultSignificance = 0.05
 )
 
 var (
@@ -50,6 +72,66 @@ var (
 	errZeroRate = errors.New(
 		"Rate can't be less than 1")
 	errBodyProvidedTwice = errors.New("Use either --body or --body-file")
+	errFormWithBody      = errors.New(
+		"Use either --form or --body/--body-file")
+	errFormStream = errors.New(
+		"Form body can't be streamed")
+	errMultipartWithoutForm = errors.New("--multipart requires --form")
+	errNoBodyTemplate       = errors.New(
+		"--body-template requires --body or --body-file")
+	errBodyTemplateStream = errors.New(
+		"Body rendered from template can't be streamed")
+	errInvalidFormField = errors.New(
+		"Invalid form field format, use key=value or key=@path")
+	errNoCookieJar = errors.New(
+		"--cookie and --reset-session require --cookie-jar")
+	errInvalidCookieFormat = errors.New("Invalid cookie format")
+	errCompressedStream    = errors.New(
+		"Compressed body can't be streamed")
+
+	errEmptyPayload     = errors.New("file content is empty")
+	errPayloadExhausted = errors.New("Payload is exhausted")
+	errPayloadStream    = errors.New(
+		"--payload-stream requires --payload-file")
+	errPayloadStrategyScope = errors.New(
+		"Payload strategies other than sequential require request scope")
+	errPayloadStrategyStream = errors.New(
+		"Only sequential and unique payload strategies can be " +
+			"streamed or used with --payload-url")
+	errUniquePayloadRewind = errors.New(
+		"Unique payload can't be rewound")
+	errInvalidZipfExponent = errors.New(
+		"Zipf exponent must be greater than 1")
+	errInvalidPayloadDelimiter = errors.New(
+		"Payload delimiter must be a single character or \\t")
+
+	errDatasetNotFound = errors.New("Dataset not found")
+	errDatasetTooLarge = errors.New("Dataset exceeds the size limit")
+	errDatasetChecksum = errors.New(
+		"Dataset checksum doesn't match the uploaded file")
+	errDatasetPayloadFile = errors.New(
+		"Dataset can't be used together with payload file or URL")
+	errNoDatasetStore     = errors.New("Datasets are not available")
+	errNotMultipartForm   = errors.New("Expected a multipart form")
+	errBodyLengthRequired = errors.New(
+		"Content-Length is required, chunked bodies are not supported")
+	errServerFormFile = errors.New(
+		"Form files can't be uploaded from the disk of the server")
+
+	errInvalidAssertionFormat = errors.New(
+		"Invalid assertion format, use " +
+			"[[name]] asserter[:expression] [condition] [expected]")
+	errEmptyAssertionExpression = errors.New("expression is required")
+	errEmptyAssertionExpected   = errors.New("expected value is required")
+	errInvalidAssertSample      = errors.New(
+		"Assertion sample must be greater than 0 and at most 1")
+
+	errNotAResult = errors.New(
+		"neither a JSON result of bombardier nor a response of its server")
+	errNoRunMetrics = errors.New(
+		"the response of the server has no rps and errors, it's of an older version")
+	errInvalidSignificance = errors.New(
+		"Significance level must be greater than 0 and less than 1")
 
 	errInvalidHeaderFormat = errors.New("Invalid header format")
 	errEmptyPrintSpec      = errors.New(
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/codesenberg/bombardier/internal"
+)
+
+// comparedPercentiles are the percentiles of latencies compared.
+var comparedPercentiles = []float64{0.5, 0.75, 0.9, 0.95, 0.99}
+
+// runSummary is what tests are compared by, it's made either of the
+// results of a test or of their JSON.
+type runSummary struct {
+	rps float64
+	// latencies are in microseconds, percentiles are keyed by fractions
+	latencies   bool
+	mean, max   float64
+	percentiles map[float64]float64
+	// histogram is sorted by latency, it's empty unless it was kept
+	histogram []internal.KeyCount
+
+	requests, errors, req4xx, req5xx uint64
+}
+
+func summaryOf(r *internal.Results) runSummary {
+	s := runSummary{
+		requests: totalRequests(r),
+		req4xx:   r.Req4XX,
+		req5xx:   r.Req5XX,
+	}
+	s.rps, s.errors = rpsOf(r), errorsOf(r)
+	if stats := r.LatenciesStats(comparedPercentiles); stats != nil {
+		s.latencies = true
+		s.mean, s.max = stats.Mean, stats.Max
+		s.percentiles = make(map[float64]float64, len(stats.Percentiles))
+		for p, v := range stats.Percentiles {
+			s.percentiles[p] = float64(v)
+		}
+		s.histogram = internal.HistogramToKeyCounts(r.Latencies)
+	}
+	return s
+}
+
+// rpsOf and errorsOf measure the test the way thresholds do, both
+// the summaries and the responses of the server are made with them.
+func rpsOf(r *internal.Results) float64 {
+	rps, _, _ := thresholdMetrics["rps"].measure(r)
+	return rps
+}
+
+func errorsOf(r *internal.Results) uint64 {
+	errors, _, _ := thresholdMetrics["errors"].measure(r)
+	return uint64(errors)
+}
+
+// parseRunSummary reads the summary of a test out of its JSON result,
+// printed either with --format json or by the server.
+func parseRunSummary(data []byte) (runSummary, error) {
+	var res struct {
+		Result *struct {
+			TimeTakenSeconds                               float64
+			Req1xx, Req2xx, Req3xx, Req4xx, Req5xx, Others uint64
+			Errors                                         []struct{ Count uint64 }
+			AssertFailures                                 uint64
+			Latency                                        *struct {
+				Mean, Max   float64
+				Percentiles map[string]float64
+				Histogram   []LatencyCount
+			}
+			Rps *struct{ Mean float64 }
+		}
+		// the rest are of the responses of the server
+		Status  *Status
+		Latency *Latency
+		Rps     *float64
+		Errors  *uint64
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return runSummary{}, err
+	}
+	var s runSummary
+	switch {
+	case res.Result != nil:
+		r := res.Result
+		s.requests = r.Req1xx + r.Req2xx + r.Req3xx + r.Req4xx + r.Req5xx + r.Others
+		s.req4xx, s.req5xx = r.Req4xx, r.Req5xx
+		s.errors = r.AssertFailures
+		for _, e := range r.Errors {
+			s.errors += e.Count
+		}
+		if r.Rps != nil {
+			s.rps = r.Rps.Mean
+		} else if r.TimeTakenSeconds > 0 {
+			s.rps = float64(s.requests) / r.TimeTakenSeconds
+		}
+		if l := r.Latency; l != nil {
+			s.latencies = true
+			s.mean, s.max = l.Mean, l.Max
+			s.percentiles = make(map[float64]float64, len(l.Percentiles))
+			for k, v := range l.Percentiles {
+				p, err := strconv.ParseFloat(strings.TrimSpace(k), 64)
+				if err != nil {
+					return s, fmt.Errorf("Invalid percentile %q", k)
+				}
+				s.percentiles[p/100] = v
+			}
+			s.histogram = keyCountsOf(l.Histogram)
+		}
+	case res.Status != nil:
+		st := res.Status
+		s.requests = st.Req1xx + st.Req2xx + st.Req3xx + st.Req4xx + st.Req5xx + st.Others
+		s.req4xx, s.req5xx = st.Req4xx, st.Req5xx
+		if res.Rps == nil || res.Errors == nil {
+			return s, errNoRunMetrics
+		}
+		s.rps, s.errors = *res.Rps, *res.Errors
+		if l := res.Latency; l != nil && l.Avg != "" {
+			// the server reports milliseconds
+			ms := func(v string) float64 {
+				f, _ := strconv.ParseFloat(v, 64)
+				return f * 1000
+			}
+			s.latencies = true
+			s.mean, s.max = ms(l.Avg), ms(l.Max)
+			s.percentiles = make(map[float64]float64, len(l.Percentiles))
+			for k, v := range l.Percentiles {
+				p, err := strconv.ParseFloat(k, 64)
+				if err != nil {
+					return s, fmt.Errorf("Invalid percentile %q", k)
+				}
+				s.percentiles[p] = ms(v)
+			}
+			s.histogram = keyCountsOf(l.Histogram)
+		}
+	default:
+		return s, errNotAResult
+	}
+	return s, nil
+}
+
+func loadRunSummary(path string) (runSummary, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return runSummary{}, err
+	}
+	s, err := parseRunSummary(data)
+	if err != nil {
+		return s, fmt.Errorf("%v: %v", path, err)
+	}
+	return s, nil
+}
+
+func keyCountsOf(histogram []LatencyCount) []internal.KeyCount {
+	res := make([]internal.KeyCount, 0, len(histogram))
+	for _, lc := range histogram {
+		res = append(res, internal.KeyCount{Key: lc.Latency, Count: lc.Count})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+// tolerance is how much a metric may get worse by before it's a
+// regression, e.g. p99=5%. It's relative for throughput and latencies,
+// while for rates it's in percentage points.
+type tolerance struct {
+	metric string
+	value  float64
+}
+
+const (
+	throughputKind = "throughput"
+	latencyKind    = "latency"
+	rateKind       = "rate"
+)
+
+// toleranceMetrics are the metrics tolerances can be set for alongside
+// with their kinds, latency sets the one of every latency.
+var toleranceMetrics = map[string]string{
+	"rps":     throughputKind,
+	"latency": latencyKind,
+	"mean":    latencyKind,
+	"max":     latencyKind,
+	"p50":     latencyKind,
+	"p75":     latencyKind,
+	"p90":     latencyKind,
+	"p95":     latencyKind,
+	"p99":     latencyKind,
+	"errors":  rateKind,
+	"4xx":     rateKind,
+	"5xx":     rateKind,
+}
+
+func toleranceMetricNames() []string {
+	names := make([]string, 0, len(toleranceMetrics))
+	for name := range toleranceMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseTolerance(expr string) (tolerance, error) {
+	parts := strings.SplitN(expr, "=", 2)
+	if len(parts) != 2 {
+		return tolerance{}, fmt.Errorf("Invalid tolerance %q, expected "+
+			"<metric>=<percent>, e.g. p99=5%%", expr)
+	}
+	t := tolerance{metric: strings.TrimSpace(parts[0])}
+	if _, ok := toleranceMetrics[t.metric]; !ok {
+		return t, fmt.Errorf("Unknown metric %q of tolerance %q, available are %v",
+			t.metric, expr, strings.Join(toleranceMetricNames(), ", "))
+	}
+	value := strings.TrimSuffix(strings.TrimSpace(parts[1]), "%")
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return t, fmt.Errorf("Invalid value of tolerance %q", expr)
+	}
+	t.value = v
+	return t, nil
+}
+
+func parseTolerances(exprs []string) (*[]tolerance, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	tolerances := make([]tolerance, 0, len(exprs))
+	for _, expr := range exprs {
+		t, err := parseTolerance(expr)
+		if err != nil {
+			return nil, err
+		}
+		tolerances = append(tolerances, t)
+	}
+	return &tolerances, nil
+}
+
+// toleranceList is the value of the repeatable --tolerance flag.
+type toleranceList []tolerance
+
+func (l *toleranceList) String() string {
+	exprs := make([]string, 0, len(*l))
+	for _, t := range *l {
+		exprs = append(exprs, t.metric+"="+strconv.FormatFloat(t.value, 'f', -1, 64)+"%")
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (l *toleranceList) IsCumulative() bool {
+	return true
+}
+
+func (l *toleranceList) Set(value string) error {
+	t, err := parseTolerance(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, t)
+	return nil
+}
+
+// comparisonOptions tell how tests are compared, the defaults are
+// used for zero values.
+type comparisonOptions struct {
+	tolerances   []tolerance
+	significance float64
+}
+
+func (o comparisonOptions) toleranceOf(metric, kind string) float64 {
+	res := defaultTolerance
+	if kind == rateKind {
+		res = defaultRateTolerance
+	}
+	// the specific tolerance wins over the one of all latencies
+	for _, t := range o.tolerances {
+		if t.metric == metric {
+			return t.value
+		}
+		if kind == latencyKind && t.metric == latencyKind {
+			res = t.value
+		}
+	}
+	return res
+}
+
+func (o comparisonOptions) level() float64 {
+	if o.significance > 0 {
+		return o.significance
+	}
+	return defaultSignificance
+}
+
+// compareRuns compares the current test with the baseline, changes of
+// latencies within noise, as told by their distributions, aren't
+// regressions.
+func compareRuns(baseline, current runSummary, o comparisonOptions) *internal.Comparison {
+	c := new(internal.Comparison)
+	if len(baseline.histogram) > 0 && len(current.histogram) > 0 {
+		d, p := ksTest(baseline.histogram, current.histogram)
+		c.Significance = &internal.Significance{
+			Statistic:   d,
+			PValue:      p,
+			Level:       o.level(),
+			Significant: p < o.level(),
+		}
+	}
+	add := func(name, kind string, base, cur float64) {
+		m := internal.ComparedMetric{
+			Name:      name,
+			Kind:      kind,
+			Baseline:  base,
+			Current:   cur,
+			Tolerance: o.toleranceOf(name, kind),
+			Verdict:   "unchanged",
+		}
+		worse := cur - base
+		if kind == rateKind {
+			m.Delta = cur - base
+		} else {
+			if base == 0 {
+				// there is nothing to be relative to
+				return
+			}
+			m.Delta = (cur - base) / base * 100
+			worse = m.Delta
+		}
+		if kind == throughputKind {
+			worse = -worse
+		}
+		noise := kind == latencyKind &&
+			c.Significance != nil && !c.Significance.Significant
+		switch {
+		case noise:
+		case worse > m.Tolerance:
+			m.Verdict = "regressed"
+			c.Regressed = true
+		case -worse > m.Tolerance:
+			m.Verdict = "improved"
+		}
+		c.Metrics = append(c.Metrics, m)
+	}
+	add("rps", throughputKind, baseline.rps, current.rps)
+	if baseline.latencies && current.latencies {
+		add("mean", latencyKind, baseline.mean, current.mean)
+		for _, p := range comparedPercentiles {
+			base, ok := baseline.percentiles[p]
+			cur, ok2 := current.percentiles[p]
+			if ok && ok2 {
+				name := "p" + strconv.FormatFloat(p*100, 'f', -1, 64)
+				add(name, latencyKind, base, cur)
+			}
+		}
+		add("max", latencyKind, baseline.max, current.max)
+	}
+	rate := func(count, total uint64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(count) / float64(total) * 100
+	}
+	add("errors", rateKind,
+		rate(baseline.errors, baseline.requests), rate(current.errors, current.requests))
+	add("4xx", rateKind,
+		rate(baseline.req4xx, baseline.requests), rate(current.req4xx, current.requests))
+	add("5xx", rateKind,
+		rate(baseline.req5xx, baseline.requests), rate(current.req5xx, current.requests))
+	return c
+}
+
+// ksTest is the two-sample Kolmogorov-Smirnov test of histograms sorted
+// by key, it returns the largest distance between their cumulative
+// distributions and the probability of one at least that large if both
+// came from the same distribution.
+func ksTest(a, b []internal.KeyCount) (d, p float64) {
+	na, nb := countOf(a), countOf(b)
+	if na == 0 || nb == 0 {
+		return 0, 1
+	}
+	var ca, cb float64
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case j == len(b) || i < len(a) && a[i].Key < b[j].Key:
+			ca += float64(a[i].Count)
+			i++
+		case i == len(a) || b[j].Key < a[i].Key:
+			cb += float64(b[j].Count)
+			j++
+		default:
+			ca += float64(a[i].Count)
+			cb += float64(b[j].Count)
+			i++
+			j++
+		}
+		d = math.Max(d, math.Abs(ca/na-cb/nb))
+	}
+	en := math.Sqrt(na * nb / (na + nb))
+	return d, ksProbability((en + 0.12 + 0.11/en) * d)
+}
+
+func countOf(h []internal.KeyCount) float64 {
+	count := uint64(0)
+	for _, kc := range h {
+		count += kc.Count
+	}
+	return float64(count)
+}
+
+// ksProbability is the Kolmogorov distribution's complementary
+// cumulative distribution function.
+func ksProbability(lambda float64) float64 {
+	const eps1, eps2 = 1e-3, 1e-8
+	a2 := -2 * lambda * lambda
+	sum, sign, prev := 0.0, 2.0, 0.0
+	for k := 1; k <= 100; k++ {
+		term := sign * math.Exp(a2*float64(k*k))
+		sum += term
+		if math.Abs(term) <= eps1*prev || math.Abs(term) <= eps2*sum {
+			return math.Min(math.Max(sum, 0), 1)
+		}
+		sign = -sign
+		prev = math.Abs(term)
+	}
+	// it only fails to converge for distributions that are alike
+	return 1
+}
+
+var comparisonFormats = map[string]string{
+	"pt":         "plain-text",
+	"plain-text": "plain-text",
+	"j":          "json",
+	"json":       "json",
+	"md":         "markdown",
+	"markdown":   "markdown",
+}
+
+// comparisonFormatFromString returns the name of the comparison format,
+// plain-text if the spec is empty.
+func comparisonFormatFromString(spec string) (string, bool) {
+	if spec == "" {
+		return "plain-text", true
+	}
+	f, ok := comparisonFormats[spec]
+	return f, ok
+}
+
+func comparisonFuncs() template.FuncMap {
+	funcs := templateFuncs()
+	funcs["FormatMetric"] = func(kind string, v float64) string {
+		switch kind {
+		case latencyKind:
+			return formatTimeUs(v)
+		case rateKind:
+			return fmt.Sprintf("%.2f%%", v)
+		}
+		return fmt.Sprintf("%.2f", v)
+	}
+	funcs["FormatDelta"] = func(kind string, v float64) string {
+		if kind == rateKind {
+			return fmt.Sprintf("%+.2fpp", v)
+		}
+		return fmt.Sprintf("%+.2f%%", v)
+	}
+	funcs["FormatTolerance"] = func(kind string, v float64) string {
+		if kind == rateKind {
+			return fmt.Sprintf("±%.2fpp", v)
+		}
+		return fmt.Sprintf("±%g%%", v)
+	}
+	return funcs
+}
+
+func printComparison(out io.Writer, format string, c *internal.Comparison) error {
+	name, ok := comparisonFormatFromString(format)
+	if !ok {
+		return fmt.Errorf("unknown comparison format %q", format)
+	}
+	t, err := template.New("comparison-template").
+		Funcs(comparisonFuncs()).
+		Parse(comparisonTemplates[name])
+	if err != nil {
+		return err
+	}
+	return t.Execute(out, c)
+}
+
+// compareCommand compares two JSON results instead of running a test.
+const compareCommand = "compare"
+
+// compare compares two JSON results of tests and prints the
+// comparison, the arguments start with the name of the command.
+func compare(args []string, out io.Writer) (regressed bool, err error) {
+	var (
+		baseline, current, format string
+		significance              float64
+		tolerances                = new(toleranceList)
+	)
+	app := kingpin.New(compareCommand,
+		"Compares the JSON results of two tests, the exit status is 3 "+
+			"if the current one regressed")
+	app.Flag("tolerance", "How much a metric may get worse by(can be "+
+		"repeated), e.g. \"p99=5%\"").
+		PlaceHolder("\"<metric>=<percent>\"").
+		SetValue(tolerances)
+	app.Flag("significance", "P-value below which latency distributions differ").
+		PlaceHolder(strconv.FormatFloat(defaultSignificance, 'f', -1, 64)).
+		Float64Var(&significance)
+	app.Flag("format", "plain-text (short: pt), json (short: j) or "+
+		"markdown (short: md)").
+		PlaceHolder("<spec>").
+		Short('o').
+		StringVar(&format)
+	app.Arg("baseline", "JSON result of the baseline").Required().
+		StringVar(&baseline)
+	app.Arg("current", "JSON result of the current test").Required().
+		StringVar(&current)
+	if _, err = app.Parse(args[1:]); err != nil {
+		return false, err
+	}
+	if significance < 0 || significance >= 1 {
+		return false, errInvalidSignificance
+	}
+	if _, ok := comparisonFormatFromString(format); !ok {
+		return false, fmt.Errorf("unknown comparison format %q", format)
+	}
+	base, err := loadRunSummary(baseline)
+	if err != nil {
+		return false, err
+	}
+	cur, err := loadRunSummary(current)
+	if err != nil {
+		return false, err
+	}
+	c := compareRuns(base, cur, comparisonOptions{
+		tolerances:   *tolerances,
+		significance: significance,
+	})
+	return c.Regressed, printComparison(out, format, c)
+}
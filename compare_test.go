@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+func TestParseTolerance(t *testing.T) {
+	expectations := []struct {
+		in       string
+		expected tolerance
+	}{
+		{"p99=5%", tolerance{metric: "p99", value: 5}},
+		{" rps = 2.5% ", tolerance{metric: "rps", value: 2.5}},
+		{"errors=0.5", tolerance{metric: "errors", value: 0.5}},
+		{"latency=0%", tolerance{metric: "latency", value: 0}},
+	}
+	for _, e := range expectations {
+		actual, err := parseTolerance(e.in)
+		if err != nil {
+			t.Errorf("%q: %v", e.in, err)
+			continue
+		}
+		if actual != e.expected {
+			t.Errorf("%q: expected %+v, but got %+v", e.in, e.expected, actual)
+		}
+	}
+	invalid := []string{"", "p99", "p99=", "p99=-1%", "p42=5%", "p99=few", "=5%"}
+	for _, in := range invalid {
+		if _, err := parseTolerance(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+// normalHistogram is a histogram of n latencies around the mean, in
+// microseconds.
+func normalHistogram(mean, n uint64) []internal.KeyCount {
+	weights := []uint64{1, 4, 10, 20, 30, 20, 10, 4, 1}
+	res := make([]internal.KeyCount, 0, len(weights))
+	for i, w := range weights {
+		res = append(res, internal.KeyCount{
+			Key:   mean - 400 + uint64(i)*100,
+			Count: n * w / 100,
+		})
+	}
+	return res
+}
+
+func TestKsTest(t *testing.T) {
+	base := normalHistogram(10000, 10000)
+	if d, p := ksTest(base, base); d != 0 || p != 1 {
+		t.Errorf("Expected alike distributions, but got D=%v, p=%v", d, p)
+	}
+	if _, p := ksTest(base, normalHistogram(10100, 10000)); p >= 0.001 {
+		t.Errorf("Expected shifted distributions to differ, but got p=%v", p)
+	}
+	if _, p := ksTest(normalHistogram(10000, 20), normalHistogram(10100, 20)); p < 0.05 {
+		t.Errorf("Expected few latencies to be alike, but got p=%v", p)
+	}
+	if d, p := ksTest(nil, base); d != 0 || p != 1 {
+		t.Errorf("Expected no difference without latencies, but got D=%v, p=%v", d, p)
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	baseline := runSummary{
+		rps:       1000,
+		latencies: true,
+		mean:      10000,
+		max:       50000,
+		percentiles: map[float64]float64{
+			0.5: 9000, 0.99: 30000,
+		},
+		requests: 10000,
+		errors:   10,
+		req5xx:   10,
+	}
+	current := baseline
+	current.rps = 850
+	current.mean = 10500
+	current.max = 80000
+	current.percentiles = map[float64]float64{0.5: 7000, 0.99: 33000}
+	current.errors = 300
+	current.req5xx = 300
+
+	c := compareRuns(baseline, current, comparisonOptions{
+		tolerances: []tolerance{{"latency", 5}, {"p99", 20}, {"errors", 5}},
+	})
+	verdicts := map[string]string{}
+	for _, m := range c.Metrics {
+		verdicts[m.Name] = m.Verdict
+	}
+	expected := map[string]string{
+		"rps":    "regressed",
+		"mean":   "unchanged",
+		"p50":    "improved",
+		"p99":    "unchanged",
+		"max":    "regressed",
+		"errors": "unchanged",
+		"4xx":    "unchanged",
+		"5xx":    "regressed",
+	}
+	for name, verdict := range expected {
+		if verdicts[name] != verdict {
+			t.Errorf("%v: expected %v, but got %v", name, verdict, verdicts[name])
+		}
+	}
+	if !c.Regressed || c.Significance != nil {
+		t.Errorf("Unexpected comparison %+v", c)
+	}
+
+	// the same distributions only differ by chance
+	baseline.histogram = normalHistogram(10000, 100)
+	current.histogram = normalHistogram(10000, 100)
+	current.rps, current.errors, current.req5xx = baseline.rps, 10, 10
+	c = compareRuns(baseline, current, comparisonOptions{})
+	if c.Regressed || c.Significance == nil || c.Significance.Significant ||
+		c.Significance.Level != defaultSignificance {
+		t.Errorf("Expected changes of latencies to be noise, but got %+v %+v",
+			c, c.Significance)
+	}
+}
+
+func TestParseRunSummary(t *testing.T) {
+	result := `{"spec":{"numberOfConnections":1},"result":{
+		"timeTakenSeconds":2,"req1xx":0,"req2xx":90,"req3xx":0,"req4xx":6,
+		"req5xx":4,"others":0,"errors":[{"description":"timeout","count":1}],
+		"assertedResponses":100,"assertFailures":2,
+		"latency":{"mean":1500,"stddev":10,"max":9000,
+			"percentiles":{"50":1000,"99":8000},
+			"histogram":[{"latency":2000,"count":50},{"latency":1000,"count":50}]},
+		"rps":{"mean":50}}}`
+	s, err := parseRunSummary([]byte(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.requests != 100 || s.errors != 3 || s.req4xx != 6 || s.req5xx != 4 ||
+		s.rps != 50 || s.mean != 1500 || s.percentiles[0.99] != 8000 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	if len(s.histogram) != 2 || s.histogram[0].Key != 1000 {
+		t.Errorf("Expected the histogram to be sorted, but got %+v", s.histogram)
+	}
+
+	response := `{"url":"http://localhost","numConns":1,"numReqs":10,
+		"status":{"req1xx":0,"req2xx":10,"req3xx":0,"req4xx":0,"req5xx":0,"others":0},
+		"latency":{"avg":"1.50","stdDev":"0.10","max":"9.00","min":"1.00",
+			"percentiles":{"0.5":"1.00","0.99":"8.00"}},
+		"tps":"125.50","rps":120,"errors":3,"passed":true,"errorCount":1}`
+	s, err = parseRunSummary([]byte(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.requests != 10 || s.errors != 3 || s.rps != 120 || s.mean != 1500 ||
+		s.percentiles[0.5] != 1000 || len(s.histogram) != 0 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	older := strings.Replace(response, `"rps":120,"errors":3,`, "", 1)
+	if _, err := parseRunSummary([]byte(older)); err != errNoRunMetrics {
+		t.Errorf("Expected %v, but got %v", errNoRunMetrics, err)
+	}
+
+	for _, invalid := range []string{`[]`, `{}`, `{"foo":1}`, `{"result":`} {
+		if _, err := parseRunSummary([]byte(invalid)); err == nil {
+			t.Errorf("%v: expected an error", invalid)
+		}
+	}
+}
+
+func TestPrintComparison(t *testing.T) {
+	c := &internal.Comparison{
+		Metrics: []internal.ComparedMetric{
+			{Name: "rps", Kind: throughputKind, Baseline: 1000, Current: 900,
+				Delta: -10, Tolerance: 5, Verdict: "regressed"},
+			{Name: "p99", Kind: latencyKind, Baseline: 30000, Current: 31000,
+				Delta: 3.33, Tolerance: 10, Verdict: "unchanged"},
+			{Name: "errors", Kind: rateKind, Baseline: 0.1, Current: 0.2,
+				Delta: 0.1, Tolerance: 1, Verdict: "unchanged"},
+		},
+		Significance: &internal.Significance{
+			Statistic: 0.25, PValue: 0.001, Level: 0.05, Significant: true,
+		},
+		Regressed: true,
+	}
+	out := new(bytes.Buffer)
+	if err := printComparison(out, "", c); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"rps           1000.00       900.00    -10.00%        ±5%  regressed",
+		"p99           30.00ms      31.00ms     +3.33%       ±10%  unchanged",
+		"errors          0.10%        0.20%    +0.10pp    ±1.00pp  unchanged",
+		"Latency distributions are different, D=0.2500, p=0.0010 at level 0.05",
+		"Result: regressed",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%v", line, out)
+		}
+	}
+
+	out.Reset()
+	if err := printComparison(out, "md", c); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"| Metric | Baseline | Current | Delta | Tolerance | Verdict |",
+		"| rps | 1000.00 | 900.00 | -10.00% | ±5% | **regressed** |",
+		"**Result:** regressed",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%v", line, out)
+		}
+	}
+
+	out.Reset()
+	if err := printComparison(out, "json", c); err != nil {
+		t.Fatal(err)
+	}
+	var report ComparisonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("%v: %v", err, out)
+	}
+	if expected := comparisonReport(c); !jsonEqual(t, report, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, report)
+	}
+
+	if err := printComparison(out, "html", c); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func jsonEqual(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(ja, jb)
+}
+
+func TestCompareCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, rps float64) string {
+		path := filepath.Join(dir, name)
+		result := `{"result":{"timeTakenSeconds":1,"req2xx":1000,` +
+			`"rps":{"mean":` + strconv.FormatFloat(rps, 'f', -1, 64) + `}}}`
+		if err := ioutil.WriteFile(path, []byte(result), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	baseline, current := write("baseline.json", 1000), write("current.json", 950)
+
+	out := new(bytes.Buffer)
+	regressed, err := compare([]string{compareCommand, baseline, current}, out)
+	if err != nil || regressed {
+		t.Errorf("Expected no regressions, but got %v: %v", err, out)
+	}
+	out.Reset()
+	regressed, err = compare([]string{
+		compareCommand, "--tolerance", "rps=1%", "-o", "json", baseline, current,
+	}, out)
+	if err != nil || !regressed || !strings.Contains(out.String(), `"regressed":true`) {
+		t.Errorf("Expected a regression, but got %v: %v", err, out)
+	}
+	for _, args := range [][]string{
+		{compareCommand, baseline},
+		{compareCommand, "--significance", "2", baseline, current},
+		{compareCommand, "-o", "html", baseline, current},
+		{compareCommand, baseline, filepath.Join(dir, "absent.json")},
+	} {
+		if _, err := compare(args, ioutil.Discard); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/valyala/fasthttp"
+)
+
+// encodings lists supported content codings.
+var encodings = []string{"gzip", "deflate", "br"}
+
+func isKnownEncoding(encoding string) bool {
+	for _, e := range encodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+func compressBody(encoding string, body []byte) []byte {
+	switch encoding {
+	case "gzip":
+		return fasthttp.AppendGzipBytes(nil, body)
+	case "deflate":
+		return fasthttp.AppendDeflateBytes(nil, body)
+	case "br":
+		return fasthttp.AppendBrotliBytes(nil, body)
+	}
+	return body
+}
+
+// contentCodings splits the value of Content-Encoding into the codings
+// in the order they were applied, identity is left out.
+func contentCodings(encoding string) []string {
+	var codings []string
+	for _, c := range strings.Split(encoding, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && c != "identity" {
+			codings = append(codings, c)
+		}
+	}
+	return codings
+}
+
+// hasKnownEncoding tells whether any of the codings is supported.
+func hasKnownEncoding(codings []string) bool {
+	for _, c := range codings {
+		if isKnownEncoding(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func newDecoder(coding string, r io.Reader) (io.Reader, error) {
+	switch coding {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "br":
+		return brotli.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("unsupported content coding %q", coding)
+}
+
+// decompressBody decodes body encoded with the specified content
+// codings, which are undone in reverse order. Bodies without known
+// codings are left as is, while an unknown coding mixed with known ones
+// is an error. No more than limit+1 bytes are decoded, so that
+// compressed bombs can't take all the memory.
+func decompressBody(encoding string, body []byte, limit int64) ([]byte, error) {
+	codings := contentCodings(encoding)
+	if !hasKnownEncoding(codings) {
+		return body, nil
+	}
+	var r io.Reader = bytes.NewReader(body)
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		if r, err = newDecoder(codings[i], r); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(io.LimitReader(r, limit+1))
+}
+
+// withCompressionHeaders returns a copy of headers with
+// Content-Encoding and Accept-Encoding added, unless they are empty.
+func withCompressionHeaders(
+	headers *headersList, compression, acceptEncoding string,
+) *headersList {
+	var extra []header
+	if compression != "" {
+		extra = append(extra, header{"Content-Encoding", compression})
+	}
+	if acceptEncoding != "" {
+		extra = append(extra, header{"Accept-Encoding", acceptEncoding})
+	}
+	return headers.with(extra...)
+}
+
+// compressionStats accumulates sizes of request and response bodies
+// before and after compression.
+type compressionStats struct {
+	requestBytes, compressedRequestBytes int64
+
+	decodedResponses                           uint64
+	encodedResponseBytes, decodedResponseBytes int64
+	// time spent on decompression, in microseconds
+	decompressionTime uint64
+}
+
+func (c *compressionStats) recordRequest(raw, compressed int) {
+	atomic.AddInt64(&c.requestBytes, int64(raw))
+	atomic.AddInt64(&c.compressedRequestBytes, int64(compressed))
+}
+
+// decode decompresses up to limit+1 bytes of the response body if it's
+// encoded with any of the known codings and records the sizes and
+// time spent.
+func (c *compressionStats) decode(
+	encoding string, body []byte, limit int64,
+) ([]byte, error) {
+	if !hasKnownEncoding(contentCodings(encoding)) {
+		return body, nil
+	}
+	start := time.Now()
+	decoded, err := decompressBody(encoding, body, limit)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&c.decompressionTime,
+		uint64(time.Since(start).Nanoseconds()/1000))
+	atomic.AddUint64(&c.decodedResponses, 1)
+	atomic.AddInt64(&c.encodedResponseBytes, int64(len(body)))
+	atomic.AddInt64(&c.decodedResponseBytes, int64(len(decoded)))
+	return decoded, nil
+}
+
+// encodeRequestBody compresses body with the specified content coding
+// and records the sizes.
+func (c *compressionStats) encodeRequestBody(encoding string, body []byte) []byte {
+	compressed := compressBody(encoding, body)
+	c.recordRequest(len(body), len(compressed))
+	return compressed
+}
+
+// decodeResponseBody decompresses up to limit+1 bytes of the response
+// body, sizes and time spent are only recorded if stats is not nil.
+func decodeResponseBody(
+	stats *compressionStats, encoding string, body []byte, limit int64,
+) ([]byte, error) {
+	if stats == nil {
+		return decompressBody(encoding, body, limit)
+	}
+	return stats.decode(encoding, body, limit)
+}
+
+func (c *compressionStats) info() *internal.CompressionStats {
+	return &internal.CompressionStats{
+		RequestBytes:           atomic.LoadInt64(&c.requestBytes),
+		CompressedRequestBytes: atomic.LoadInt64(&c.compressedRequestBytes),
+
+		DecodedResponses:     atomic.LoadUint64(&c.decodedResponses),
+		EncodedResponseBytes: atomic.LoadInt64(&c.encodedResponseBytes),
+		DecodedResponseBytes: atomic.LoadInt64(&c.decodedResponseBytes),
+		DecompressionTime: time.Duration(
+			atomic.LoadUint64(&c.decompressionTime)) * time.Microsecond,
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	body := []byte(strings.Repeat(`{"name":"Tom","age":42}`, 100))
+	for _, encoding := range encodings {
+		compressed := compressBody(encoding, body)
+		if len(compressed) >= len(body) {
+			t.Errorf("%v: body wasn't compressed, %v >= %v",
+				encoding, len(compressed), len(body))
+		}
+		decoded, err := decompressBody(encoding, compressed, int64(len(body)))
+		if err != nil {
+			t.Errorf("%v: %v", encoding, err)
+			continue
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Errorf("%v: decoded body differs from the original", encoding)
+		}
+	}
+}
+
+func TestDecompressBodyShouldBeLimited(t *testing.T) {
+	body := make([]byte, 1<<20)
+	for _, encoding := range encodings {
+		decoded, err := decompressBody(encoding, compressBody(encoding, body), 1000)
+		if err != nil {
+			t.Errorf("%v: %v", encoding, err)
+			continue
+		}
+		if len(decoded) != 1001 {
+			t.Errorf("%v: expected 1001 decoded bytes, but got %v",
+				encoding, len(decoded))
+		}
+	}
+}
+
+func TestDecompressBodyShouldUndoMultipleCodings(t *testing.T) {
+	body := []byte(strings.Repeat(`{"name":"Tom","age":42}`, 100))
+	encoded := compressBody("br", compressBody("gzip", body))
+	for _, encoding := range []string{"gzip, br", "GZIP,br", "gzip, identity, br"} {
+		decoded, err := decompressBody(encoding, encoded, int64(len(body)))
+		if err != nil {
+			t.Errorf("%v: %v", encoding, err)
+			continue
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Errorf("%v: decoded body differs from the original", encoding)
+		}
+	}
+	if _, err := decompressBody("gzip, br", compressBody("br", body), 1000); err == nil {
+		t.Error("Decoding of a body missing one of the codings should fail")
+	}
+	gzipped := compressBody("gzip", body)
+	if _, err := decompressBody("compress, gzip", gzipped, 1000); err == nil {
+		t.Error("Decoding of an unknown coding should fail")
+	}
+	decoded, err := decompressBody("compress", gzipped, 1000)
+	if err != nil || !bytes.Equal(decoded, gzipped) {
+		t.Errorf("Unknown coding should be left as is, but got %v", err)
+	}
+}
+
+func TestCompressionStatsShouldRecordDecodedResponses(t *testing.T) {
+	body := []byte(strings.Repeat("a", 1000))
+	compressed := compressBody("gzip", body)
+	stats := new(compressionStats)
+	if _, err := stats.decode("gzip", compressed, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stats.decode("", body, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stats.decode("gzip", body, 1000); err == nil {
+		t.Error("Decoding of malformed body should fail")
+	}
+	stats.recordRequest(100, 10)
+	info := stats.info()
+	if info.DecodedResponses != 1 {
+		t.Errorf("Expected 1 decoded response, but got %v",
+			info.DecodedResponses)
+	}
+	if e, a := int64(len(compressed)), info.EncodedResponseBytes; e != a {
+		t.Errorf("Expected %v encoded bytes, but got %v", e, a)
+	}
+	if e, a := int64(len(body)), info.DecodedResponseBytes; e != a {
+		t.Errorf("Expected %v decoded bytes, but got %v", e, a)
+	}
+	if e, a := 10.0, info.RequestRatio(); e != a {
+		t.Errorf("Expected request ratio %v, but got %v", e, a)
+	}
+}
+
+func TestWithCompressionHeadersShouldNotModifyHeaders(t *testing.T) {
+	headers := &headersList{{"Accept", "application/json"}}
+	res := withCompressionHeaders(headers, "br", "gzip, br")
+	expected := &headersList{
+		{"Accept", "application/json"},
+		{"Content-Encoding", "br"},
+		{"Accept-Encoding", "gzip, br"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, but got %v", expected, res)
+	}
+	if len(*headers) != 1 {
+		t.Errorf("Original headers were modified: %v", headers)
+	}
+}
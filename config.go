@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -13,14 +14,40 @@ type config struct {
 	duration                       *time.Duration
 	url, method, certPath, keyPath string
 	body, bodyFilePath             string
+	bodyTemplate                   bool
+	form                           *[]string
+	multipart                      bool
 	payloadFile                    string
 	payloadUrl                     string
 	varNames                       string
+	payloadFormat                  string
+	payloadDelimiter               string
+	payloadHeader                  bool
+	payloadLazyQuotes              bool
+	payloadStream                  bool
+	payloadBufferSize              uint64
+	payloadRewind                  bool
+	payloadStrategy                string
+	payloadSeed                    int64
+	payloadZipfExponent            float64
+	payloadHeaders                 *headersList
+	payloadToken                   string
+	payloadPageSize                uint64
+	payloadRetries                 *uint64
+	payloadTimeout                 time.Duration
 	startLine                      uint32
 	scope                          scope
 	stream                         bool
 	headers                        *headersList
+	host                           string
+	omitHeaders                    *[]string
 	timeout                        time.Duration
+	maxRedirects                   uint64
+	cookieJar                      bool
+	cookies                        *[]string
+	resetSessionEvery              uint64
+	compression                    string
+	acceptEncoding                 string
 	// TODO(codesenberg): printLatencies should probably be
 	// re(named&maked) into printPercentiles or even let
 	// users provide their own percentiles and not just
@@ -29,7 +56,39 @@ type config struct {
 	rate                     *uint64
 	clientType               clientTyp
 
-	assertions *[]assertion
+	assertions    *[]assertion
+	assertMaxBody uint64
+	// assertSample is the fraction of responses asserted, all of them
+	// are if it's zero
+	assertSample float64
+	// failureSamples is the number of failed responses kept, nil for
+	// the default one
+	failureSamples *uint64
+	failuresDir    string
+
+	// thresholds the results must meet for the test to pass
+	thresholds *[]threshold
+	// abortConditions stop the test early once any is breached
+	abortConditions *[]abortCondition
+
+	// latencyHistogram tells to include every latency in the JSON
+	// result, so that distributions can be compared
+	latencyHistogram bool
+	// baselineFile is the JSON result the test is compared with,
+	// unless the baseline is already read
+	baselineFile string
+	baseline     *runSummary
+	tolerances   *[]tolerance
+	// significance is the p-value below which latency distributions
+	// differ, the default one is used if it's zero
+	significance  float64
+	compareFormat string
+
+	// timeseries tells to record the results of every interval, which
+	// it is if they are written to timeseriesFile too
+	timeseries       bool
+	timeseriesFile   string
+	timeseriesFormat string
 
 	printIntro, printProgress, printResult bool
 
@@ -61,7 +120,15 @@ func (c *config) checkArgs() error {
 		c.checkRunParameters,
 		c.checkTimeoutDuration,
 		c.checkHTTPParameters,
+		c.checkFormParameters,
+		c.checkBodyTemplate,
+		c.checkPayloadParameters,
+		c.checkSessionParameters,
+		c.checkCompressionParameters,
 		c.checkCertPaths,
+		c.checkAssertions,
+		c.checkComparison,
+		c.checkTimeseries,
 	}
 
 	for _, check := range checks {
@@ -138,6 +205,136 @@ func (c *config) checkHTTPParameters() error {
 	if c.body != "" && c.bodyFilePath != "" {
 		return errBodyProvidedTwice
 	}
+	if c.omitHeaders == nil {
+		return nil
+	}
+	for _, h := range *c.omitHeaders {
+		if !isOmittableHeader(h) {
+			return fmt.Errorf(
+				"Can't omit %q header, only %v can be omitted",
+				h, strings.Join(omittableHeaders, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+func (c *config) checkFormParameters() error {
+	if c.form == nil {
+		if c.multipart {
+			return errMultipartWithoutForm
+		}
+		return nil
+	}
+	if !canHaveBody(c.method) {
+		return errBodyNotAllowed
+	}
+	if c.body != "" || c.bodyFilePath != "" {
+		return errFormWithBody
+	}
+	if c.stream {
+		return errFormStream
+	}
+	for _, f := range *c.form {
+		if _, err := parseFormField(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *config) checkBodyTemplate() error {
+	if !c.bodyTemplate {
+		return nil
+	}
+	if c.body == "" && c.bodyFilePath == "" {
+		return errNoBodyTemplate
+	}
+	if c.stream {
+		return errBodyTemplateStream
+	}
+	return nil
+}
+
+func (c *config) checkPayloadParameters() error {
+	if c.payloadFormat != "" && !isKnownPayloadFormat(c.payloadFormat) {
+		return fmt.Errorf(
+			"Unknown payload format %q, available are %v",
+			c.payloadFormat, strings.Join(payloadFormats, ", "),
+		)
+	}
+	if c.payloadStream && c.payloadFile == "" {
+		return errPayloadStream
+	}
+	strategy, err := getPayloadStrategy(c.payloadStrategy)
+	if err != nil {
+		return err
+	}
+	if strategy != sequentialPayload && c.scope != request {
+		return errPayloadStrategyScope
+	}
+	streamed := c.payloadStream || c.payloadUrl != ""
+	if streamed && !strategy.streamable() {
+		return errPayloadStrategyStream
+	}
+	if strategy == uniquePayload && c.payloadRewind {
+		return errUniquePayloadRewind
+	}
+	if c.payloadZipfExponent != 0 && c.payloadZipfExponent <= 1 {
+		return errInvalidZipfExponent
+	}
+	if c.payloadTimeout < 0 {
+		return errNegativeTimeout
+	}
+	if c.payloadDelimiter != "" {
+		if _, err := parseDelimiter(c.payloadDelimiter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variableNames returns names of the payload variables, nil if they
+// aren't specified.
+func (c *config) variableNames() []string {
+	if c.varNames == "" {
+		return nil
+	}
+	names := strings.Split(c.varNames, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+func (c *config) checkSessionParameters() error {
+	if !c.cookieJar && (c.cookies != nil || c.resetSessionEvery > 0) {
+		return errNoCookieJar
+	}
+	if c.cookies == nil {
+		return nil
+	}
+	for _, cookie := range *c.cookies {
+		if !strings.Contains(cookie, "=") {
+			return errInvalidCookieFormat
+		}
+	}
+	return nil
+}
+
+func (c *config) checkCompressionParameters() error {
+	if c.compression == "" {
+		return nil
+	}
+	if !isKnownEncoding(c.compression) {
+		return fmt.Errorf(
+			"Unknown compression %q, supported are %v",
+			c.compression, strings.Join(encodings, ", "),
+		)
+	}
+	if c.stream {
+		return errCompressedStream
+	}
 	return nil
 }
 
@@ -202,3 +399,77 @@ func (ct clientTyp) String() string {
 	}
 	return "unknown client"
 }
+
+// assertMaxBodySize returns the limit of response body size for
+// assertions, default one if it's not set.
+func (c *config) assertMaxBodySize() int64 {
+	if c.assertMaxBody == 0 {
+		return defaultAssertMaxBody
+	}
+	return int64(c.assertMaxBody)
+}
+
+// assertSampleRate returns the fraction of responses to assert.
+func (c *config) assertSampleRate() float64 {
+	if c.assertSample == 0 {
+		return 1
+	}
+	return c.assertSample
+}
+
+// failureSamplesCount returns the number of failed responses to keep,
+// default one if it's not set.
+func (c *config) failureSamplesCount() uint64 {
+	if c.failureSamples == nil {
+		return defaultFailureSamples
+	}
+	return *c.failureSamples
+}
+
+func (c *config) checkComparison() error {
+	if c.significance < 0 || c.significance >= 1 {
+		return errInvalidSignificance
+	}
+	if _, ok := comparisonFormatFromString(c.compareFormat); !ok {
+		return fmt.Errorf("unknown comparison format %q", c.compareFormat)
+	}
+	return nil
+}
+
+func (c *config) checkTimeseries() error {
+	if c.timeseriesFormat == "" {
+		return nil
+	}
+	_, err := timeseriesFormatOf(c.timeseriesFile, c.timeseriesFormat)
+	return err
+}
+
+func (c *config) checkAssertions() error {
+	if c.assertSample < 0 || c.assertSample > 1 {
+		return errInvalidAssertSample
+	}
+	if c.assertions == nil {
+		return nil
+	}
+	names := make(map[string]bool, len(*c.assertions))
+	for _, a := range *c.assertions {
+		if a.name == "" {
+			continue
+		}
+		if names[a.name] {
+			return fmt.Errorf("Duplicate assertion name %q", a.name)
+		}
+		names[a.name] = true
+	}
+	// groups refer to the assertions by their names
+	assertions, err := resolveAssertions(*c.assertions)
+	if err != nil {
+		return err
+	}
+	for _, a := range assertions {
+		if err := checkAssertion(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -281,6 +281,267 @@ func TestCheckArgsInvalidRequestMethod(t *testing.T) {
 	}
 }
 
+func TestCheckArgsUnknownOmittedHeader(t *testing.T) {
+	omitHeaders := []string{"User-Agent", "X-Custom"}
+	c := config{
+		numConns:    defaultNumberOfConns,
+		numReqs:     &defaultNumberOfReqs,
+		url:         "http://localhost:8080",
+		headers:     nil,
+		omitHeaders: &omitHeaders,
+		timeout:     defaultTimeout,
+		method:      "GET",
+		body:        "",
+	}
+	if c.checkArgs() == nil {
+		t.Fail()
+	}
+	omitHeaders = []string{"User-Agent", "connection"}
+	if err := c.checkArgs(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckArgsSessionParameters(t *testing.T) {
+	expectations := []struct {
+		cookieJar  bool
+		cookies    *[]string
+		resetEvery uint64
+		out        error
+	}{
+		{false, nil, 0, nil},
+		{true, &[]string{"sid=${sid}", "empty="}, 10, nil},
+		{false, &[]string{"sid=1"}, 0, errNoCookieJar},
+		{false, nil, 10, errNoCookieJar},
+		{true, &[]string{"sid"}, 0, errInvalidCookieFormat},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:          defaultNumberOfConns,
+			numReqs:           &defaultNumberOfReqs,
+			url:               "http://localhost:8080",
+			headers:           new(headersList),
+			timeout:           defaultTimeout,
+			method:            "GET",
+			cookieJar:         e.cookieJar,
+			cookies:           e.cookies,
+			resetSessionEvery: e.resetEvery,
+		}
+		if r := c.checkArgs(); r != e.out {
+			t.Errorf("Expected %v, but got %v", e.out, r)
+		}
+	}
+}
+
+func TestCheckArgsFormParameters(t *testing.T) {
+	expectations := []struct {
+		method    string
+		form      *[]string
+		multipart bool
+		body      string
+		stream    bool
+		out       error
+	}{
+		{"POST", nil, false, "", false, nil},
+		{"POST", &[]string{"a=1", "f=@file;type=text/plain"}, false, "", false, nil},
+		{"PUT", &[]string{"a=1"}, true, "", false, nil},
+		{"POST", nil, true, "", false, errMultipartWithoutForm},
+		{"GET", &[]string{"a=1"}, false, "", false, errBodyNotAllowed},
+		{"POST", &[]string{"a=1"}, false, "body", false, errFormWithBody},
+		{"POST", &[]string{"a=1"}, false, "", true, errFormStream},
+		{"POST", &[]string{"a"}, false, "", false, errInvalidFormField},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:  defaultNumberOfConns,
+			numReqs:   &defaultNumberOfReqs,
+			url:       "http://localhost:8080",
+			headers:   new(headersList),
+			timeout:   defaultTimeout,
+			method:    e.method,
+			body:      e.body,
+			form:      e.form,
+			multipart: e.multipart,
+			stream:    e.stream,
+		}
+		if r := c.checkArgs(); r != e.out {
+			t.Errorf("Expected %v, but got %v", e.out, r)
+		}
+	}
+}
+
+func TestCheckArgsCompressionParameters(t *testing.T) {
+	expectations := []struct {
+		compression string
+		stream      bool
+		valid       bool
+		out         error
+	}{
+		{"", true, true, nil},
+		{"gzip", false, true, nil},
+		{"br", false, true, nil},
+		{"zstd", false, false, nil},
+		{"deflate", true, false, errCompressedStream},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:    defaultNumberOfConns,
+			numReqs:     &defaultNumberOfReqs,
+			url:         "http://localhost:8080",
+			headers:     new(headersList),
+			timeout:     defaultTimeout,
+			method:      "POST",
+			compression: e.compression,
+			stream:      e.stream,
+		}
+		r := c.checkArgs()
+		if e.valid != (r == nil) {
+			t.Errorf("%q: expected valid = %v, but got %v",
+				e.compression, e.valid, r)
+		}
+		if e.out != nil && r != e.out {
+			t.Errorf("Expected %v, but got %v", e.out, r)
+		}
+	}
+}
+
+func TestCheckArgsBodyTemplate(t *testing.T) {
+	expectations := []struct {
+		body, bodyFilePath string
+		stream             bool
+		out                error
+	}{
+		{`{"id":{{.id}}}`, "", false, nil},
+		{"", "/tmp/body.tmpl", false, nil},
+		{"", "", false, errNoBodyTemplate},
+		{"", "/tmp/body.tmpl", true, errBodyTemplateStream},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:     defaultNumberOfConns,
+			numReqs:      &defaultNumberOfReqs,
+			url:          "http://localhost:8080",
+			headers:      new(headersList),
+			timeout:      defaultTimeout,
+			method:       "POST",
+			body:         e.body,
+			bodyFilePath: e.bodyFilePath,
+			bodyTemplate: true,
+			stream:       e.stream,
+		}
+		if r := c.checkArgs(); r != e.out {
+			t.Errorf("Expected %v, but got %v", e.out, r)
+		}
+	}
+}
+
+func TestCheckArgsPayloadParameters(t *testing.T) {
+	expectations := []struct {
+		format, delimiter string
+		valid             bool
+	}{
+		{"", "", true},
+		{"jsonl", "", true},
+		{"tsv", `\t`, true},
+		{"csv", ";", true},
+		{"xml", "", false},
+		{"csv", ";;", false},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:         defaultNumberOfConns,
+			numReqs:          &defaultNumberOfReqs,
+			url:              "http://localhost:8080",
+			headers:          new(headersList),
+			timeout:          defaultTimeout,
+			method:           "GET",
+			payloadFile:      "payload",
+			payloadFormat:    e.format,
+			payloadDelimiter: e.delimiter,
+		}
+		if r := c.checkArgs(); (r == nil) != e.valid {
+			t.Errorf("%q, %q: expected valid = %v, but got %v",
+				e.format, e.delimiter, e.valid, r)
+		}
+	}
+}
+
+func TestCheckArgsPayloadStream(t *testing.T) {
+	c := config{
+		numConns:      defaultNumberOfConns,
+		numReqs:       &defaultNumberOfReqs,
+		url:           "http://localhost:8080",
+		headers:       new(headersList),
+		timeout:       defaultTimeout,
+		method:        "GET",
+		payloadUrl:    "http://localhost:8081/payload",
+		payloadStream: true,
+	}
+	if r := c.checkArgs(); r != errPayloadStream {
+		t.Errorf("Expected %v, but got %v", errPayloadStream, r)
+	}
+	c.payloadFile, c.payloadUrl = "users.csv", ""
+	if r := c.checkArgs(); r != nil {
+		t.Errorf("Expected nil, but got %v", r)
+	}
+}
+
+func TestCheckArgsPayloadStrategy(t *testing.T) {
+	expectations := []struct {
+		strategy     string
+		scope        scope
+		stream       bool
+		rewind       bool
+		zipfExponent float64
+		out          error
+	}{
+		{"", thread, true, true, 0, nil},
+		{"unique", request, true, false, 0, nil},
+		{"zipf", request, false, false, 1.5, nil},
+		{"partition", request, false, false, 0, nil},
+		{"shuffle", thread, false, false, 0, errPayloadStrategyScope},
+		{"random", request, true, false, 0, errPayloadStrategyStream},
+		{"unique", request, true, true, 0, errUniquePayloadRewind},
+		{"zipf", request, false, false, 1, errInvalidZipfExponent},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:            defaultNumberOfConns,
+			numReqs:             &defaultNumberOfReqs,
+			url:                 "http://localhost:8080",
+			headers:             new(headersList),
+			timeout:             defaultTimeout,
+			method:              "GET",
+			payloadFile:         "users.csv",
+			payloadStream:       e.stream,
+			payloadRewind:       e.rewind,
+			payloadStrategy:     e.strategy,
+			payloadZipfExponent: e.zipfExponent,
+			scope:               e.scope,
+		}
+		if r := c.checkArgs(); r != e.out {
+			t.Errorf("%q: expected %v, but got %v", e.strategy, e.out, r)
+		}
+	}
+	c := config{
+		numConns:        defaultNumberOfConns,
+		numReqs:         &defaultNumberOfReqs,
+		url:             "http://localhost:8080",
+		headers:         new(headersList),
+		timeout:         defaultTimeout,
+		method:          "GET",
+		payloadStrategy: "roundrobin",
+	}
+	if r := c.checkArgs(); r == nil {
+		t.Error("Expected an error for unknown strategy")
+	}
+	c.payloadStrategy = "shuffle"
+	c.payloadUrl = "http://localhost:8082/rows"
+	if r := c.checkArgs(); r != errPayloadStrategyStream {
+		t.Errorf("Expected %v, but got %v", errPayloadStrategyStream, r)
+	}
+}
+
 func TestCheckArgsTestType(t *testing.T) {
 	countedConfig := config{
 		numConns: defaultNumberOfConns,
@@ -396,3 +657,111 @@ func clientTypeFromString(s string) clientTyp {
 		return fhttp
 	}
 }
+
+func TestCheckArgsAssertions(t *testing.T) {
+	expectations := []struct {
+		assertions []assertion
+		valid      bool
+	}{
+		{nil, true},
+		{[]assertion{{asserter: "StatusCode", expected: "201"}}, true},
+		{[]assertion{
+			{asserter: "JsonPath", expression: "$.id", condition: "NOT_NULL"},
+			{asserter: "Unknown"},
+		}, false},
+		{[]assertion{{asserter: "JsonPath", expression: "$.id", condition: "ANY"}}, false},
+		{[]assertion{
+			{name: "ok", asserter: "StatusCode", expected: "200"},
+			{asserter: "StatusCode", expected: "200"},
+			{asserter: "StatusCode", expected: "200"},
+		}, true},
+		{[]assertion{
+			{name: "ok", asserter: "StatusCode", expected: "200"},
+			{name: "ok", asserter: "BodyContains", expected: "ok"},
+		}, false},
+		{[]assertion{
+			{name: "ok", asserter: "StatusCode", expected: "200"},
+			{group: "not", members: []assertion{{ref: "ok"}}},
+		}, true},
+		{[]assertion{
+			{group: "anyOf", members: []assertion{{ref: "ok"}}},
+		}, false},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns: defaultNumberOfConns,
+			numReqs:  &defaultNumberOfReqs,
+			url:      "http://localhost:8080",
+			headers:  new(headersList),
+			timeout:  defaultTimeout,
+			method:   "GET",
+		}
+		if e.assertions != nil {
+			c.assertions = &e.assertions
+		}
+		if err := c.checkArgs(); (err == nil) != e.valid {
+			t.Errorf("%+v: expected valid %v, but got %v", e.assertions, e.valid, err)
+		}
+	}
+	for _, sample := range []float64{-0.1, 1.1} {
+		c := config{
+			numConns:     defaultNumberOfConns,
+			numReqs:      &defaultNumberOfReqs,
+			url:          "http://localhost:8080",
+			headers:      new(headersList),
+			timeout:      defaultTimeout,
+			method:       "GET",
+			assertSample: sample,
+		}
+		if err := c.checkArgs(); err != errInvalidAssertSample {
+			t.Errorf("%v: expected %v, but got %v", sample, errInvalidAssertSample, err)
+		}
+	}
+}
+
+func TestCheckArgsComparison(t *testing.T) {
+	expectations := []struct {
+		significance float64
+		format       string
+		valid        bool
+	}{
+		{0, "", true},
+		{0.01, "md", true},
+		{-0.1, "", false},
+		{1, "", false},
+		{0, "html", false},
+	}
+	for _, e := range expectations {
+		c := config{
+			numConns:      defaultNumberOfConns,
+			numReqs:       &defaultNumberOfReqs,
+			url:           "http://localhost:8080",
+			headers:       new(headersList),
+			timeout:       defaultTimeout,
+			method:        "GET",
+			significance:  e.significance,
+			compareFormat: e.format,
+		}
+		if err := c.checkArgs(); (err == nil) != e.valid {
+			t.Errorf("%+v: unexpected error %v", e, err)
+		}
+	}
+}
+
+func TestCheckArgsTimeseries(t *testing.T) {
+	for _, format := range []string{"", "csv", "jsonl", "xml"} {
+		c := config{
+			numConns:         defaultNumberOfConns,
+			numReqs:          &defaultNumberOfReqs,
+			url:              "http://localhost:8080",
+			headers:          new(headersList),
+			timeout:          defaultTimeout,
+			method:           "GET",
+			timeseriesFile:   "series.csv",
+			timeseriesFormat: format,
+		}
+		if err := c.checkArgs(); (err == nil) != (format != "xml") {
+			t.Errorf("%q: unexpected error %v", format, err)
+		}
+	}
+}
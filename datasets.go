@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	defaultDatasetDir     = "datasets"
+	defaultMaxDatasetSize = 100 << 20
+	defaultPreviewRows    = 10
+	maxPreviewRows        = 1000
+
+	// datasetInfoExt differs from the extensions of the dataset files
+	datasetInfoExt = ".info.json"
+)
+
+// Dataset is a payload file uploaded to the server, which tests can
+// reference by ID instead of a path on the server's filesystem.
+type Dataset struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Format     string    `json:"format"`
+	Delimiter  string    `json:"delimiter,omitempty"`
+	LazyQuotes bool      `json:"lazyQuotes,omitempty"`
+	Size       int64     `json:"size"`
+	Sha256     string    `json:"sha256"`
+	Rows       uint64    `json:"rows"`
+	Columns    []string  `json:"columns"`
+	Created    time.Time `json:"created"`
+}
+
+// DatasetPreview holds the first rows of a dataset.
+type DatasetPreview struct {
+	Columns []string            `json:"columns"`
+	Rows    []map[string]string `json:"rows"`
+}
+
+func (d *Dataset) fileOptions() payloadFileOptions {
+	return payloadFileOptions{
+		format:     d.Format,
+		delimiter:  d.Delimiter,
+		lazyQuotes: d.LazyQuotes,
+		header:     d.Format == csvPayload || d.Format == tsvPayload,
+	}
+}
+
+// datasetStore keeps the uploaded files in dir, each of them next to a
+// JSON file with its description.
+type datasetStore struct {
+	dir     string
+	maxSize int64
+
+	mu sync.RWMutex
+}
+
+func newDatasetStore(dir string, maxSize int64) (*datasetStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxDatasetSize
+	}
+	return &datasetStore{dir: dir, maxSize: maxSize}, nil
+}
+
+// add stores the file read from r and checks that it can be used as a
+// payload. If checksum isn't empty, it must match the SHA-256 of the
+// file in hex.
+func (s *datasetStore) add(
+	name string, r io.Reader, opts payloadFileOptions, checksum string,
+) (*Dataset, error) {
+	format := opts.format
+	if format == "" {
+		format = detectPayloadFormat(name)
+	}
+	if !isKnownPayloadFormat(format) {
+		return nil, fmt.Errorf(
+			"Unknown payload format %q, available are %v",
+			format, strings.Join(payloadFormats, ", "),
+		)
+	}
+	if opts.delimiter != "" {
+		if _, err := parseDelimiter(opts.delimiter); err != nil {
+			return nil, err
+		}
+	}
+	d := &Dataset{
+		ID:         uuid.Must(uuid.NewV4()).String(),
+		Name:       filepath.Base(name),
+		Format:     format,
+		Delimiter:  opts.delimiter,
+		LazyQuotes: opts.lazyQuotes,
+		Created:    time.Now().UTC(),
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	// one byte over the limit is enough to tell that it's exceeded
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, s.maxSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size > s.maxSize {
+		return nil, errDatasetTooLarge
+	}
+	d.Size = size
+	d.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, d.Sha256) {
+		return nil, errDatasetChecksum
+	}
+
+	if d.Rows, d.Columns, err = inspectDataset(tmp.Name(), d.fileOptions()); err != nil {
+		if err == errEmptyPayload {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%v: %w", d.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Rename(tmp.Name(), s.path(d)); err != nil {
+		return nil, err
+	}
+	if err := s.writeInfo(d); err != nil {
+		_ = os.Remove(s.path(d))
+		return nil, err
+	}
+	return d, nil
+}
+
+// inspectDataset counts rows of the file and finds the columns they
+// have in common.
+func inspectDataset(path string, opts payloadFileOptions) (uint64, []string, error) {
+	file, reader, err := openPayloadFile(path, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	var (
+		rows    uint64
+		columns []string
+		// column sets are interned, so rows mostly share them
+		seen = map[*columnSet]bool{}
+	)
+	for {
+		r, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		rows++
+		if seen[r.cols] {
+			continue
+		}
+		if len(seen) == 0 {
+			columns = append([]string(nil), r.cols.names...)
+			sort.Strings(columns)
+		} else {
+			columns = intersectColumns(columns, r.cols)
+		}
+		seen[r.cols] = true
+	}
+	if rows == 0 {
+		return 0, nil, errEmptyPayload
+	}
+	if names := reader.columns(); names != nil {
+		columns = names
+	}
+	return rows, columns, nil
+}
+
+func intersectColumns(columns []string, cs *columnSet) []string {
+	res := columns[:0]
+	for _, name := range columns {
+		if _, ok := cs.index[name]; ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// list returns the datasets from the oldest to the newest.
+func (s *datasetStore) list() ([]*Dataset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos, err := filepath.Glob(filepath.Join(s.dir, "*"+datasetInfoExt))
+	if err != nil {
+		return nil, err
+	}
+	datasets := make([]*Dataset, 0, len(infos))
+	for _, info := range infos {
+		d, err := readDatasetInfo(info)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, d)
+	}
+	sort.Slice(datasets, func(i, j int) bool {
+		return datasets[i].Created.Before(datasets[j].Created)
+	})
+	return datasets, nil
+}
+
+func (s *datasetStore) get(id string) (*Dataset, error) {
+	if _, err := uuid.FromString(id); err != nil {
+		return nil, errDatasetNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, err := readDatasetInfo(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, errDatasetNotFound
+	}
+	return d, err
+}
+
+// preview returns up to n first rows of the dataset.
+func (s *datasetStore) preview(id string, n int) (*DatasetPreview, error) {
+	d, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	file, reader, err := openPayloadFile(s.path(d), d.fileOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	p := &DatasetPreview{Columns: d.Columns, Rows: []map[string]string{}}
+	for len(p.Rows) < n {
+		r, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Rows = append(p.Rows, r.toMap())
+	}
+	return p, nil
+}
+
+func (s *datasetStore) remove(id string) error {
+	d, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.infoPath(id)); err != nil {
+		return err
+	}
+	return os.Remove(s.path(d))
+}
+
+// path returns the path of the dataset file, the extension keeps its
+// format recognizable.
+func (s *datasetStore) path(d *Dataset) string {
+	return filepath.Join(s.dir, d.ID+"."+d.Format)
+}
+
+func (s *datasetStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+datasetInfoExt)
+}
+
+func (s *datasetStore) writeInfo(d *Dataset) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.infoPath(d.ID), data, 0640)
+}
+
+func readDatasetInfo(path string) (*Dataset, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dataset{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newTestDatasetStore(t *testing.T, maxSize int64) *datasetStore {
+	dir, err := ioutil.TempDir("", "datasets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newDatasetStore(dir, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDatasetStoreLifecycle(t *testing.T) {
+	s := newTestDatasetStore(t, 0)
+	defer os.RemoveAll(s.dir)
+	content := "id;name\n1;Tom\n2;Ann\n3;Bob\n"
+	sum := sha256.Sum256([]byte(content))
+	users, err := s.add("users.csv", strings.NewReader(content),
+		payloadFileOptions{delimiter: ";"}, hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.Rows != 3 || !reflect.DeepEqual(users.Columns, []string{"id", "name"}) {
+		t.Errorf("Unexpected dataset %+v", users)
+	}
+	// file names of JSON datasets mustn't be taken for descriptions
+	orders, err := s.add("orders.json",
+		strings.NewReader(`[{"id":1,"sku":"a"},{"id":2}]`), payloadFileOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders.Format != jsonPayload || !reflect.DeepEqual(orders.Columns, []string{"id"}) {
+		t.Errorf("Unexpected dataset %+v", orders)
+	}
+
+	list, err := s.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != users.ID || list[1].ID != orders.ID {
+		t.Errorf("Unexpected datasets %+v", list)
+	}
+	p, err := s.preview(users.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{
+		{"id": "1", "name": "Tom"},
+		{"id": "2", "name": "Ann"},
+	}
+	if !reflect.DeepEqual(p.Rows, expected) {
+		t.Errorf("Expected %v, but got %v", expected, p.Rows)
+	}
+
+	if err := s.remove(users.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.get(users.ID); err != errDatasetNotFound {
+		t.Errorf("Expected %v, but got %v", errDatasetNotFound, err)
+	}
+	if err := s.remove(users.ID); err != errDatasetNotFound {
+		t.Errorf("Expected %v, but got %v", errDatasetNotFound, err)
+	}
+	if _, err := s.get("../../etc/passwd"); err != errDatasetNotFound {
+		t.Errorf("Expected %v, but got %v", errDatasetNotFound, err)
+	}
+}
+
+func TestDatasetStoreShouldRejectInvalidFiles(t *testing.T) {
+	s := newTestDatasetStore(t, 16)
+	defer os.RemoveAll(s.dir)
+	expectations := []struct {
+		name, content, checksum string
+		out                     error
+	}{
+		{"big.csv", "id\n1\n2\n3\n4\n5\n6\n7\n8\n", "", errDatasetTooLarge},
+		{"sum.csv", "id\n1\n", "deadbeef", errDatasetChecksum},
+		{"empty.csv", "id\n", "", errEmptyPayload},
+		{"short.csv", "id,a\n1\n", "", nil},
+		{"users.xml", "<a/>", "", nil},
+	}
+	for _, e := range expectations {
+		_, err := s.add(e.name, strings.NewReader(e.content),
+			payloadFileOptions{}, e.checksum)
+		if err == nil {
+			t.Errorf("%v: expected an error", e.name)
+		} else if e.out != nil && err != e.out {
+			t.Errorf("%v: expected %v, but got %v", e.name, e.out, err)
+		}
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no files to be left, but got %v", len(files))
+	}
+}
+
+func TestNewConfigShouldUseDataset(t *testing.T) {
+	s := newTestDatasetStore(t, 0)
+	defer os.RemoveAll(s.dir)
+	datasets = s
+	defer func() {
+		datasets = nil
+	}()
+	d, err := s.add("users.tsv", strings.NewReader("id\tname\n1\tTom\n"),
+		payloadFileOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newConfig(&BombardierRequest{Dataset: d.ID, VariableNames: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.payloadFile != s.path(d) || c.payloadFormat != tsvPayload || !c.payloadHeader {
+		t.Errorf("Unexpected payload config %+v", c)
+	}
+	if _, err := newConfig(&BombardierRequest{
+		Dataset: d.ID, PayloadFile: "users.csv",
+	}); err != errDatasetPayloadFile {
+		t.Errorf("Expected %v, but got %v", errDatasetPayloadFile, err)
+	}
+	if _, err := newConfig(&BombardierRequest{
+		Dataset: "00000000-0000-0000-0000-000000000000",
+	}); err != errDatasetNotFound {
+		t.Errorf("Expected %v, but got %v", errDatasetNotFound, err)
+	}
+}
+
+func TestDatasetUploadHandling(t *testing.T) {
+	s := newTestDatasetStore(t, 0)
+	defer os.RemoveAll(s.dir)
+	datasets = s
+	defer func() {
+		datasets = nil
+	}()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("format", "jsonl")
+	fw, err := w.CreateFormFile("file", "users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("{\"id\":1}\n{\"id\":2}\n"))
+	_ = w.Close()
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.Header.SetContentType(w.FormDataContentType())
+	ctx.Request.SetBody(body.Bytes())
+	datasetUploadHandling(ctx)
+	if ctx.Response.StatusCode() != http.StatusCreated {
+		t.Fatalf("Expected %v, but got %v: %s", http.StatusCreated,
+			ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	d := &Dataset{}
+	if err := json.Unmarshal(ctx.Response.Body(), d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "users.txt" || d.Format != jsonLinesPayload || d.Rows != 2 {
+		t.Errorf("Unexpected dataset %+v", d)
+	}
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.SetUserValue("id", d.ID)
+	ctx.Request.SetRequestURI("/api/datasets/" + d.ID + "/preview?rows=1")
+	datasetPreviewHandling(ctx)
+	p := &DatasetPreview{}
+	if err := json.Unmarshal(ctx.Response.Body(), p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Rows) != 1 || p.Rows[0]["id"] != "1" {
+		t.Errorf("Unexpected preview %+v", p)
+	}
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.SetUserValue("id", "unknown")
+	datasetDeleteHandling(ctx)
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Errorf("Expected %v, but got %v", http.StatusNotFound,
+			ctx.Response.StatusCode())
+	}
+}
+
+func TestServerShouldOnlyAllowLargeBodiesForDatasets(t *testing.T) {
+	s := newTestDatasetStore(t, 8<<20)
+	defer os.RemoveAll(s.dir)
+	datasets = s
+	defer func() {
+		datasets = nil
+	}()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		_ = newServer().Serve(ln)
+	}()
+	url := "http://" + ln.Addr().String()
+
+	// larger than the limit of the other routes
+	var rows bytes.Buffer
+	for i := 0; rows.Len() <= fasthttp.DefaultMaxRequestBodySize; i++ {
+		fmt.Fprintf(&rows, "{\"id\":%d}\n", i)
+	}
+	upload := func(content []byte) *http.Response {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		fw, err := w.CreateFormFile("file", "users.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write(content)
+		_ = w.WriteField("format", "jsonl")
+		_ = w.Close()
+		resp, err := http.Post(url+"/api/datasets", w.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	if resp := upload(rows.Bytes()); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %v, but got %v", http.StatusCreated, resp.StatusCode)
+	}
+	// too large bodies are rejected by their headers, before being sent
+	announce := func(path string, size int) int {
+		conn, err := net.Dial("tcp4", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "POST %v HTTP/1.1\r\nHost: localhost\r\n"+
+			"Content-Type: multipart/form-data; boundary=x\r\n"+
+			"Content-Length: %v\r\n\r\n", path, size)
+		// fasthttp prefetches the start of the body before the handler
+		_, _ = conn.Write(make([]byte, 64<<10))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	expectations := []struct {
+		path string
+		size int
+	}{
+		{"/api/datasets", 10 << 20},
+		{"/api/pt", rows.Len()},
+		{"/api/compare", rows.Len()},
+	}
+	for _, e := range expectations {
+		if code := announce(e.path, e.size); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%v: expected %v, but got %v", e.path,
+				http.StatusRequestEntityTooLarge, code)
+		}
+	}
+
+	post := func(body io.Reader) int {
+		resp, err := http.Post(url+"/api/pt", "application/json", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// of unknown length, so that it's sent chunked
+	if code := post(io.MultiReader(strings.NewReader("{}"))); code != http.StatusLengthRequired {
+		t.Errorf("Expected %v, but got %v", http.StatusLengthRequired, code)
+	}
+	if code := post(strings.NewReader(`{"url":""}`)); code != http.StatusBadRequest {
+		t.Errorf("Expected %v, but got %v", http.StatusBadRequest, code)
+	}
+}
@@ -51,7 +51,7 @@ func (e *errorMap) sum() uint64 {
 	defer e.mu.RUnlock()
 	sum := uint64(0)
 	for _, v := range e.m {
-		sum += *v
+		sum += atomic.LoadUint64(v)
 	}
 	return sum
 }
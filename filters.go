@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// filter transforms the value of a placeholder, i.e. ${name|urlencode}.
+type filter func(value string, v *vars) string
+
+// filterNames lists filters available in placeholders.
+var filterNames = []string{
+	"urlencode", "json", "base64", "upper", "lower", "sha256",
+	"hmacSHA256:<secretVar>",
+}
+
+// compileFilter parses filter spec in form name or name:arg.
+func compileFilter(spec string) (filter, string, error) {
+	name, arg := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	if name != "hmacSHA256" && arg != "" {
+		return nil, "", fmt.Errorf("Filter %q takes no arguments", name)
+	}
+	switch name {
+	case "urlencode":
+		return func(s string, _ *vars) string {
+			return url.QueryEscape(s)
+		}, "", nil
+	case "json":
+		return jsonEscape, "", nil
+	case "base64":
+		return func(s string, _ *vars) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		}, "", nil
+	case "upper":
+		return func(s string, _ *vars) string {
+			return strings.ToUpper(s)
+		}, "", nil
+	case "lower":
+		return func(s string, _ *vars) string {
+			return strings.ToLower(s)
+		}, "", nil
+	case "sha256":
+		return func(s string, _ *vars) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}, "", nil
+	case "hmacSHA256":
+		if arg == "" {
+			return nil, "", fmt.Errorf(
+				"Filter hmacSHA256 requires a variable holding the secret")
+		}
+		return func(s string, v *vars) string {
+			secret, _ := v.lookup(arg)
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(s))
+			return hex.EncodeToString(mac.Sum(nil))
+		}, arg, nil
+	}
+	return nil, "", fmt.Errorf(
+		"Unknown filter %q, available are %v",
+		name, strings.Join(filterNames, ", "),
+	)
+}
+
+// jsonEscape escapes s to be inserted into a JSON string, quotes
+// around it are not added.
+func jsonEscape(s string, _ *vars) string {
+	// marshaling a string never fails
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 )
@@ -66,3 +67,26 @@ func (n *nullableString) Set(value string) error {
 	*n.val = value
 	return nil
 }
+
+type nullableStrings struct {
+	val *[]string
+}
+
+func (n *nullableStrings) String() string {
+	if n.val == nil {
+		return nilStr
+	}
+	return fmt.Sprint(*n.val)
+}
+
+func (n *nullableStrings) Set(value string) error {
+	if n.val == nil {
+		n.val = new([]string)
+	}
+	*n.val = append(*n.val, value)
+	return nil
+}
+
+func (n *nullableStrings) IsCumulative() bool {
+	return true
+}
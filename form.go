@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	urlencodedContentType = "application/x-www-form-urlencoded"
+	defaultFileType       = "application/octet-stream"
+	// maxCachedFormFiles is the total size of the files with
+	// placeholders in their paths kept in memory, the rest are read
+	// by every request
+	maxCachedFormFiles = 64 << 20
+)
+
+// formField is a single --form entry, either key=value or
+// key=@path[;filename=name][;type=mime/type].
+type formField struct {
+	key, value string
+	// file fields hold path to the file in value
+	file               bool
+	fileName, fileType string
+}
+
+// compiledFormField is a form field with placeholders compiled.
+type compiledFormField struct {
+	key, value, fileName *valueTemplate
+	file                 bool
+	fileType             string
+	// content of the file, if its path has no placeholders
+	content []byte
+}
+
+func (f formField) compile() compiledFormField {
+	return compiledFormField{
+		key:      compileTemplate(f.key),
+		value:    compileTemplate(f.value),
+		fileName: compileTemplate(f.fileName),
+		file:     f.file,
+		fileType: f.fileType,
+	}
+}
+
+func parseFormField(spec string) (formField, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return formField{}, errInvalidFormField
+	}
+	f := formField{key: strings.TrimSpace(kv[0]), value: kv[1]}
+	if !strings.HasPrefix(f.value, "@") {
+		return f, nil
+	}
+	f.file = true
+	params := strings.Split(f.value[1:], ";")
+	f.value = params[0]
+	if f.value == "" {
+		return formField{}, errInvalidFormField
+	}
+	for _, p := range params[1:] {
+		pkv := strings.SplitN(p, "=", 2)
+		if len(pkv) != 2 {
+			return formField{}, errInvalidFormField
+		}
+		switch strings.TrimSpace(pkv[0]) {
+		case "filename":
+			f.fileName = pkv[1]
+		case "type":
+			f.fileType = pkv[1]
+		default:
+			return formField{}, errInvalidFormField
+		}
+	}
+	return f, nil
+}
+
+// formBody builds multipart/form-data or x-www-form-urlencoded
+// request bodies out of --form fields.
+type formBody struct {
+	fields    []compiledFormField
+	multipart bool
+	boundary  string
+
+	files *formFiles
+}
+
+// newFormBody parses form fields. The body is built as multipart if
+// it's forced or any of the fields is a file. Files with static paths
+// are read once here, the ones with placeholders in their paths are
+// read on their first use and cached by the resolved path.
+func newFormBody(specs []string, forceMultipart bool) (*formBody, error) {
+	f := &formBody{
+		multipart: forceMultipart,
+		files:     newFormFiles(maxCachedFormFiles),
+	}
+	for _, spec := range specs {
+		field, err := parseFormField(spec)
+		if err != nil {
+			return nil, err
+		}
+		f.multipart = f.multipart || field.file
+		compiled := field.compile()
+		if field.file && !compiled.value.hasVars() {
+			if compiled.content, err = ioutil.ReadFile(field.value); err != nil {
+				return nil, err
+			}
+		}
+		f.fields = append(f.fields, compiled)
+	}
+	if f.multipart {
+		f.boundary = multipart.NewWriter(nil).Boundary()
+	}
+	return f, nil
+}
+
+func (f *formBody) contentType() string {
+	if f.multipart {
+		return "multipart/form-data; boundary=" + f.boundary
+	}
+	return urlencodedContentType
+}
+
+// build returns the body with variables in keys, values, file paths
+// and names replaced with the ones from ctx.
+func (f *formBody) build(ctx *vars) (string, error) {
+	if !f.multipart {
+		parts := make([]string, 0, len(f.fields))
+		for _, field := range f.fields {
+			parts = append(parts, url.QueryEscape(field.key.render(ctx))+
+				"="+url.QueryEscape(field.value.render(ctx)))
+		}
+		return strings.Join(parts, "&"), nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(f.boundary); err != nil {
+		return "", err
+	}
+	for _, field := range f.fields {
+		key := field.key.render(ctx)
+		if !field.file {
+			if err := w.WriteField(key, field.value.render(ctx)); err != nil {
+				return "", err
+			}
+			continue
+		}
+		path := field.value.render(ctx)
+		content := field.content
+		if field.value.hasVars() {
+			var err error
+			if content, err = f.files.read(path); err != nil {
+				return "", err
+			}
+		}
+		name := filepath.Base(path)
+		if fileName := field.fileName.render(ctx); fileName != "" {
+			name = fileName
+		}
+		fileType := defaultFileType
+		if field.fileType != "" {
+			fileType = field.fileType
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+
+			quoteEscaper.Replace(key)+`"; filename="`+
+			quoteEscaper.Replace(name)+`"`)
+		h.Set("Content-Type", fileType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return "", err
+		}
+		if _, err = part.Write(content); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// formFiles caches contents of files by path until their total size
+// reaches the limit, files that don't fit are read every time.
+type formFiles struct {
+	mu      sync.RWMutex
+	files   map[string][]byte
+	size    int
+	maxSize int
+}
+
+func newFormFiles(maxSize int) *formFiles {
+	return &formFiles{
+		files:   make(map[string][]byte),
+		maxSize: maxSize,
+	}
+}
+
+func (f *formFiles) read(path string) ([]byte, error) {
+	f.mu.RLock()
+	content, ok := f.files[path]
+	f.mu.RUnlock()
+	if ok {
+		return content, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	if _, ok := f.files[path]; !ok && f.size+len(content) <= f.maxSize {
+		f.files[path] = content
+		f.size += len(content)
+	}
+	f.mu.Unlock()
+	return content, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFormField(t *testing.T) {
+	expectations := []struct {
+		in  string
+		out formField
+		err error
+	}{
+		{"name=Tom", formField{key: "name", value: "Tom"}, nil},
+		{"empty=", formField{key: "empty"}, nil},
+		{"doc=@/tmp/${file}", formField{
+			key: "doc", value: "/tmp/${file}", file: true,
+		}, nil},
+		{"doc=@a.pdf;filename=${name}.pdf;type=application/pdf", formField{
+			key: "doc", value: "a.pdf", file: true,
+			fileName: "${name}.pdf", fileType: "application/pdf",
+		}, nil},
+		{"name", formField{}, errInvalidFormField},
+		{"=value", formField{}, errInvalidFormField},
+		{"doc=@", formField{}, errInvalidFormField},
+		{"doc=@a.pdf;size=1", formField{}, errInvalidFormField},
+	}
+	for _, e := range expectations {
+		f, err := parseFormField(e.in)
+		if err != e.err || f != e.out {
+			t.Errorf("%q: expected (%+v, %v), but got (%+v, %v)",
+				e.in, e.out, e.err, f, err)
+		}
+	}
+}
+
+func TestFormBodyShouldBeURLEncoded(t *testing.T) {
+	f, err := newFormBody([]string{"q=${query}", "page=1", "a b=c&d"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.contentType() != urlencodedContentType {
+		t.Errorf("Unexpected content type %v", f.contentType())
+	}
+	body, err := f.build(newVars(rowOf(map[string]string{"query": "go lang"}), nil, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "q=go+lang&page=1&a+b=c%26d"; body != e {
+		t.Errorf("Expected %q, but got %q", e, body)
+	}
+}
+
+func TestFormBodyShouldUploadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := newFormBody([]string{
+		"title=${title}",
+		"doc=@" + dir + "/${file};filename=\"${title}\".txt;type=text/plain",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"a.txt", "b.txt", "a.txt"} {
+		body, err := f.build(newVars(
+			rowOf(map[string]string{"title": "T", "file": file}), nil, 0,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, params, err := mime.ParseMediaType(f.contentType())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		form, err := r.ReadForm(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := form.Value["title"]; len(v) != 1 || v[0] != "T" {
+			t.Errorf("Unexpected title %v", v)
+		}
+		fh := form.File["doc"][0]
+		if fh.Filename != `"T".txt` ||
+			fh.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("Unexpected file header %v %v", fh.Filename, fh.Header)
+		}
+		content, _ := fh.Open()
+		data, _ := ioutil.ReadAll(content)
+		if string(data) != file {
+			t.Errorf("Expected content %q, but got %q", file, data)
+		}
+	}
+}
+
+func TestFormBodyShouldOnlyKeepStaticFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.txt")
+	if _, err = newFormBody([]string{"doc=@" + path}, false); err == nil {
+		t.Error("Expected the absent file to be rejected")
+	}
+	if err = ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFormBody([]string{
+		"static=@" + path, "dynamic=@" + dir + "/${file}",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	body, err := f.build(newVars(rowOf(map[string]string{"file": "a.txt"}), nil, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := multipart.NewReader(strings.NewReader(body), f.boundary)
+	form, err := r.ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"static": "old", "dynamic": "new"} {
+		content, _ := form.File[name][0].Open()
+		data, _ := ioutil.ReadAll(content)
+		if string(data) != expected {
+			t.Errorf("%v: expected %q, but got %q", name, expected, data)
+		}
+	}
+}
+
+func TestFormFilesShouldBeCachedUpToLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	small, large := filepath.Join(dir, "small"), filepath.Join(dir, "large")
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(small, "old")
+	write(large, "old data")
+	files := newFormFiles(4)
+	for _, path := range []string{small, large} {
+		if _, err := files.read(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(small, "new")
+	write(large, "new data")
+	expectations := map[string]string{small: "old", large: "new data"}
+	for path, expected := range expectations {
+		content, err := files.read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("%v: expected %q, but got %q", path, expected, content)
+		}
+	}
+	if _, err := files.read(filepath.Join(dir, "absent")); err == nil {
+		t.Error("Expected the absent file to be rejected")
+	}
+}
+
+func TestNewConfigShouldRejectFormFiles(t *testing.T) {
+	_, err := newConfig(&BombardierRequest{Form: []string{"name=Tom"}})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = newConfig(&BombardierRequest{
+		Form: []string{"name=Tom", "doc=@/etc/shadow"},
+	})
+	if err != errServerFormFile {
+		t.Errorf("Expected %v, but got %v", errServerFormFile, err)
+	}
+}
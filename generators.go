@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// generatorPrefix distinguishes generator expressions from payload
+// variables in placeholders, i.e. ${__uuid} or ${__randInt(1,10)}.
+const generatorPrefix = "__"
+
+const randStringAlphabet = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generator produces a value for a single placeholder of the request
+// sent by the worker.
+type generator func(worker uint64) string
+
+// generators holds the state shared by generator expressions during
+// the test, such as sequences, and caches compiled expressions.
+type generators struct {
+	seq        uint64
+	threadSeqs []uint64
+
+	compiled sync.Map
+}
+
+func newGenerators(numConns uint64) *generators {
+	return &generators{threadSeqs: make([]uint64, numConns)}
+}
+
+func isGenerator(key string) bool {
+	return strings.HasPrefix(key, generatorPrefix)
+}
+
+// generate evaluates expression for the worker. Expressions are
+// verified with compile before the test, so invalid ones are left
+// as is.
+func (g *generators) generate(expr string, worker uint64) string {
+	if gen, ok := g.compiled.Load(expr); ok {
+		return gen.(generator)(worker)
+	}
+	gen, err := g.compile(expr)
+	if err != nil {
+		return expr
+	}
+	g.compiled.Store(expr, gen)
+	return gen(worker)
+}
+
+// compile parses generator expression in form __name or
+// __name(arg1,arg2,...).
+func (g *generators) compile(expr string) (generator, error) {
+	name, args := strings.TrimPrefix(expr, generatorPrefix), ""
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		if !strings.HasSuffix(name, ")") {
+			return nil, fmt.Errorf("Unclosed parenthesis in ${%v}", expr)
+		}
+		name, args = name[:i], name[i+1:len(name)-1]
+	}
+	gen, err := g.compileFunc(name, args)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid generator ${%v}: %v", expr, err)
+	}
+	return gen, nil
+}
+
+func (g *generators) compileFunc(name, args string) (generator, error) {
+	switch name {
+	case "uuid":
+		return func(uint64) string {
+			return uuid.Must(uuid.NewV4()).String()
+		}, nil
+	case "randInt":
+		min, max, err := parseRange(args)
+		if err != nil {
+			return nil, err
+		}
+		return func(uint64) string {
+			return strconv.FormatInt(randInt(min, max), decBase)
+		}, nil
+	case "randString":
+		n, err := strconv.Atoi(strings.TrimSpace(args))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("length must be a positive integer")
+		}
+		return func(uint64) string {
+			return randString(n)
+		}, nil
+	case "seq":
+		return func(uint64) string {
+			return strconv.FormatUint(atomic.AddUint64(&g.seq, 1), decBase)
+		}, nil
+	case "threadSeq":
+		return func(worker uint64) string {
+			i := worker % uint64(len(g.threadSeqs))
+			return strconv.FormatUint(
+				atomic.AddUint64(&g.threadSeqs[i], 1), decBase)
+		}, nil
+	case "now":
+		format := strings.TrimSpace(args)
+		return func(uint64) string {
+			return formatTime(time.Now(), format)
+		}, nil
+	case "date":
+		layout, offset, err := parseDateArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return func(uint64) string {
+			return formatTime(offset(time.Now()), layout)
+		}, nil
+	case "pick":
+		if args == "" {
+			return nil, fmt.Errorf("nothing to pick from")
+		}
+		choices := strings.Split(args, ",")
+		return func(uint64) string {
+			return choices[rand.Intn(len(choices))]
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown generator %q", name)
+}
+
+// randInt returns a random number from min to max inclusive, the
+// range may be as wide as the whole of int64.
+func randInt(min, max int64) int64 {
+	span := uint64(max) - uint64(min)
+	if span < math.MaxInt64 {
+		return min + rand.Int63n(int64(span)+1)
+	}
+	for {
+		// at least a half of the draws are in range
+		if v := rand.Uint64(); v <= span {
+			return min + int64(v)
+		}
+	}
+}
+
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randStringAlphabet[rand.Intn(len(randStringAlphabet))]
+	}
+	return string(b)
+}
+
+func parseRange(args string) (int64, int64, error) {
+	bounds := strings.Split(args, ",")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("expected min and max")
+	}
+	min, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), decBase, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := strconv.ParseInt(strings.TrimSpace(bounds[1]), decBase, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if max < min {
+		return 0, 0, fmt.Errorf("max is less than min")
+	}
+	return min, max, nil
+}
+
+// parseDateArgs parses layout optionally followed by an offset, such
+// as -1d, 2h or -30m. Layout may contain commas itself.
+func parseDateArgs(args string) (string, func(time.Time) time.Time, error) {
+	noOffset := func(t time.Time) time.Time { return t }
+	i := strings.LastIndexByte(args, ',')
+	if i < 0 {
+		return args, noOffset, nil
+	}
+	spec := strings.TrimSpace(args[i+1:])
+	if strings.HasSuffix(spec, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(spec, "d"))
+		if err == nil {
+			return args[:i], func(t time.Time) time.Time {
+				return t.AddDate(0, 0, days)
+			}, nil
+		}
+	}
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		// not an offset, but a part of the layout
+		return args, noOffset, nil
+	}
+	return args[:i], func(t time.Time) time.Time {
+		return t.Add(d)
+	}, nil
+}
+
+// formatTime formats t as unix timestamp in the specified units or
+// using Go's time layout. Default format is RFC 3339.
+func formatTime(t time.Time, format string) string {
+	switch format {
+	case "":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), decBase)
+	case "unixMillis":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), decBase)
+	case "unixMicros":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), decBase)
+	case "unixNanos":
+		return strconv.FormatInt(t.UnixNano(), decBase)
+	}
+	return t.Format(format)
+}
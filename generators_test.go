@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGeneratorsShouldProduceValues(t *testing.T) {
+	g := newGenerators(2)
+	expectations := []struct {
+		expr    string
+		pattern string
+	}{
+		{"__uuid", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`},
+		{"__randInt(5,5)", `^5$`},
+		{"__randInt(-3, 3)", `^-?[0-3]$`},
+		{"__randString(16)", `^[a-zA-Z0-9]{16}$`},
+		{"__pick(a,b,c)", `^[abc]$`},
+		{"__now(unixMillis)", `^\d{13}$`},
+		{"__now(unix)", `^\d{10}$`},
+		{"__now", `^\d{4}-\d{2}-\d{2}T`},
+		{"__date(2006-01-02)", `^\d{4}-\d{2}-\d{2}$`},
+		{"__date(Jan 2, 2006)", `^[A-Z][a-z]{2} \d{1,2}, \d{4}$`},
+	}
+	for _, e := range expectations {
+		gen, err := g.compile(e.expr)
+		if err != nil {
+			t.Errorf("%v: %v", e.expr, err)
+			continue
+		}
+		if v := gen(0); !regexp.MustCompile(e.pattern).MatchString(v) {
+			t.Errorf("%v: %q doesn't match %v", e.expr, v, e.pattern)
+		}
+	}
+}
+
+func TestGeneratorsShouldApplyDateOffset(t *testing.T) {
+	g := newGenerators(1)
+	expectations := map[string]time.Time{
+		"__date(2006-01-02,-1d)":   time.Now().AddDate(0, 0, -1),
+		"__date(2006-01-02, 2d)":   time.Now().AddDate(0, 0, 2),
+		"__date(2006-01-02,-240h)": time.Now().Add(-240 * time.Hour),
+	}
+	for expr, expected := range expectations {
+		if e, a := expected.Format("2006-01-02"), g.generate(expr, 0); e != a {
+			t.Errorf("%v: expected %v, but got %v", expr, e, a)
+		}
+	}
+}
+
+func TestGeneratorsShouldCountSequences(t *testing.T) {
+	g := newGenerators(2)
+	for i := 1; i <= 3; i++ {
+		if e, a := strconv.Itoa(i), g.generate("__seq", uint64(i)); e != a {
+			t.Errorf("Expected seq %v, but got %v", e, a)
+		}
+	}
+	expectations := []struct {
+		worker   uint64
+		expected string
+	}{
+		{0, "1"}, {1, "1"}, {0, "2"}, {0, "3"}, {1, "2"},
+	}
+	for _, e := range expectations {
+		if a := g.generate("__threadSeq", e.worker); a != e.expected {
+			t.Errorf("Worker %v: expected %v, but got %v",
+				e.worker, e.expected, a)
+		}
+	}
+}
+
+func TestRandIntShouldCoverWideRanges(t *testing.T) {
+	expectations := []struct{ min, max int64 }{
+		{0, math.MaxInt64},
+		{math.MinInt64, 0},
+		{math.MinInt64, math.MaxInt64},
+		{math.MaxInt64, math.MaxInt64},
+		{math.MinInt64, math.MinInt64},
+		{-1, math.MaxInt64 - 1},
+	}
+	g := newGenerators(1)
+	for _, e := range expectations {
+		for i := 0; i < 100; i++ {
+			if v := randInt(e.min, e.max); v < e.min || v > e.max {
+				t.Fatalf("%+v: %v is out of range", e, v)
+			}
+		}
+		expr := fmt.Sprintf("__randInt(%v,%v)", e.min, e.max)
+		gen, err := g.compile(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", expr, err)
+		}
+		v, err := strconv.ParseInt(gen(0), decBase, 64)
+		if err != nil || v < e.min || v > e.max {
+			t.Errorf("%v: unexpected value %v, %v", expr, v, err)
+		}
+	}
+}
+
+func TestGeneratorsShouldRejectInvalidExpressions(t *testing.T) {
+	g := newGenerators(1)
+	for _, expr := range []string{
+		"__unknown",
+		"__randInt(10,1)",
+		"__randInt(1)",
+		"__randInt(a,b)",
+		"__randString(0)",
+		"__pick()",
+		"__now(unix",
+	} {
+		if _, err := g.compile(expr); err == nil {
+			t.Errorf("%v: expected an error", expr)
+		}
+	}
+}
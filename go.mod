@@ -8,20 +8,22 @@ require (
 	github.com/alecthomas/kingpin v2.2.3+incompatible
 	github.com/alecthomas/template v0.0.0-20160405071501-a0175ee3bccc // indirect
 	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
+	github.com/andybalholm/brotli v1.0.1
+	github.com/andybalholm/brotli v1.0.1
 	github.com/buaazp/fasthttprouter v0.1.1
 	github.com/cheggaaa/pb v1.0.7
 	github.com/codesenberg/concurrent v0.0.0-20180314162318-11aa0abba0a2
 	github.com/fasthttp/websocket v1.4.3
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/juju/ratelimit v0.0.0-20151125201925-77ed1c8a0121
-	github.com/klauspost/compress v1.11.8 // indirect
+	github.com/klauspost/compress v1.11.8
 	github.com/klauspost/cpuid v0.0.0-20160302075316-09cded8978dc // indirect
 	github.com/klauspost/crc32 v0.0.0-20161016154125-cb6bfca970f6 // indirect
 	github.com/mattn/go-runewidth v0.0.0-20170201023540-14207d285c6c // indirect
 	github.com/oliveagle/jsonpath v0.0.0-20180606110733-2e52cf6e6852
 	github.com/qiangxue/fasthttp-routing v0.0.0-20160225050629-6ccdc2a18d87 // indirect
 	github.com/satori/go.uuid v0.0.0-20180103174451-36e9d2ebbde5
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0
 	github.com/valyala/fasthttp v1.24.0
 	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781
 )
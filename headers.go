@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 )
 
@@ -19,6 +20,9 @@ func (h *headersList) IsCumulative() bool {
 	return true
 }
 
+// Set appends header to the list. Repeated keys are kept as separate
+// entries, so that multi-valued headers are sent as given and in the
+// order they were specified.
 func (h *headersList) Set(value string) error {
 	res := strings.SplitN(value, ":", 2)
 	if len(res) != 2 {
@@ -29,3 +33,84 @@ func (h *headersList) Set(value string) error {
 	})
 	return nil
 }
+
+// with returns a copy of the list with extra headers appended, the
+// list itself is left intact.
+func (h *headersList) with(extra ...header) *headersList {
+	res := make(headersList, 0)
+	if h != nil {
+		res = append(res, *h...)
+	}
+	res = append(res, extra...)
+	return &res
+}
+
+// has tells whether the list contains header with the specified name.
+func (h *headersList) has(key string) bool {
+	if h == nil {
+		return false
+	}
+	for _, e := range *h {
+		if strings.EqualFold(e.key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// specialHeaders are managed by HTTP clients on their own and are only
+// recognized by them in canonical form.
+var specialHeaders = map[string]bool{
+	"Host":              true,
+	"User-Agent":        true,
+	"Content-Type":      true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Cookie":            true,
+	"Transfer-Encoding": true,
+}
+
+// omittableHeaders are the headers that clients may add by default and
+// that can be suppressed with --omit-header. Neither client adds
+// Connection to HTTP/1.1 requests on its own, since connections are
+// kept alive by default, so omitting it only ensures that.
+var omittableHeaders = []string{"Accept-Encoding", "Connection", "User-Agent"}
+
+func isSpecialHeader(key string) bool {
+	return specialHeaders[http.CanonicalHeaderKey(key)]
+}
+
+// canonicalKey returns header name in the form it should be sent in.
+// Names of ordinary headers are left as is.
+func (h header) canonicalKey() string {
+	if isSpecialHeader(h.key) {
+		return http.CanonicalHeaderKey(h.key)
+	}
+	return h.key
+}
+
+func isOmittableHeader(key string) bool {
+	for _, h := range omittableHeaders {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
+
+type omittedHeaders map[string]bool
+
+func newOmittedHeaders(keys *[]string) omittedHeaders {
+	res := make(omittedHeaders)
+	if keys == nil {
+		return res
+	}
+	for _, k := range *keys {
+		res[http.CanonicalHeaderKey(k)] = true
+	}
+	return res
+}
+
+func (o omittedHeaders) has(key string) bool {
+	return o[http.CanonicalHeaderKey(key)]
+}
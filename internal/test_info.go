@@ -37,11 +37,20 @@ type Spec struct {
 	CertPath string
 	KeyPath  string
 
-	Stream     bool
-	Timeout    time.Duration
-	ClientType ClientType
+	Stream       bool
+	Timeout      time.Duration
+	ClientType   ClientType
+	MaxRedirects uint64
+
+	// Compression is the content coding of request bodies, empty if
+	// they are sent as is.
+	Compression    string
+	AcceptEncoding string
 
 	Rate *uint64
+
+	// AssertSample is the fraction of responses asserted.
+	AssertSample float64
 }
 
 // IsTimedTest tells if the test was limited by time.
@@ -83,6 +92,32 @@ type Results struct {
 
 	Errors []ErrorWithCount
 
+	// Redirects is nil unless redirects were followed.
+	Redirects *RedirectStats
+	// Compression is nil unless compression was enabled.
+	Compression *CompressionStats
+
+	// Assertions contains failures of each assertion, it's empty if
+	// responses weren't asserted.
+	Assertions []AssertionStats
+	// AssertedResponses is the number of responses assertions were
+	// checked against.
+	AssertedResponses uint64
+	// AssertFailures is the number of responses failed by assertions,
+	// soft ones aside.
+	AssertFailures uint64
+	// FailedResponses are the first responses assertions failed on.
+	FailedResponses []FailedResponse
+	// Aborted is the reason the test was stopped early, it's empty if
+	// the test wasn't.
+	Aborted string
+	// Thresholds are the results of the thresholds the test had to
+	// meet, in the order they were given.
+	Thresholds []ThresholdResult
+	// Timeseries are the results of every interval of the test, it's
+	// empty unless they were recorded.
+	Timeseries []Interval
+
 	Latencies ReadonlyUint64Histogram
 	Requests  ReadonlyFloat64Histogram
 }
@@ -107,6 +142,92 @@ func (r Results) Throughput() float64 {
 	return float64(r.BytesRead+r.BytesWritten) / r.TimeTaken.Seconds()
 }
 
+// Passed tells whether the test met every threshold and wasn't aborted.
+func (r Results) Passed() bool {
+	if r.Aborted != "" {
+		return false
+	}
+	for _, t := range r.Thresholds {
+		if !t.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// ThresholdResult tells whether the test met the threshold, e.g.
+// p99<300ms.
+type ThresholdResult struct {
+	Threshold string
+	// Actual is the value of the metric, n/a if there wasn't enough
+	// data to compute it, in which case the threshold isn't met.
+	Actual string
+	Passed bool
+}
+
+// Interval contains the results of an interval of the test.
+type Interval struct {
+	Start time.Time
+	// Offset is the time from the beginning of the test to the start of
+	// the interval.
+	Offset   time.Duration
+	Duration time.Duration
+	Rps      float64
+	// Latencies are in microseconds, within 1/32 of the actual ones
+	// above 32us. They are zero if no requests were completed.
+	LatencyMin, LatencyMean, LatencyMax float64
+	LatencyP50, LatencyP90, LatencyP99  float64
+
+	Req1XX, Req2XX, Req3XX, Req4XX, Req5XX, Others uint64
+	// Errors are the requests that got no response or failed
+	// assertions.
+	Errors uint64
+
+	BytesRead, BytesWritten uint64
+}
+
+// Comparison is the comparison of a test with a baseline.
+type Comparison struct {
+	Metrics []ComparedMetric
+	// Significance is nil unless both tests have latency histograms.
+	Significance *Significance
+	// Regressed tells whether any metric got worse than the tolerance
+	// allows.
+	Regressed bool
+}
+
+// ComparedMetric is a metric of the test alongside with the one of the
+// baseline.
+type ComparedMetric struct {
+	Name string
+	// Kind is either throughput, latency or rate.
+	Kind string
+	// Baseline and Current are in requests per second for throughput,
+	// microseconds for latencies and percents of all requests for
+	// rates.
+	Baseline, Current float64
+	// Delta is the change relative to the baseline in percents, for
+	// rates it's the difference in percentage points, as is the
+	// Tolerance.
+	Delta, Tolerance float64
+	// Verdict is either improved, unchanged or regressed.
+	Verdict string
+}
+
+// Significance is the result of the two-sample Kolmogorov-Smirnov test
+// of latency distributions.
+type Significance struct {
+	// Statistic is the largest distance between the cumulative
+	// distributions.
+	Statistic float64
+	// PValue is the probability of the distributions being at least
+	// that far apart if they were the same.
+	PValue float64
+	// Level is the p-value below which the difference is significant.
+	Level       float64
+	Significant bool
+}
+
 // LatenciesStats contains statistical information about latencies.
 type LatenciesStats struct {
 	// These are in microseconds
@@ -281,6 +402,152 @@ func (r Results) RequestsStats(percentiles []float64) *RequestsStats {
 	}
 }
 
+// RedirectStats contains information about redirects followed
+// during the test.
+type RedirectStats struct {
+	// Hops contains number of requests by the number of redirects
+	// they followed.
+	Hops []KeyCount
+	// FinalCodes contains number of responses by the status code of
+	// the final response.
+	FinalCodes []KeyCount
+	// TimeTaken is the total time spent on redirects.
+	TimeTaken time.Duration
+	// Loops is the number of requests abandoned because of redirect
+	// loops.
+	Loops uint64
+	// TooManyRedirects is the number of requests abandoned because
+	// they exceeded the limit of redirects.
+	TooManyRedirects uint64
+}
+
+// MeanHops returns average number of redirects followed by a request.
+func (r *RedirectStats) MeanHops() float64 {
+	sum, count := uint64(0), uint64(0)
+	for _, h := range r.Hops {
+		sum += h.Key * h.Count
+		count += h.Count
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count)
+}
+
+// CompressionStats contains information about compressed request
+// and response bodies.
+type CompressionStats struct {
+	// RequestBytes and CompressedRequestBytes are the total sizes of
+	// request bodies before and after compression.
+	RequestBytes, CompressedRequestBytes int64
+	// DecodedResponses is the number of compressed responses.
+	DecodedResponses uint64
+	// EncodedResponseBytes and DecodedResponseBytes are the total
+	// sizes of compressed response bodies as received over the wire
+	// and after decompression.
+	EncodedResponseBytes, DecodedResponseBytes int64
+	// DecompressionTime is the total CPU time spent on decompression.
+	DecompressionTime time.Duration
+}
+
+// RequestRatio returns compression ratio of request bodies, that is
+// how many times they were smaller on the wire.
+func (c *CompressionStats) RequestRatio() float64 {
+	return ratio(c.RequestBytes, c.CompressedRequestBytes)
+}
+
+// ResponseRatio returns compression ratio of response bodies.
+func (c *CompressionStats) ResponseRatio() float64 {
+	return ratio(c.DecodedResponseBytes, c.EncodedResponseBytes)
+}
+
+// MeanDecompressionTime returns average time spent on decompressing
+// a single response.
+func (c *CompressionStats) MeanDecompressionTime() time.Duration {
+	if c.DecodedResponses == 0 {
+		return 0
+	}
+	return c.DecompressionTime / time.Duration(c.DecodedResponses)
+}
+
+func ratio(raw, compressed int64) float64 {
+	if compressed == 0 {
+		return 0
+	}
+	return float64(raw) / float64(compressed)
+}
+
+// AssertionStats contains failures of a single assertion.
+type AssertionStats struct {
+	Name string
+	// Severity is soft or abort, it's empty for hard assertions.
+	Severity string
+	Failures uint64
+	// EstimatedFailures is the number of failures expected if every
+	// response were asserted, it equals Failures unless responses
+	// were sampled.
+	EstimatedFailures uint64
+	// Reasons are sorted from the most frequent one.
+	Reasons []AssertionFailureReason
+	// Violations of JSON schemas grouped by the schema path, the most
+	// frequent ones first.
+	Violations []SchemaViolations
+}
+
+// SchemaViolations is a part of JSON schema alongside with number of
+// times responses violated it.
+type SchemaViolations struct {
+	// SchemaPath is like #/properties/id/type
+	SchemaPath string
+	Count      uint64
+	// Example is the first violation, e.g. $.id: string is not integer
+	Example string
+}
+
+// AssertionFailureReason is a reason assertion failed for alongside
+// with number of times it occurred.
+type AssertionFailureReason struct {
+	Reason string
+	Count  uint64
+	// Example is the first actual value that failed the assertion,
+	// it's empty if there is no value, e.g. when it's missing.
+	Example string
+}
+
+// FailedResponse is a response an assertion failed on.
+type FailedResponse struct {
+	Assertion string
+	Reason    string
+	Error     string
+
+	StatusCode int
+	Headers    []Header
+	// Body is empty unless assertions read it.
+	Body          string
+	BodyTruncated bool
+
+	// Payload is the row of the payload the request was made with.
+	Payload map[string]string
+}
+
+// KeyCount is a key alongside with number of times it occurred.
+type KeyCount struct {
+	Key, Count uint64
+}
+
+// HistogramToKeyCounts converts histogram into a slice sorted by key.
+func HistogramToKeyCounts(h ReadonlyUint64Histogram) []KeyCount {
+	res := make([]KeyCount, 0, h.Count())
+	h.VisitAll(func(k, c uint64) bool {
+		res = append(res, KeyCount{k, c})
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
 // ErrorWithCount contains error description alongside with number of
 // times this error occurred.
 type ErrorWithCount struct {
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+// statsInterval is how often the results of the last interval are
+// gathered, e.g. to check abort conditions against.
+const statsInterval = time.Second
+
+const (
+	// latencies below are counted exactly
+	exactLatencies = 32
+	// subBuckets is the number of buckets every power of two above
+	// is split to, which keeps the error within 1/32
+	subBuckets   = 16
+	subBucketLog = 4
+
+	latencyBucketsCount = exactLatencies + (64-5)*subBuckets
+)
+
+// latencyBuckets is a fixed size log-linear histogram of latencies in
+// microseconds, cheap to clear and merge unlike uhist.Histogram.
+type latencyBuckets [latencyBucketsCount]uint64
+
+func latencyBucket(us uint64) int {
+	if us < exactLatencies {
+		return int(us)
+	}
+	exp := bits.Len64(us) - 1
+	sub := us >> uint(exp-subBucketLog)
+	return exactLatencies + (exp-5)*subBuckets + int(sub-subBuckets)
+}
+
+// latencyOf returns the middle of the latencies counted by the bucket.
+func latencyOf(bucket int) uint64 {
+	if bucket < exactLatencies {
+		return uint64(bucket)
+	}
+	exp := uint((bucket-exactLatencies)/subBuckets + 5)
+	sub := uint64((bucket-exactLatencies)%subBuckets + subBuckets)
+	width := uint64(1) << (exp - subBucketLog)
+	return sub*width + width/2
+}
+
+func (l *latencyBuckets) record(us uint64) {
+	atomic.AddUint64(&l[latencyBucket(us)], 1)
+}
+
+func (l *latencyBuckets) merge(other *latencyBuckets) {
+	for i := range other {
+		if c := atomic.LoadUint64(&other[i]); c > 0 {
+			l[i] += c
+		}
+	}
+}
+
+// Get implements internal.ReadonlyUint64Histogram.
+func (l *latencyBuckets) Get(us uint64) uint64 {
+	return atomic.LoadUint64(&l[latencyBucket(us)])
+}
+
+// VisitAll implements internal.ReadonlyUint64Histogram.
+func (l *latencyBuckets) VisitAll(fn func(uint64, uint64) bool) {
+	for i := range l {
+		if c := atomic.LoadUint64(&l[i]); c > 0 && !fn(latencyOf(i), c) {
+			return
+		}
+	}
+}
+
+// Count implements internal.ReadonlyUint64Histogram.
+func (l *latencyBuckets) Count() uint64 {
+	count := uint64(0)
+	for i := range l {
+		if atomic.LoadUint64(&l[i]) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// rateSamples are the request rates of intervals.
+type rateSamples []float64
+
+// Get implements internal.ReadonlyFloat64Histogram.
+func (s rateSamples) Get(rate float64) uint64 {
+	count := uint64(0)
+	for _, r := range s {
+		if r == rate {
+			count++
+		}
+	}
+	return count
+}
+
+// VisitAll implements internal.ReadonlyFloat64Histogram.
+func (s rateSamples) VisitAll(fn func(float64, uint64) bool) {
+	for _, r := range s {
+		if !fn(r, 1) {
+			return
+		}
+	}
+}
+
+// Count implements internal.ReadonlyFloat64Histogram.
+func (s rateSamples) Count() uint64 {
+	return uint64(len(s))
+}
+
+// counters are the running totals intervals are told apart by.
+type counters struct {
+	req1xx, req2xx, req3xx, req4xx, req5xx, others uint64
+
+	errors, asserted, assertFailures uint64
+
+	bytesRead, bytesWritten uint64
+}
+
+func (c counters) minus(o counters) counters {
+	return counters{
+		req1xx:         c.req1xx - o.req1xx,
+		req2xx:         c.req2xx - o.req2xx,
+		req3xx:         c.req3xx - o.req3xx,
+		req4xx:         c.req4xx - o.req4xx,
+		req5xx:         c.req5xx - o.req5xx,
+		others:         c.others - o.others,
+		errors:         c.errors - o.errors,
+		asserted:       c.asserted - o.asserted,
+		assertFailures: c.assertFailures - o.assertFailures,
+		bytesRead:      c.bytesRead - o.bytesRead,
+		bytesWritten:   c.bytesWritten - o.bytesWritten,
+	}
+}
+
+func (c counters) plus(o counters) counters {
+	return counters{
+		req1xx:         c.req1xx + o.req1xx,
+		req2xx:         c.req2xx + o.req2xx,
+		req3xx:         c.req3xx + o.req3xx,
+		req4xx:         c.req4xx + o.req4xx,
+		req5xx:         c.req5xx + o.req5xx,
+		others:         c.others + o.others,
+		errors:         c.errors + o.errors,
+		asserted:       c.asserted + o.asserted,
+		assertFailures: c.assertFailures + o.assertFailures,
+		bytesRead:      c.bytesRead + o.bytesRead,
+		bytesWritten:   c.bytesWritten + o.bytesWritten,
+	}
+}
+
+func (c counters) total() uint64 {
+	return c.req1xx + c.req2xx + c.req3xx + c.req4xx + c.req5xx + c.others
+}
+
+// interval is what happened during a statsInterval of the test.
+type interval struct {
+	start     time.Time
+	duration  time.Duration
+	counts    counters
+	latencies *latencyBuckets
+}
+
+// summary sums the interval up, begin is the beginning of the test.
+func (i *interval) summary(begin time.Time) internal.Interval {
+	s := internal.Interval{
+		Start:        i.start,
+		Offset:       i.start.Sub(begin),
+		Duration:     i.duration,
+		Req1XX:       i.counts.req1xx,
+		Req2XX:       i.counts.req2xx,
+		Req3XX:       i.counts.req3xx,
+		Req4XX:       i.counts.req4xx,
+		Req5XX:       i.counts.req5xx,
+		Others:       i.counts.others,
+		Errors:       i.counts.errors + i.counts.assertFailures,
+		BytesRead:    i.counts.bytesRead,
+		BytesWritten: i.counts.bytesWritten,
+	}
+	if i.duration > 0 {
+		s.Rps = float64(i.counts.total()) / i.duration.Seconds()
+	}
+	r := internal.Results{Latencies: i.latencies}
+	if stats := r.LatenciesStats([]float64{0.5, 0.9, 0.99}); stats != nil {
+		s.LatencyMin, s.LatencyMean, s.LatencyMax = stats.Min, stats.Mean, stats.Max
+		s.LatencyP50 = float64(stats.Percentiles[0.5])
+		s.LatencyP90 = float64(stats.Percentiles[0.9])
+		s.LatencyP99 = float64(stats.Percentiles[0.99])
+	}
+	return s
+}
+
+// intervalRecorder splits the test into intervals, latencies are
+// recorded by the workers while the rest is worked out of the totals
+// at the end of every interval.
+type intervalRecorder struct {
+	// current holds the *latencyBuckets of the interval in progress
+	current atomic.Value
+
+	// start is the beginning of the interval in progress
+	start  time.Time
+	totals counters
+	// keep is the number of the last intervals kept for windows
+	keep      int
+	intervals []*interval
+}
+
+func newIntervalRecorder(keep int) *intervalRecorder {
+	r := &intervalRecorder{
+		keep:      keep,
+		intervals: make([]*interval, 0, keep),
+	}
+	r.current.Store(new(latencyBuckets))
+	return r
+}
+
+func (r *intervalRecorder) record(us uint64) {
+	r.current.Load().(*latencyBuckets).record(us)
+}
+
+// next closes the interval in progress with the totals at its end and
+// starts the next one.
+func (r *intervalRecorder) next(now time.Time, totals counters) *interval {
+	latencies := r.current.Load().(*latencyBuckets)
+	r.current.Store(new(latencyBuckets))
+	i := &interval{
+		start:     r.start,
+		duration:  now.Sub(r.start),
+		counts:    totals.minus(r.totals),
+		latencies: latencies,
+	}
+	r.start, r.totals = now, totals
+	if r.keep == 0 {
+		return i
+	}
+	if len(r.intervals) == r.keep {
+		copy(r.intervals, r.intervals[1:])
+		r.intervals = r.intervals[:len(r.intervals)-1]
+	}
+	r.intervals = append(r.intervals, i)
+	return i
+}
+
+// window returns the results of the last n intervals, ok is false
+// until that many have passed.
+func (r *intervalRecorder) window(n int) (res internal.Results, ok bool) {
+	if n > len(r.intervals) {
+		return res, false
+	}
+	return windowResults(r.intervals[len(r.intervals)-n:]), true
+}
+
+func windowResults(intervals []*interval) internal.Results {
+	var (
+		counts    counters
+		latencies = new(latencyBuckets)
+		rates     = make(rateSamples, 0, len(intervals))
+		duration  time.Duration
+	)
+	for _, i := range intervals {
+		counts = counts.plus(i.counts)
+		latencies.merge(i.latencies)
+		duration += i.duration
+		if i.duration > 0 {
+			rates = append(rates, float64(i.counts.total())/i.duration.Seconds())
+		}
+	}
+	res := internal.Results{
+		TimeTaken:         duration,
+		Req1XX:            counts.req1xx,
+		Req2XX:            counts.req2xx,
+		Req3XX:            counts.req3xx,
+		Req4XX:            counts.req4xx,
+		Req5XX:            counts.req5xx,
+		Others:            counts.others,
+		AssertedResponses: counts.asserted,
+		AssertFailures:    counts.assertFailures,
+		Latencies:         latencies,
+		Requests:          rates,
+	}
+	if counts.errors > 0 {
+		res.Errors = []internal.ErrorWithCount{
+			{Error: "errors", Count: counts.errors},
+		}
+	}
+	return res
+}
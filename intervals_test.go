@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	for _, us := range []uint64{0, 1, 31, 32, 33, 63, 64, 1000, 123456, 2e6, 1 << 40} {
+		b := latencyBucket(us)
+		if b < 0 || b >= latencyBucketsCount {
+			t.Fatalf("%v: bucket %v out of range", us, b)
+		}
+		approx := latencyOf(b)
+		if latencyBucket(approx) != b {
+			t.Errorf("%v: %v is out of bucket %v", us, approx, b)
+		}
+		if diff := float64(approx) - float64(us); diff*32 > float64(us) ||
+			-diff*32 > float64(us) {
+			t.Errorf("%v: %v is too far off", us, approx)
+		}
+	}
+	if latencyBucket(^uint64(0)) != latencyBucketsCount-1 {
+		t.Errorf("Expected the largest latency in the last bucket")
+	}
+	for us := uint64(1); us < 1<<20; us++ {
+		if latencyBucket(us) < latencyBucket(us-1) {
+			t.Fatalf("%v: buckets aren't ordered", us)
+		}
+	}
+}
+
+func TestIntervalRecorder(t *testing.T) {
+	r := newIntervalRecorder(2)
+	start := time.Now()
+	r.start = start
+	totals := counters{}
+	for i := 1; i <= 3; i++ {
+		for j := 0; j < 10*i; j++ {
+			r.record(uint64(i) * 1000)
+		}
+		totals.req2xx += 10 * uint64(i)
+		totals.req5xx += uint64(i)
+		totals.errors++
+		r.next(start.Add(time.Duration(i)*time.Second), totals)
+	}
+	if len(r.intervals) != 2 {
+		t.Fatalf("Expected only the last 2 intervals to be kept, but got %v",
+			len(r.intervals))
+	}
+	if _, ok := r.window(3); ok {
+		t.Error("Expected no window longer than the kept intervals")
+	}
+	res, ok := r.window(2)
+	if !ok {
+		t.Fatal("Expected the window of the last 2 intervals")
+	}
+	if res.TimeTaken != 2*time.Second || res.Req2XX != 50 || res.Req5XX != 5 {
+		t.Errorf("Unexpected results %+v", res)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Count != 2 {
+		t.Errorf("Unexpected errors %+v", res.Errors)
+	}
+	latencies := res.LatenciesStats(nil)
+	if latencies == nil || latencies.Min < 1900 || latencies.Max > 3100 {
+		t.Errorf("Expected latencies of the window only, but got %+v", latencies)
+	}
+	requests := res.RequestsStats(nil)
+	if requests == nil || requests.Mean != 27.5 || requests.Max != 33 {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+}
+
+func TestIntervalSummary(t *testing.T) {
+	begin := time.Now()
+	latencies := new(latencyBuckets)
+	for us := uint64(1); us <= 100; us++ {
+		latencies.record(us * 1000)
+	}
+	i := &interval{
+		start:    begin.Add(2 * time.Second),
+		duration: 500 * time.Millisecond,
+		counts: counters{
+			req2xx: 90, req5xx: 10, errors: 2, assertFailures: 3,
+			bytesRead: 1000, bytesWritten: 200,
+		},
+		latencies: latencies,
+	}
+	s := i.summary(begin)
+	if s.Offset != 2*time.Second || s.Rps != 200 || s.Req2XX != 90 ||
+		s.Req5XX != 10 || s.Errors != 5 || s.BytesRead != 1000 ||
+		s.BytesWritten != 200 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	near := func(actual, expected float64) bool {
+		return actual >= expected*31/32 && actual <= expected*33/32
+	}
+	if !near(s.LatencyMin, 1000) || !near(s.LatencyMax, 100000) ||
+		!near(s.LatencyP50, 50000) || !near(s.LatencyP99, 99000) ||
+		!near(s.LatencyMean, 50500) {
+		t.Errorf("Unexpected latencies %+v", s)
+	}
+
+	i.latencies = new(latencyBuckets)
+	if s := i.summary(begin); s.LatencyMax != 0 || s.LatencyMean != 0 {
+		t.Errorf("Expected no latencies, but got %+v", s)
+	}
+}
@@ -1,122 +1,220 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/json"
-	"errors"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"os"
-	"strconv"
+	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"sync/atomic"
-	"time"
 )
 
 type payload struct {
-	data      []map[string]string
+	rows []row
+	// names of the variables every row has
+	names     []string
 	readCount uint32
 	len       uint32
+
+	// stream is set if rows are read from the file during the test
+	// instead of being loaded into memory
+	stream *payloadStream
+
+	strategy payloadStrategy
+	// order of the rows for shuffle strategy
+	order []int
+	// state of the strategy for each worker
+	workers []workerRows
 }
 
-func loadFromFile(filePath string, columns []string, startLine uint32) (*payload, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
+// columnSet maps variable names to positions of their values in rows.
+type columnSet struct {
+	names []string
+	index map[string]int
+}
+
+func newColumnSet(names []string) *columnSet {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
 	}
-	reader := csv.NewReader(file)
+	return &columnSet{names: names, index: index}
+}
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+// columnSets shares column sets between the rows with the same
+// variables.
+type columnSets map[string]*columnSet
+
+func (s columnSets) get(names []string) *columnSet {
+	key := strings.Join(names, "\x00")
+	if cs, ok := s[key]; ok {
+		return cs
 	}
-	if records == nil {
-		return nil, errors.New("file content is empty")
+	cs := newColumnSet(names)
+	s[key] = cs
+	return cs
+}
+
+// row converts variables to a row.
+func (s columnSets) row(vars map[string]string) row {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = vars[name]
+	}
+	return row{cols: s.get(names), values: values}
+}
 
-	colLen := len(columns)
-	rowLen := len(records)
+// row is a single record of the payload. Rows only hold values, the
+// names of variables are shared by all the rows with the same columns.
+type row struct {
+	cols   *columnSet
+	values []string
+}
 
-	if colLen != len(records[0]) {
-		return nil, errors.New("number of variables does not match the number of csv file columns")
+func rowOf(vars map[string]string) row {
+	if vars == nil {
+		return row{}
 	}
+	return make(columnSets).row(vars)
+}
+
+func (r row) empty() bool {
+	return r.cols == nil
+}
+
+func (r row) lookup(name string) (string, bool) {
+	if r.cols == nil {
+		return "", false
+	}
+	i, ok := r.cols.index[name]
+	if !ok {
+		return "", false
+	}
+	return r.values[i], true
+}
 
-	data := make([]map[string]string, len(records))
-	for row := 0; row < rowLen; row++ {
-		data[row] = map[string]string{}
-		for col := 0; col < colLen; col++ {
-			data[row][columns[col]] = records[row][col]
+// toMap returns variables of the row, nil if the row is empty.
+func (r row) toMap() map[string]string {
+	if r.cols == nil {
+		return nil
+	}
+	res := make(map[string]string, len(r.values))
+	for i, name := range r.cols.names {
+		res[name] = r.values[i]
+	}
+	return res
+}
+
+func loadFromFile(filePath string, opts payloadFileOptions, startLine uint32) (*payload, error) {
+	file, reader, err := openPayloadFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []row
+	for {
+		r, err := reader.read()
+		if err == io.EOF {
+			break
 		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", filePath, err)
+		}
+		rows = append(rows, r)
+	}
+	if len(rows) == 0 {
+		return nil, errEmptyPayload
+	}
+	columns := reader.columns()
+	if columns == nil {
+		columns = commonColumns(rows)
 	}
 
 	return &payload{
-		data:      data,
+		rows:      rows,
+		names:     columns,
 		readCount: startLine,
-		len:       uint32(rowLen),
+		len:       uint32(len(rows)),
 	}, nil
 
 }
 
-func loadFromUrl(payloadUrl string, columns []string, offset uint32, limit uint32) (*payload, error) {
-	params := url.Values{}
-	params.Set("columns", strings.Join(columns, ","))
-	params.Set("offset", strconv.Itoa(int(offset)))
-	params.Set("limit", strconv.Itoa(int(limit)))
-
-	reqUrl, _ := url.Parse(payloadUrl)
-	reqUrl.RawQuery = params.Encode()
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(reqUrl.String())
+// streamFromFile opens the payload file to be read during the test.
+// The first pinned rows are held for the whole test to be shared by
+// requests of the same worker.
+func streamFromFile(
+	filePath string, opts payloadFileOptions, startLine uint32, pinned uint64,
+) (*payload, error) {
+	src, err := newFileRowSource(filePath, opts)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	body, _ := ioutil.ReadAll(resp.Body)
+	s, err := newPayloadStream(src, opts.bufferSize, startLine, pinned)
+	if err != nil {
+		return nil, err
+	}
+	return &payload{names: s.names, stream: s}, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		if body != nil {
-			return nil, errors.New(string(body))
-		} else {
-			return nil, errors.New("invalid status code '" + strconv.Itoa(resp.StatusCode) + "'")
-		}
+// columns returns names of the variables provided by the payload.
+func (payload *payload) columns() []string {
+	if payload.names != nil {
+		return payload.names
 	}
+	return commonColumns(payload.rows)
+}
 
-	data := make([]map[string]string, limit)
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		return nil, err
+// first returns the row the test starts with, it's used to check
+// placeholders and templates before the test.
+func (payload *payload) first() row {
+	if payload.stream != nil {
+		return payload.stream.first
 	}
+	if len(payload.rows) == 0 {
+		return row{}
+	}
+	return payload.rows[payload.readCount%payload.len]
+}
 
-	return &payload{
-		data:      data,
-		readCount: 0,
-		len:       limit,
-	}, nil
+func (payload *payload) next() row {
+	return payload.rows[payload.nextIndex()%payload.len]
 }
 
-func (payload *payload) next() map[string]string {
-	var prev uint32
-	var next uint32
-	for {
-		prev = payload.readCount
-		next = prev + 1
-		if atomic.CompareAndSwapUint32(&payload.readCount, prev, next) {
-			return payload.data[prev%payload.len]
-		}
+func (payload *payload) nextIndex() uint32 {
+	return atomic.AddUint32(&payload.readCount, 1) - 1
+}
+
+func (payload *payload) nextUnique() (row, error) {
+	i := payload.nextIndex()
+	if i >= payload.len {
+		// keep the count from wrapping around
+		atomic.StoreUint32(&payload.readCount, payload.len)
+		return row{}, errPayloadExhausted
 	}
+	return payload.rows[i], nil
 }
 
-func (payload *payload) get(s scope, idx uint64) map[string]string {
+func (payload *payload) get(s scope, idx uint64) (row, error) {
+	if payload.stream != nil {
+		return payload.stream.get(s, idx)
+	}
 	if s == request {
-		return payload.next()
+		return payload.pick(idx)
 	} else if s == thread {
-		return payload.data[uint32(idx)%payload.len]
+		return payload.rows[uint32(idx)%payload.len], nil
 	} else {
-		return payload.data[0]
+		return payload.rows[0], nil
+	}
+}
+
+// close stops reading the payload, if it's streamed.
+func (payload *payload) close() {
+	if payload.stream != nil {
+		payload.stream.close()
 	}
 }
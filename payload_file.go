@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats of payload files.
+const (
+	csvPayload       = "csv"
+	tsvPayload       = "tsv"
+	jsonLinesPayload = "jsonl"
+	jsonPayload      = "json"
+)
+
+var payloadFormats = []string{
+	csvPayload, tsvPayload, jsonLinesPayload, jsonPayload,
+}
+
+// payloadFormatByExt maps file extensions to payload formats, files
+// with unknown extensions are read as CSV.
+var payloadFormatByExt = map[string]string{
+	".csv":    csvPayload,
+	".tsv":    tsvPayload,
+	".tab":    tsvPayload,
+	".jsonl":  jsonLinesPayload,
+	".ndjson": jsonLinesPayload,
+	".json":   jsonPayload,
+}
+
+// payloadFileOptions describe how the payload file is read.
+type payloadFileOptions struct {
+	// format is detected from the file extension if empty
+	format string
+	// columns are variable names, with header they select columns
+	// by name, otherwise they're assigned to columns in order
+	columns []string
+	// header tells whether the first row of CSV holds variable names,
+	// it's implied if there are no columns
+	header     bool
+	delimiter  string
+	lazyQuotes bool
+	// bufferSize is the number of rows streams read ahead
+	bufferSize int
+	// rewind tells streams to start over after the last row
+	rewind bool
+}
+
+func isKnownPayloadFormat(format string) bool {
+	for _, f := range payloadFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func detectPayloadFormat(filePath string) string {
+	if f, ok := payloadFormatByExt[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return f
+	}
+	return csvPayload
+}
+
+// parseDelimiter accepts a single character or one of the \t and tab
+// aliases for the tab character.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError ||
+		r == '"' || r == '\r' || r == '\n' {
+		return 0, errInvalidPayloadDelimiter
+	}
+	return r, nil
+}
+
+// payloadLineError reports a malformed row of the payload file.
+type payloadLineError struct {
+	line int
+	err  error
+}
+
+func (p *payloadLineError) Error() string {
+	return fmt.Sprintf("payload line %v: %v", p.line, p.err)
+}
+
+// rowReader reads rows of the payload file one by one.
+type rowReader interface {
+	// read returns io.EOF after the last row
+	read() (row, error)
+	// columns returns variables of the rows, nil if rows may have
+	// different ones
+	columns() []string
+}
+
+// openPayloadFile opens the file and reads its header, if any.
+func openPayloadFile(filePath string, opts payloadFileOptions) (*os.File, rowReader, error) {
+	format := opts.format
+	if format == "" {
+		format = detectPayloadFormat(filePath)
+	}
+	comma := ','
+	switch format {
+	case csvPayload, jsonLinesPayload, jsonPayload:
+	case tsvPayload:
+		comma = '\t'
+	default:
+		return nil, nil, fmt.Errorf("Unknown payload format %q", format)
+	}
+	if opts.delimiter != "" {
+		var err error
+		if comma, err = parseDelimiter(opts.delimiter); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reader rowReader
+	switch format {
+	case jsonLinesPayload:
+		reader = newJSONLinesReader(file, opts)
+	case jsonPayload:
+		reader = newJSONArrayReader(file, opts)
+	default:
+		reader, err = newDelimitedReader(file, opts, comma)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("%v: %w", filePath, err)
+	}
+	return file, reader, nil
+}
+
+// delimitedReader reads CSV and TSV files.
+type delimitedReader struct {
+	csv  *csv.Reader
+	cols *columnSet
+	// indices of the selected columns, nil if all of them are used
+	indices []int
+	minLen  int
+}
+
+func newDelimitedReader(
+	r io.Reader, opts payloadFileOptions, comma rune,
+) (*delimitedReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.LazyQuotes = opts.lazyQuotes
+	// rows of different length are reported with line numbers
+	reader.FieldsPerRecord = -1
+
+	d := &delimitedReader{csv: reader}
+	names := opts.columns
+	if opts.header || len(names) == 0 {
+		record, line, err := d.record()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == nil {
+			names, d.indices, err = selectColumns(record, names)
+			if err != nil {
+				return nil, &payloadLineError{line, err}
+			}
+		}
+	}
+	d.cols = newColumnSet(names)
+	d.minLen = len(names)
+	for _, idx := range d.indices {
+		if idx >= d.minLen {
+			d.minLen = idx + 1
+		}
+	}
+	return d, nil
+}
+
+func (d *delimitedReader) record() ([]string, int, error) {
+	record, err := d.csv.Read()
+	if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			return nil, 0, &payloadLineError{perr.Line, perr.Err}
+		}
+		return nil, 0, err
+	}
+	line, _ := d.csv.FieldPos(0)
+	return record, line, nil
+}
+
+func (d *delimitedReader) read() (row, error) {
+	record, line, err := d.record()
+	if err != nil {
+		return row{}, err
+	}
+	if len(record) < d.minLen || (d.indices == nil && len(record) != d.minLen) {
+		return row{}, &payloadLineError{line, fmt.Errorf(
+			"number of variables (%v) does not match the number "+
+				"of columns (%v)", d.minLen, len(record),
+		)}
+	}
+	if d.indices == nil {
+		return row{cols: d.cols, values: record}, nil
+	}
+	values := make([]string, len(d.indices))
+	for i, idx := range d.indices {
+		values[i] = record[idx]
+	}
+	return row{cols: d.cols, values: values}, nil
+}
+
+func (d *delimitedReader) columns() []string {
+	return d.cols.names
+}
+
+// selectColumns returns names from the header, or, if names were
+// provided, the indices of the columns with these names.
+func selectColumns(header, names []string) ([]string, []int, error) {
+	if len(names) == 0 {
+		seen := make(map[string]bool, len(header))
+		for _, name := range header {
+			if name == "" {
+				return nil, nil, fmt.Errorf("empty variable name in header")
+			}
+			if seen[name] {
+				return nil, nil, fmt.Errorf("duplicate variable %q in header", name)
+			}
+			seen[name] = true
+		}
+		return header, nil, nil
+	}
+	indexOf := make(map[string]int, len(header))
+	for i, name := range header {
+		indexOf[name] = i
+	}
+	indices := make([]int, len(names))
+	for i, name := range names {
+		idx, ok := indexOf[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("no column %q in header", name)
+		}
+		indices[i] = idx
+	}
+	return names, indices, nil
+}
+
+// jsonLinesReader reads files with a JSON object on each line.
+type jsonLinesReader struct {
+	r    *bufio.Reader
+	line int
+	obj  *objectDecoder
+}
+
+func newJSONLinesReader(r io.Reader, opts payloadFileOptions) *jsonLinesReader {
+	return &jsonLinesReader{r: bufio.NewReader(r), obj: newObjectDecoder(opts)}
+}
+
+func (j *jsonLinesReader) read() (row, error) {
+	for {
+		line, err := j.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return row{}, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			return row{}, io.EOF
+		}
+		j.line++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		r, derr := j.obj.decode(line)
+		if derr != nil {
+			return row{}, &payloadLineError{j.line, derr}
+		}
+		return r, nil
+	}
+}
+
+func (j *jsonLinesReader) columns() []string {
+	return j.obj.columns()
+}
+
+// jsonArrayReader reads files with an array of JSON objects.
+type jsonArrayReader struct {
+	lines   *lineTracker
+	dec     *json.Decoder
+	obj     *objectDecoder
+	started bool
+}
+
+func newJSONArrayReader(r io.Reader, opts payloadFileOptions) *jsonArrayReader {
+	lines := &lineTracker{r: r}
+	return &jsonArrayReader{
+		lines: lines,
+		dec:   json.NewDecoder(lines),
+		obj:   newObjectDecoder(opts),
+	}
+}
+
+func (j *jsonArrayReader) read() (row, error) {
+	if !j.started {
+		j.started = true
+		tok, err := j.dec.Token()
+		if err == io.EOF {
+			return row{}, io.EOF
+		}
+		if err != nil || tok != json.Delim('[') {
+			return row{}, &payloadLineError{
+				j.lines.lineAt(j.dec.InputOffset()),
+				fmt.Errorf("expected an array of objects"),
+			}
+		}
+	}
+	if !j.dec.More() {
+		if _, err := j.dec.Token(); err != nil {
+			return row{}, j.lineError(err)
+		}
+		return row{}, io.EOF
+	}
+	var raw json.RawMessage
+	if err := j.dec.Decode(&raw); err != nil {
+		return row{}, j.lineError(err)
+	}
+	line := j.lines.lineAt(j.dec.InputOffset() - int64(len(raw)))
+	r, err := j.obj.decode(raw)
+	if err != nil {
+		return row{}, &payloadLineError{line, err}
+	}
+	return r, nil
+}
+
+func (j *jsonArrayReader) lineError(err error) error {
+	offset := j.dec.InputOffset()
+	if serr, ok := err.(*json.SyntaxError); ok {
+		offset = serr.Offset
+	}
+	return &payloadLineError{j.lines.lineAt(offset), err}
+}
+
+func (j *jsonArrayReader) columns() []string {
+	return j.obj.columns()
+}
+
+// lineTracker counts lines of the data read through it, so that the
+// line of an offset could be found without keeping the data around.
+type lineTracker struct {
+	r      io.Reader
+	offset int64
+	// offsets of newlines after the last offset looked up
+	newlines []int64
+	passed   int
+}
+
+func (t *lineTracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			t.newlines = append(t.newlines, t.offset+int64(i))
+		}
+	}
+	t.offset += int64(n)
+	return n, err
+}
+
+// lineAt returns the number of the line offset is at. Offsets must
+// not decrease between the calls.
+func (t *lineTracker) lineAt(offset int64) int {
+	i := 0
+	for i < len(t.newlines) && t.newlines[i] < offset {
+		i++
+	}
+	t.passed += i
+	t.newlines = append(t.newlines[:0], t.newlines[i:]...)
+	return t.passed + 1
+}
+
+// objectDecoder flattens JSON objects into rows, nested values are
+// named by their paths, i.e. user.address.city or items.0.id.
+type objectDecoder struct {
+	// selected variables, all of them are used if empty
+	selected *columnSet
+	sets     columnSets
+}
+
+func newObjectDecoder(opts payloadFileOptions) *objectDecoder {
+	d := &objectDecoder{sets: make(columnSets)}
+	if len(opts.columns) > 0 {
+		d.selected = newColumnSet(opts.columns)
+	}
+	return d
+}
+
+func (d *objectDecoder) decode(raw []byte) (row, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return row{}, err
+	}
+	if obj == nil {
+		return row{}, fmt.Errorf("expected an object")
+	}
+	vars := make(map[string]string)
+	flattenJSON("", obj, vars)
+	if d.selected == nil {
+		return d.sets.row(vars), nil
+	}
+	values := make([]string, len(d.selected.names))
+	for i, name := range d.selected.names {
+		value, ok := vars[name]
+		if !ok {
+			return row{}, fmt.Errorf("no variable %q", name)
+		}
+		values[i] = value
+	}
+	return row{cols: d.selected, values: values}, nil
+}
+
+// columns returns the selected variables, if any, since otherwise
+// objects may have different keys.
+func (d *objectDecoder) columns() []string {
+	if d.selected == nil {
+		return nil
+	}
+	return d.selected.names
+}
+
+func flattenJSON(prefix string, v interface{}, dst map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if prefix != "" {
+			dst[prefix] = jsonText(value)
+		}
+		for key, nested := range value {
+			flattenJSON(join(key), nested, dst)
+		}
+	case []interface{}:
+		dst[prefix] = jsonText(value)
+		for i, nested := range value {
+			flattenJSON(join(strconv.Itoa(i)), nested, dst)
+		}
+	case string:
+		dst[prefix] = value
+	case nil:
+		dst[prefix] = ""
+	default:
+		dst[prefix] = fmt.Sprint(value)
+	}
+}
+
+func jsonText(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// commonColumns returns variables present in every row.
+func commonColumns(rows []row) []string {
+	if len(rows) == 0 || rows[0].cols == nil {
+		return nil
+	}
+	sets := map[*columnSet]bool{}
+	for _, r := range rows {
+		sets[r.cols] = true
+	}
+	var res []string
+	for _, name := range rows[0].cols.names {
+		common := true
+		for cs := range sets {
+			if _, ok := cs.index[name]; !ok {
+				common = false
+				break
+			}
+		}
+		if common {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
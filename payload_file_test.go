@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writePayloadFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFromFileFormats(t *testing.T) {
+	expectations := []struct {
+		name, content string
+		opts          payloadFileOptions
+		data          []map[string]string
+		columns       []string
+	}{
+		{
+			"plain.csv", "Tom,1\nAnn,2\n",
+			payloadFileOptions{columns: []string{"name", "id"}},
+			[]map[string]string{
+				{"name": "Tom", "id": "1"},
+				{"name": "Ann", "id": "2"},
+			},
+			[]string{"name", "id"},
+		},
+		{
+			"header.csv", "name,id\nTom,1\n",
+			payloadFileOptions{},
+			[]map[string]string{{"name": "Tom", "id": "1"}},
+			[]string{"name", "id"},
+		},
+		{
+			"select.csv", "name,age,id\nTom,30,1\n",
+			payloadFileOptions{columns: []string{"id", "name"}, header: true},
+			[]map[string]string{{"name": "Tom", "id": "1"}},
+			[]string{"id", "name"},
+		},
+		{
+			"users.tsv", "name\tnote\nTom\ta, b\n",
+			payloadFileOptions{},
+			[]map[string]string{{"name": "Tom", "note": "a, b"}},
+			[]string{"name", "note"},
+		},
+		{
+			"users.txt", "name;note\nTom;\"a; \"\"b\"\"\"\n",
+			payloadFileOptions{delimiter: ";"},
+			[]map[string]string{{"name": "Tom", "note": `a; "b"`}},
+			[]string{"name", "note"},
+		},
+		{
+			"lazy.csv", "name,note\nTom,say \"hi\"\n",
+			payloadFileOptions{lazyQuotes: true},
+			[]map[string]string{{"name": "Tom", "note": `say "hi"`}},
+			[]string{"name", "note"},
+		},
+		{
+			"users.jsonl",
+			`{"name":"Tom","age":30,"address":{"city":"Oslo"},"tags":["a"]}` +
+				"\n\n" + `{"name":"Ann","vip":true,"address":{"city":"Rome"}}` + "\n",
+			payloadFileOptions{},
+			[]map[string]string{
+				{
+					"name": "Tom", "age": "30", "address": `{"city":"Oslo"}`,
+					"address.city": "Oslo", "tags": `["a"]`, "tags.0": "a",
+				},
+				{
+					"name": "Ann", "vip": "true", "address": `{"city":"Rome"}`,
+					"address.city": "Rome",
+				},
+			},
+			[]string{"address", "address.city", "name"},
+		},
+		{
+			"users.json", `[{"id": 1, "user": {"name": "Tom"}},` +
+				`{"id": 2.5, "user": {"name": null}}]`,
+			payloadFileOptions{columns: []string{"id", "user.name"}},
+			[]map[string]string{
+				{"id": "1", "user.name": "Tom"},
+				{"id": "2.5", "user.name": ""},
+			},
+			[]string{"id", "user.name"},
+		},
+		{
+			"users.data", `{"id":1}`,
+			payloadFileOptions{format: jsonLinesPayload},
+			[]map[string]string{{"id": "1"}},
+			[]string{"id"},
+		},
+	}
+	for _, e := range expectations {
+		path := writePayloadFile(t, e.name, e.content)
+		defer os.RemoveAll(filepath.Dir(path))
+		p, err := loadFromFile(path, e.opts, 0)
+		if err != nil {
+			t.Errorf("%v: %v", e.name, err)
+			continue
+		}
+		var data []map[string]string
+		for _, r := range p.rows {
+			data = append(data, r.toMap())
+		}
+		if !reflect.DeepEqual(data, e.data) {
+			t.Errorf("%v: expected %v, but got %v", e.name, e.data, data)
+		}
+		if !reflect.DeepEqual(p.columns(), e.columns) {
+			t.Errorf("%v: expected columns %v, but got %v",
+				e.name, e.columns, p.columns())
+		}
+	}
+}
+
+func TestLoadFromFileReportsLines(t *testing.T) {
+	expectations := []struct {
+		name, content string
+		opts          payloadFileOptions
+		line          int
+	}{
+		{"short.csv", "Tom,1\nAnn,2\nBob\n",
+			payloadFileOptions{columns: []string{"name", "id"}}, 3},
+		{"quotes.csv", "name,id\nTom,1\n\"Ann,2\n", payloadFileOptions{}, 3},
+		{"header.csv", "name,name\nTom,1\n", payloadFileOptions{}, 1},
+		{"missing.csv", "name,id\nTom,1\n",
+			payloadFileOptions{columns: []string{"age"}, header: true}, 1},
+		{"bad.jsonl", "{\"a\":1}\n{\"a\":\n", payloadFileOptions{}, 2},
+		{"array.jsonl", "{\"a\":1}\n[1]\n", payloadFileOptions{}, 2},
+		{"vars.jsonl", "{\"a\":1}\n{\"b\":1}\n",
+			payloadFileOptions{columns: []string{"a"}}, 2},
+		{"bad.json", "[\n  {\"a\": 1},\n  {\"a\": 2},\n  \"a\"\n]",
+			payloadFileOptions{}, 4},
+		{"object.json", "\n{\"a\": 1}", payloadFileOptions{}, 2},
+	}
+	for _, e := range expectations {
+		path := writePayloadFile(t, e.name, e.content)
+		defer os.RemoveAll(filepath.Dir(path))
+		_, err := loadFromFile(path, e.opts, 0)
+		if err == nil {
+			t.Errorf("%v: expected an error", e.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), e.name) {
+			t.Errorf("%v: file name is missing in %q", e.name, err)
+		}
+		var lerr *payloadLineError
+		if !errors.As(err, &lerr) {
+			t.Errorf("%v: expected line error, but got %v", e.name, err)
+			continue
+		}
+		if lerr.line != e.line {
+			t.Errorf("%v: expected line %v, but got %v (%v)",
+				e.name, e.line, lerr.line, err)
+		}
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	expectations := []struct {
+		in  string
+		out rune
+		err error
+	}{
+		{";", ';', nil},
+		{"|", '|', nil},
+		{`\t`, '\t', nil},
+		{"tab", '\t', nil},
+		{"¦", '¦', nil},
+		{"", 0, errInvalidPayloadDelimiter},
+		{";;", 0, errInvalidPayloadDelimiter},
+		{`"`, 0, errInvalidPayloadDelimiter},
+		{"\n", 0, errInvalidPayloadDelimiter},
+	}
+	for _, e := range expectations {
+		r, err := parseDelimiter(e.in)
+		if r != e.out || err != e.err {
+			t.Errorf("%q: expected %q, %v, but got %q, %v",
+				e.in, e.out, e.err, r, err)
+		}
+	}
+}
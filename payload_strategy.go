@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// payloadStrategy decides which row of the payload is used by the
+// next request of request scope.
+type payloadStrategy int
+
+const (
+	// sequentialPayload goes through the rows in order and starts over
+	// after the last one
+	sequentialPayload payloadStrategy = iota
+	// uniquePayload uses every row once and stops the test after the
+	// last one
+	uniquePayload
+	// shufflePayload goes through the rows in a random order
+	shufflePayload
+	// randomPayload picks rows uniformly with replacement
+	randomPayload
+	// zipfPayload picks rows following Zipf's law, so that the first
+	// rows are picked the most often
+	zipfPayload
+	// partitionPayload splits rows between the workers, each of them
+	// goes through its own part in order
+	partitionPayload
+)
+
+const defaultZipfExponent = 1.1
+
+var payloadStrategies = map[string]payloadStrategy{
+	"sequential": sequentialPayload,
+	"unique":     uniquePayload,
+	"shuffle":    shufflePayload,
+	"random":     randomPayload,
+	"zipf":       zipfPayload,
+	"partition":  partitionPayload,
+}
+
+var payloadStrategyNames = []string{
+	"sequential", "unique", "shuffle", "random", "zipf", "partition",
+}
+
+func getPayloadStrategy(name string) (payloadStrategy, error) {
+	if name == "" {
+		return sequentialPayload, nil
+	}
+	strategy, ok := payloadStrategies[name]
+	if !ok {
+		return 0, fmt.Errorf(
+			"Unknown payload strategy %q, available are %v",
+			name, strings.Join(payloadStrategyNames, ", "),
+		)
+	}
+	return strategy, nil
+}
+
+// streamable tells whether rows can be picked without having all of
+// them in memory.
+func (s payloadStrategy) streamable() bool {
+	return s == sequentialPayload || s == uniquePayload
+}
+
+// payloadStrategyOptions configure the way rows are picked.
+type payloadStrategyOptions struct {
+	strategy payloadStrategy
+	workers  uint64
+	// seed of the random strategies, current time is used if zero
+	seed int64
+	// exponent of the Zipf distribution, must be greater than 1
+	zipfExponent float64
+}
+
+// workerRows is the state of the strategy kept by each worker, so
+// that the workers don't have to synchronize.
+type workerRows struct {
+	rand *rand.Rand
+	zipf *rand.Zipf
+	// next row of the partition and its bounds
+	next, start, end uint32
+}
+
+// useStrategy prepares the payload for picking rows with the strategy.
+func (payload *payload) useStrategy(opts payloadStrategyOptions) error {
+	payload.strategy = opts.strategy
+	if payload.stream != nil || opts.strategy.streamable() {
+		return nil
+	}
+	seed := opts.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	switch opts.strategy {
+	case shufflePayload:
+		payload.order = rand.New(rand.NewSource(seed)).Perm(int(payload.len))
+	case partitionPayload:
+		if uint64(payload.len) < opts.workers {
+			return fmt.Errorf(
+				"Payload has %v rows, which is not enough for %v partitions",
+				payload.len, opts.workers,
+			)
+		}
+	}
+	s := opts.zipfExponent
+	if s == 0 {
+		s = defaultZipfExponent
+	}
+	payload.workers = make([]workerRows, opts.workers)
+	for i := range payload.workers {
+		w := &payload.workers[i]
+		w.rand = rand.New(rand.NewSource(seed + int64(i)))
+		if opts.strategy == zipfPayload {
+			w.zipf = rand.NewZipf(w.rand, s, 1, uint64(payload.len-1))
+		}
+		w.start = uint32(uint64(i) * uint64(payload.len) / opts.workers)
+		w.end = uint32(uint64(i+1) * uint64(payload.len) / opts.workers)
+		w.next = w.start
+	}
+	return nil
+}
+
+// pick returns the row for the next request of the worker idx.
+func (payload *payload) pick(idx uint64) (row, error) {
+	switch payload.strategy {
+	case uniquePayload:
+		return payload.nextUnique()
+	case shufflePayload:
+		i := payload.nextIndex() % payload.len
+		return payload.rows[payload.order[i]], nil
+	case randomPayload:
+		w := payload.worker(idx)
+		return payload.rows[w.rand.Intn(int(payload.len))], nil
+	case zipfPayload:
+		w := payload.worker(idx)
+		return payload.rows[w.zipf.Uint64()], nil
+	case partitionPayload:
+		w := payload.worker(idx)
+		r := payload.rows[w.next]
+		w.next++
+		if w.next == w.end {
+			w.next = w.start
+		}
+		return r, nil
+	}
+	return payload.next(), nil
+}
+
+func (payload *payload) worker(idx uint64) *workerRows {
+	return &payload.workers[idx%uint64(len(payload.workers))]
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func newTestPayload(numRows int) *payload {
+	rows := make([]row, numRows)
+	cols := newColumnSet([]string{"id"})
+	for i := range rows {
+		rows[i] = row{cols: cols, values: []string{strconv.Itoa(i)}}
+	}
+	return &payload{rows: rows, len: uint32(numRows)}
+}
+
+func pickID(t *testing.T, p *payload, worker uint64) int {
+	r, err := p.get(request, worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := r.lookup("id")
+	id, _ := strconv.Atoi(value)
+	return id
+}
+
+func TestPayloadStrategyUnique(t *testing.T) {
+	p := newTestPayload(5)
+	p.readCount = 2
+	if err := p.useStrategy(payloadStrategyOptions{
+		strategy: uniquePayload, workers: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for expected := 2; expected < 5; expected++ {
+		if id := pickID(t, p, 0); id != expected {
+			t.Errorf("Expected %v, but got %v", expected, id)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := p.get(request, 1); err != errPayloadExhausted {
+			t.Errorf("Expected %v, but got %v", errPayloadExhausted, err)
+		}
+	}
+}
+
+func TestPayloadStrategyShuffle(t *testing.T) {
+	orders := make([][]int, 2)
+	for i := range orders {
+		p := newTestPayload(20)
+		if err := p.useStrategy(payloadStrategyOptions{
+			strategy: shufflePayload, workers: 1, seed: 42,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		seen := map[int]bool{}
+		for j := 0; j < 40; j++ {
+			id := pickID(t, p, 0)
+			if j < 20 {
+				seen[id] = true
+			}
+			orders[i] = append(orders[i], id)
+		}
+		if len(seen) != 20 {
+			t.Errorf("Expected every row once per pass, but got %v", seen)
+		}
+	}
+	sequential := true
+	for j := range orders[0] {
+		if orders[0][j] != orders[1][j] {
+			t.Fatalf("Expected the same order with the same seed: %v, %v",
+				orders[0], orders[1])
+		}
+		sequential = sequential && orders[0][j] == j%20
+	}
+	if sequential {
+		t.Error("Expected rows to be shuffled")
+	}
+}
+
+func TestPayloadStrategyRandomAndZipf(t *testing.T) {
+	for _, strategy := range []payloadStrategy{randomPayload, zipfPayload} {
+		p := newTestPayload(10)
+		if err := p.useStrategy(payloadStrategyOptions{
+			strategy: strategy, workers: 2, seed: 7, zipfExponent: 2,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		counts := make([]int, 10)
+		for i := 0; i < 2000; i++ {
+			counts[pickID(t, p, uint64(i%2))]++
+		}
+		if strategy == zipfPayload {
+			for i := 1; i < len(counts); i++ {
+				if counts[0] <= counts[i] {
+					t.Errorf("Expected the first row to be the hottest: %v", counts)
+					break
+				}
+			}
+			continue
+		}
+		for i, count := range counts {
+			if count < 100 || count > 300 {
+				t.Errorf("Row %v: expected about 200 picks, but got %v", i, count)
+			}
+		}
+	}
+}
+
+func TestPayloadStrategyPartition(t *testing.T) {
+	p := newTestPayload(7)
+	if err := p.useStrategy(payloadStrategyOptions{
+		strategy: partitionPayload, workers: 3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectations := [][]int{
+		{0, 1, 0, 1},
+		{2, 3, 2, 3},
+		{4, 5, 6, 4},
+	}
+	for worker, expected := range expectations {
+		for i, id := range expected {
+			if got := pickID(t, p, uint64(worker)); got != id {
+				t.Errorf("Worker %v, request %v: expected %v, but got %v",
+					worker, i, id, got)
+			}
+		}
+	}
+	p = newTestPayload(2)
+	if err := p.useStrategy(payloadStrategyOptions{
+		strategy: partitionPayload, workers: 3,
+	}); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestGetPayloadStrategy(t *testing.T) {
+	for name, expected := range payloadStrategies {
+		if s, err := getPayloadStrategy(name); s != expected || err != nil {
+			t.Errorf("%v: expected %v, but got %v, %v", name, expected, s, err)
+		}
+	}
+	if s, err := getPayloadStrategy(""); s != sequentialPayload || err != nil {
+		t.Errorf("Expected sequential by default, but got %v, %v", s, err)
+	}
+	if _, err := getPayloadStrategy("roundrobin"); err == nil {
+		t.Error("Expected an error")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// payloadStream reads rows of the payload file in the background
+// during the test, so that only a bounded number of them is held in
+// memory no matter how large the file is.
+type payloadStream struct {
+	src rowSource
+
+	// ring is the bounded buffer of rows read ahead of the requests
+	ring chan row
+	// pending rows were read before the test and are sent first
+	pending []row
+	// err stops the reading, it's set before ring is closed. It's
+	// either errPayloadExhausted or a *payloadReadError
+	err error
+
+	// the first row is used by benchmark scope and the pinned ones by
+	// thread scope, since they have to stay the same during the test
+	first  row
+	pinned []row
+	names  []string
+
+	start sync.Once
+	done  chan struct{}
+	stop  sync.Once
+}
+
+// payloadReadError stops the test, since there are no rows to send
+// after reading of the streamed payload failed.
+type payloadReadError struct {
+	err error
+}
+
+func (e *payloadReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *payloadReadError) Unwrap() error {
+	return e.err
+}
+
+// rowSource provides rows of the streamed payload.
+type rowSource interface {
+	// next returns errPayloadExhausted after the last row
+	next() (row, error)
+	// columns returns variables of the rows, nil if rows may have
+	// different ones
+	columns() []string
+	close()
+}
+
+func newPayloadStream(
+	src rowSource, bufferSize int, startLine uint32, pinned uint64,
+) (*payloadStream, error) {
+	for i := uint32(0); i < startLine; i++ {
+		if _, err := src.next(); err != nil {
+			src.close()
+			if err == errPayloadExhausted {
+				return nil, errEmptyPayload
+			}
+			return nil, err
+		}
+	}
+	first, err := src.next()
+	if err != nil {
+		src.close()
+		if err == errPayloadExhausted {
+			return nil, errEmptyPayload
+		}
+		return nil, err
+	}
+	s := &payloadStream{
+		src:     src,
+		first:   first,
+		pinned:  []row{first},
+		pending: []row{first},
+		names:   src.columns(),
+		done:    make(chan struct{}),
+	}
+	for uint64(len(s.pinned)) < pinned {
+		r, err := src.next()
+		if err == errPayloadExhausted {
+			break
+		}
+		if err != nil {
+			src.close()
+			return nil, err
+		}
+		s.pinned = append(s.pinned, r)
+		s.pending = append(s.pending, r)
+	}
+	if s.names == nil {
+		s.names = commonColumns(s.pinned)
+	}
+	if bufferSize < 1 {
+		bufferSize = defaultPayloadBufferSize
+	}
+	s.ring = make(chan row, bufferSize)
+	return s, nil
+}
+
+func (s *payloadStream) get(sc scope, idx uint64) (row, error) {
+	if sc == thread {
+		return s.pinned[idx%uint64(len(s.pinned))], nil
+	} else if sc != request {
+		return s.first, nil
+	}
+	s.start.Do(func() {
+		go s.fill()
+	})
+	r, ok := <-s.ring
+	if !ok {
+		return row{}, s.err
+	}
+	return r, nil
+}
+
+// fill reads rows into the ring until the file is exhausted or the
+// stream is closed.
+func (s *payloadStream) fill() {
+	defer close(s.ring)
+	defer s.src.close()
+	pending := s.pending
+	s.pending = nil
+	for {
+		var r row
+		if len(pending) > 0 {
+			r, pending = pending[0], pending[1:]
+		} else {
+			var err error
+			if r, err = s.src.next(); err != nil {
+				if err != errPayloadExhausted {
+					err = &payloadReadError{err: err}
+				}
+				s.err = err
+				return
+			}
+		}
+		// select picks randomly if both are ready
+		select {
+		case <-s.done:
+			s.err = errPayloadExhausted
+			return
+		default:
+		}
+		select {
+		case s.ring <- r:
+		case <-s.done:
+			s.err = errPayloadExhausted
+			return
+		}
+	}
+}
+
+func (s *payloadStream) close() {
+	s.stop.Do(func() {
+		close(s.done)
+		// the file wasn't read during the test
+		s.start.Do(s.src.close)
+	})
+}
+
+// fileRowSource reads rows of the file, starting over after the last
+// one if rewind is on.
+type fileRowSource struct {
+	filePath string
+	opts     payloadFileOptions
+
+	file   *os.File
+	reader rowReader
+	// rows read since the file was opened
+	read uint64
+}
+
+func newFileRowSource(filePath string, opts payloadFileOptions) (*fileRowSource, error) {
+	src := &fileRowSource{filePath: filePath, opts: opts}
+	if err := src.open(); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+func (src *fileRowSource) open() error {
+	file, reader, err := openPayloadFile(src.filePath, src.opts)
+	if err != nil {
+		return err
+	}
+	src.file, src.reader, src.read = file, reader, 0
+	return nil
+}
+
+func (src *fileRowSource) next() (row, error) {
+	for {
+		r, err := src.reader.read()
+		if err == nil {
+			src.read++
+			return r, nil
+		}
+		if err != io.EOF {
+			return row{}, fmt.Errorf("%v: %w", src.filePath, err)
+		}
+		if !src.opts.rewind || src.read == 0 {
+			return row{}, errPayloadExhausted
+		}
+		src.close()
+		if err := src.open(); err != nil {
+			return row{}, err
+		}
+	}
+}
+
+func (src *fileRowSource) columns() []string {
+	return src.reader.columns()
+}
+
+func (src *fileRowSource) close() {
+	if src.file != nil {
+		_ = src.file.Close()
+		src.file = nil
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPayloadStreamShouldRewind(t *testing.T) {
+	path := writePayloadFile(t, "ids.csv", "id\n1\n2\n3\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	p, err := streamFromFile(path, payloadFileOptions{
+		bufferSize: 2, rewind: true,
+	}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	if first, _ := p.first().lookup("id"); first != "2" {
+		t.Errorf("Expected to start with 2, but got %v", first)
+	}
+	for i, expected := range []string{"2", "3", "1", "2", "3", "1", "2"} {
+		r, err := p.get(request, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, _ := r.lookup("id"); id != expected {
+			t.Errorf("%v: expected %v, but got %v", i, expected, id)
+		}
+	}
+}
+
+func TestPayloadStreamShouldBeExhausted(t *testing.T) {
+	path := writePayloadFile(t, "ids.jsonl", "{\"id\":1}\n{\"id\":2}\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	p, err := streamFromFile(path, payloadFileOptions{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	for i := 0; i < 2; i++ {
+		if _, err := p.get(request, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p.get(request, 0); err != errPayloadExhausted {
+			t.Errorf("Expected %v, but got %v", errPayloadExhausted, err)
+		}
+	}
+	// benchmark scope isn't affected
+	if r, err := p.get(benchmark, 0); err != nil || r.empty() {
+		t.Errorf("Expected the first row, but got %v, %v", r, err)
+	}
+}
+
+func TestPayloadStreamShouldPinThreadRows(t *testing.T) {
+	path := writePayloadFile(t, "ids.tsv", "id\tname\n1\ta\n2\tb\n3\tc\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	p, err := streamFromFile(path, payloadFileOptions{}, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	for i := 0; i < 3; i++ {
+		for worker, expected := range []string{"a", "b"} {
+			r, _ := p.get(thread, uint64(worker))
+			if name, _ := r.lookup("name"); name != expected {
+				t.Errorf("Worker %v: expected %v, but got %v",
+					worker, expected, name)
+			}
+		}
+	}
+	if columns := p.columns(); len(columns) != 2 {
+		t.Errorf("Expected 2 columns, but got %v", columns)
+	}
+}
+
+func TestPayloadStreamShouldReportErrors(t *testing.T) {
+	path := writePayloadFile(t, "ids.csv", "id,name\n1,a\n2\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	p, err := streamFromFile(path, payloadFileOptions{rewind: true}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	if _, err := p.get(request, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.get(request, 0); err == nil {
+		t.Error("Expected an error")
+	}
+
+	empty := writePayloadFile(t, "empty.csv", "id,name\n")
+	defer os.RemoveAll(filepath.Dir(empty))
+	if _, err := streamFromFile(empty, payloadFileOptions{}, 0, 0); err != errEmptyPayload {
+		t.Errorf("Expected %v, but got %v", errEmptyPayload, err)
+	}
+}
+
+func TestPayloadStreamShouldStopOnClose(t *testing.T) {
+	path := writePayloadFile(t, "ids.csv", "id\n1\n2\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	p, err := streamFromFile(path, payloadFileOptions{
+		bufferSize: 1, rewind: true,
+	}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.get(request, 0); err != nil {
+		t.Fatal(err)
+	}
+	p.close()
+	p.close()
+	// the ring is closed once the reader notices
+	for i := 0; i < 3; i++ {
+		if _, err := p.get(request, 0); err != nil {
+			return
+		}
+	}
+	t.Error("Expected the stream to stop")
+}
+
+func TestPayloadStreamMemoryShouldNotDependOnFileSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	path := writePayloadFile(t, "users.csv", "")
+	defer os.RemoveAll(filepath.Dir(path))
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "id,name,email")
+	const numRows = 200000
+	for i := 0; i < numRows; i++ {
+		fmt.Fprintf(w, "%v,user%v,user%v@example.com\n", i, i, i)
+	}
+	_ = w.Flush()
+	_ = file.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	p, err := streamFromFile(path, payloadFileOptions{bufferSize: 64}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	for i := 0; i < numRows; i++ {
+		if _, err := p.get(request, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	// the rows alone would take more than 10MB
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 2<<20 {
+		t.Errorf("Expected the heap to stay flat, but it grew by %v bytes", grown)
+	}
+	if _, err := p.get(request, 0); err != errPayloadExhausted {
+		t.Errorf("Expected %v, but got %v", errPayloadExhausted, err)
+	}
+}
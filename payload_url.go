@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rows of the payload URL are fetched page by page during the test
+// with GET requests to
+//
+//	<url>?columns=<names>&offset=<offset>&limit=<limit>
+//
+// The response is either a JSON array of objects, JSON Lines
+// (application/x-ndjson) or CSV with a header row (text/csv). A page
+// with less than limit rows is the last one, rows are started over
+// from the first page after it unless the strategy is unique.
+// Responses with 429 and 5xx status codes are retried, the rest of the
+// non-200 ones abort the test with the response body as the reason.
+
+const (
+	defaultPayloadPageSize = 1000
+	defaultPayloadRetries  = 3
+	defaultPayloadTimeout  = 30 * time.Second
+
+	payloadRetryBackoff    = 100 * time.Millisecond
+	maxPayloadRetryBackoff = 5 * time.Second
+)
+
+// payloadURLOptions describe how pages of the payload are fetched.
+type payloadURLOptions struct {
+	// columns are requested from the server, all of them if empty
+	columns []string
+	headers *headersList
+	// token is sent as a bearer token
+	token    string
+	pageSize uint64
+	retries  uint64
+	timeout  time.Duration
+	// rewind tells to start over from the first page after the last
+	rewind bool
+}
+
+// urlRowSource fetches pages of the payload from URL on demand.
+type urlRowSource struct {
+	url    *url.URL
+	opts   payloadURLOptions
+	client *http.Client
+
+	// offset of the next page
+	offset   uint64
+	page     []row
+	pos      int
+	lastPage bool
+	// rows fetched since the first page
+	read uint64
+}
+
+func newURLRowSource(
+	payloadURL string, opts payloadURLOptions, offset uint64,
+) (*urlRowSource, error) {
+	u, err := url.Parse(payloadURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.pageSize == 0 {
+		opts.pageSize = defaultPayloadPageSize
+	}
+	if opts.timeout == 0 {
+		opts.timeout = defaultPayloadTimeout
+	}
+	return &urlRowSource{
+		url:    u,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.timeout},
+		offset: offset,
+	}, nil
+}
+
+func (src *urlRowSource) next() (row, error) {
+	for {
+		if src.pos < len(src.page) {
+			r := src.page[src.pos]
+			src.pos++
+			src.read++
+			return r, nil
+		}
+		if src.lastPage {
+			if !src.opts.rewind || src.read == 0 {
+				return row{}, errPayloadExhausted
+			}
+			src.offset, src.read, src.lastPage = 0, 0, false
+		}
+		page, err := src.fetch()
+		if err != nil {
+			return row{}, err
+		}
+		src.page, src.pos = page, 0
+		src.offset += uint64(len(page))
+		src.lastPage = uint64(len(page)) < src.opts.pageSize
+	}
+}
+
+func (src *urlRowSource) columns() []string {
+	if len(src.opts.columns) == 0 {
+		return nil
+	}
+	return src.opts.columns
+}
+
+func (src *urlRowSource) close() {
+	src.client.CloseIdleConnections()
+}
+
+// fetch requests the next page, retrying on network errors and
+// responses with retriable status codes.
+func (src *urlRowSource) fetch() ([]row, error) {
+	backoff := payloadRetryBackoff
+	for attempt := uint64(0); ; attempt++ {
+		rows, retriable, err := src.fetchPage()
+		if err == nil {
+			return rows, nil
+		}
+		if !retriable || attempt >= src.opts.retries {
+			return nil, err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxPayloadRetryBackoff {
+			backoff = maxPayloadRetryBackoff
+		}
+	}
+}
+
+func (src *urlRowSource) fetchPage() ([]row, bool, error) {
+	u := *src.url
+	params := u.Query()
+	if len(src.opts.columns) > 0 {
+		params.Set("columns", strings.Join(src.opts.columns, ","))
+	}
+	params.Set("offset", strconv.FormatUint(src.offset, decBase))
+	params.Set("limit", strconv.FormatUint(src.opts.pageSize, decBase))
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if src.opts.headers != nil {
+		for _, h := range *src.opts.headers {
+			req.Header.Add(h.key, h.value)
+		}
+	}
+	if src.opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+src.opts.token)
+	}
+	req.Header.Set("Accept", "application/json, application/x-ndjson, text/csv")
+
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		retriable := resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode >= http.StatusInternalServerError
+		msg := strings.TrimSpace(string(body))
+		if msg == "" {
+			msg = "invalid status code '" + strconv.Itoa(resp.StatusCode) + "'"
+		}
+		return nil, retriable, fmt.Errorf("%v: %v", src.url.Redacted(), msg)
+	}
+
+	rows, err := src.parsePage(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, false, fmt.Errorf("%v: %w", src.url.Redacted(), err)
+	}
+	return rows, false, nil
+}
+
+func (src *urlRowSource) parsePage(contentType string, body []byte) ([]row, error) {
+	opts := payloadFileOptions{columns: src.opts.columns}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var (
+		reader rowReader
+		err    error
+	)
+	switch mediaType {
+	case "text/csv":
+		opts.header = true
+		reader, err = newDelimitedReader(bytes.NewReader(body), opts, ',')
+	case "application/x-ndjson", "application/jsonl":
+		reader = newJSONLinesReader(bytes.NewReader(body), opts)
+	default:
+		reader = newJSONArrayReader(bytes.NewReader(body), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rows []row
+	for {
+		r, err := reader.read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+}
+
+// streamFromURL fetches the payload from URL during the test, starting
+// with the row at offset.
+func streamFromURL(
+	payloadURL string, opts payloadURLOptions,
+	offset uint64, bufferSize int, pinned uint64,
+) (*payload, error) {
+	src, err := newURLRowSource(payloadURL, opts, offset)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newPayloadStream(src, bufferSize, 0, pinned)
+	if err != nil {
+		return nil, err
+	}
+	return &payload{names: s.names, stream: s}, nil
+}
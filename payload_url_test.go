@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newPayloadServer serves numRows rows with id and name through the
+// payload URL API in the specified format.
+func newPayloadServer(
+	numRows int, format string, handler func(http.ResponseWriter, *http.Request) bool,
+) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			if handler != nil && !handler(rw, r) {
+				return
+			}
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			var lines []string
+			for i := offset; i < offset+limit && i < numRows; i++ {
+				switch format {
+				case "csv":
+					lines = append(lines, fmt.Sprintf("%v,user%v", i, i))
+				default:
+					lines = append(lines, fmt.Sprintf(`{"id":%v,"name":"user%v"}`, i, i))
+				}
+			}
+			switch format {
+			case "csv":
+				rw.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				fmt.Fprint(rw, "id,name\n"+strings.Join(lines, "\n"))
+			case "jsonl":
+				rw.Header().Set("Content-Type", "application/x-ndjson")
+				fmt.Fprint(rw, strings.Join(lines, "\n"))
+			default:
+				rw.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(rw, "["+strings.Join(lines, ",")+"]")
+			}
+		},
+	))
+}
+
+func TestPayloadURLShouldFetchPages(t *testing.T) {
+	for _, format := range []string{"json", "jsonl", "csv"} {
+		var (
+			mu      sync.Mutex
+			offsets []string
+		)
+		s := newPayloadServer(25, format, func(rw http.ResponseWriter, r *http.Request) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			offsets = append(offsets, r.URL.Query().Get("offset"))
+			if r.URL.Query().Get("limit") != "10" {
+				t.Errorf("Unexpected limit %v", r.URL.Query().Get("limit"))
+			}
+			return true
+		})
+		p, err := streamFromURL(s.URL+"/rows?kind=users", payloadURLOptions{
+			pageSize: 10,
+		}, 3, 4, 0)
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		for i := 3; i < 25; i++ {
+			r, err := p.get(request, 0)
+			if err != nil {
+				t.Fatalf("%v: %v", format, err)
+			}
+			if name, _ := r.lookup("name"); name != "user"+strconv.Itoa(i) {
+				t.Errorf("%v: expected user%v, but got %v", format, i, name)
+			}
+		}
+		if _, err := p.get(request, 0); err != errPayloadExhausted {
+			t.Errorf("%v: expected %v, but got %v", format, errPayloadExhausted, err)
+		}
+		p.close()
+		s.Close()
+		mu.Lock()
+		if strings.Join(offsets, ",") != "3,13,23" {
+			t.Errorf("%v: unexpected offsets %v", format, offsets)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestPayloadURLShouldAuthenticate(t *testing.T) {
+	s := newPayloadServer(3, "json", func(rw http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer secret" ||
+			r.Header.Get("X-Tenant") != "qa" ||
+			r.URL.Query().Get("columns") != "id" {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	defer s.Close()
+	headers := new(headersList)
+	_ = headers.Set("X-Tenant: qa")
+	p, err := streamFromURL(s.URL, payloadURLOptions{
+		columns: []string{"id"},
+		headers: headers,
+		token:   "secret",
+	}, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	if columns := p.columns(); len(columns) != 1 || columns[0] != "id" {
+		t.Errorf("Unexpected columns %v", columns)
+	}
+
+	_, err = streamFromURL(s.URL, payloadURLOptions{
+		columns: []string{"id"},
+	}, 0, 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("Expected an authorization error, but got %v", err)
+	}
+}
+
+func TestPayloadURLShouldRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	s := newPayloadServer(3, "json", func(rw http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= 2 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	})
+	defer s.Close()
+	retries := uint64(2)
+	p, err := streamFromURL(s.URL, payloadURLOptions{retries: retries}, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.close()
+
+	attempts = 0
+	if _, err := streamFromURL(s.URL, payloadURLOptions{retries: 1}, 0, 0, 0); err == nil {
+		t.Error("Expected an error after retries ran out")
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, but got %v", attempts)
+	}
+}
+
+func TestPayloadURLShouldRewind(t *testing.T) {
+	s := newPayloadServer(3, "json", nil)
+	defer s.Close()
+	p, err := streamFromURL(s.URL, payloadURLOptions{
+		pageSize: 2, rewind: true,
+	}, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	for i := 0; i < 7; i++ {
+		r, err := p.get(request, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, _ := r.lookup("id"); id != strconv.Itoa(i%3) {
+			t.Errorf("Expected %v, but got %v", i%3, id)
+		}
+	}
+}
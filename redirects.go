@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+
+	uhist "github.com/codesenberg/concurrent/uint64/histogram"
+)
+
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errRedirectLoop     = errors.New("redirect loop detected")
+)
+
+// redirectStats accumulates information about redirects followed
+// by a client.
+type redirectStats struct {
+	// time spent on redirects, in microseconds
+	timeTaken uint64
+	loops     uint64
+	tooMany   uint64
+
+	// number of redirects followed by a request -> count
+	hops *uhist.Histogram
+	// status code of the final response -> count
+	finalCodes *uhist.Histogram
+}
+
+func newRedirectStats() *redirectStats {
+	return &redirectStats{
+		hops:       uhist.Default(),
+		finalCodes: uhist.Default(),
+	}
+}
+
+func (r *redirectStats) record(code, hops int, usTaken uint64, err error) {
+	r.hops.Increment(uint64(hops))
+	if code > 0 {
+		r.finalCodes.Increment(uint64(code))
+	}
+	atomic.AddUint64(&r.timeTaken, usTaken)
+	switch err {
+	case errRedirectLoop:
+		atomic.AddUint64(&r.loops, 1)
+	case errTooManyRedirects:
+		atomic.AddUint64(&r.tooMany, 1)
+	}
+}
+
+func (r *redirectStats) info() *internal.RedirectStats {
+	return &internal.RedirectStats{
+		Hops:       internal.HistogramToKeyCounts(r.hops),
+		FinalCodes: internal.HistogramToKeyCounts(r.finalCodes),
+		TimeTaken: time.Duration(
+			atomic.LoadUint64(&r.timeTaken)) * time.Microsecond,
+		Loops:            atomic.LoadUint64(&r.loops),
+		TooManyRedirects: atomic.LoadUint64(&r.tooMany),
+	}
+}
+
+func isRedirectError(err error) bool {
+	return err == errTooManyRedirects || err == errRedirectLoop
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusSeeOther, http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectMethod tells which method should be used to follow the
+// redirect and whether the body should be sent again. It mimics the
+// behaviour of net/http.
+func redirectMethod(code int, method string) (string, bool) {
+	switch code {
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return method, true
+	}
+	if method == http.MethodHead {
+		return method, false
+	}
+	return http.MethodGet, false
+}
+
+// redirectChain keeps track of redirects followed by a single request.
+type redirectChain struct {
+	maxRedirects int
+	hops         int
+	// jar holds cookies of the session, if any. URLs are only visited
+	// again in a loop if they are requested with the same cookies,
+	// e.g. /app -> /login -> /app isn't one once the login sets them.
+	jar     http.CookieJar
+	visited map[string]bool
+	// the moment the last hop was sent
+	lastHop time.Time
+}
+
+func newRedirectChain(maxRedirects int, start time.Time) *redirectChain {
+	return &redirectChain{
+		maxRedirects: maxRedirects,
+		lastHop:      start,
+	}
+}
+
+// next resolves location against current URL and registers the
+// hop. It fails if following the redirect would exceed the limit or
+// lead to an URL that was already visited with the same cookies.
+func (r *redirectChain) next(current *url.URL, location string) (*url.URL, error) {
+	if r.hops >= r.maxRedirects {
+		return nil, errTooManyRedirects
+	}
+	next, err := current.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if r.visited == nil {
+		r.visited = map[string]bool{r.visitKey(current): true}
+	}
+	key := r.visitKey(next)
+	if r.visited[key] {
+		return nil, errRedirectLoop
+	}
+	r.visited[key] = true
+	r.hops++
+	r.lastHop = time.Now()
+	return next, nil
+}
+
+// visitKey tells visits of u apart by the cookies it's requested with.
+func (r *redirectChain) visitKey(u *url.URL) string {
+	key := u.String()
+	if r.jar == nil {
+		return key
+	}
+	for _, c := range r.jar.Cookies(u) {
+		key += "\n" + c.String()
+	}
+	return key
+}
+
+// usTaken returns time spent on redirects (that is, everything
+// before the final hop was sent) in microseconds.
+func (r *redirectChain) usTaken(start time.Time) uint64 {
+	return uint64(r.lastHop.Sub(start).Nanoseconds() / 1000)
+}
+
+type redirectChainKey struct{}
+
+func withRedirectChain(ctx context.Context, chain *redirectChain) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, chain)
+}
+
+// checkRedirectFunc returns http.Client.CheckRedirect that follows at
+// most maxRedirects redirects, tracking them in the redirectChain
+// stored in request's context.
+func checkRedirectFunc(
+	maxRedirects int,
+) func(*http.Request, []*http.Request) error {
+	if maxRedirects == 0 {
+		return func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		chain, ok := req.Context().Value(redirectChainKey{}).(*redirectChain)
+		if !ok {
+			return http.ErrUseLastResponse
+		}
+		_, err := chain.next(via[len(via)-1].URL, req.URL.String())
+		return err
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRedirectMethod(t *testing.T) {
+	expectations := []struct {
+		code     int
+		method   string
+		out      string
+		keepBody bool
+	}{
+		{http.StatusMovedPermanently, "POST", "GET", false},
+		{http.StatusFound, "PUT", "GET", false},
+		{http.StatusSeeOther, "POST", "GET", false},
+		{http.StatusSeeOther, "HEAD", "HEAD", false},
+		{http.StatusTemporaryRedirect, "POST", "POST", true},
+		{http.StatusPermanentRedirect, "PUT", "PUT", true},
+	}
+	for _, e := range expectations {
+		method, keepBody := redirectMethod(e.code, e.method)
+		if method != e.out || keepBody != e.keepBody {
+			t.Errorf("Expected (%v, %v) for %v %v, but got (%v, %v)",
+				e.out, e.keepBody, e.code, e.method, method, keepBody)
+		}
+	}
+}
+
+func TestRedirectChain(t *testing.T) {
+	start, _ := url.Parse("http://localhost/start")
+	chain := newRedirectChain(2, time.Now())
+	next, err := chain.next(start, "/next?a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := "http://localhost/next?a=b", next.String(); e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if _, err = chain.next(next, "http://localhost/start"); err != errRedirectLoop {
+		t.Errorf("Expected %v, but got %v", errRedirectLoop, err)
+	}
+	last, err := chain.next(next, "https://otherhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.next(last, "/more"); err != errTooManyRedirects {
+		t.Errorf("Expected %v, but got %v", errTooManyRedirects, err)
+	}
+	if chain.hops != 2 {
+		t.Errorf("Expected 2 hops, but got %v", chain.hops)
+	}
+}
+
+func TestRedirectChainShouldTellVisitsApartByCookies(t *testing.T) {
+	app, _ := url.Parse("http://localhost/app")
+	jar, _ := cookiejar.New(nil)
+	chain := newRedirectChain(5, time.Now())
+	chain.jar = jar
+	login, err := chain.next(app, "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(login, []*http.Cookie{{Name: "sid", Value: "1", Path: "/"}})
+	again, err := chain.next(login, "/app")
+	if err != nil {
+		t.Fatalf("Expected the app to be visited again with cookies, but got %v", err)
+	}
+	if _, err = chain.next(again, "/app"); err != errRedirectLoop {
+		t.Errorf("Expected %v, but got %v", errRedirectLoop, err)
+	}
+}
+
+func TestRedirectStatsInfo(t *testing.T) {
+	r := newRedirectStats()
+	r.record(200, 1, 100, nil)
+	r.record(200, 2, 200, nil)
+	r.record(302, 3, 300, errTooManyRedirects)
+	r.record(-1, 1, 100, errRedirectLoop)
+	info := r.info()
+	if info.Loops != 1 || info.TooManyRedirects != 1 {
+		t.Errorf("Expected a loop and too many redirects, but got %+v", info)
+	}
+	if e, a := 700*time.Microsecond, info.TimeTaken; e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if e, a := 7.0/4, info.MeanHops(); e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if len(info.FinalCodes) != 2 || info.FinalCodes[0].Key != 200 ||
+		info.FinalCodes[0].Count != 2 {
+		t.Errorf("Unexpected final codes: %v", info.FinalCodes)
+	}
+}
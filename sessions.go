@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// session holds the state of a virtual user, every worker (connection)
+// has its own one.
+type session struct {
+	jar      *cookiejar.Jar
+	requests uint64
+}
+
+// applyTo adds cookies stored for u to the request.
+func (s *session) applyTo(req *fasthttp.Request, u *url.URL) {
+	for _, c := range s.jar.Cookies(u) {
+		req.Header.SetCookie(c.Name, c.Value)
+	}
+}
+
+// update stores cookies set by the response to the request to u.
+func (s *session) update(resp *fasthttp.Response, u *url.URL) {
+	var setCookies []string
+	resp.Header.VisitAllCookie(func(_, value []byte) {
+		setCookies = append(setCookies, string(value))
+	})
+	if len(setCookies) == 0 {
+		return
+	}
+	r := &http.Response{Header: http.Header{"Set-Cookie": setCookies}}
+	s.jar.SetCookies(u, r.Cookies())
+}
+
+type cookieSeed struct {
+	name  string
+	value *valueTemplate
+}
+
+type sessions struct {
+	list       []*session
+	resetEvery uint64
+	// cookies to start every session with, values may contain
+	// placeholders
+	seeds []cookieSeed
+}
+
+func newSessions(numConns, resetEvery uint64, seeds *[]string) *sessions {
+	s := &sessions{
+		list:       make([]*session, numConns),
+		resetEvery: resetEvery,
+	}
+	if seeds != nil {
+		for _, seed := range *seeds {
+			// format was verified by config.checkArgs
+			kv := strings.SplitN(seed, "=", 2)
+			s.seeds = append(s.seeds, cookieSeed{
+				name:  strings.TrimSpace(kv[0]),
+				value: compileTemplate(kv[1]),
+			})
+		}
+	}
+	return s
+}
+
+// acquire returns the session of the worker idx. New session is
+// started if the worker has none yet or the current one has already
+// served resetEvery requests, its cookies are seeded for u.
+func (s *sessions) acquire(
+	idx uint64, u *url.URL, ctx *vars,
+) *session {
+	i := idx % uint64(len(s.list))
+	sess := s.list[i]
+	if sess == nil || (s.resetEvery > 0 && sess.requests >= s.resetEvery) {
+		sess = s.start(u, ctx)
+		s.list[i] = sess
+	}
+	sess.requests++
+	return sess
+}
+
+func (s *sessions) start(u *url.URL, ctx *vars) *session {
+	// cookiejar.New never returns an error
+	jar, _ := cookiejar.New(nil)
+	if len(s.seeds) > 0 {
+		cookies := make([]*http.Cookie, 0, len(s.seeds))
+		for _, seed := range s.seeds {
+			cookies = append(cookies, &http.Cookie{
+				Name:  seed.name,
+				Value: seed.value.render(ctx),
+				Path:  "/",
+			})
+		}
+		jar.SetCookies(u, cookies)
+	}
+	return &session{jar: jar}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestSessionsShouldBeResetEveryNRequests(t *testing.T) {
+	u, _ := url.Parse("http://localhost/")
+	s := newSessions(2, 3, nil)
+	first := s.acquire(0, u, nil)
+	other := s.acquire(1, u, nil)
+	if first == other {
+		t.Error("Workers must not share sessions")
+	}
+	for i := 0; i < 2; i++ {
+		if sess := s.acquire(0, u, nil); sess != first {
+			t.Errorf("Session was reset after %v requests", i+2)
+		}
+	}
+	if sess := s.acquire(0, u, nil); sess == first {
+		t.Error("Session must be reset after 3 requests")
+	}
+}
+
+func TestSessionsShouldBeSeededFromPayload(t *testing.T) {
+	u, _ := url.Parse("http://localhost/some/path")
+	s := newSessions(1, 0, &[]string{"sid=${sessionCookie}", "lang=en"})
+	sess := s.acquire(
+		0, u, newVars(rowOf(map[string]string{"sessionCookie": "abc"}), nil, 0),
+	)
+
+	other, _ := url.Parse("http://localhost/")
+	cookies := sess.jar.Cookies(other)
+	expected := map[string]string{"sid": "abc", "lang": "en"}
+	if len(cookies) != len(expected) {
+		t.Fatalf("Expected %v cookies, but got %v", len(expected), cookies)
+	}
+	for _, c := range cookies {
+		if expected[c.Name] != c.Value {
+			t.Errorf("Expected %v=%v, but got %v", c.Name, expected[c.Name], c)
+		}
+	}
+}
+
+func TestSessionShouldStoreCookiesFromResponse(t *testing.T) {
+	u, _ := url.Parse("http://localhost/")
+	sess := newSessions(1, 0, nil).acquire(0, u, nil)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	raw := "HTTP/1.1 200 OK\r\n" +
+		"Set-Cookie: sid=42; Path=/\r\n" +
+		"Set-Cookie: theme=dark\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	if err := resp.Read(bufio.NewReader(strings.NewReader(raw))); err != nil {
+		t.Fatal(err)
+	}
+	sess.update(resp, u)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	sess.applyTo(req, u)
+	if e, a := "42", string(req.Header.Cookie("sid")); e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+	if e, a := "dark", string(req.Header.Cookie("theme")); e != a {
+		t.Errorf("Expected %v, but got %v", e, a)
+	}
+}
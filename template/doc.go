@@ -17,6 +17,8 @@ besides those described in aforementioned documentation, namely:
 	- FormatTimeUsUint64(us uint64) string
 		Same as above, but for uint64, since type conversions are
 		not available in templates.
+	- FormatDuration(d time.Duration) string
+		Same as above, but for time.Duration.
 	- FloatsToArray(ps ...float64) []float64
 		Converts a bunch of floats into array, since, again,
 		type conversions are not available in templates.
@@ -36,6 +38,35 @@ besides those described in aforementioned documentation, namely:
 		Generates UUID Version 4, based on random numbers (RFC 4122)
 	- UUIDV5(ns UUID, name string) UUID
 		Generates UUID Version 5, based on SHA-1 hashing (RFC 4122)
+	- Add(a, b int) int
+		Adds two integers, i.e. to number items starting from 1.
+	- Int(s string) (int, error)
+		Parses integer, payload variables are always strings.
+	- RandInt(min, max int) int
+		Random integer in range [min, max].
+	- RandFloat(min, max float64) float64
+		Random float in range [min, max).
+	- RandString(n int) string
+		Random alphanumeric string of length n.
+	- Pick(choices ...interface{}) interface{}
+		Randomly chosen one of the arguments.
+	- Seq(n int) []int
+		Integers from 0 to n-1, to range over in loops.
+	- Now() time.Time
+		Current time.
+	- JSON(v interface{}) (string, error)
+		Encodes v as JSON, strings are quoted and escaped.
+
+All of the helpers except WithLatencies are also available in request
+body templates (--body-template), which receive the current row of
+the payload as a map of variable names to values, i.e.
+
+	{"user":{{JSON .name}},"items":[
+		{{- range $i, $_ := Seq (Int .count)}}{{if $i}},{{end}}
+		{"n":{{Add $i 1}},"qty":{{RandInt 1 5}}}
+		{{- end}}]}
+
+Referring to a variable not provided by the payload is an error.
 
 The structure that gets passed to the template is documented in
 the package github.com/codesenberg/bombardier/internal. The structure
@@ -63,6 +63,60 @@ const (
 			{{- printf "\n    %10v - %v" .Error .Count }}
 		{{- end -}}
 	{{ end -}}
+	{{- with .Redirects }}
+		{{- "\n  Redirects:" }}
+		{{- printf "\n    hops/req - %.2f, time spent - %v, loops - %v, too many - %v" .MeanHops (FormatDuration .TimeTaken) .Loops .TooManyRedirects }}
+		{{- "\n    final codes:" }}
+		{{- range $index, $code := .FinalCodes }}
+			{{- if ne $index 0 }},{{ end }}
+			{{- printf " %v - %v" .Key .Count }}
+		{{- end -}}
+	{{ end -}}
+	{{- with .Compression }}
+		{{- "\n  Compression:" }}
+		{{- if .CompressedRequestBytes }}
+			{{- printf "\n    requests  - raw %v, wire %v, ratio %.2f" .RequestBytes .CompressedRequestBytes .RequestRatio }}
+		{{- end }}
+		{{- printf "\n    responses - wire %v, decoded %v, ratio %.2f" .EncodedResponseBytes .DecodedResponseBytes .ResponseRatio }}
+		{{- printf "\n    decompression - %v total, %v/resp" (FormatDuration .DecompressionTime) (FormatDuration .MeanDecompressionTime) }}
+	{{- end -}}
+	{{- with .Assertions }}
+		{{- "\n  Assertions:" }}
+		{{- $sampled := lt $.Spec.AssertSample 1.0 }}
+		{{- if $sampled }}
+			{{- printf " %v responses checked, %.0f%% sample" $.Result.AssertedResponses (Multiply $.Spec.AssertSample 100) }}
+		{{- end }}
+		{{- range . }}
+			{{- printf "\n    %v" .Name }}
+			{{- with .Severity }}{{ printf " (%v)" . }}{{ end }}
+			{{- printf " - %v failed" .Failures }}
+			{{- if $sampled }}{{ printf ", ~%v estimated" .EstimatedFailures }}{{ end }}
+			{{- range .Reasons }}
+				{{- printf "\n      %v - %v" .Reason .Count }}
+				{{- with .Example }}{{ printf ", e.g. %q" . }}{{ end }}
+			{{- end -}}
+			{{- range .Violations }}
+				{{- printf "\n      %v - %v, e.g. %q" .SchemaPath .Count .Example }}
+			{{- end -}}
+		{{- end -}}
+	{{ end -}}
+	{{- with .FailedResponses }}
+		{{- printf "\n  Failed responses: %v saved" (len .) }}
+	{{- end -}}
+	{{- with .Aborted }}
+		{{- printf "\n  Aborted: %v" . }}
+	{{- end -}}
+	{{- with .Thresholds }}
+		{{- "\n  Thresholds:" }}
+		{{- range . }}
+			{{- printf "\n    %v - " .Threshold }}
+			{{- if .Passed }}passed{{ else }}failed{{ end }}
+			{{- printf ", actual %v" .Actual }}
+		{{- end -}}
+	{{ end -}}
+	{{- if or .Thresholds .Aborted }}
+		{{- "\n  Result: " }}{{ if .Passed }}passed{{ else }}failed{{ end }}
+	{{- end -}}
 {{ end }}
 {{ printf "  %-10v %10v/s\n" "Throughput:" (FormatBinary .Result.Throughput)}}`
 	jsonTemplate = `{"spec":{
@@ -101,6 +155,17 @@ const (
 
 ,"stream":{{ .Stream }},"timeoutSeconds":{{ .Timeout.Seconds }}
 
+{{- with .MaxRedirects -}}
+,"followRedirects":{{ . }}
+{{- end -}}
+
+{{- with .Compression -}}
+,"compression":"{{ . }}"
+{{- end -}}
+{{- with .AcceptEncoding -}}
+,"acceptEncoding":{{ . | printf "%q" }}
+{{- end -}}
+
 {{- if .IsFastHTTP -}}
 ,"client":"fasthttp"
 {{- end -}}
@@ -114,6 +179,10 @@ const (
 {{- with .Rate -}}
 ,"rate":{{ . }}
 {{- end -}}
+
+{{- if and .AssertSample (lt .AssertSample 1.0) -}}
+,"assertSample":{{ .AssertSample }}
+{{- end -}}
 {{- end -}}
 },
 
@@ -138,6 +207,102 @@ const (
 ]
 {{- end -}}
 
+{{- with .Redirects -}}
+,"redirects":{"meanHops":{{ .MeanHops -}}
+,"timeTakenSeconds":{{ .TimeTaken.Seconds -}}
+,"loops":{{ .Loops -}}
+,"tooManyRedirects":{{ .TooManyRedirects -}}
+,"hops":{
+{{- range $index, $hops := .Hops -}}
+{{- if ne $index 0 -}},{{- end -}}
+"{{ .Key }}":{{ .Count }}
+{{- end -}}
+},"finalCodes":{
+{{- range $index, $code := .FinalCodes -}}
+{{- if ne $index 0 -}},{{- end -}}
+"{{ .Key }}":{{ .Count }}
+{{- end -}}
+}}
+{{- end -}}
+
+{{- with .Compression -}}
+,"compression":{"requestBytes":{{ .RequestBytes -}}
+,"compressedRequestBytes":{{ .CompressedRequestBytes -}}
+,"requestRatio":{{ .RequestRatio -}}
+,"decodedResponses":{{ .DecodedResponses -}}
+,"encodedResponseBytes":{{ .EncodedResponseBytes -}}
+,"decodedResponseBytes":{{ .DecodedResponseBytes -}}
+,"responseRatio":{{ .ResponseRatio -}}
+,"decompressionTimeSeconds":{{ .DecompressionTime.Seconds -}}
+}
+{{- end -}}
+
+{{- with .Assertions -}}
+,"assertedResponses":{{ $.Result.AssertedResponses -}}
+,"assertFailures":{{ $.Result.AssertFailures -}}
+,"assertions":[
+{{- range $index, $assertion := . -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"name":{{ .Name | printf "%q" -}}
+{{- with .Severity -}},"severity":{{ . | printf "%q" }}{{- end -}}
+,"failures":{{ .Failures -}}
+,"estimatedFailures":{{ .EstimatedFailures }},"reasons":[
+{{- range $index, $reason := .Reasons -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"reason":{{ .Reason | printf "%q" }},"count":{{ .Count }},"example":{{ .Example | printf "%q" }}}
+{{- end -}}
+]
+{{- with .Violations -}}
+,"violations":[
+{{- range $index, $violation := . -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"schemaPath":{{ .SchemaPath | printf "%q" }},"count":{{ .Count }},"example":{{ .Example | printf "%q" }}}
+{{- end -}}
+]
+{{- end -}}
+}
+{{- end -}}
+]
+{{- end -}}
+
+{{- with .FailedResponses -}}
+,"failedResponses":[
+{{- range $index, $failure := . -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"assertion":{{ .Assertion | printf "%q" }},"reason":{{ .Reason | printf "%q" -}}
+,"error":{{ .Error | printf "%q" }},"statusCode":{{ .StatusCode -}}
+,"headers":[
+{{- range $index, $header := .Headers -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"key":{{ .Key | printf "%q" }},"value":{{ .Value | printf "%q" }}}
+{{- end -}}
+],"body":{{ .Body | printf "%q" }},"bodyTruncated":{{ .BodyTruncated -}}
+,"payload":{
+{{- $first := true -}}
+{{- range $name, $value := .Payload -}}
+{{- if not $first -}},{{- end -}}
+{{- $first = false -}}
+{{ $name | printf "%q" }}:{{ $value | printf "%q" }}
+{{- end -}}
+}}
+{{- end -}}
+]
+{{- end -}}
+
+{{- with .Aborted -}}
+,"aborted":{{ . | printf "%q" }}
+{{- end -}}
+
+{{- with .Thresholds -}}
+,"thresholds":[
+{{- range $index, $threshold := . -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"threshold":{{ .Threshold | printf "%q" }},"actual":{{ .Actual | printf "%q" }},"passed":{{ .Passed }}}
+{{- end -}}
+]
+{{- end -}}
+,"passed":{{ .Passed -}}
+
 {{- with .LatenciesStats (FloatsToArray 0.5 0.75 0.9 0.95 0.99) -}}
 ,"latency":{"mean":{{ .Mean -}}
 ,"stddev":{{ .Stddev -}}
@@ -152,6 +317,15 @@ const (
 }
 {{- end -}}
 
+{{- if WithHistogram -}}
+,"histogram":[
+{{- range $index, $bucket := KeyCounts $.Result.Latencies -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"latency":{{ .Key }},"count":{{ .Count }}}
+{{- end -}}
+]
+{{- end -}}
+
 }
 {{- end -}}
 
@@ -166,6 +340,70 @@ const (
 {{- end -}}
 }}
 {{- end -}}
+
+{{- with .Timeseries -}}
+,"timeseries":[
+{{- range $index, $interval := . -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"time":{{ .Start.Format "2006-01-02T15:04:05.999999999Z07:00" | printf "%q" -}}
+,"offsetSeconds":{{ .Offset.Seconds }},"durationSeconds":{{ .Duration.Seconds -}}
+,"rps":{{ .Rps -}}
+,"latencyMin":{{ .LatencyMin }},"latencyMean":{{ .LatencyMean -}}
+,"latencyP50":{{ .LatencyP50 }},"latencyP90":{{ .LatencyP90 -}}
+,"latencyP99":{{ .LatencyP99 }},"latencyMax":{{ .LatencyMax -}}
+,"req1xx":{{ .Req1XX }},"req2xx":{{ .Req2XX }},"req3xx":{{ .Req3XX -}}
+,"req4xx":{{ .Req4XX }},"req5xx":{{ .Req5XX }},"others":{{ .Others -}}
+,"errors":{{ .Errors }},"bytesRead":{{ .BytesRead -}}
+,"bytesWritten":{{ .BytesWritten }}}
+{{- end -}}
+]
+{{- end -}}
 }}
 {{- end -}}`
 )
+
+var comparisonTemplates = map[string]string{
+	"plain-text": comparisonPlainTextTemplate,
+	"json":       comparisonJsonTemplate,
+	"markdown":   comparisonMarkdownTemplate,
+}
+
+const (
+	comparisonPlainTextTemplate = `
+{{- printf "%-8v %12v %12v %10v %10v  %v" "Metric" "Baseline" "Current" "Delta" "Tolerance" "Verdict" }}
+{{- range .Metrics }}
+{{ printf "%-8v %12v %12v %10v %10v  %v" .Name (FormatMetric .Kind .Baseline) (FormatMetric .Kind .Current) (FormatDelta .Kind .Delta) (FormatTolerance .Kind .Tolerance) .Verdict }}
+{{- end }}
+{{- with .Significance }}
+{{ printf "Latency distributions are %v, D=%.4f, p=%.4f at level %v" (or (and .Significant "different") "alike") .Statistic .PValue .Level }}
+{{- end }}
+Result: {{ if .Regressed }}regressed{{ else }}no regressions{{ end }}
+`
+
+	comparisonMarkdownTemplate = `| Metric | Baseline | Current | Delta | Tolerance | Verdict |
+| --- | ---: | ---: | ---: | ---: | --- |
+{{- range .Metrics }}
+| {{ .Name }} | {{ FormatMetric .Kind .Baseline }} | {{ FormatMetric .Kind .Current }} | {{ FormatDelta .Kind .Delta }} | {{ FormatTolerance .Kind .Tolerance }} | {{ if eq .Verdict "regressed" }}**regressed**{{ else }}{{ .Verdict }}{{ end }} |
+{{- end }}
+{{ with .Significance }}
+{{ printf "Latency distributions are %v (Kolmogorov-Smirnov D = %.4f, p = %.4f, level %v)." (or (and .Significant "different") "alike") .Statistic .PValue .Level }}
+{{ end }}
+**Result:** {{ if .Regressed }}regressed{{ else }}no regressions{{ end }}
+`
+
+	comparisonJsonTemplate = `{"metrics":[
+{{- range $index, $metric := .Metrics -}}
+{{- if ne $index 0 -}},{{- end -}}
+{"name":{{ .Name | printf "%q" }},"kind":{{ .Kind | printf "%q" -}}
+,"baseline":{{ .Baseline }},"current":{{ .Current -}}
+,"delta":{{ .Delta }},"tolerance":{{ .Tolerance -}}
+,"verdict":{{ .Verdict | printf "%q" }}}
+{{- end -}}
+]
+{{- with .Significance -}}
+,"significance":{"statistic":{{ .Statistic }},"pValue":{{ .PValue -}}
+,"level":{{ .Level }},"significant":{{ .Significant }}}
+{{- end -}}
+,"regressed":{{ .Regressed }}}
+`
+)
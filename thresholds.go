@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+// threshold is a condition the results must meet for the test to pass,
+// e.g. p99<300ms, errors<0.1% or rps>2000.
+type threshold struct {
+	expr     string
+	metric   string
+	operator string
+	// value is in microseconds for latencies
+	value float64
+	// percent tells that value is a percentage of the total, e.g. of
+	// all requests for errors
+	percent bool
+}
+
+// thresholdMetric is a figure of the results thresholds are checked
+// against.
+type thresholdMetric struct {
+	// latencies are compared with durations
+	latency bool
+	// relative metrics can be compared with percentages of a total
+	relative bool
+	// measure returns the metric and the total it's a part of, ok is
+	// false if there isn't enough data to tell
+	measure func(r *internal.Results) (value, total float64, ok bool)
+}
+
+var thresholdOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+var percentileMetricRegexp = regexp.MustCompile(`^p(\d+(?:\.\d+)?)$`)
+
+func latencyMetric(
+	percentiles []float64, stat func(s *internal.LatenciesStats) float64,
+) thresholdMetric {
+	return thresholdMetric{
+		latency: true,
+		measure: func(r *internal.Results) (float64, float64, bool) {
+			s := r.LatenciesStats(percentiles)
+			if s == nil {
+				return 0, 0, false
+			}
+			return stat(s), 0, true
+		},
+	}
+}
+
+func countMetric(count func(r *internal.Results) uint64) thresholdMetric {
+	return thresholdMetric{
+		relative: true,
+		measure: func(r *internal.Results) (float64, float64, bool) {
+			return float64(count(r)), float64(totalRequests(r)), true
+		},
+	}
+}
+
+var thresholdMetrics = map[string]thresholdMetric{
+	"avg": latencyMetric(nil, func(s *internal.LatenciesStats) float64 {
+		return s.Mean
+	}),
+	"stddev": latencyMetric(nil, func(s *internal.LatenciesStats) float64 {
+		return s.Stddev
+	}),
+	"max": latencyMetric(nil, func(s *internal.LatenciesStats) float64 {
+		return s.Max
+	}),
+	"min": latencyMetric(nil, func(s *internal.LatenciesStats) float64 {
+		return s.Min
+	}),
+	"rps": {
+		measure: func(r *internal.Results) (float64, float64, bool) {
+			if s := r.RequestsStats(nil); s != nil {
+				return s.Mean, 0, true
+			}
+			// too short a test to sample the rate, so it's the average
+			if r.TimeTaken <= 0 {
+				return 0, 0, false
+			}
+			return float64(totalRequests(r)) / r.TimeTaken.Seconds(), 0, true
+		},
+	},
+	// requests that got no response or failed assertions
+	"errors": countMetric(func(r *internal.Results) uint64 {
+		errors := r.AssertFailures
+		for _, e := range r.Errors {
+			errors += e.Count
+		}
+		return errors
+	}),
+	// responses failed by assertions, soft ones aside, out of the
+	// asserted ones
+	"assertFailures": {
+		relative: true,
+		measure: func(r *internal.Results) (float64, float64, bool) {
+			return float64(r.AssertFailures), float64(r.AssertedResponses), true
+		},
+	},
+	"1xx": countMetric(func(r *internal.Results) uint64 { return r.Req1XX }),
+	"2xx": countMetric(func(r *internal.Results) uint64 { return r.Req2XX }),
+	"3xx": countMetric(func(r *internal.Results) uint64 { return r.Req3XX }),
+	"4xx": countMetric(func(r *internal.Results) uint64 { return r.Req4XX }),
+	"5xx": countMetric(func(r *internal.Results) uint64 { return r.Req5XX }),
+	"others": countMetric(func(r *internal.Results) uint64 {
+		return r.Others
+	}),
+}
+
+func totalRequests(r *internal.Results) uint64 {
+	return r.Req1XX + r.Req2XX + r.Req3XX + r.Req4XX + r.Req5XX + r.Others
+}
+
+func thresholdMetricNames() []string {
+	names := make([]string, 0, len(thresholdMetrics)+1)
+	names = append(names, "p<percentile>")
+	for name := range thresholdMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// metricOf returns the metric of the threshold, percentiles of latencies
+// are made up on demand.
+func metricOf(name string) (thresholdMetric, bool) {
+	if m, ok := thresholdMetrics[name]; ok {
+		return m, true
+	}
+	match := percentileMetricRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return thresholdMetric{}, false
+	}
+	p, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || p <= 0 || p > 100 {
+		return thresholdMetric{}, false
+	}
+	p /= 100
+	return latencyMetric([]float64{p}, func(s *internal.LatenciesStats) float64 {
+		return float64(s.Percentiles[p])
+	}), true
+}
+
+func parseThreshold(expr string) (threshold, error) {
+	t := threshold{expr: strings.TrimSpace(expr)}
+	i, op := -1, ""
+	for _, o := range thresholdOperators {
+		if j := strings.Index(t.expr, o); j >= 0 && (i < 0 || j < i) {
+			i, op = j, o
+		}
+	}
+	if i < 0 {
+		return t, fmt.Errorf("Invalid threshold %q, expected "+
+			"<metric><operator><value> with one of the operators %v",
+			expr, strings.Join(thresholdOperators, " "))
+	}
+	t.metric = strings.TrimSpace(t.expr[:i])
+	t.operator = op
+	value := strings.TrimSpace(t.expr[i+len(op):])
+	m, ok := metricOf(t.metric)
+	if !ok {
+		return t, fmt.Errorf("Unknown metric %q of threshold %q, available are %v",
+			t.metric, expr, strings.Join(thresholdMetricNames(), ", "))
+	}
+	var err error
+	switch {
+	case m.latency:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		t.value = float64(d) / float64(time.Microsecond)
+	case strings.HasSuffix(value, "%"):
+		if !m.relative {
+			return t, fmt.Errorf("Threshold %q: %v can't be a percentage",
+				expr, t.metric)
+		}
+		t.percent = true
+		t.value, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	default:
+		t.value, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil || math.IsNaN(t.value) {
+		return t, fmt.Errorf("Invalid value %q of threshold %q", value, expr)
+	}
+	return t, nil
+}
+
+// check evaluates the threshold against the results.
+func (t threshold) check(r *internal.Results) internal.ThresholdResult {
+	res := internal.ThresholdResult{Threshold: t.expr, Actual: "n/a"}
+	m, _ := metricOf(t.metric)
+	value, total, ok := m.measure(r)
+	if !ok {
+		return res
+	}
+	switch {
+	case t.percent:
+		if total > 0 {
+			value = value / total * 100
+		}
+		res.Actual = strconv.FormatFloat(value, 'f', 2, 64) + "%"
+	case m.latency:
+		res.Actual = time.Duration(value * float64(time.Microsecond)).String()
+	default:
+		res.Actual = strconv.FormatFloat(value, 'f', -1, 64)
+		if t.metric == "rps" {
+			res.Actual = strconv.FormatFloat(value, 'f', 2, 64)
+		}
+	}
+	switch t.operator {
+	case "<":
+		res.Passed = value < t.value
+	case "<=":
+		res.Passed = value <= t.value
+	case ">":
+		res.Passed = value > t.value
+	case ">=":
+		res.Passed = value >= t.value
+	case "==":
+		res.Passed = value == t.value
+	case "!=":
+		res.Passed = value != t.value
+	}
+	return res
+}
+
+func checkThresholds(thresholds []threshold, r *internal.Results) []internal.ThresholdResult {
+	if len(thresholds) == 0 {
+		return nil
+	}
+	res := make([]internal.ThresholdResult, 0, len(thresholds))
+	for _, t := range thresholds {
+		res = append(res, t.check(r))
+	}
+	return res
+}
+
+// thresholdsList is the value of the repeatable --threshold flag.
+type thresholdsList []threshold
+
+func (l *thresholdsList) String() string {
+	exprs := make([]string, 0, len(*l))
+	for _, t := range *l {
+		exprs = append(exprs, t.expr)
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (l *thresholdsList) IsCumulative() bool {
+	return true
+}
+
+func (l *thresholdsList) Set(value string) error {
+	t, err := parseThreshold(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, t)
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+	fhist "github.com/codesenberg/concurrent/float64/histogram"
+	uhist "github.com/codesenberg/concurrent/uint64/histogram"
+)
+
+func TestParseThreshold(t *testing.T) {
+	expectations := []struct {
+		in       string
+		expected threshold
+	}{
+		{"p99<300ms", threshold{
+			expr: "p99<300ms", metric: "p99", operator: "<", value: 300000,
+		}},
+		{" p99.9 <= 1s ", threshold{
+			expr: "p99.9 <= 1s", metric: "p99.9", operator: "<=", value: 1000000,
+		}},
+		{"errors<0.1%", threshold{
+			expr: "errors<0.1%", metric: "errors", operator: "<", value: 0.1,
+			percent: true,
+		}},
+		{"rps>2000", threshold{
+			expr: "rps>2000", metric: "rps", operator: ">", value: 2000,
+		}},
+		{"assertFailures==0", threshold{
+			expr: "assertFailures==0", metric: "assertFailures", operator: "==",
+		}},
+		{"5xx!=0", threshold{
+			expr: "5xx!=0", metric: "5xx", operator: "!=",
+		}},
+	}
+	for _, e := range expectations {
+		actual, err := parseThreshold(e.in)
+		if err != nil {
+			t.Errorf("%q: %v", e.in, err)
+			continue
+		}
+		if actual != e.expected {
+			t.Errorf("%q: expected %+v, but got %+v", e.in, e.expected, actual)
+		}
+	}
+	invalid := []string{
+		"", "p99", "p99 300ms", "p99<300", "p0<1s", "p101<1s", "pxx<1s",
+		"latency<1s", "rps>10%", "errors<few", "avg<", "<1s",
+	}
+	for _, in := range invalid {
+		if _, err := parseThreshold(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestThresholdsCheck(t *testing.T) {
+	latencies := uhist.Default()
+	for ms := uint64(1); ms <= 100; ms++ {
+		latencies.Increment(ms * 1000)
+	}
+	requests := fhist.Default()
+	requests.Increment(1500)
+	requests.Increment(2500)
+	r := &internal.Results{
+		TimeTaken:         time.Second,
+		Req2XX:            990,
+		Req5XX:            10,
+		Errors:            []internal.ErrorWithCount{{Error: "timeout", Count: 5}},
+		AssertedResponses: 100,
+		AssertFailures:    2,
+		Latencies:         latencies,
+		Requests:          requests,
+	}
+	expectations := []struct {
+		threshold, actual string
+		passed            bool
+	}{
+		{"p99<300ms", "99ms", true},
+		{"p50>=60ms", "50ms", false},
+		{"avg<=50.5ms", "50.5ms", true},
+		{"max<100ms", "100ms", false},
+		{"rps>2000", "2000.00", false},
+		{"rps>=2000", "2000.00", true},
+		{"errors<1%", "0.70%", true},
+		{"errors<=5", "7", false},
+		{"assertFailures==0", "2", false},
+		{"assertFailures<5%", "2.00%", true},
+		{"5xx<1%", "1.00%", false},
+		{"2xx>=99%", "99.00%", true},
+	}
+	for _, e := range expectations {
+		th, err := parseThreshold(e.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := th.check(r)
+		if res.Actual != e.actual || res.Passed != e.passed {
+			t.Errorf("%v: expected %v(passed %v), but got %+v",
+				e.threshold, e.actual, e.passed, res)
+		}
+	}
+
+	empty := &internal.Results{
+		Latencies: uhist.Default(),
+		Requests:  fhist.Default(),
+	}
+	th, _ := parseThreshold("p99<1s")
+	if res := th.check(empty); res.Passed || res.Actual != "n/a" {
+		t.Errorf("Expected missing latencies to fail the threshold, but got %+v", res)
+	}
+}
+
+func TestResultsPassed(t *testing.T) {
+	expectations := []struct {
+		results internal.Results
+		passed  bool
+	}{
+		{internal.Results{}, true},
+		{internal.Results{Thresholds: []internal.ThresholdResult{
+			{Passed: true}, {Passed: true},
+		}}, true},
+		{internal.Results{Thresholds: []internal.ThresholdResult{
+			{Passed: true}, {Passed: false},
+		}}, false},
+		{internal.Results{Aborted: "assertion failed"}, false},
+	}
+	for _, e := range expectations {
+		if e.results.Passed() != e.passed {
+			t.Errorf("%+v: expected passed %v", e.results, e.passed)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+var timeseriesFormats = []string{"csv", "jsonl"}
+
+// timeseriesFormatOf returns the format of the file, which is told by
+// its extension unless the format is given.
+func timeseriesFormatOf(path, format string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return "csv", nil
+		}
+		return "jsonl", nil
+	}
+	for _, f := range timeseriesFormats {
+		if f == format {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown timeseries format %q, expected one of %v",
+		format, strings.Join(timeseriesFormats, ", "))
+}
+
+var timeseriesColumns = []string{
+	"time", "offsetSeconds", "durationSeconds", "rps",
+	"latencyMin", "latencyMean", "latencyP50", "latencyP90", "latencyP99",
+	"latencyMax", "req1xx", "req2xx", "req3xx", "req4xx", "req5xx",
+	"others", "errors", "bytesRead", "bytesWritten",
+}
+
+func timeseriesRecord(i internal.Interval) []string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	u := func(v uint64) string {
+		return strconv.FormatUint(v, decBase)
+	}
+	return []string{
+		i.Start.Format(time.RFC3339Nano), f(i.Offset.Seconds()),
+		f(i.Duration.Seconds()), f(i.Rps),
+		f(i.LatencyMin), f(i.LatencyMean), f(i.LatencyP50), f(i.LatencyP90),
+		f(i.LatencyP99), f(i.LatencyMax),
+		u(i.Req1XX), u(i.Req2XX), u(i.Req3XX), u(i.Req4XX), u(i.Req5XX),
+		u(i.Others), u(i.Errors), u(i.BytesRead), u(i.BytesWritten),
+	}
+}
+
+// timeseries keeps the summaries of the intervals of the test and
+// writes them to the file as they come, if there is one.
+type timeseries struct {
+	begin     time.Time
+	intervals []internal.Interval
+
+	file  io.WriteCloser
+	write func(i internal.Interval) error
+	// err is the first error of writing, the rest of the intervals
+	// aren't written after it
+	err error
+}
+
+// newTimeseries returns the time series written to the file in the
+// format, it's only kept in memory if the path is empty.
+func newTimeseries(path, format string) (*timeseries, error) {
+	t := new(timeseries)
+	if path == "" {
+		return t, nil
+	}
+	format, err := timeseriesFormatOf(path, format)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t.file = file
+	switch format {
+	case "csv":
+		w := csv.NewWriter(file)
+		header := true
+		t.write = func(i internal.Interval) error {
+			if header {
+				header = false
+				if err := w.Write(timeseriesColumns); err != nil {
+					return err
+				}
+			}
+			if err := w.Write(timeseriesRecord(i)); err != nil {
+				return err
+			}
+			w.Flush()
+			return w.Error()
+		}
+	default:
+		enc := json.NewEncoder(file)
+		t.write = func(i internal.Interval) error {
+			return enc.Encode(intervalReport(i))
+		}
+	}
+	return t, nil
+}
+
+func (t *timeseries) add(i internal.Interval) {
+	t.intervals = append(t.intervals, i)
+	if t.write != nil && t.err == nil {
+		t.err = t.write(i)
+	}
+}
+
+// close closes the file, it returns the first error of writing to it.
+func (t *timeseries) close() error {
+	if t.file == nil {
+		return nil
+	}
+	if err := t.file.Close(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
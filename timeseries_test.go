@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codesenberg/bombardier/internal"
+)
+
+func TestTimeseriesFormatOf(t *testing.T) {
+	expectations := []struct {
+		path, format, expected string
+	}{
+		{"series.csv", "", "csv"},
+		{"SERIES.CSV", "", "csv"},
+		{"series.jsonl", "", "jsonl"},
+		{"series", "", "jsonl"},
+		{"series.txt", "csv", "csv"},
+		{"series.csv", "jsonl", "jsonl"},
+	}
+	for _, e := range expectations {
+		actual, err := timeseriesFormatOf(e.path, e.format)
+		if err != nil || actual != e.expected {
+			t.Errorf("%+v: got %v, %v", e, actual, err)
+		}
+	}
+	if _, err := timeseriesFormatOf("series.csv", "xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func testIntervals() []internal.Interval {
+	begin := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []internal.Interval{
+		{Start: begin, Duration: time.Second, Rps: 100, LatencyMin: 900,
+			LatencyMean: 1000.5, LatencyP50: 1000, LatencyP90: 1100,
+			LatencyP99: 1500, LatencyMax: 2000, Req2XX: 99, Req5XX: 1,
+			Errors: 1, BytesRead: 1000, BytesWritten: 500},
+		{Start: begin.Add(time.Second), Offset: time.Second,
+			Duration: 500 * time.Millisecond, Rps: 20, Req2XX: 10},
+	}
+}
+
+func TestTimeseriesShouldWriteCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeseries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "series.csv")
+	ts, err := newTimeseries(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range testIntervals() {
+		ts.add(i)
+	}
+	if err := ts.close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[0]) != len(timeseriesColumns) {
+		t.Fatalf("Expected the header and 2 rows, but got %v", records)
+	}
+	expected := []string{
+		"2020-01-02T03:04:05Z", "0", "1", "100", "900", "1000.5", "1000",
+		"1100", "1500", "2000", "0", "99", "0", "0", "1", "0", "1", "1000",
+		"500",
+	}
+	for i, v := range expected {
+		if records[1][i] != v {
+			t.Errorf("%v: expected %v, but got %v", timeseriesColumns[i], v, records[1][i])
+		}
+	}
+	if records[2][1] != "1" || records[2][2] != "0.5" {
+		t.Errorf("Unexpected row %v", records[2])
+	}
+	if len(ts.intervals) != 2 {
+		t.Errorf("Expected the intervals to be kept, but got %v", ts.intervals)
+	}
+}
+
+func TestTimeseriesShouldWriteJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeseries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "series.log")
+	ts, err := newTimeseries(path, "jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervals := testIntervals()
+	for _, i := range intervals {
+		ts.add(i)
+	}
+	if err := ts.close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+		var r IntervalReport
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatalf("%v: %s", err, s.Bytes())
+		}
+		if expected := intervalReport(intervals[lines]); r != expected {
+			t.Errorf("Expected %+v, but got %+v", expected, r)
+		}
+	}
+	if lines != len(intervals) {
+		t.Errorf("Expected %v lines, but got %v", len(intervals), lines)
+	}
+
+	if _, err := newTimeseries(filepath.Join(dir, "absent", "series.csv"), ""); err == nil {
+		t.Error("Expected the file to be impossible to create")
+	}
+	ts, err = newTimeseries("", "")
+	if err != nil || ts.close() != nil {
+		t.Errorf("Expected the series to be kept in memory only, but got %v", err)
+	}
+}
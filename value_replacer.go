@@ -1,54 +1,264 @@
 package main
 
-func containsPlaceholder(source string) bool {
-	arr := []rune(source)
-	previous := ' '
-	matched := false
-
-	for i := 0; i < len(arr); i++ {
-		if arr[i] == '{' && previous == '$' {
-			matched = true
-		} else if arr[i] == '}' && matched {
+import (
+	"fmt"
+	"strings"
+
+	"github.com/valyala/bytebufferpool"
+)
+
+const (
+	placeholderStart = "${"
+	placeholderEnd   = '}'
+	// escapedPlaceholderStart is rendered as a literal "${"
+	escapedPlaceholderStart = "$${"
+	// defaultSeparator separates variable name from its default
+	// value, i.e. ${name:-fallback}
+	defaultSeparator = ":-"
+)
+
+// renderPool holds buffers templates are rendered into.
+var renderPool bytebufferpool.Pool
+
+// segment is either a literal part of the template or a placeholder.
+type segment struct {
+	text string
+	ph   *placeholder
+}
+
+// placeholder is a compiled ${name:-default|filter|filter:arg}
+// expression.
+type placeholder struct {
+	// raw is the expression between the braces
+	raw        string
+	key        string
+	def        string
+	hasDefault bool
+	filters    []filter
+	// variables filters refer to
+	filterVars []string
+	// err is set if the expression is malformed, it's reported
+	// before the test
+	err error
+}
+
+func compilePlaceholder(raw string) *placeholder {
+	parts := strings.Split(raw, "|")
+	p := &placeholder{raw: raw, key: parts[0]}
+	// generator arguments may look like a default
+	if i := strings.Index(p.key, defaultSeparator); i >= 0 && !isGenerator(p.key) {
+		p.key, p.def = p.key[:i], p.key[i+len(defaultSeparator):]
+		p.hasDefault = true
+	}
+	for _, spec := range parts[1:] {
+		f, filterVar, err := compileFilter(strings.TrimSpace(spec))
+		if err != nil {
+			p.err = fmt.Errorf("Invalid placeholder ${%v}: %v", raw, err)
+			return p
+		}
+		p.filters = append(p.filters, f)
+		if filterVar != "" {
+			p.filterVars = append(p.filterVars, filterVar)
+		}
+	}
+	return p
+}
+
+// resolvable tells whether the placeholder is substituted during the
+// test. Variables without defaults are only resolved with a payload.
+func (p *placeholder) resolvable(withPayload bool) bool {
+	return withPayload || p.hasDefault || isGenerator(p.key)
+}
+
+func (p *placeholder) appendTo(dst []byte, v *vars) []byte {
+	value, ok := v.lookup(p.key)
+	if !ok {
+		if !p.hasDefault {
+			// there is nothing to resolve it with
+			dst = append(dst, placeholderStart...)
+			dst = append(dst, p.raw...)
+			return append(dst, placeholderEnd)
+		}
+		value = p.def
+	}
+	for _, f := range p.filters {
+		value = f(value, v)
+	}
+	return append(dst, value...)
+}
+
+// valueTemplate is a string with placeholders compiled once into
+// literal and variable segments, so that rendering it for a request
+// is just a matter of appending them to a buffer.
+type valueTemplate struct {
+	segments []segment
+	// static is the rendered template if it has no placeholders
+	static string
+	vars   bool
+}
+
+func compileTemplate(source string) *valueTemplate {
+	t := new(valueTemplate)
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			t.segments = append(t.segments, segment{text: literal.String()})
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(source); {
+		rest := source[i:]
+		if strings.HasPrefix(rest, escapedPlaceholderStart) {
+			literal.WriteString(placeholderStart)
+			i += len(escapedPlaceholderStart)
+			continue
+		}
+		if strings.HasPrefix(rest, placeholderStart) {
+			end := strings.IndexByte(rest, placeholderEnd)
+			if end >= 0 {
+				flush()
+				t.segments = append(t.segments, segment{
+					ph: compilePlaceholder(rest[len(placeholderStart):end]),
+				})
+				t.vars = true
+				i += end + 1
+				continue
+			}
+		}
+		literal.WriteByte(source[i])
+		i++
+	}
+	flush()
+	if !t.vars {
+		for _, s := range t.segments {
+			t.static += s.text
+		}
+	}
+	return t
+}
+
+// hasVars tells whether the template has any placeholders.
+func (t *valueTemplate) hasVars() bool {
+	return t.vars
+}
+
+// placeholders returns all placeholders of the template.
+func (t *valueTemplate) placeholders() []*placeholder {
+	var res []*placeholder
+	for _, s := range t.segments {
+		if s.ph != nil {
+			res = append(res, s.ph)
+		}
+	}
+	return res
+}
+
+// resolvable tells whether any of the placeholders is substituted
+// during the test.
+func (t *valueTemplate) resolvable(withPayload bool) bool {
+	for _, ph := range t.placeholders() {
+		if ph.resolvable(withPayload) {
 			return true
 		}
-		previous = arr[i]
 	}
 	return false
 }
 
+// appendTo renders the template with v to dst. Placeholders which
+// can't be resolved are kept as is.
+func (t *valueTemplate) appendTo(dst []byte, v *vars) []byte {
+	for _, s := range t.segments {
+		if s.ph == nil {
+			dst = append(dst, s.text...)
+		} else {
+			dst = s.ph.appendTo(dst, v)
+		}
+	}
+	return dst
+}
+
+func (t *valueTemplate) render(v *vars) string {
+	if !t.vars {
+		return t.static
+	}
+	buf := renderPool.Get()
+	buf.B = t.appendTo(buf.B, v)
+	res := string(buf.B)
+	renderPool.Put(buf)
+	return res
+}
+
+func containsPlaceholder(source string) bool {
+	return compileTemplate(source).hasVars()
+}
+
+type unknownVariableError struct {
+	name, placeholder string
+}
+
+func (u *unknownVariableError) Error() string {
+	return fmt.Sprintf(
+		"Unknown variable %q in ${%v}, it's neither provided by the "+
+			"payload nor has a default", u.name, u.placeholder,
+	)
+}
+
+// vars are the values placeholders of a single request are resolved
+// with: variables from the payload and generator expressions.
+type vars struct {
+	payload row
+	gens    *generators
+	// index of the worker sending the request
+	worker uint64
+}
+
+func newVars(payload row, gens *generators, worker uint64) *vars {
+	if payload.empty() && gens == nil {
+		return nil
+	}
+	return &vars{payload: payload, gens: gens, worker: worker}
+}
+
 func replace(source string, ctx map[string]string) string {
 	if ctx == nil || len(ctx) == 0 {
 		return source
 	}
-	result := ""
-	arr := []rune(source)
-	key := ""
-	previous := ' '
-	matched := false
-
-	for i := 0; i < len(arr); i++ {
-		if arr[i] == '{' && previous == '$' {
-			matched = true
-			previous = arr[i]
-			result = result[0 : len(result)-1]
-		} else if arr[i] == '}' && matched {
-			result += getValue(key, ctx)
-			key = ""
-			matched = false
-		} else if matched {
-			key += string(arr[i])
-		} else {
-			previous = arr[i]
-			result += string(arr[i])
+	return compileTemplate(source).render(&vars{payload: rowOf(ctx)})
+}
+
+// lookup returns the value of variable or generator expression key.
+func (v *vars) lookup(key string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	if isGenerator(key) {
+		if v.gens == nil {
+			return "", false
 		}
+		return v.gens.generate(key, v.worker), true
 	}
-	return result
+	return v.payload.lookup(key)
+}
+
+// headerTemplate is a header with its value compiled.
+type headerTemplate struct {
+	// key is the name the header is sent with
+	key     string
+	special bool
+	value   *valueTemplate
 }
 
-func getValue(key string, context map[string]string) string {
-	value, ok := context[key]
-	if ok {
-		return value
+func compileHeaders(h *headersList) []headerTemplate {
+	if h == nil {
+		return nil
+	}
+	res := make([]headerTemplate, 0, len(*h))
+	for _, header := range *h {
+		res = append(res, headerTemplate{
+			key:     header.canonicalKey(),
+			special: isSpecialHeader(header.key),
+			value:   compileTemplate(header.value),
+		})
 	}
-	return key
+	return res
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -20,3 +22,151 @@ func TestReplace(t *testing.T) {
 		t.Errorf("Expected \"%v\", but got \"%v\"", expected, actual)
 	}
 }
+
+func TestReplaceShouldEvaluateGenerators(t *testing.T) {
+	v := newVars(rowOf(map[string]string{"name": "bombardier"}), newGenerators(1), 0)
+	actual := compileTemplate("${name}-${__seq}-${__seq}-${missing}").render(v)
+	expected := "bombardier-1-2-${missing}"
+	if actual != expected {
+		t.Errorf("Expected \"%v\", but got \"%v\"", expected, actual)
+	}
+}
+
+func TestCompilePlaceholders(t *testing.T) {
+	expectations := []struct {
+		raw        string
+		key, def   string
+		hasDefault bool
+		filters    int
+		filterVars []string
+		valid      bool
+	}{
+		{"name", "name", "", false, 0, nil, true},
+		{"name:-John Doe", "name", "John Doe", true, 0, nil, true},
+		{"name:-", "name", "", true, 0, nil, true},
+		{"name|urlencode|upper", "name", "", false, 2, nil, true},
+		{"id:-0|sha256|hmacSHA256:secret", "id", "0", true, 2, []string{"secret"}, true},
+		{"__date(15:04:05,-1h)|base64", "__date(15:04:05,-1h)", "", false, 1, nil, true},
+		{"name|unknown", "name", "", false, 0, nil, false},
+		{"name|upper:1", "name", "", false, 0, nil, false},
+		{"name|hmacSHA256", "name", "", false, 0, nil, false},
+	}
+	for _, e := range expectations {
+		ph := compilePlaceholder(e.raw)
+		if ph.key != e.key || ph.def != e.def || ph.hasDefault != e.hasDefault ||
+			len(ph.filters) != e.filters ||
+			!reflect.DeepEqual(ph.filterVars, e.filterVars) ||
+			(ph.err == nil) != e.valid {
+			t.Errorf("%q: unexpected result %+v", e.raw, ph)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	v := newVars(rowOf(map[string]string{
+		"q": `a b&"c"`, "secret": "key", "empty": "",
+	}), nil, 0)
+	expectations := map[string]string{
+		"${q|urlencode}":                  "a+b%26%22c%22",
+		"${q|json}":                       `a b\u0026\"c\"`,
+		"${q|base64}":                     "YSBiJiJjIg==",
+		"${q|upper}":                      `A B&"C"`,
+		"${empty|sha256}":                 "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"${empty|hmacSHA256:secret}":      "5d5d139563c95b5967b9bd9a8c9b233a9dedb45072794cd232dc1b74832607d0",
+		"${missing:-x y|urlencode|upper}": "X+Y",
+		"${q:-unused}":                    `a b&"c"`,
+	}
+	for source, expected := range expectations {
+		if actual := compileTemplate(source).render(v); actual != expected {
+			t.Errorf("%v: expected %q, but got %q", source, expected, actual)
+		}
+	}
+}
+
+func TestCompileTemplate(t *testing.T) {
+	v := newVars(rowOf(map[string]string{"name": "bombardier", "id": "42"}), nil, 0)
+	expectations := []struct {
+		source, expected string
+		hasVars          bool
+	}{
+		{"", "", false},
+		{"plain text", "plain text", false},
+		{"${name}", "bombardier", true},
+		{"/users/${id}/${name}?x=${id}", "/users/42/bombardier?x=42", true},
+		{"Привет, ${name}!", "Привет, bombardier!", true},
+		{"escaped $${name}", "escaped ${name}", false},
+		{"$${name} and ${name}", "${name} and bombardier", true},
+		{"price: $5, ${unclosed", "price: $5, ${unclosed", false},
+	}
+	for _, e := range expectations {
+		tmpl := compileTemplate(e.source)
+		if tmpl.hasVars() != e.hasVars {
+			t.Errorf("%q: expected hasVars = %v", e.source, e.hasVars)
+		}
+		if actual := tmpl.render(v); actual != e.expected {
+			t.Errorf("Expected \"%v\", but got \"%v\"", e.expected, actual)
+		}
+		if actual := string(tmpl.appendTo([]byte(">"), v)); actual != ">"+e.expected {
+			t.Errorf("Expected \">%v\", but got \"%v\"", e.expected, actual)
+		}
+	}
+	if actual := compileTemplate("${name}").render(nil); actual != "${name}" {
+		t.Errorf("Placeholders must be kept without vars, but got %q", actual)
+	}
+}
+
+// runeReplace is how placeholders were resolved before templates were
+// compiled, it's kept to compare the performance.
+func runeReplace(source string, ctx map[string]string) string {
+	result := ""
+	arr := []rune(source)
+	key := ""
+	previous := ' '
+	matched := false
+	for i := 0; i < len(arr); i++ {
+		if arr[i] == '{' && previous == '$' {
+			matched = true
+			previous = arr[i]
+			result = result[0 : len(result)-1]
+		} else if arr[i] == '}' && matched {
+			if value, ok := ctx[key]; ok {
+				result += value
+			} else {
+				result += key
+			}
+			key = ""
+			matched = false
+		} else if matched {
+			key += string(arr[i])
+		} else {
+			previous = arr[i]
+			result += string(arr[i])
+		}
+	}
+	return result
+}
+
+var (
+	benchmarkBody = strings.Repeat(
+		`{"user":"${name}","id":${id},"tags":["a","b","c"]},`, 100)
+	benchmarkVars = map[string]string{"name": "bombardier", "id": "42"}
+)
+
+func BenchmarkRuneReplace(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = runeReplace(benchmarkBody, benchmarkVars)
+	}
+}
+
+func BenchmarkTemplateRender(b *testing.B) {
+	tmpl := compileTemplate(benchmarkBody)
+	v := newVars(rowOf(benchmarkVars), nil, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := renderPool.Get()
+		buf.B = tmpl.appendTo(buf.B, v)
+		renderPool.Put(buf)
+	}
+}